@@ -1,7 +1,10 @@
 package adapter
 
 import (
+	"github.com/upwrd/sift/lib"
+	"github.com/upwrd/sift/network/ble"
 	"github.com/upwrd/sift/network/ipv4"
+	"github.com/upwrd/sift/network/ssdp"
 	"github.com/upwrd/sift/types"
 )
 
@@ -34,3 +37,51 @@ type IPv4Factory interface {
 	HandleIPv4(*ipv4.ServiceContext) Adapter
 	GetIPv4Description() ipv4.ServiceDescription
 }
+
+// An SSDPFactory creates Adapters which control UPnP devices and services
+// found with SSDP. Its Adapters receive the URL of the UPnP device
+// description in their context.
+type SSDPFactory interface {
+	Factory
+	HandleSSDP(*ssdp.ServiceContext) Adapter
+	GetSSDPDescription() ssdp.ServiceDescription
+}
+
+// A NetworkFactory creates Adapters which control devices over a network other
+// than IP. Updates from its Adapters are ranked against updates about the same
+// Device from other Adapters by ControllerType (see lib.Prioritizer), so that,
+// for example, a lock reached directly over Bluetooth is preferred to the same
+// lock reached through a cloud service.
+//
+// NetworkFactory does not describe how the network's services are found; the
+// Server must support each network itself, and its factories implement an
+// interface for it. Bluetooth LE (see BLEFactory) is the only such network so
+// far, so factories for other networks, such as Zigbee or Z-Wave, cannot yet
+// be added.
+type NetworkFactory interface {
+	Factory
+	ControllerType() lib.ControllerType // e.g. lib.ControllerTypeBluetooth
+}
+
+// A BLEFactory creates Adapters which control Bluetooth LE peripherals, found
+// by their advertisements. Its Adapters connect to their peripherals through
+// their context.
+type BLEFactory interface {
+	NetworkFactory
+	HandleBLE(*ble.ServiceContext) Adapter
+	GetBLEDescription() ble.ServiceDescription
+}
+
+// A ConfigurableFactory is a Factory which accepts configuration from the
+// operator, such as the port of a service or the credentials used to log in to
+// a hub. The Server stores values for each declared field and passes them to
+// the Factory's Adapters through their contexts (see
+// sift.Server.SetAdapterConfig).
+type ConfigurableFactory interface {
+	Factory
+	ConfigFields() []types.ConfigField
+
+	// Configure is called when the Factory is added to the Server, and again
+	// whenever its configuration changes.
+	Configure(types.AdapterConfig) error
+}
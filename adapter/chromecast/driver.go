@@ -7,6 +7,7 @@ import (
 	"github.com/upwrd/sift/adapter"
 	"github.com/upwrd/sift/lib"
 	"github.com/upwrd/sift/logging"
+	"github.com/upwrd/sift/network"
 	"github.com/upwrd/sift/network/ipv4"
 	"github.com/upwrd/sift/types"
 	log "gopkg.in/inconshreveable/log15.v2"
@@ -28,6 +29,9 @@ const (
 
 var openPorts = []uint16{8008, 8009}
 
+// Chromecasts advertise themselves with DNS-SD
+var serviceTypes = []string{"_googlecast._tcp"}
+
 // An AdapterFactory creates adapters
 type AdapterFactory struct{}
 
@@ -47,7 +51,7 @@ func (f *AdapterFactory) HandleIPv4(context *ipv4.ServiceContext) adapter.Adapte
 // GetIPv4Description returns a description of the example IPv4 service that
 // can be used to identify example services on a network
 func (f *AdapterFactory) GetIPv4Description() ipv4.ServiceDescription {
-	return ipv4.ServiceDescription{OpenPorts: openPorts}
+	return ipv4.ServiceDescription{OpenPorts: openPorts, ServiceTypes: serviceTypes}
 }
 
 // Name returns the name of this adapter factory, "Google Chromecast"
@@ -96,7 +100,7 @@ type pyError struct {
 
 type pyUpdate struct {
 	pyMsg
-	Update types.MediaPlayer
+	Update json.RawMessage // a typed Component; see types.UnmarshalComponent
 }
 
 // Serve begins adapting the example service specified by the adapter's
@@ -119,7 +123,7 @@ func (a *ipv4Adapter) Serve() {
 				return
 			case <-heartbeat.C:
 				// Try to send a heartbeat status
-				if err := a.context.SendStatus(ipv4.AdapterStatusHandling); err != nil {
+				if err := a.context.SendStatus(network.AdapterStatusHandling); err != nil {
 					return // Context must have been killed, stop heartbeating
 				}
 				heartbeat.Reset(timeBetweenHeartbeats)
@@ -164,12 +168,18 @@ func (a *ipv4Adapter) Serve() {
 				return
 			}
 
-			a.log.Debug("update from python script", "update", asPyUpdate.Update, "msg", msg)
+			update, err := types.UnmarshalComponent(asPyUpdate.Update)
+			if err != nil {
+				a.log.Error("could not unmarshal component from python script", "msg", msg, "err", err)
+				return
+			}
+
+			a.log.Debug("update from python script", "update", update, "msg", msg)
 			newDevice := types.Device{
 				Name:     fmt.Sprintf("Chromecast @ %s", a.context.IP.String()),
 				IsOnline: true,
 				Components: map[string]types.Component{
-					"chromecast": asPyUpdate.Update,
+					"chromecast": update,
 				},
 			}
 			newDeviceExternal := types.ExternalDeviceID{
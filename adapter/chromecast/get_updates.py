@@ -31,7 +31,7 @@ class Error():
         return self.__dict__
 
 # A Update is sent each time the Chromecast's state changes
-# It should match a MediaPlayer struct defined in sift/types
+# It should match a typed MediaPlayer struct defined in sift/types
 class Update():
     def __init__(self, update):
         self.type = TYPE_UPDATE
@@ -41,6 +41,7 @@ class Update():
 
 class MediaPlayerComponent():
     def __init__(self, ip, play_state, source):
+        self.type="media_player" # sift/types.ComponentTypeMediaPlayer
         self.external_id=ip # Use the IP address as the external id
         self.make="Google"
         self.model="Chromecast"
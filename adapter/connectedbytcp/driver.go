@@ -8,6 +8,7 @@ import (
 	"github.com/upwrd/sift/adapter"
 	"github.com/upwrd/sift/lib"
 	"github.com/upwrd/sift/logging"
+	"github.com/upwrd/sift/network"
 	"github.com/upwrd/sift/network/ipv4"
 	"github.com/upwrd/sift/types"
 	log "gopkg.in/inconshreveable/log15.v2"
@@ -16,7 +17,6 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
-	"strings"
 	"time"
 )
 
@@ -28,6 +28,8 @@ var Log = logging.Log.New("pkg", "drivers/connectedbytcp")
 
 const (
 	openPorts             = 443
+	gatewayProbePath      = "/gwr/gop.php"
+	gatewayProbeContent   = "Missing input" // returned by the gateway API when no command is given
 	timeBetweenHeartbeats = 5 * time.Second
 	timeBetweenPolls      = 10 * time.Second
 
@@ -37,6 +39,16 @@ const (
 	tcpGatewayCredentialsTokenKey = "cbtcpGateway"
 )
 
+// Names of the config fields accepted by the factory
+const (
+	// ConfigEmail and ConfigPassword are the account used to log in to
+	// gateways. If no account is configured, a generated UUID is used as both.
+	ConfigEmail    = "email"
+	ConfigPassword = "password"
+	// ConfigPollInterval is how often gateways are polled for device states
+	ConfigPollInterval = "poll_interval"
+)
+
 // An AdapterFactory creates adapters
 type AdapterFactory struct{}
 
@@ -54,12 +66,59 @@ func (f *AdapterFactory) HandleIPv4(context *ipv4.ServiceContext) adapter.Adapte
 // GetIPv4Description returns a description of the example IPv4 service that
 // can be used to identify example services on a network
 func (f *AdapterFactory) GetIPv4Description() ipv4.ServiceDescription {
-	return ipv4.ServiceDescription{OpenPorts: []uint16{openPorts}}
+	return ipv4.ServiceDescription{
+		OpenPorts: []uint16{openPorts},
+		Probes: []ipv4.Probe{ipv4.HTTPProbe{
+			Port:         openPorts,
+			Path:         gatewayProbePath,
+			TLS:          true,
+			BodyContains: gatewayProbeContent,
+		}},
+	}
 }
 
 // Name returns the name of this adapter factory, "Connected By TCP"
 func (f *AdapterFactory) Name() string { return "Connected by TCP" }
 
+// ConfigFields returns the settings accepted by the factory
+func (f *AdapterFactory) ConfigFields() []types.ConfigField {
+	return []types.ConfigField{
+		{
+			Name:        ConfigEmail,
+			Type:        types.ConfigTypeString,
+			Description: "the account email used to log in to gateways",
+		},
+		{
+			Name:        ConfigPassword,
+			Type:        types.ConfigTypeString,
+			Description: "the account password used to log in to gateways",
+			Secret:      true,
+		},
+		{
+			Name:        ConfigPollInterval,
+			Type:        types.ConfigTypeDuration,
+			Default:     timeBetweenPolls.String(),
+			Description: "how often gateways are polled for device states",
+		},
+	}
+}
+
+// Configure checks the factory's configuration. Adapters read their
+// configuration from their contexts, so nothing is kept by the factory.
+func (f *AdapterFactory) Configure(config types.AdapterConfig) error {
+	interval, err := config.Duration(ConfigPollInterval)
+	if err != nil {
+		return err
+	}
+	if interval <= 0 {
+		return fmt.Errorf("poll interval must be positive, got %v", interval)
+	}
+	if config.IsSet(ConfigPassword) && !config.IsSet(ConfigEmail) {
+		return fmt.Errorf("a password was set without an email")
+	}
+	return nil
+}
+
 type ipv4Adapter struct {
 	updateChan chan interface{}
 	context    *ipv4.ServiceContext
@@ -89,16 +148,16 @@ func newIPv4Adapter(context *ipv4.ServiceContext) *ipv4Adapter {
 // update channel provided by UpdateChan(). While the adapter is serving,
 // heartbeat messages will be sent to the adapter's context's status channel.
 func (a *ipv4Adapter) Serve() {
-	// Check if the ipv4 context that we were given represents a Connected By TCP service
-	if !a.isConnectedByTCPService() {
-		a.log.Info("service is not a Connected By TCP service", "ip", a.context.IP.String())
-		a.context.SendStatus(ipv4.AdapterStatusIncorrectService)
+	// The scanner has checked that the context represents a Connected By TCP
+	// gateway (see GetIPv4Description), but it must still be logged in to
+	if !a.logIn() {
+		a.context.SendStatus(network.AdapterStatusError)
 		return
 	}
 
 	if a.differ == nil {
 		a.log.Warn("Connected By TCP IPv4 Adapter was improperly instantiated!")
-		a.context.SendStatus(ipv4.AdapterStatusError)
+		a.context.SendStatus(network.AdapterStatusError)
 		return
 	}
 
@@ -115,7 +174,7 @@ func (a *ipv4Adapter) Serve() {
 				return
 			case <-heartbeat.C:
 				// Try to send a heartbeat status
-				if err := a.context.SendStatus(ipv4.AdapterStatusHandling); err != nil {
+				if err := a.context.SendStatus(network.AdapterStatusHandling); err != nil {
 					return // Context must have been killed, stop heartbeating
 				}
 				heartbeat.Reset(timeBetweenHeartbeats)
@@ -124,9 +183,13 @@ func (a *ipv4Adapter) Serve() {
 	}()
 
 	// Periodically gather states from the server
-	timer := time.NewTimer(timeBetweenPolls)
+	pollInterval, err := a.context.Config.Duration(ConfigPollInterval)
+	if err != nil || pollInterval <= 0 {
+		pollInterval = timeBetweenPolls
+	}
+	timer := time.NewTimer(pollInterval)
 	for {
-		timer.Reset(timeBetweenPolls)
+		timer.Reset(pollInterval)
 		select {
 		case <-timer.C: // if the timer signal is recieved, continue
 		case <-a.stop:
@@ -136,7 +199,7 @@ func (a *ipv4Adapter) Serve() {
 		devices, err := getDevicesFromServer(a.context)
 		if err != nil {
 			a.log.Warn("error getting devices from server", "err", err)
-			a.context.SendStatus(ipv4.AdapterStatusError)
+			a.context.SendStatus(network.AdapterStatusError)
 			return
 		}
 
@@ -153,35 +216,13 @@ func (a *ipv4Adapter) Stop() { a.stop <- struct{}{} }
 // adapter
 func (a *ipv4Adapter) UpdateChan() chan interface{} { return a.updateChan }
 
-func (a *ipv4Adapter) isConnectedByTCPService() bool {
-	// log in
+func (a *ipv4Adapter) logIn() bool {
 	_, err := loginWRetry(a.context, numLoginRetries) // ignore output, only care if its successful
 	if err != nil {
-		a.log.Warn("endpoint is NOT a Connected By TCP service, because login was unsuccessful", "err", err, "service_ip", a.context.IP)
-		return false
-	}
-
-	client := getCertificateIgnoringClient()
-	endpointURL := "https://" + a.context.IP.String() + "/gwr/gop.php"
-	resp, err := client.Get(endpointURL)
-	if err != nil {
-		a.log.Warn("endpoint is NOT a Connected By TCP service, because of error during http.Get", "err", err, "url_attempted", endpointURL)
-		return false
-	}
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		a.log.Warn("service is NOT a Connected By TCP service, because the content of the endpoint path was not readable", "err", err, "url_attempted", endpointURL)
+		a.log.Warn("could not log in to Connected By TCP gateway", "err", err, "service_ip", a.context.IP)
 		return false
 	}
-
-	expectedContent := "Missing input"
-	bodyStr := string(body)
-	if !strings.Contains(bodyStr, expectedContent) {
-		a.log.Warn("service is NOT a Connected By TCP service, because the expected content did not match", "expected", expectedContent, "got", bodyStr, "url_attempted", endpointURL)
-		return false
-	}
-
-	a.log.Debug("found a ConnectedByTCP Gateway", "url", endpointURL)
+	a.log.Debug("logged in to Connected By TCP gateway", "service_ip", a.context.IP)
 	return true
 }
 
@@ -246,6 +287,15 @@ func loginWRetry(context *ipv4.ServiceContext, numRetries int) (string, error) {
 // stores them in the context
 func loginContext(context *ipv4.ServiceContext) (string, error) {
 	uuid, token := getUUIDFromContext(context), getLoginTokenFromContext(context)
+
+	// If the operator configured an account, log in with it; the cached
+	// credentials are only valid if they were issued to that account
+	email, _ := context.Config.String(ConfigEmail)
+	password, _ := context.Config.String(ConfigPassword)
+	if email != "" && uuid != email {
+		uuid, token = email, ""
+	}
+
 	if uuid != "" && token != "" {
 		Log.Debug("using cached credentials", "uuid", uuid, "token", token)
 		return token, nil // already logged in
@@ -255,25 +305,28 @@ func loginContext(context *ipv4.ServiceContext) (string, error) {
 	if uuid == "" {
 		uuid = uuidlib.New()
 	}
+	if email == "" {
+		password = uuid
+	}
 
 	// format the login request
 	values := make(url.Values)
 	values.Set("cmd", "GWRLogin")
 	values.Set("fmt", "xml")
-	command := "<gip><version>1</version><email>" + uuid + "</email><password>" + uuid + "</password></gip>"
+	command := "<gip><version>1</version><email>" + uuid + "</email><password>" + password + "</password></gip>"
 	values.Set("data", command)
 
 	// post request, get response
 	client := getCertificateIgnoringClient() // TODO: replace with context client
-	url := "https://" + context.IP.String() + "/gwr/gop.php"
+	url := "https://" + context.URLHost(0) + "/gwr/gop.php"
 	resp, err := client.PostForm(url, values)
 	if err != nil {
-		Log.Debug("failed to post login form", "err", err, "url", url, "uuid", uuid, "form_values_submitted", values.Encode())
+		Log.Debug("failed to post login form", "err", err, "url", url, "uuid", uuid)
 		return "", err
 	}
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		Log.Debug("could not read response body", "err", err, "body", resp.Body, "url", url, "uuid", uuid, "form_values_submitted", values.Encode())
+		Log.Debug("could not read response body", "err", err, "body", resp.Body, "url", url, "uuid", uuid)
 		return "", err
 	}
 
@@ -286,7 +339,7 @@ func loginContext(context *ipv4.ServiceContext) (string, error) {
 	// TODO: Does a response of <gip><version>1</version><rc>404</rc></gip>
 	// indicate that the user needs to press the login button?
 	if xmlLogin.RC.Value != "200" || xmlLogin.Token.Value == "" {
-		Log.Debug("could not parse login values from response", "err", err, "body", string(body), "url", url, "uuid", uuid, "form_values_submitted", values.Encode())
+		Log.Debug("could not parse login values from response", "err", err, "body", string(body), "url", url, "uuid", uuid)
 		authErr := authFailedError{
 			When:      time.Now(),
 			What:      "tried to login to ConnectedByTCP API at " + context.IP.String() + ", but received unexpected response: " + string(body),
@@ -330,7 +383,7 @@ func getXMLFromGateway(context *ipv4.ServiceContext) (string, error) {
 	// which is not recognized by the default HTTP client.  This adapter
 	// currently ignores the certificate check (!!!)
 	client := getCertificateIgnoringClient()
-	response, err := client.PostForm("https://"+context.IP.String()+"/gwr/gop.php", values)
+	response, err := client.PostForm("https://"+context.URLHost(0)+"/gwr/gop.php", values)
 	if err != nil {
 		return "", err
 	}
@@ -369,7 +422,7 @@ func setLight(context *ipv4.ServiceContext, target types.ExternalComponentID, in
 	}
 
 	// Get the destination path
-	apiAddr := "https://" + context.IP.String() + "/gwr/gop.php"
+	apiAddr := "https://" + context.URLHost(0) + "/gwr/gop.php"
 
 	// Convert some values into the appropriate string format
 	var isOn string // "0" == off, "1" == on
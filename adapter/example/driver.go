@@ -6,15 +6,17 @@ import (
 	"github.com/upwrd/sift/adapter"
 	"github.com/upwrd/sift/lib"
 	"github.com/upwrd/sift/logging"
+	"github.com/upwrd/sift/network"
 	"github.com/upwrd/sift/network/ipv4"
 	"github.com/upwrd/sift/types"
 	log "gopkg.in/inconshreveable/log15.v2"
 	logext "gopkg.in/inconshreveable/log15.v2/ext"
 	"io/ioutil"
-	"net"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -40,17 +42,27 @@ const (
 
 const (
 	manufacturer = "example"
+
+	// ConfigPort is the name of the config field holding the port that
+	// example servers listen on. Static services registered with a port are
+	// handled with that port set here.
+	ConfigPort = types.ConfigFieldPort
 )
 
 // An AdapterFactory creates adapters
 type AdapterFactory struct {
-	port uint16
+	defaultPort uint16
+	port        uint16
+	plock       sync.RWMutex // protects port
 }
 
-// NewFactory properly instantiates a new AdapterFactory
+// NewFactory properly instantiates a new AdapterFactory. Example servers are
+// expected to listen on port, unless the operator configures another (see
+// ConfigPort).
 func NewFactory(port uint16) *AdapterFactory {
 	return &AdapterFactory{
-		port: port,
+		defaultPort: port,
+		port:        port,
 	}
 }
 
@@ -59,13 +71,60 @@ func (f *AdapterFactory) HandleIPv4(context *ipv4.ServiceContext) adapter.Adapte
 	if context == nil {
 		return nil
 	}
-	return newAdapter(f.port, context)
+	port := f.getPort()
+	if context.Config.IsSet(ConfigPort) {
+		if p, err := context.Config.Int(ConfigPort); err == nil {
+			port = uint16(p)
+		}
+	}
+	return newAdapter(port, context)
 }
 
 // GetIPv4Description returns a description of the example IPv4 service that
 // can be used to identify example services on a network
 func (f *AdapterFactory) GetIPv4Description() ipv4.ServiceDescription {
-	return ipv4.ServiceDescription{OpenPorts: []uint16{f.port}}
+	port := f.getPort()
+	return ipv4.ServiceDescription{
+		OpenPorts: []uint16{port},
+		Probes: []ipv4.Probe{ipv4.HTTPProbe{
+			Port:        port,
+			Path:        "/status",
+			BodyMatches: `"type"\s*:\s*"` + serverTypeAllAtOnce + `"`,
+		}},
+	}
+}
+
+// ConfigFields returns the settings accepted by the factory
+func (f *AdapterFactory) ConfigFields() []types.ConfigField {
+	return []types.ConfigField{
+		{
+			Name:        ConfigPort,
+			Type:        types.ConfigTypeInt,
+			Default:     strconv.Itoa(int(f.defaultPort)),
+			Description: "the TCP port that example servers listen on",
+		},
+	}
+}
+
+// Configure sets the port that the factory looks for example servers on
+func (f *AdapterFactory) Configure(config types.AdapterConfig) error {
+	port, err := config.Int(ConfigPort)
+	if err != nil {
+		return err
+	}
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("port must be between 1 and 65535, got %v", port)
+	}
+	f.plock.Lock()
+	defer f.plock.Unlock()
+	f.port = uint16(port)
+	return nil
+}
+
+func (f *AdapterFactory) getPort() uint16 {
+	f.plock.RLock()
+	defer f.plock.RUnlock()
+	return f.port
 }
 
 // Name returns the name of this adapter factory, "SIFT example"
@@ -112,16 +171,9 @@ func (a *ipv4Adapter) UpdateChan() chan interface{} {
 // update channel provided by UpdateChan(). While the adapter is serving,
 // heartbeat messages will be sent to the adapter's context's status channel.
 func (a *ipv4Adapter) Serve() {
-	// Check if the ipv4 context that we were given represents an example service
-	if !a.isExampleService() {
-		a.log.Info("%s was not an example service\n", a.context.IP.String())
-		a.context.SendStatus(ipv4.AdapterStatusIncorrectService)
-		return
-	}
-
 	if a.differ == nil {
 		a.log.Warn("example ipv4 Adapter was improperly instantiated!")
-		a.context.SendStatus(ipv4.AdapterStatusError)
+		a.context.SendStatus(network.AdapterStatusError)
 		return
 	}
 
@@ -138,7 +190,7 @@ func (a *ipv4Adapter) Serve() {
 				return
 			case <-heartbeat.C:
 				// Try to send a heartbeat status
-				if err := a.context.SendStatus(ipv4.AdapterStatusHandling); err != nil {
+				if err := a.context.SendStatus(network.AdapterStatusHandling); err != nil {
 					return // Context must have been killed, stop heartbeating
 				}
 				heartbeat.Reset(timeBetweenHeartbeats)
@@ -160,7 +212,7 @@ func (a *ipv4Adapter) Serve() {
 		devices, err := a.getDevicesFromServer(a.context)
 		if err != nil {
 			a.log.Warn("error getting devices from server", "err", err)
-			a.context.SendStatus(ipv4.AdapterStatusError)
+			a.context.SendStatus(network.AdapterStatusError)
 			return
 		}
 
@@ -185,6 +237,10 @@ func (a *ipv4Adapter) EnactIntent(target types.ExternalComponentID, intent types
 		return fmt.Errorf("unhandled intent type: %T", intent)
 	case types.SetLightEmitterIntent:
 		return a.enactSetLightEmitterIntent(target, typed)
+	case types.SetSwitchIntent:
+		return a.enactSetSwitchIntent(target, typed)
+	case types.SetThermostatIntent:
+		return a.enactSetThermostatIntent(target, typed)
 	}
 }
 
@@ -219,6 +275,48 @@ func (a *ipv4Adapter) enactSetLightEmitterIntent(target types.ExternalComponentI
 	return a.setComponent(a.context, target.Device.ID, target.Name, light) // Send the component to the server
 }
 
+func (a *ipv4Adapter) enactSetSwitchIntent(target types.ExternalComponentID, intent types.SetSwitchIntent) error {
+	device, err := a.differ.GetLatest(target.Device)
+	if err != nil {
+		return err
+	}
+	component, ok := device.Components[target.Name]
+	if !ok {
+		return fmt.Errorf("device %v does not have a component named %v", target.Device.ID, target.Name)
+	}
+	if _, ok := component.(types.Switch); !ok {
+		return fmt.Errorf("cannot enact SetSwitchIntent on a component which is not a types.Switch (got %T)", component)
+	}
+
+	// Build a component using the server-side outlet type. Only whether it is on
+	// is set; the server measures the power draw itself (see Server.setComponent).
+	outlet := Outlet{IsOn: intent.IsOn}
+	return a.setComponent(a.context, target.Device.ID, target.Name, outlet) // Send the component to the server
+}
+
+func (a *ipv4Adapter) enactSetThermostatIntent(target types.ExternalComponentID, intent types.SetThermostatIntent) error {
+	device, err := a.differ.GetLatest(target.Device)
+	if err != nil {
+		return err
+	}
+	component, ok := device.Components[target.Name]
+	if !ok {
+		return fmt.Errorf("device %v does not have a component named %v", target.Device.ID, target.Name)
+	}
+	if _, ok := component.(types.Thermostat); !ok {
+		return fmt.Errorf("cannot enact SetThermostatIntent on a component which is not a types.Thermostat (got %T)", component)
+	}
+
+	// Build a component using the server-side thermostat type. The current
+	// temperature is measured by the server, so it is not set.
+	thermostat := Thermostat{
+		Mode:    strings.ToLower(intent.Mode),
+		HeatToF: celsiusToFahrenheit(intent.HeatSetpointInCelsius),
+		CoolToF: celsiusToFahrenheit(intent.CoolSetpointInCelsius),
+	}
+	return a.setComponent(a.context, target.Device.ID, target.Name, thermostat) // Send the component to the server
+}
+
 //
 // IPv4 Helper functions (retrieving data from server)
 //
@@ -229,12 +327,7 @@ func (a *ipv4Adapter) getDataFromServer(context *ipv4.ServiceContext) (data []by
 		}
 	}()
 
-	var url string
-	if context.Port != nil {
-		url = getDevicesURL(context.IP, *context.Port)
-	} else {
-		url = getDevicesURL(context.IP, a.port)
-	}
+	url := getDevicesURL(context, a.port)
 
 	var res *http.Response
 	done := make(chan struct{})
@@ -260,65 +353,8 @@ func (a *ipv4Adapter) getDataFromServer(context *ipv4.ServiceContext) (data []by
 	return body, nil
 }
 
-func getStatusURL(ip net.IP, port uint16) string {
-	return "http://" + ip.String() + ":" + strconv.Itoa(int(port)) + "/status"
-	/*
-		if context.Port == "" {
-			return "http://" + context.IP.String() + ":" + strconv.Itoa(int(DefaultPort)) + "/status"
-		}
-		return "http://" + context.IP.String() + ":" + context.Port + "/status"
-	*/
-}
-
-func getDevicesURL(ip net.IP, port uint16) string {
-	return "http://" + ip.String() + ":" + strconv.Itoa(int(port)) + "/devices"
-	/*
-		if context.Port == "" {
-			return "http://" + context.IP.String() + ":" + strconv.Itoa(int(DefaultPort)) + "/devices"
-		}
-		return "http://" + context.IP.String() + ":" + context.Port + "/devices"
-	*/
-}
-
-func (a *ipv4Adapter) isExampleService() bool {
-	defer func() {
-		if r := recover(); r != nil {
-			Log.Warn("paniced during call to isExampleServer(%v): %v\n", a.context.IP.String(), r)
-		}
-	}()
-
-	var url string
-	if a.context.Port != nil {
-		url = getStatusURL(a.context.IP, *a.context.Port)
-	} else {
-		url = getStatusURL(a.context.IP, a.port)
-	}
-
-	res, err := http.Get(url)
-	if err != nil {
-		a.log.Warn("service is NOT an example service, because of error during http.Get", "err", err, "url_attempted", url)
-		return false
-	}
-	statusJSON, err := ioutil.ReadAll(res.Body)
-	res.Body.Close()
-	if err != nil {
-		a.log.Warn("service is NOT an example service, because the content of the status path was not readable", "err", err, "url_attempted", url)
-		return false
-	}
-
-	var status serverStatus
-	err = json.Unmarshal(statusJSON, &status)
-	if err != nil {
-		a.log.Warn("service is NOT an example service, because the content of the status path was not marshalable to a status struct", "err", err, "url_attempted", url, "content_read", statusJSON)
-		return false
-	}
-
-	if status.Type != serverTypeAllAtOnce {
-		a.log.Warn("service is NOT an example service, because the status type was incorrect", "expected", serverTypeAllAtOnce, "got", status.Type, "url_attempted", url, "content_read", statusJSON)
-		return false
-	}
-
-	return true
+func getDevicesURL(context *ipv4.ServiceContext, port uint16) string {
+	return "http://" + context.URLHost(port) + "/devices"
 }
 
 func (a *ipv4Adapter) getDevicesFromServer(context *ipv4.ServiceContext) (map[types.ExternalDeviceID]types.Device, error) {
@@ -385,6 +421,10 @@ func convertComponent(c Component) (types.Component, error) {
 		return nil, fmt.Errorf("unsupported component type %T\n", c)
 	case Light:
 		return convertLight(typed), nil
+	case Outlet:
+		return convertOutlet(typed), nil
+	case Thermostat:
+		return convertThermostat(typed), nil
 	}
 }
 
@@ -401,6 +441,45 @@ func convertLight(light Light) types.LightEmitter {
 	}
 }
 
+// convertOutlet converts a server-formatted Outlet into a sift Switch
+func convertOutlet(outlet Outlet) types.Switch {
+	return types.Switch{
+		BaseComponent: types.BaseComponent{
+			Make:  "example",
+			Model: "outlet_1",
+		},
+		State: types.SwitchState{
+			IsOn:             outlet.IsOn,
+			PowerDrawInWatts: float64(outlet.PowerInMilliwatts) / 1000,
+		},
+	}
+}
+
+// convertThermostat converts a server-formatted Thermostat into a sift
+// Thermostat
+func convertThermostat(thermostat Thermostat) types.Thermostat {
+	return types.Thermostat{
+		BaseComponent: types.BaseComponent{
+			Make:  "example",
+			Model: "thermostat_1",
+		},
+		State: types.ThermostatState{
+			Mode:                  strings.ToUpper(thermostat.Mode),
+			CurrentTempInCelsius:  fahrenheitToCelsius(thermostat.CurrentTempF),
+			HeatSetpointInCelsius: fahrenheitToCelsius(thermostat.HeatToF),
+			CoolSetpointInCelsius: fahrenheitToCelsius(thermostat.CoolToF),
+		},
+	}
+}
+
+func fahrenheitToCelsius(f int) float64 {
+	return float64(f-32) * 5 / 9
+}
+
+func celsiusToFahrenheit(c float64) int {
+	return int(math.Floor(c*9/5 + 32 + 0.5))
+}
+
 func (a *ipv4Adapter) setComponent(context *ipv4.ServiceContext, devID, compID string, comp interface{}) error {
 	//typed := comp.GetTyped()           // Wrap component with its Type
 	asJSON, err := json.Marshal(comp) // convert Component to JSON
@@ -408,12 +487,7 @@ func (a *ipv4Adapter) setComponent(context *ipv4.ServiceContext, devID, compID s
 		return fmt.Errorf("error converting component to JSON: %v", err)
 	}
 
-	var url string
-	if context.Port != nil {
-		url = getDevicesURL(context.IP, *context.Port)
-	} else {
-		url = getDevicesURL(context.IP, a.port)
-	}
+	url := getDevicesURL(context, a.port)
 	url = url + "/" + devID + "/" + compID
 
 	Log.Debug("sending http POST to set component", "url", url, "content", string(asJSON), "context", context)
@@ -17,6 +17,7 @@ import (
 	"net"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 )
 
@@ -24,11 +25,17 @@ const (
 	serverTypeAllAtOnce = "all_at_once"
 	defaultPort         = uint16(10203)
 	testPort            = uint16(1)
+
+	// how often the server updates the state of emulated devices, such as
+	// the room temperature measured by thermostats
+	emulationInterval = 5 * time.Second
 )
 
 const (
-	componentTypeLight = "light"
-	componentTypeLock  = "lock"
+	componentTypeLight      = "light"
+	componentTypeLock       = "lock"
+	componentTypeOutlet     = "outlet"
+	componentTypeThermostat = "thermostat"
 )
 
 // A Device is an example server's representation of a physical unit
@@ -36,6 +43,15 @@ type Device struct {
 	Components map[string]Component
 }
 
+// copy returns a copy of the device which does not share its Components
+func (d Device) copy() Device {
+	components := make(map[string]Component, len(d.Components))
+	for id, comp := range d.Components {
+		components[id] = comp
+	}
+	return Device{Components: components}
+}
+
 // A Component is an example server's representation of a functional unit
 type Component interface {
 	GetType() string
@@ -84,6 +100,66 @@ func (l Lock) MarshalJSON() ([]byte, error) {
 	return json.Marshal(s)
 }
 
+// An Outlet is an example server's representation of a smart outlet. The
+// server emulates the outlet measuring its own power draw: while on, it draws
+// the load of whatever is plugged into it.
+type Outlet struct {
+	IsOn              bool `json:"is_on"`
+	PowerInMilliwatts uint `json:"power_in_milliwatts"`
+	LoadInMilliwatts  uint `json:"load_in_milliwatts,omitempty"` // the draw of the plugged-in appliance when on
+}
+
+// GetType returns the outlet's type
+func (o Outlet) GetType() string { return componentTypeOutlet }
+
+// MarshalJSON uses the 'typed' version of the Outlet when marshalling to JSON
+func (o Outlet) MarshalJSON() ([]byte, error) {
+	s := struct {
+		IsOn              bool `json:"is_on"`
+		PowerInMilliwatts uint `json:"power_in_milliwatts"`
+		LoadInMilliwatts  uint `json:"load_in_milliwatts,omitempty"`
+		Type              string
+	}{
+		IsOn:              o.IsOn,
+		PowerInMilliwatts: o.PowerInMilliwatts,
+		LoadInMilliwatts:  o.LoadInMilliwatts,
+		Type:              componentTypeOutlet,
+	}
+	return json.Marshal(s)
+}
+
+// A Thermostat is an example server's representation of a thermostat. Unlike
+// SIFT, the example server thinks in degrees Fahrenheit. The server emulates
+// the room's temperature, which moves towards the setpoints while the
+// thermostat is heating or cooling.
+type Thermostat struct {
+	Mode         string `json:"mode"` // "off", "heat", "cool", or "auto"
+	CurrentTempF int    `json:"current_temp_f"`
+	HeatToF      int    `json:"heat_to_f"`
+	CoolToF      int    `json:"cool_to_f"`
+}
+
+// GetType returns the thermostat's type
+func (t Thermostat) GetType() string { return componentTypeThermostat }
+
+// MarshalJSON uses the 'typed' version of the Thermostat when marshalling to JSON
+func (t Thermostat) MarshalJSON() ([]byte, error) {
+	s := struct {
+		Mode         string `json:"mode"`
+		CurrentTempF int    `json:"current_temp_f"`
+		HeatToF      int    `json:"heat_to_f"`
+		CoolToF      int    `json:"cool_to_f"`
+		Type         string
+	}{
+		Mode:         t.Mode,
+		CurrentTempF: t.CurrentTempF,
+		HeatToF:      t.HeatToF,
+		CoolToF:      t.CoolToF,
+		Type:         componentTypeThermostat,
+	}
+	return json.Marshal(s)
+}
+
 type serverConfig struct {
 	version           string
 	pushEnabled       bool // enable push notifications of Device/Component changes
@@ -97,6 +173,7 @@ type serverConfig struct {
 type Server struct {
 	port        uint16
 	devices     map[string]Device
+	dlock       sync.RWMutex // protects devices
 	notify      chan struct{}
 	listeners   []chan bool
 	netListener net.Listener
@@ -123,6 +200,8 @@ func (s *Server) Serve() {
 	if s.port != testPort { // in test mode, the server does not serve over HTTP
 		go s.serveHTTP()
 	}
+	emulate := time.NewTicker(emulationInterval)
+	defer emulate.Stop()
 
 	for {
 		select {
@@ -137,8 +216,10 @@ func (s *Server) Serve() {
 				s.log.Warn("taking longer than 10 seconds to close http server, skipping")
 			}
 		case <-s.notify:
-			for _, listener := range s.listeners {
-				listener <- true
+			s.notifyListeners()
+		case <-emulate.C:
+			if s.emulate() {
+				s.notifyListeners()
 			}
 		}
 	}
@@ -175,25 +256,103 @@ func (s *Server) close() error {
 	return nil
 }
 
+func (s *Server) notifyListeners() {
+	for _, listener := range s.listeners {
+		listener <- true
+	}
+}
+
 // SetDevice sets the server to report the given device with id "id"
 func (s *Server) SetDevice(id string, device Device) {
+	s.dlock.Lock()
 	s.devices[id] = device
+	s.dlock.Unlock()
 	s.notify <- struct{}{}
 }
 
+// AddEmulatedDevices adds an outlet with a lamp plugged into it, and a
+// thermostat in a cool room, to the devices reported by the server. Their
+// states change as a real outlet and thermostat would (see Outlet and
+// Thermostat).
+func (s *Server) AddEmulatedDevices() {
+	s.SetDevice("outlet 1", Device{
+		Components: map[string]Component{
+			"outlet": Outlet{LoadInMilliwatts: 60000},
+		},
+	})
+	s.SetDevice("thermostat 1", Device{
+		Components: map[string]Component{
+			"thermostat": Thermostat{Mode: "heat", CurrentTempF: 64, HeatToF: 68, CoolToF: 76},
+		},
+	})
+}
+
+// setComponent sets a component of a device. As with a real device, clients
+// can only set what they control: outlets measure their own power draw, and
+// thermostats the temperature of their room.
 func (s *Server) setComponent(deviceID, componentID string, c Component) error {
+	s.dlock.Lock()
 	device, ok := s.devices[deviceID]
 	if !ok {
+		s.dlock.Unlock()
 		return fmt.Errorf("no device found with id %v", deviceID)
 	}
 
+	switch typed := c.(type) {
+	case Outlet:
+		if existing, ok := device.Components[componentID].(Outlet); ok {
+			typed.LoadInMilliwatts = existing.LoadInMilliwatts
+		}
+		typed.PowerInMilliwatts = 0
+		if typed.IsOn {
+			typed.PowerInMilliwatts = typed.LoadInMilliwatts
+		}
+		c = typed
+	case Thermostat:
+		if existing, ok := device.Components[componentID].(Thermostat); ok {
+			typed.CurrentTempF = existing.CurrentTempF
+		}
+		c = typed
+	}
 	device.Components[componentID] = c
+	s.dlock.Unlock()
 	s.notify <- struct{}{}
 	return nil
 }
 
+// emulate moves the temperature of each heating or cooling thermostat's room
+// one degree towards its setpoint. Returns true if any device has changed.
+func (s *Server) emulate() bool {
+	s.dlock.Lock()
+	defer s.dlock.Unlock()
+	changed := false
+	for _, device := range s.devices {
+		for id, comp := range device.Components {
+			t, ok := comp.(Thermostat)
+			if !ok {
+				continue
+			}
+			heating := t.Mode == "heat" || t.Mode == "auto"
+			cooling := t.Mode == "cool" || t.Mode == "auto"
+			switch {
+			case heating && t.CurrentTempF < t.HeatToF:
+				t.CurrentTempF++
+			case cooling && t.CurrentTempF > t.CoolToF:
+				t.CurrentTempF--
+			default:
+				continue
+			}
+			device.Components[id] = t
+			changed = true
+		}
+	}
+	return changed
+}
+
 func (s *Server) removeDevice(id string) {
+	s.dlock.Lock()
 	delete(s.devices, id)
+	s.dlock.Unlock()
 	s.notify <- struct{}{}
 }
 
@@ -219,11 +378,17 @@ var hardcodedPaths = []string{"/", "/status", "/devices", "/devices/{devID}", "/
 
 //
 func (s *Server) getDevices() map[string]Device {
-	return s.devices
+	s.dlock.RLock()
+	defer s.dlock.RUnlock()
+	devices := make(map[string]Device, len(s.devices))
+	for id, device := range s.devices {
+		devices[id] = device.copy() // emulate() changes the components of stored devices
+	}
+	return devices
 }
 
 func (s *Server) getDevicesHTTP(w http.ResponseWriter, r *http.Request) {
-	asJSON, err := json.Marshal(s.devices)
+	asJSON, err := json.Marshal(s.getDevices())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -233,8 +398,13 @@ func (s *Server) getDevicesHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) getDevice(id string) (Device, bool) {
+	s.dlock.RLock()
+	defer s.dlock.RUnlock()
 	dev, ok := s.devices[id]
-	return dev, ok
+	if !ok {
+		return Device{}, false
+	}
+	return dev.copy(), true
 }
 
 func (s *Server) getDeviceHTTP(w http.ResponseWriter, r *http.Request) {
@@ -245,6 +415,8 @@ func (s *Server) getDeviceHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.dlock.RLock()
+	defer s.dlock.RUnlock()
 	device, ok := s.devices[id]
 	if !ok {
 		http.Error(w, "device "+id+" not found", http.StatusNotFound)
@@ -295,6 +467,8 @@ func (s *Server) getComponentHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.dlock.RLock()
+	defer s.dlock.RUnlock()
 	device, ok := s.devices[devID]
 	if !ok {
 		http.Error(w, "device "+devID+" not found", http.StatusNotFound)
@@ -455,6 +629,10 @@ func componentFromJSON(input []byte) (Component, error) {
 		return lightFromJSON(input)
 	case componentTypeLock:
 		return lockFromJSON(input)
+	case componentTypeOutlet:
+		return outletFromJSON(input)
+	case componentTypeThermostat:
+		return thermostatFromJSON(input)
 	}
 }
 
@@ -469,3 +647,15 @@ func lockFromJSON(input []byte) (Lock, error) {
 	err := json.Unmarshal(input, &lock)
 	return lock, err
 }
+
+func outletFromJSON(input []byte) (Outlet, error) {
+	var outlet Outlet
+	err := json.Unmarshal(input, &outlet)
+	return outlet, err
+}
+
+func thermostatFromJSON(input []byte) (Thermostat, error) {
+	var thermostat Thermostat
+	err := json.Unmarshal(input, &thermostat)
+	return thermostat, err
+}
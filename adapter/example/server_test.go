@@ -218,6 +218,65 @@ func (s *TestSIFTExampleSuite) TestComponentGETandPOST(c *C) {
 	c.Assert(devices["device 1"], DeepEquals, device1State2)
 }
 
+func (s *TestSIFTExampleSuite) TestEmulatedDevices(c *C) {
+	server := NewServer(testPort) // Start a server
+	c.Assert(server, NotNil)
+	ts := httptest.NewServer(server.Handlers(""))
+	defer ts.Close()
+	server.AddEmulatedDevices()
+	c.Assert(len(getDevices(ts, c)), Equals, 2)
+
+	// the outlet draws its load while on, whatever the client reports
+	outlet := postComponent(ts, c, "outlet 1", "outlet", Outlet{IsOn: true, PowerInMilliwatts: 5})
+	c.Assert(outlet, Equals, Outlet{IsOn: true, PowerInMilliwatts: 60000, LoadInMilliwatts: 60000})
+	outlet = postComponent(ts, c, "outlet 1", "outlet", Outlet{IsOn: false, PowerInMilliwatts: 60000})
+	c.Assert(outlet, Equals, Outlet{IsOn: false, PowerInMilliwatts: 0, LoadInMilliwatts: 60000})
+
+	// the thermostat measures its room, which warms towards the setpoint
+	thermostat := postComponent(ts, c, "thermostat 1", "thermostat", Thermostat{Mode: "heat", CurrentTempF: 90, HeatToF: 66, CoolToF: 76})
+	c.Assert(thermostat, Equals, Thermostat{Mode: "heat", CurrentTempF: 64, HeatToF: 66, CoolToF: 76})
+	c.Assert(server.emulate(), Equals, true)
+	c.Assert(server.emulate(), Equals, true)
+	c.Assert(server.emulate(), Equals, false) // reached the setpoint
+	c.Assert(getComponent(ts, c, "thermostat 1", "thermostat"), Equals, Thermostat{Mode: "heat", CurrentTempF: 66, HeatToF: 66, CoolToF: 76})
+
+	// ...and cools towards the other
+	postComponent(ts, c, "thermostat 1", "thermostat", Thermostat{Mode: "cool", HeatToF: 60, CoolToF: 65})
+	c.Assert(server.emulate(), Equals, true)
+	c.Assert(getComponent(ts, c, "thermostat 1", "thermostat").(Thermostat).CurrentTempF, Equals, 65)
+	postComponent(ts, c, "thermostat 1", "thermostat", Thermostat{Mode: "off", HeatToF: 70, CoolToF: 60})
+	c.Assert(server.emulate(), Equals, false)
+}
+
+func (s *TestSIFTExampleSuite) TestGetDevicesCopies(c *C) {
+	server := NewServer(testPort)
+	server.AddEmulatedDevices()
+
+	// devices are copied, so they can be read while the server emulates them
+	devices := server.getDevices()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			server.emulate()
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		for _, device := range devices {
+			for id := range device.Components {
+				device.Components[id] = Light{}
+			}
+		}
+	}
+	<-done
+
+	device, ok := server.getDevice("thermostat 1")
+	c.Assert(ok, Equals, true)
+	c.Assert(device.Components["thermostat"], Equals, Thermostat{Mode: "heat", CurrentTempF: 68, HeatToF: 68, CoolToF: 76})
+	_, ok = server.getDevice("unknown")
+	c.Assert(ok, Equals, false)
+}
+
 //
 // JSON tests
 //
@@ -230,6 +289,16 @@ var componentTests = map[string]Component{
 	"lock": Lock{
 		IsOpen: true,
 	},
+	"outlet": Outlet{
+		IsOn:              true,
+		PowerInMilliwatts: 60500,
+	},
+	"thermostat": Thermostat{
+		Mode:         "heat",
+		CurrentTempF: 66,
+		HeatToF:      68,
+		CoolToF:      76,
+	},
 }
 
 func (s *TestSIFTExampleSuite) TestComponentJSONBackAndForth(c *C) {
@@ -263,6 +332,16 @@ var deviceTests = map[string]Device{
 			},
 		},
 	},
+	"device with outlet and thermostat": Device{
+		Components: map[string]Component{
+			"outlet": Outlet{IsOn: true, PowerInMilliwatts: 1200},
+			"thermostat": Thermostat{
+				Mode:    "auto",
+				HeatToF: 65,
+				CoolToF: 78,
+			},
+		},
+	},
 }
 
 func (s *TestSIFTExampleSuite) TestDeviceJSONBackAndForth(c *C) {
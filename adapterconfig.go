@@ -0,0 +1,211 @@
+package sift
+
+import (
+	"fmt"
+	"github.com/upwrd/sift/adapter"
+	"github.com/upwrd/sift/types"
+)
+
+// Secret config values are stored as Adapter credentials (which may be
+// encrypted) under this prefix, rather than with the rest of the config
+func secretConfigKey(name string) string { return "config:" + name }
+
+// AdapterConfigFields returns the config fields declared by the named Adapter
+// Factory, sorted by name. The factory must have been added to the Server.
+func (s *Server) AdapterConfigFields(factoryName string) ([]types.ConfigField, error) {
+	factory, err := s.getConfigurableFactory(factoryName)
+	if err != nil {
+		return nil, err
+	}
+	config, err := types.NewAdapterConfig(factory.ConfigFields(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("factory %v declares invalid config fields: %v", factoryName, err)
+	}
+	return config.Fields(), nil
+}
+
+// SetAdapterConfig sets a config value for the named Adapter Factory, which
+// must have been added to the Server and must declare a field with the given
+// key. The value is checked against the field's type, and by the factory
+// itself, before it is stored. It is used by Adapters created afterwards.
+// Values of secret fields are stored as Adapter credentials, and are not
+// returned by GetAdapterConfig.
+func (s *Server) SetAdapterConfig(factoryName, key, value string) error {
+	factory, err := s.getConfigurableFactory(factoryName)
+	if err != nil {
+		return err
+	}
+	field, err := getConfigField(factory, key)
+	if err != nil {
+		return err
+	}
+	if err := field.Validate(value); err != nil {
+		return err
+	}
+	return s.reconfigure(factory, func(values map[string]string) error {
+		values[key] = value
+		return nil
+	}, func() error {
+		if field.Secret {
+			return s.Store.UpsertAdapterCredential(factoryName, secretConfigKey(key), value)
+		}
+		return s.Store.SetAdapterConfig(factoryName, key, value)
+	})
+}
+
+// DeleteAdapterConfig deletes the config value set for the named Adapter
+// Factory with the given key, so that the field's default is used instead.
+func (s *Server) DeleteAdapterConfig(factoryName, key string) error {
+	factory, err := s.getConfigurableFactory(factoryName)
+	if err != nil {
+		return err
+	}
+	field, err := getConfigField(factory, key)
+	if err != nil {
+		return err
+	}
+	return s.reconfigure(factory, func(values map[string]string) error {
+		if _, ok := values[key]; !ok {
+			return fmt.Errorf("no config %v set for %v", key, factoryName)
+		}
+		delete(values, key)
+		return nil
+	}, func() error {
+		if field.Secret {
+			return s.Store.RevokeAdapterCredential(factoryName, secretConfigKey(key))
+		}
+		return s.Store.DeleteAdapterConfig(factoryName, key)
+	})
+}
+
+// reconfigure applies a change to a factory's config values, then persists
+// it. If the factory rejects the new config, nothing is persisted; if the
+// change cannot be persisted, the factory is given its previous config.
+func (s *Server) reconfigure(factory adapter.ConfigurableFactory, change func(map[string]string) error, persist func() error) error {
+	values, err := s.getAdapterConfigValues(factory)
+	if err != nil {
+		return err
+	}
+	previous, err := types.NewAdapterConfig(factory.ConfigFields(), values)
+	if err != nil {
+		return fmt.Errorf("stored config for %v is invalid: %v", factory.Name(), err)
+	}
+	if err := change(values); err != nil {
+		return err
+	}
+	config, err := types.NewAdapterConfig(factory.ConfigFields(), values)
+	if err != nil {
+		return err
+	}
+	if err := factory.Configure(config); err != nil {
+		return fmt.Errorf("invalid config for %v: %v", factory.Name(), err)
+	}
+	if err := persist(); err != nil {
+		if cfgErr := factory.Configure(previous); cfgErr != nil {
+			s.log.Error("could not restore previous adapter config", "factory", factory.Name(), "err", cfgErr)
+		}
+		return fmt.Errorf("could not store config for %v: %v", factory.Name(), err)
+	}
+	s.log.Info("adapter config changed", "factory", factory.Name())
+	s.refreshDescriptions(factory)
+	return nil
+}
+
+// configureFactory gives a newly-added factory its stored config
+func (s *Server) configureFactory(factory adapter.ConfigurableFactory) error {
+	config, err := s.getAdapterConfig(factory)
+	if err != nil {
+		return err
+	}
+	if err := factory.Configure(config); err != nil {
+		return fmt.Errorf("invalid config for %v: %v", factory.Name(), err)
+	}
+	return nil
+}
+
+// getAdapterConfig returns the config for Adapters created by the factory. If
+// the factory does not accept configuration, the config is empty.
+func (s *Server) getAdapterConfig(factory adapter.Factory) (types.AdapterConfig, error) {
+	configurable, ok := factory.(adapter.ConfigurableFactory)
+	if !ok {
+		return types.AdapterConfig{}, nil
+	}
+	values, err := s.getAdapterConfigValues(configurable)
+	if err != nil {
+		return types.AdapterConfig{}, err
+	}
+	return types.NewAdapterConfig(configurable.ConfigFields(), values)
+}
+
+// getAdapterConfigValues returns the values set for the factory, including
+// secret values
+func (s *Server) getAdapterConfigValues(factory adapter.ConfigurableFactory) (map[string]string, error) {
+	values, err := s.Store.GetAdapterConfig(factory.Name())
+	if err != nil {
+		return nil, fmt.Errorf("could not get config for %v: %v", factory.Name(), err)
+	}
+	for _, field := range factory.ConfigFields() {
+		if !field.Secret {
+			continue
+		}
+		delete(values, field.Name) // secret values are only read from credentials
+		if value, err := s.Store.GetAdapterCredential(factory.Name(), secretConfigKey(field.Name)); err == nil {
+			values[field.Name] = value
+		}
+	}
+	return values, nil
+}
+
+// refreshDescriptions updates the scanners with the factory's current
+// descriptions, which may depend on its config
+func (s *Server) refreshDescriptions(factory adapter.Factory) {
+	// the scanners may post events while descriptions are updated, so the
+	// factories are not locked while updating them
+	var ids []string
+	s.flock.RLock()
+	for id, f := range s.factoriesByDescriptionID {
+		if f == factory {
+			ids = append(ids, id)
+		}
+	}
+	s.flock.RUnlock()
+
+	for _, id := range ids {
+		switch typed := factory.(type) {
+		case adapter.IPv4Factory:
+			if err := s.ipv4Scan.UpdateDescription(id, typed.GetIPv4Description()); err != nil {
+				s.log.Warn("could not update ipv4 description", "factory", factory.Name(), "err", err)
+			}
+			s.ipv4Scan.Rescan() // look for services matching the new description now
+		case adapter.SSDPFactory:
+			if err := s.ssdpSearch.UpdateDescription(id, typed.GetSSDPDescription()); err != nil {
+				s.log.Warn("could not update ssdp description", "factory", factory.Name(), "err", err)
+			}
+		case adapter.BLEFactory:
+			if err := s.bleDiscovery.UpdateDescription(id, typed.GetBLEDescription()); err != nil {
+				s.log.Warn("could not update ble description", "factory", factory.Name(), "err", err)
+			}
+		}
+	}
+}
+
+func (s *Server) getConfigurableFactory(name string) (adapter.ConfigurableFactory, error) {
+	factory, ok := s.factoryByName(name)
+	if !ok {
+		return nil, fmt.Errorf("no adapter factory named %v has been added", name)
+	}
+	configurable, ok := factory.(adapter.ConfigurableFactory)
+	if !ok {
+		return nil, fmt.Errorf("adapter factory %v does not accept configuration", name)
+	}
+	return configurable, nil
+}
+
+func getConfigField(factory adapter.ConfigurableFactory, name string) (types.ConfigField, error) {
+	for _, field := range factory.ConfigFields() {
+		if field.Name == name {
+			return field, nil
+		}
+	}
+	return types.ConfigField{}, fmt.Errorf("adapter factory %v has no config field %v", factory.Name(), name)
+}
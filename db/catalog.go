@@ -0,0 +1,103 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/upwrd/sift/types"
+	"io"
+	"os"
+)
+
+// A SpecCatalog lists the specs of known Components, indexed by component
+// type. It is usually read from a JSON file, like:
+//
+//	{
+//		"light_emitter": [
+//			{
+//				"make": "example",
+//				"model": "light_emitter_1",
+//				"specs": {"max_output_in_lumens": 700, "min_output_in_lumens": 0}
+//			}
+//		]
+//	}
+type SpecCatalog map[string][]SpecCatalogEntry
+
+// A SpecCatalogEntry holds the specs for a single make and model. Specs are
+// decoded by the storage registered for the component type.
+type SpecCatalogEntry struct {
+	Make  string          `json:"make"`
+	Model string          `json:"model"`
+	Specs json.RawMessage `json:"specs"`
+}
+
+// LoadSpecCatalogFile imports the JSON-encoded SpecCatalog at the given path
+// into the spec tables. See LoadSpecCatalog.
+func (sdb *SiftDB) LoadSpecCatalogFile(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("could not open spec catalog: %v", err)
+	}
+	defer file.Close()
+	return sdb.LoadSpecCatalog(file)
+}
+
+// LoadSpecCatalog imports a JSON-encoded SpecCatalog into the spec tables,
+// replacing the existing specs of any matching make and model. Either all
+// entries are loaded, or none are. The number of entries loaded is returned.
+func (sdb *SiftDB) LoadSpecCatalog(r io.Reader) (n int, err error) {
+	// begin a database transaction
+	tx, err := sdb.db.Beginx()
+	if err != nil {
+		return 0, fmt.Errorf("could not begin transaction: %v", err)
+	}
+	// If something bad happens, roll back the transaction
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				sdb.log.Error("could not roll back db transaction", "original_err", err, "rollback_err", rbErr)
+			}
+			sdb.log.Warn("rolled back db transaction", "original_err", err)
+		} else {
+			if cmErr := tx.Commit(); cmErr != nil {
+				sdb.log.Error("could not commit transaction", "commit_err", cmErr)
+				err = fmt.Errorf("could not commit transaction: %v", cmErr)
+			}
+			sdb.log.Debug("spec catalog loaded; transaction committed", "num_loaded", n)
+		}
+	}()
+
+	n, err = loadSpecCatalogTx(tx, r)
+	return
+}
+
+func loadSpecCatalogTx(tx siftTx, r io.Reader) (int, error) {
+	var catalog SpecCatalog
+	if err := json.NewDecoder(r).Decode(&catalog); err != nil {
+		return 0, fmt.Errorf("could not decode spec catalog: %v", err)
+	}
+	return upsertSpecCatalogTx(tx, catalog)
+}
+
+func upsertSpecCatalogTx(tx siftTx, catalog SpecCatalog) (int, error) {
+	n := 0
+	for typeName, entries := range catalog {
+		storage, err := componentStorage(typeName)
+		if err != nil {
+			return 0, err
+		}
+		specStorage, ok := storage.(types.SpecStorage)
+		if !ok {
+			return 0, fmt.Errorf("specs for component type %v cannot be loaded", typeName)
+		}
+		for _, entry := range entries {
+			if entry.Make == "" || entry.Model == "" {
+				return 0, fmt.Errorf("%v spec catalog entry must have a make and model", typeName)
+			}
+			if err := specStorage.UpsertSpecs(tx, entry.Make, entry.Model, entry.Specs); err != nil {
+				return 0, fmt.Errorf("could not load %v specs for %v %v: %v", typeName, entry.Make, entry.Model, err)
+			}
+			n++
+		}
+	}
+	return n, nil
+}
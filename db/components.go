@@ -0,0 +1,496 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/upwrd/sift/types"
+	"strings"
+)
+
+// Storage for the built-in Component types. The tables used by these types
+// are created by rawsql.InitSql, so their Schema() methods return nothing.
+func init() {
+	builtins := map[string]types.ComponentStorage{
+		types.ComponentTypeLightEmitter: lightEmitterStorage{},
+		types.ComponentTypeMediaPlayer:  mediaPlayerStorage{},
+		types.ComponentTypeSwitch:       switchStorage{},
+		types.ComponentTypeThermostat:   thermostatStorage{},
+	}
+	for name, storage := range builtins {
+		if err := types.SetComponentStorage(name, storage); err != nil {
+			panic(fmt.Sprintf("could not set storage for built-in component type %v: %v", name, err))
+		}
+	}
+}
+
+// componentStorage returns the storage hooks registered for the named
+// Component type
+func componentStorage(typeName string) (types.ComponentStorage, error) {
+	ct, ok := types.LookupComponentType(typeName)
+	if !ok {
+		return nil, fmt.Errorf("unhandled component type: %v", typeName)
+	}
+	if ct.Storage == nil {
+		return nil, fmt.Errorf("components of type %v cannot be stored", typeName)
+	}
+	return ct.Storage, nil
+}
+
+// upsertSpecsTx updates or inserts the row matching make and model in a spec
+// table
+func upsertSpecsTx(tx types.StorageTx, table, make, model string, columns []string, values []interface{}) error {
+	// Try updating
+	q := "UPDATE " + table + " SET " + strings.Join(columns, "=?, ") + "=? WHERE make=? AND model=?"
+	res, err := tx.Exec(q, append(values, make, model)...)
+	if err != nil {
+		return fmt.Errorf("error updating %v: %v", table, err)
+	}
+
+	// Check the number of rows affected by the update; should be 1 if the
+	// row existed, and 0 if not
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("error getting row count (required for update): %v", err)
+	} else if n == 0 {
+		// The update failed, do an insert instead
+		q = "INSERT INTO " + table + " (make, model, " + strings.Join(columns, ", ") + ") VALUES (?, ?" + strings.Repeat(", ?", len(columns)) + ")"
+		if _, err := tx.Exec(q, append([]interface{}{make, model}, values...)...); err != nil {
+			return fmt.Errorf("error inserting into %v: %v", table, err)
+		}
+	}
+	Log.Debug("upserted specs", "table", table, "make", make, "model", model, "values", values)
+	return nil
+}
+
+// toModelSpecs encodes the specs of a make and model, as they would be passed
+// to UpsertSpecs
+func toModelSpecs(make, model string, specs interface{}) (types.ModelSpecs, error) {
+	raw, err := json.Marshal(specs)
+	if err != nil {
+		return types.ModelSpecs{}, fmt.Errorf("could not encode specs for %v %v: %v", make, model, err)
+	}
+	return types.ModelSpecs{Make: make, Model: model, Specs: raw}, nil
+}
+
+//
+// Light emitters
+//
+
+type lightEmitterStorage struct{}
+
+func (lightEmitterStorage) Schema() string { return "" }
+
+func (lightEmitterStorage) StateTable() string { return "light_emitter_state" }
+
+func (lightEmitterStorage) Get(tx types.StorageTx, id int64, base types.BaseComponent) (types.Component, error) {
+	var state types.LightEmitterState
+	q := "SELECT brightness_in_percent FROM light_emitter_state WHERE id=? LIMIT 1"
+	if err := tx.Get(&state, q, id); err != nil {
+		return nil, fmt.Errorf("error getting light emitter with id %v: %v", id, err)
+	}
+	return types.LightEmitter{BaseComponent: base, State: state}, nil
+}
+
+func (lightEmitterStorage) Upsert(tx types.StorageTx, compID int64, c types.Component) error {
+	le, ok := c.(types.LightEmitter)
+	if !ok {
+		return fmt.Errorf("expected types.LightEmitter, got %T", c)
+	}
+
+	// Try updating
+	q := "UPDATE light_emitter_state SET brightness_in_percent=? WHERE id=?"
+	res, err := tx.Exec(q, le.State.BrightnessInPercent, compID)
+	if err != nil {
+		return fmt.Errorf("error updating component: %v", err)
+	}
+
+	// Check the number of rows affected by the udpate; should be 1 if the
+	// light_emitter_state row existed, and 0 if not
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("error getting row count (required for update): %v", err)
+	} else if n == 0 {
+		// The update failed, do an insert instead
+		q = "INSERT INTO light_emitter_state (id, brightness_in_percent) VALUES (?, ?)"
+		if _, err := tx.Exec(q, compID, le.State.BrightnessInPercent); err != nil {
+			return fmt.Errorf("error inserting component: %v", err)
+		}
+		Log.Debug("inserted new light emitter", "id", compID, "new_values", le, "query", q)
+		return nil
+	}
+	Log.Debug("updated existing light emitter", "id", compID, "new_values", le, "query", q)
+	return nil
+}
+
+func (lightEmitterStorage) Delete(tx types.StorageTx, compID int64) error {
+	if _, err := tx.Exec("DELETE FROM light_emitter_state WHERE id=?", compID); err != nil {
+		return fmt.Errorf("error deleteing from light_emitter_state: %v", err)
+	}
+	//TODO: also delete light_emitter_stats
+	return nil
+}
+
+func (lightEmitterStorage) GetSpecs(tx types.StorageTx, c types.Component) (types.Component, error) {
+	le, ok := c.(types.LightEmitter)
+	if !ok {
+		return nil, fmt.Errorf("expected types.LightEmitter, got %T", c)
+	}
+	specs := types.LightEmitterSpecs{}
+	q := `SELECT max_output_in_lumens, min_output_in_lumens, expected_lifetime_in_hours
+		FROM light_emitter_spec
+		WHERE make=? AND model=?
+		LIMIT 1`
+	if err := tx.Get(&specs, q, le.Make, le.Model); err == sql.ErrNoRows {
+		return le, nil // no specs are known for this make and model
+	} else if err != nil {
+		return nil, fmt.Errorf("error querying for light emitter spec: %v", err)
+	}
+	le.Specs = &specs
+	return le, nil
+}
+
+func (lightEmitterStorage) UpsertSpecs(tx types.StorageTx, make, model string, raw json.RawMessage) error {
+	var specs types.LightEmitterSpecs
+	if err := json.Unmarshal(raw, &specs); err != nil {
+		return fmt.Errorf("could not decode light emitter specs: %v", err)
+	}
+	return upsertSpecsTx(tx, "light_emitter_spec", make, model,
+		[]string{"max_output_in_lumens", "min_output_in_lumens", "expected_lifetime_in_hours"},
+		[]interface{}{specs.MaxOutputInLumens, specs.MinOutputInLumens, specs.ExpectedLifetimeInHours})
+}
+
+func (lightEmitterStorage) ListSpecs(tx types.StorageTx) ([]types.ModelSpecs, error) {
+	rows := []struct {
+		Make, Model string
+		types.LightEmitterSpecs
+	}{}
+	if err := tx.Select(&rows, "SELECT * FROM light_emitter_spec ORDER BY make, model"); err != nil {
+		return nil, fmt.Errorf("error listing light emitter specs: %v", err)
+	}
+	list := make([]types.ModelSpecs, 0, len(rows))
+	for _, row := range rows {
+		ms, err := toModelSpecs(row.Make, row.Model, row.LightEmitterSpecs)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, ms)
+	}
+	return list, nil
+}
+
+//
+// Media players
+//
+
+type mediaPlayerStorage struct{}
+
+func (mediaPlayerStorage) Schema() string { return "" }
+
+func (mediaPlayerStorage) StateTable() string { return "media_player_state" }
+
+func (mediaPlayerStorage) Get(tx types.StorageTx, id int64, base types.BaseComponent) (types.Component, error) {
+	var state types.MediaPlayerState
+	q := "SELECT play_state, media_type, source FROM media_player_state WHERE id=? LIMIT 1"
+	if err := tx.Get(&state, q, id); err != nil {
+		return nil, fmt.Errorf("error getting media player with id %v: %v", id, err)
+	}
+	return types.MediaPlayer{BaseComponent: base, State: state}, nil
+}
+
+func (mediaPlayerStorage) Upsert(tx types.StorageTx, compID int64, c types.Component) error {
+	mp, ok := c.(types.MediaPlayer)
+	if !ok {
+		return fmt.Errorf("expected types.MediaPlayer, got %T", c)
+	}
+
+	// Try updating
+	q := "UPDATE media_player_state SET play_state=?, media_type=?, source=? WHERE id=?"
+	res, err := tx.Exec(q, mp.State.PlayState, mp.State.MediaType, mp.State.Source, compID)
+	if err != nil {
+		return fmt.Errorf("error updating component: %v", err)
+	}
+
+	// Check the number of rows affected by the udpate; should be 1 if the
+	// media_player_state row existed, and 0 if not
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("error getting row count (required for update): %v", err)
+	} else if n == 0 {
+		// The update failed, do an insert instead
+		q = "INSERT INTO media_player_state (id, play_state, media_type, source) VALUES (?, ?, ?, ?)"
+		if _, err := tx.Exec(q, compID, mp.State.PlayState, mp.State.MediaType, mp.State.Source); err != nil {
+			return fmt.Errorf("error inserting component: %v", err)
+		}
+		Log.Debug("inserted new media player", "id", compID, "new_values", mp, "query", q)
+		return nil
+	}
+	Log.Debug("updated existing media player", "id", compID, "new_values", mp, "query", q)
+	return nil
+}
+
+func (mediaPlayerStorage) Delete(tx types.StorageTx, compID int64) error {
+	if _, err := tx.Exec("DELETE FROM media_player_state WHERE id=?", compID); err != nil {
+		return fmt.Errorf("error deleteing from media_player_state: %v", err)
+	}
+	//TODO: also delete media_player_stats
+	return nil
+}
+
+func (mediaPlayerStorage) GetSpecs(tx types.StorageTx, c types.Component) (types.Component, error) {
+	mp, ok := c.(types.MediaPlayer)
+	if !ok {
+		return nil, fmt.Errorf("expected types.MediaPlayer, got %T", c)
+	}
+	specs := types.MediaPlayerSpecs{}
+	q := `SELECT supported_audio_types, supported_video_types
+		FROM media_player_spec
+		WHERE make=? AND model=?
+		LIMIT 1`
+	if err := tx.Get(&specs, q, mp.Make, mp.Model); err == sql.ErrNoRows {
+		return mp, nil // no specs are known for this make and model
+	} else if err != nil {
+		return nil, fmt.Errorf("error querying for media player spec: %v", err)
+	}
+	mp.Specs = &specs
+	return mp, nil
+}
+
+func (mediaPlayerStorage) UpsertSpecs(tx types.StorageTx, make, model string, raw json.RawMessage) error {
+	var specs types.MediaPlayerSpecs
+	if err := json.Unmarshal(raw, &specs); err != nil {
+		return fmt.Errorf("could not decode media player specs: %v", err)
+	}
+	return upsertSpecsTx(tx, "media_player_spec", make, model,
+		[]string{"supported_audio_types", "supported_video_types"},
+		[]interface{}{specs.SupportedAudioTypes, specs.SupportedVideoTypes})
+}
+
+func (mediaPlayerStorage) ListSpecs(tx types.StorageTx) ([]types.ModelSpecs, error) {
+	rows := []struct {
+		Make, Model string
+		types.MediaPlayerSpecs
+	}{}
+	if err := tx.Select(&rows, "SELECT * FROM media_player_spec ORDER BY make, model"); err != nil {
+		return nil, fmt.Errorf("error listing media player specs: %v", err)
+	}
+	list := make([]types.ModelSpecs, 0, len(rows))
+	for _, row := range rows {
+		ms, err := toModelSpecs(row.Make, row.Model, row.MediaPlayerSpecs)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, ms)
+	}
+	return list, nil
+}
+
+//
+// Switches
+//
+
+type switchStorage struct{}
+
+func (switchStorage) Schema() string { return "" }
+
+func (switchStorage) StateTable() string { return "switch_state" }
+
+func (switchStorage) Get(tx types.StorageTx, id int64, base types.BaseComponent) (types.Component, error) {
+	var state types.SwitchState
+	q := "SELECT is_on, power_draw_in_watts FROM switch_state WHERE id=? LIMIT 1"
+	if err := tx.Get(&state, q, id); err != nil {
+		return nil, fmt.Errorf("error getting switch with id %v: %v", id, err)
+	}
+	return types.Switch{BaseComponent: base, State: state}, nil
+}
+
+func (switchStorage) Upsert(tx types.StorageTx, compID int64, c types.Component) error {
+	sw, ok := c.(types.Switch)
+	if !ok {
+		return fmt.Errorf("expected types.Switch, got %T", c)
+	}
+
+	// Try updating
+	q := "UPDATE switch_state SET is_on=?, power_draw_in_watts=? WHERE id=?"
+	res, err := tx.Exec(q, sw.State.IsOn, sw.State.PowerDrawInWatts, compID)
+	if err != nil {
+		return fmt.Errorf("error updating component: %v", err)
+	}
+
+	// Check the number of rows affected by the udpate; should be 1 if the
+	// switch_state row existed, and 0 if not
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("error getting row count (required for update): %v", err)
+	} else if n == 0 {
+		// The update failed, do an insert instead
+		q = "INSERT INTO switch_state (id, is_on, power_draw_in_watts) VALUES (?, ?, ?)"
+		if _, err := tx.Exec(q, compID, sw.State.IsOn, sw.State.PowerDrawInWatts); err != nil {
+			return fmt.Errorf("error inserting component: %v", err)
+		}
+		Log.Debug("inserted new switch", "id", compID, "new_values", sw, "query", q)
+		return nil
+	}
+	Log.Debug("updated existing switch", "id", compID, "new_values", sw, "query", q)
+	return nil
+}
+
+func (switchStorage) Delete(tx types.StorageTx, compID int64) error {
+	if _, err := tx.Exec("DELETE FROM switch_state WHERE id=?", compID); err != nil {
+		return fmt.Errorf("error deleteing from switch_state: %v", err)
+	}
+	return nil
+}
+
+func (switchStorage) GetSpecs(tx types.StorageTx, c types.Component) (types.Component, error) {
+	sw, ok := c.(types.Switch)
+	if !ok {
+		return nil, fmt.Errorf("expected types.Switch, got %T", c)
+	}
+	specs := types.SwitchSpecs{}
+	q := `SELECT max_load_in_watts, is_metered
+		FROM switch_spec
+		WHERE make=? AND model=?
+		LIMIT 1`
+	if err := tx.Get(&specs, q, sw.Make, sw.Model); err == sql.ErrNoRows {
+		return sw, nil // no specs are known for this make and model
+	} else if err != nil {
+		return nil, fmt.Errorf("error querying for switch spec: %v", err)
+	}
+	sw.Specs = &specs
+	return sw, nil
+}
+
+func (switchStorage) UpsertSpecs(tx types.StorageTx, make, model string, raw json.RawMessage) error {
+	var specs types.SwitchSpecs
+	if err := json.Unmarshal(raw, &specs); err != nil {
+		return fmt.Errorf("could not decode switch specs: %v", err)
+	}
+	return upsertSpecsTx(tx, "switch_spec", make, model,
+		[]string{"max_load_in_watts", "is_metered"},
+		[]interface{}{specs.MaxLoadInWatts, specs.IsMetered})
+}
+
+func (switchStorage) ListSpecs(tx types.StorageTx) ([]types.ModelSpecs, error) {
+	rows := []struct {
+		Make, Model string
+		types.SwitchSpecs
+	}{}
+	if err := tx.Select(&rows, "SELECT * FROM switch_spec ORDER BY make, model"); err != nil {
+		return nil, fmt.Errorf("error listing switch specs: %v", err)
+	}
+	list := make([]types.ModelSpecs, 0, len(rows))
+	for _, row := range rows {
+		ms, err := toModelSpecs(row.Make, row.Model, row.SwitchSpecs)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, ms)
+	}
+	return list, nil
+}
+
+//
+// Thermostats
+//
+
+type thermostatStorage struct{}
+
+func (thermostatStorage) Schema() string { return "" }
+
+func (thermostatStorage) StateTable() string { return "thermostat_state" }
+
+func (thermostatStorage) Get(tx types.StorageTx, id int64, base types.BaseComponent) (types.Component, error) {
+	var state types.ThermostatState
+	q := `SELECT mode, current_temp_in_celsius, heat_setpoint_in_celsius, cool_setpoint_in_celsius
+		FROM thermostat_state WHERE id=? LIMIT 1`
+	if err := tx.Get(&state, q, id); err != nil {
+		return nil, fmt.Errorf("error getting thermostat with id %v: %v", id, err)
+	}
+	return types.Thermostat{BaseComponent: base, State: state}, nil
+}
+
+func (thermostatStorage) Upsert(tx types.StorageTx, compID int64, c types.Component) error {
+	t, ok := c.(types.Thermostat)
+	if !ok {
+		return fmt.Errorf("expected types.Thermostat, got %T", c)
+	}
+
+	// Try updating
+	q := `UPDATE thermostat_state SET mode=?, current_temp_in_celsius=?,
+		heat_setpoint_in_celsius=?, cool_setpoint_in_celsius=? WHERE id=?`
+	res, err := tx.Exec(q, t.State.Mode, t.State.CurrentTempInCelsius,
+		t.State.HeatSetpointInCelsius, t.State.CoolSetpointInCelsius, compID)
+	if err != nil {
+		return fmt.Errorf("error updating component: %v", err)
+	}
+
+	// Check the number of rows affected by the udpate; should be 1 if the
+	// thermostat_state row existed, and 0 if not
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("error getting row count (required for update): %v", err)
+	} else if n == 0 {
+		// The update failed, do an insert instead
+		q = `INSERT INTO thermostat_state (id, mode, current_temp_in_celsius,
+			heat_setpoint_in_celsius, cool_setpoint_in_celsius) VALUES (?, ?, ?, ?, ?)`
+		if _, err := tx.Exec(q, compID, t.State.Mode, t.State.CurrentTempInCelsius,
+			t.State.HeatSetpointInCelsius, t.State.CoolSetpointInCelsius); err != nil {
+			return fmt.Errorf("error inserting component: %v", err)
+		}
+		Log.Debug("inserted new thermostat", "id", compID, "new_values", t, "query", q)
+		return nil
+	}
+	Log.Debug("updated existing thermostat", "id", compID, "new_values", t, "query", q)
+	return nil
+}
+
+func (thermostatStorage) Delete(tx types.StorageTx, compID int64) error {
+	if _, err := tx.Exec("DELETE FROM thermostat_state WHERE id=?", compID); err != nil {
+		return fmt.Errorf("error deleteing from thermostat_state: %v", err)
+	}
+	return nil
+}
+
+func (thermostatStorage) GetSpecs(tx types.StorageTx, c types.Component) (types.Component, error) {
+	t, ok := c.(types.Thermostat)
+	if !ok {
+		return nil, fmt.Errorf("expected types.Thermostat, got %T", c)
+	}
+	specs := types.ThermostatSpecs{}
+	q := `SELECT supported_modes, min_setpoint_in_celsius, max_setpoint_in_celsius
+		FROM thermostat_spec
+		WHERE make=? AND model=?
+		LIMIT 1`
+	if err := tx.Get(&specs, q, t.Make, t.Model); err == sql.ErrNoRows {
+		return t, nil // no specs are known for this make and model
+	} else if err != nil {
+		return nil, fmt.Errorf("error querying for thermostat spec: %v", err)
+	}
+	t.Specs = &specs
+	return t, nil
+}
+
+func (thermostatStorage) UpsertSpecs(tx types.StorageTx, make, model string, raw json.RawMessage) error {
+	var specs types.ThermostatSpecs
+	if err := json.Unmarshal(raw, &specs); err != nil {
+		return fmt.Errorf("could not decode thermostat specs: %v", err)
+	}
+	return upsertSpecsTx(tx, "thermostat_spec", make, model,
+		[]string{"supported_modes", "min_setpoint_in_celsius", "max_setpoint_in_celsius"},
+		[]interface{}{specs.SupportedModes, specs.MinSetpointInCelsius, specs.MaxSetpointInCelsius})
+}
+
+func (thermostatStorage) ListSpecs(tx types.StorageTx) ([]types.ModelSpecs, error) {
+	rows := []struct {
+		Make, Model string
+		types.ThermostatSpecs
+	}{}
+	if err := tx.Select(&rows, "SELECT * FROM thermostat_spec ORDER BY make, model"); err != nil {
+		return nil, fmt.Errorf("error listing thermostat specs: %v", err)
+	}
+	list := make([]types.ModelSpecs, 0, len(rows))
+	for _, row := range rows {
+		ms, err := toModelSpecs(row.Make, row.Model, row.ThermostatSpecs)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, ms)
+	}
+	return list, nil
+}
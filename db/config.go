@@ -0,0 +1,88 @@
+package db
+
+import (
+	"fmt"
+)
+
+// SetAdapterConfig sets a configuration value for the named Adapter. Values
+// are stored as strings; checking them against the fields declared by the
+// Adapter's factory is left to the caller (see sift.Server.SetAdapterConfig).
+// Configuration values are not encrypted, so secrets should be stored with
+// UpsertAdapterCredential instead.
+func (sdb *SiftDB) SetAdapterConfig(adapterName, key, value string) (err error) {
+	// begin a database transaction
+	tx, err := sdb.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %v", err)
+	}
+	// If something bad happens, roll back the transaction
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				sdb.log.Error("could not roll back db transaction", "original_err", err, "rollback_err", rbErr)
+			}
+			sdb.log.Warn("rolled back db transaction", "original_err", err)
+		} else {
+			if cmErr := tx.Commit(); cmErr != nil {
+				sdb.log.Error("could not commit transaction", "commit_err", cmErr)
+				err = fmt.Errorf("could not commit transaction: %v", cmErr)
+			}
+			sdb.log.Debug("adapter config updated; transaction committed")
+		}
+	}()
+
+	err = setAdapterConfigTx(tx, adapterName, key, value)
+	return
+}
+
+func setAdapterConfigTx(tx siftTx, adapterName, key, value string) error {
+	// Try updating the Adapter config
+	q := "UPDATE adapter_config SET value=? WHERE adapter_name=? AND key=?"
+	res, err := tx.Exec(q, value, adapterName, key)
+	if err != nil {
+		return fmt.Errorf("error updating adapter_config: %v", err)
+	}
+
+	// Check the number of rows affected by the update; should be 1 if the
+	// row existed, and 0 if not
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("error getting row count (required for update): %v", err)
+	} else if n == 0 {
+		// The update failed, do an insert instead
+		q = "INSERT INTO adapter_config (adapter_name, key, value) VALUES (?, ?, ?)"
+		if _, err := tx.Exec(q, adapterName, key, value); err != nil {
+			return fmt.Errorf("error inserting adapter config: %v", err)
+		}
+	}
+	return nil
+}
+
+// GetAdapterConfig returns every configuration value set for the named
+// Adapter, indexed by key. If none have been set, the map is empty.
+func (sdb *SiftDB) GetAdapterConfig(adapterName string) (map[string]string, error) {
+	rows := []ExportedConfig{}
+	q := "SELECT adapter_name, key, value FROM adapter_config WHERE adapter_name=?"
+	if err := sdb.db.Select(&rows, q, adapterName); err != nil {
+		return nil, fmt.Errorf("could not get config for %v: %v", adapterName, err)
+	}
+	config := make(map[string]string, len(rows))
+	for _, row := range rows {
+		config[row.Key] = row.Value
+	}
+	return config, nil
+}
+
+// DeleteAdapterConfig deletes the configuration value set for the named
+// Adapter with the given key, so that the field's default is used instead
+func (sdb *SiftDB) DeleteAdapterConfig(adapterName, key string) error {
+	res, err := sdb.db.Exec("DELETE FROM adapter_config WHERE adapter_name=? AND key=?", adapterName, key)
+	if err != nil {
+		return fmt.Errorf("could not delete config %v for %v: %v", key, adapterName, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("error getting row count: %v", err)
+	} else if n == 0 {
+		return fmt.Errorf("no config %v set for %v", key, adapterName)
+	}
+	return nil
+}
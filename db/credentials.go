@@ -0,0 +1,178 @@
+package db
+
+import (
+	"fmt"
+)
+
+// UpsertAdapterCredential stores a value for the named Adapter, retrievable
+// with the given key. Adapters with different names are segregated from
+// eachother. If a credential key has been set (see SetCredentialKeys), the
+// value is encrypted before it is stored.
+func (sdb *SiftDB) UpsertAdapterCredential(adapterName, key, value string) (err error) {
+	stored, err := sdb.creds.encrypt(adapterName, key, value)
+	if err != nil {
+		return fmt.Errorf("could not encrypt credential: %v", err)
+	}
+
+	// begin a database transaction
+	tx, err := sdb.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %v", err)
+	}
+	// If something bad happens, roll back the transaction
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				sdb.log.Error("could not roll back db transaction", "original_err", err, "rollback_err", rbErr)
+			}
+			sdb.log.Warn("rolled back db transaction", "original_err", err)
+		} else {
+			if cmErr := tx.Commit(); cmErr != nil {
+				sdb.log.Error("could not commit transaction", "commit_err", cmErr)
+				err = fmt.Errorf("could not commit transaction: %v", cmErr)
+			}
+			sdb.log.Debug("adapter credentials updated; transaction committed")
+		}
+	}()
+
+	err = upsertAdapterCredentialTx(tx, adapterName, key, stored)
+	return
+}
+
+func upsertAdapterCredentialTx(tx siftTx, adapterName, key, value string) error {
+	// Try updating the Adapter Credentials
+	q := "UPDATE adapter_credential SET value=? WHERE adapter_name=? AND key=?"
+	res, err := tx.Exec(q, value, adapterName, key)
+	if err != nil {
+		return fmt.Errorf("error updating adapter_credentials: %v", err)
+	}
+
+	// Check the number of rows affected by the update; should be 1 if the
+	// row existed, and 0 if not
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("error getting row count (required for update): %v", err)
+	} else if n == 0 {
+		// The update failed, do an insert instead
+		q = "INSERT INTO adapter_credential (adapter_name, key, value) VALUES (?, ?, ?)"
+		if _, err := tx.Exec(q, adapterName, key, value); err != nil {
+			return fmt.Errorf("error inserting adapter credentials: %v", err)
+		}
+	}
+	return nil
+}
+
+// GetAdapterCredential retrieves the value stored for the named Adapter with
+// the given key.
+func (sdb *SiftDB) GetAdapterCredential(adapterName, key string) (string, error) {
+	var stored string
+	q := "SELECT value FROM adapter_credential WHERE adapter_name=? AND key=?"
+	if err := sdb.db.Get(&stored, q, adapterName, key); err != nil {
+		return "", fmt.Errorf("could not get credentials from database: %v", err)
+	}
+	return sdb.creds.decrypt(adapterName, key, stored)
+}
+
+// ListAdapterCredentials returns the keys of the credentials stored for the
+// named Adapter, in sorted order. Values are not returned.
+func (sdb *SiftDB) ListAdapterCredentials(adapterName string) ([]string, error) {
+	keys := []string{}
+	q := "SELECT key FROM adapter_credential WHERE adapter_name=? ORDER BY key"
+	if err := sdb.db.Select(&keys, q, adapterName); err != nil {
+		return nil, fmt.Errorf("could not list credentials for %v: %v", adapterName, err)
+	}
+	return keys, nil
+}
+
+// RevokeAdapterCredential deletes the credential stored for the named Adapter
+// with the given key
+func (sdb *SiftDB) RevokeAdapterCredential(adapterName, key string) error {
+	res, err := sdb.db.Exec("DELETE FROM adapter_credential WHERE adapter_name=? AND key=?", adapterName, key)
+	if err != nil {
+		return fmt.Errorf("could not revoke credential %v for %v: %v", key, adapterName, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("error getting row count: %v", err)
+	} else if n == 0 {
+		return fmt.Errorf("no credential %v stored for %v", key, adapterName)
+	}
+	sdb.log.Info("revoked adapter credential", "adapter_name", adapterName, "key", key)
+	return nil
+}
+
+// RevokeAdapterCredentials deletes every credential stored for the named
+// Adapter, returning the number deleted
+func (sdb *SiftDB) RevokeAdapterCredentials(adapterName string) (int, error) {
+	res, err := sdb.db.Exec("DELETE FROM adapter_credential WHERE adapter_name=?", adapterName)
+	if err != nil {
+		return 0, fmt.Errorf("could not revoke credentials for %v: %v", adapterName, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error getting row count: %v", err)
+	}
+	sdb.log.Info("revoked adapter credentials", "adapter_name", adapterName, "num_revoked", n)
+	return int(n), nil
+}
+
+// SetCredentialKeys sets the keys used to encrypt Adapter credentials. The
+// first key encrypts new values; every key may be used to decrypt existing
+// ones. Keys are read from the CredentialKeyEnv environment variable when the
+// database is opened, so most callers do not need SetCredentialKeys.
+func (sdb *SiftDB) SetCredentialKeys(keys ...CredentialKey) error {
+	return sdb.creds.setKeys(keys)
+}
+
+// RotateCredentials re-encrypts every stored credential with the first
+// credential key, including any stored before encryption was enabled. Once it
+// returns, older keys are no longer needed. The number of credentials
+// re-encrypted is returned.
+func (sdb *SiftDB) RotateCredentials() (n int, err error) {
+	if !sdb.creds.hasKey() {
+		return 0, fmt.Errorf("no credential key has been set")
+	}
+	// begin a database transaction
+	tx, err := sdb.db.Beginx()
+	if err != nil {
+		return 0, fmt.Errorf("could not begin transaction: %v", err)
+	}
+	// If something bad happens, roll back the transaction
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				sdb.log.Error("could not roll back db transaction", "original_err", err, "rollback_err", rbErr)
+			}
+			sdb.log.Warn("rolled back db transaction", "original_err", err)
+		} else {
+			if cmErr := tx.Commit(); cmErr != nil {
+				sdb.log.Error("could not commit transaction", "commit_err", cmErr)
+				err = fmt.Errorf("could not commit transaction: %v", cmErr)
+			}
+			sdb.log.Info("adapter credentials rotated; transaction committed", "num_rotated", n)
+		}
+	}()
+
+	creds := []ExportedCredential{}
+	q := "SELECT adapter_name, key, COALESCE(value, '') AS value FROM adapter_credential"
+	if err = tx.Select(&creds, q); err != nil {
+		err = fmt.Errorf("could not get adapter credentials: %v", err)
+		return
+	}
+	for _, cred := range creds {
+		var value, stored string
+		if value, err = sdb.creds.decrypt(cred.AdapterName, cred.Key, cred.Value); err != nil {
+			err = fmt.Errorf("could not decrypt credential %v for %v: %v", cred.Key, cred.AdapterName, err)
+			return
+		}
+		if stored, err = sdb.creds.encrypt(cred.AdapterName, cred.Key, value); err != nil {
+			err = fmt.Errorf("could not encrypt credential: %v", err)
+			return
+		}
+		q = "UPDATE adapter_credential SET value=? WHERE adapter_name=? AND key=?"
+		if _, err = tx.Exec(q, stored, cred.AdapterName, cred.Key); err != nil {
+			err = fmt.Errorf("could not update credential %v for %v: %v", cred.Key, cred.AdapterName, err)
+			return
+		}
+		n++
+	}
+	return
+}
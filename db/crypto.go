@@ -0,0 +1,154 @@
+package db
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// CredentialKeyEnv is the environment variable from which Open reads the keys
+// used to encrypt Adapter credentials. It holds one or more comma-separated
+// keys in the form "id:base64-encoded key". The first key is used to encrypt
+// new values; the rest are only used to decrypt values written before a key
+// rotation (see RotateCredentials). For example:
+//
+//	SIFT_CREDENTIAL_KEY="2016b:c2VjcmV0...,2016a:b2xkIHNl..."
+const CredentialKeyEnv = "SIFT_CREDENTIAL_KEY"
+
+// A CredentialKey is an AES key used to encrypt Adapter credentials at rest.
+// Its ID is stored with each value it encrypts, so that the right key can be
+// found after the keys are rotated.
+type CredentialKey struct {
+	ID  string
+	Key []byte // 16, 24 or 32 bytes, to use AES-128, AES-192 or AES-256
+}
+
+// ParseCredentialKeys parses keys in the format used by CredentialKeyEnv
+func ParseCredentialKeys(s string) ([]CredentialKey, error) {
+	keys := []CredentialKey{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		i := strings.Index(part, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("credential key must have the form id:base64-encoded key")
+		}
+		key, err := base64.StdEncoding.DecodeString(part[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("could not decode credential key %v: %v", part[:i], err)
+		}
+		keys = append(keys, CredentialKey{ID: part[:i], Key: key})
+	}
+	return keys, nil
+}
+
+// encrypted values are stored as encryptedPrefix + key ID + ":" + base64(nonce
+// + ciphertext). Values without the prefix were stored before encryption was
+// enabled, and are read as plaintext.
+const encryptedPrefix = "enc:v1:"
+
+// a credentialCipher encrypts and decrypts Adapter credentials
+type credentialCipher struct {
+	mu      sync.RWMutex
+	primary string                 // ID of the key used to encrypt new values
+	aeads   map[string]cipher.AEAD // indexed by key ID
+}
+
+// setKeys replaces the keys used by the cipher. The first key is used to
+// encrypt new values. If no keys are given, new values are not encrypted.
+func (cc *credentialCipher) setKeys(keys []CredentialKey) error {
+	aeads := make(map[string]cipher.AEAD, len(keys))
+	for _, k := range keys {
+		if k.ID == "" || strings.ContainsAny(k.ID, ":,") {
+			return fmt.Errorf("invalid credential key ID %q", k.ID)
+		}
+		if _, dup := aeads[k.ID]; dup {
+			return fmt.Errorf("duplicate credential key ID %v", k.ID)
+		}
+		block, err := aes.NewCipher(k.Key)
+		if err != nil {
+			return fmt.Errorf("invalid credential key %v: %v", k.ID, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return fmt.Errorf("invalid credential key %v: %v", k.ID, err)
+		}
+		aeads[k.ID] = aead
+	}
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.aeads = aeads
+	cc.primary = ""
+	if len(keys) > 0 {
+		cc.primary = keys[0].ID
+	}
+	return nil
+}
+
+func (cc *credentialCipher) hasKey() bool {
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+	return cc.primary != ""
+}
+
+// encrypt encrypts a credential with the primary key. The adapter name and
+// key are authenticated along with the value, so an encrypted value cannot be
+// moved to another credential. If there is no primary key, the value is
+// returned unchanged.
+func (cc *credentialCipher) encrypt(adapterName, key, value string) (string, error) {
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+	if cc.primary == "" {
+		return value, nil
+	}
+	aead := cc.aeads[cc.primary]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("could not generate nonce: %v", err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), credentialAD(adapterName, key))
+	return encryptedPrefix + cc.primary + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt returns the plaintext of a stored credential
+func (cc *credentialCipher) decrypt(adapterName, key, stored string) (string, error) {
+	if !strings.HasPrefix(stored, encryptedPrefix) {
+		return stored, nil // stored before encryption was enabled
+	}
+	rest := stored[len(encryptedPrefix):]
+	i := strings.Index(rest, ":")
+	if i < 0 {
+		return "", fmt.Errorf("malformed encrypted credential")
+	}
+	keyID := rest[:i]
+
+	cc.mu.RLock()
+	aead, ok := cc.aeads[keyID]
+	cc.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("credential was encrypted with unknown key %v", keyID)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(rest[i+1:])
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted credential")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, credentialAD(adapterName, key))
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt credential with key %v: %v", keyID, err)
+	}
+	return string(plaintext), nil
+}
+
+// credentialAD returns the additional data authenticated with a credential
+func credentialAD(adapterName, key string) []byte {
+	return []byte(adapterName + "\x00" + key)
+}
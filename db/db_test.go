@@ -1,8 +1,15 @@
 package db
 
 import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
 	"github.com/upwrd/sift/types"
 	. "gopkg.in/check.v1"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 
@@ -150,6 +157,41 @@ func upsertAndGetTests() []insertAndGetTest {
 				},
 			},
 		},
+		// Should succeed with switches and thermostats
+		{
+			id: types.ExternalDeviceID{
+				Manufacturer: "upward",
+				ID:           "c0ffee",
+			},
+			device: types.Device{
+				Name:     "hallway",
+				IsOnline: true,
+				Components: map[string]types.Component{
+					"outlet": types.Switch{
+						BaseComponent: types.BaseComponent{
+							Make:  "example",
+							Model: "outlet_1",
+						},
+						State: types.SwitchState{
+							IsOn:             true,
+							PowerDrawInWatts: 60.5,
+						},
+					},
+					"thermostat": types.Thermostat{
+						BaseComponent: types.BaseComponent{
+							Make:  "example",
+							Model: "thermostat_1",
+						},
+						State: types.ThermostatState{
+							Mode:                  types.ThermostatModeHeat,
+							CurrentTempInCelsius:  19.5,
+							HeatSetpointInCelsius: 21,
+							CoolSetpointInCelsius: 25,
+						},
+					},
+				},
+			},
+		},
 	}
 }
 
@@ -201,6 +243,350 @@ func (s *DBTestSuite) TestInsertAndGetStress(c *C) {
 	wg.Wait()
 }
 
+func (s *DBTestSuite) TestConcurrentUpserts(c *C) {
+	db, err := Open("")
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	// Many goroutines share the SiftDB's connection pool; none of them should
+	// fail because the database is locked
+	const numWriters = 20
+	errs := make(chan error, numWriters)
+	wg := sync.WaitGroup{}
+	wg.Add(numWriters)
+	for i := 0; i < numWriters; i++ {
+		go func(i int) {
+			defer wg.Done()
+			dev := types.Device{
+				Name:     "light",
+				IsOnline: true,
+				Components: map[string]types.Component{
+					"bulb": types.LightEmitter{
+						BaseComponent: types.BaseComponent{Make: "example", Model: "light_emitter_1"},
+						State:         types.LightEmitterState{BrightnessInPercent: uint8(i)},
+					},
+				},
+			}
+			_, err := db.UpsertDevice(types.ExternalDeviceID{Manufacturer: "example", ID: fmt.Sprintf("%v", i)}, dev)
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		c.Assert(err, IsNil)
+	}
+
+	devs, err := db.GetDevices(ExpandNone)
+	c.Assert(err, IsNil)
+	c.Assert(len(devs), Equals, numWriters)
+}
+
+func (s *DBTestSuite) TestUpsertChanges(c *C) {
+	db, err := Open("")
+	c.Assert(err, IsNil)
+	defer db.Close()
+	testUpsertChanges(c, db)
+}
+
+func testUpsertChanges(c *C, db Store) {
+	extID := types.ExternalDeviceID{Manufacturer: "example", ID: "changes"}
+	bulb := types.LightEmitter{
+		BaseComponent: types.BaseComponent{Make: "example", Model: "light_emitter_1"},
+		State:         types.LightEmitterState{BrightnessInPercent: 100},
+	}
+	dev := types.Device{
+		Name:       "lamp",
+		IsOnline:   true,
+		Components: map[string]types.Component{"bulb": bulb},
+	}
+	resp, err := db.UpsertDevice(extID, dev)
+	c.Assert(err, IsNil)
+	c.Assert(len(resp.UpsertedComponents), Equals, 1)
+	c.Assert(resp.HasDeviceChanged, Equals, true)
+	c.Assert(resp.ComponentChanges, DeepEquals, map[string][]types.FieldChange{}) // the bulb is new
+
+	// upserting the same device again changes nothing
+	resp, err = db.UpsertDevice(extID, dev)
+	c.Assert(err, IsNil)
+	c.Assert(len(resp.UpsertedComponents), Equals, 0)
+	c.Assert(len(resp.DeletedComponents), Equals, 0)
+	c.Assert(resp.HasDeviceChanged, Equals, false)
+
+	// changes within a component are described field-by-field
+	bulb.State.BrightnessInPercent = 10
+	dev.Components["bulb"] = bulb
+	dev.Components["switch"] = types.Switch{State: types.SwitchState{IsOn: true}}
+	resp, err = db.UpsertDevice(extID, dev)
+	c.Assert(err, IsNil)
+	c.Assert(len(resp.UpsertedComponents), Equals, 2)
+	c.Assert(resp.HasDeviceChanged, Equals, false)
+	c.Assert(resp.ComponentChanges, DeepEquals, map[string][]types.FieldChange{
+		"bulb": {{Field: "State.BrightnessInPercent", Old: uint8(100), New: uint8(10)}},
+	})
+}
+
+func (s *DBTestSuite) TestAdapterCredentials(c *C) {
+	db, err := Open("")
+	c.Assert(err, IsNil)
+	defer db.Close()
+	testAdapterCredentials(c, db)
+}
+
+func testAdapterCredentials(c *C, db Store) {
+	_, err := db.GetAdapterCredential("chromecast", "token")
+	c.Assert(err, NotNil)
+
+	c.Assert(db.UpsertAdapterCredential("chromecast", "token", "abc"), IsNil)
+	c.Assert(db.UpsertAdapterCredential("chromecast", "token", "def"), IsNil)
+	c.Assert(db.UpsertAdapterCredential("hue", "token", "xyz"), IsNil)
+
+	value, err := db.GetAdapterCredential("chromecast", "token")
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, "def")
+	value, err = db.GetAdapterCredential("hue", "token")
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, "xyz")
+
+	// credentials can be listed and revoked per adapter
+	c.Assert(db.UpsertAdapterCredential("chromecast", "id", "123"), IsNil)
+	keys, err := db.ListAdapterCredentials("chromecast")
+	c.Assert(err, IsNil)
+	c.Assert(keys, DeepEquals, []string{"id", "token"})
+	c.Assert(db.RevokeAdapterCredential("chromecast", "token"), IsNil)
+	c.Assert(db.RevokeAdapterCredential("chromecast", "token"), NotNil)
+	_, err = db.GetAdapterCredential("chromecast", "token")
+	c.Assert(err, NotNil)
+	n, err := db.RevokeAdapterCredentials("chromecast")
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+	keys, err = db.ListAdapterCredentials("chromecast")
+	c.Assert(err, IsNil)
+	c.Assert(keys, DeepEquals, []string{})
+	value, err = db.GetAdapterCredential("hue", "token")
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, "xyz")
+}
+
+func (s *DBTestSuite) TestDeviceIdentity(c *C) {
+	db, err := Open("")
+	c.Assert(err, IsNil)
+	defer db.Close()
+	testDeviceIdentity(c, db)
+}
+
+func testDeviceIdentity(c *C, db Store) {
+	hubID := types.ExternalDeviceID{Manufacturer: "hub", ID: "bulb-7"}
+	lanID := types.ExternalDeviceID{Manufacturer: "example", ID: "10.0.0.7"}
+	otherID := types.ExternalDeviceID{Manufacturer: "example", ID: "10.0.0.8"}
+	bulb := types.LightEmitter{State: types.LightEmitterState{BrightnessInPercent: 50}}
+
+	hubResp, err := db.UpsertDevice(hubID, types.Device{
+		Name:        "hub bulb",
+		Components:  map[string]types.Component{"bulb": bulb},
+		Identifiers: map[string]string{types.IdentifierMAC: "AA:BB:CC:00:11:22"},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(db.SetDeviceMetadata(hubResp.DeviceID, types.Metadata{DisplayName: "Porch"}), IsNil)
+
+	// without merge rules, a device reported under a different external ID
+	// is a different device, even if it shares a MAC address
+	lanResp, err := db.UpsertDevice(lanID, types.Device{
+		Name:        "lan bulb",
+		IsOnline:    true,
+		Components:  map[string]types.Component{"power": types.Switch{}},
+		Identifiers: map[string]string{types.IdentifierMAC: "aa-bb-cc-00-11-22"},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(lanResp.DeviceID, Not(Equals), hubResp.DeviceID)
+
+	// merge manually
+	c.Assert(db.MergeDevices(hubResp.DeviceID, hubResp.DeviceID), NotNil)
+	c.Assert(db.MergeDevices(hubResp.DeviceID, lanResp.DeviceID), IsNil)
+	id, err := db.ResolveExternalDeviceID(lanID)
+	c.Assert(err, IsNil)
+	c.Assert(id, Equals, hubResp.DeviceID)
+	extID, err := db.GetExternalDeviceID(hubResp.DeviceID)
+	c.Assert(err, IsNil)
+	c.Assert(extID, Equals, hubID) // the surviving device keeps its own ID
+	aliases, err := db.GetDeviceAliases(hubResp.DeviceID)
+	c.Assert(err, IsNil)
+	c.Assert(aliases, DeepEquals, []types.ExternalDeviceID{lanID})
+	_, err = db.GetDevice(lanResp.DeviceID, ExpandNone)
+	c.Assert(err, NotNil)
+
+	// the merged device combines both, preferring what 'into' already had
+	dev, err := db.GetDevice(hubResp.DeviceID, ExpandNone)
+	c.Assert(err, IsNil)
+	c.Assert(dev.Name, Equals, "hub bulb")
+	c.Assert(dev.IsOnline, Equals, true)
+	c.Assert(len(dev.Components), Equals, 2)
+	c.Assert(dev.Identifiers, DeepEquals, map[string]string{types.IdentifierMAC: "aa:bb:cc:00:11:22"})
+	md, err := db.GetDeviceMetadata(hubResp.DeviceID)
+	c.Assert(err, IsNil)
+	c.Assert(md.DisplayName, Equals, "Porch")
+
+	// updates under the alias now update the merged device
+	resp, err := db.UpsertDevice(lanID, types.Device{Name: "renamed", IsOnline: true})
+	c.Assert(err, IsNil)
+	c.Assert(resp.DeviceID, Equals, hubResp.DeviceID)
+
+	// with a merge rule, devices sharing a MAC address are merged as soon as
+	// they are reported
+	db.SetMergeIdentifiers(types.IdentifierMAC)
+	resp, err = db.UpsertDevice(otherID, types.Device{
+		Name:        "same bulb",
+		Identifiers: map[string]string{types.IdentifierMAC: "AA:BB:CC:00:11:22"},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(resp.DeviceID, Equals, hubResp.DeviceID)
+	aliases, err = db.GetDeviceAliases(hubResp.DeviceID)
+	c.Assert(err, IsNil)
+	c.Assert(aliases, DeepEquals, []types.ExternalDeviceID{lanID, otherID})
+
+	// aliases can be removed, after which the external ID is unknown; the
+	// primary external ID is not an alias
+	c.Assert(db.RemoveDeviceAlias(hubID), NotNil)
+	c.Assert(db.RemoveDeviceAlias(lanID), IsNil)
+	_, err = db.ResolveExternalDeviceID(lanID)
+	c.Assert(err, NotNil)
+	c.Assert(db.RemoveDeviceAlias(lanID), NotNil)
+}
+
+func (s *DBTestSuite) TestAdapterConfig(c *C) {
+	db, err := Open("")
+	c.Assert(err, IsNil)
+	defer db.Close()
+	testAdapterConfig(c, db)
+}
+
+func testAdapterConfig(c *C, db Store) {
+	config, err := db.GetAdapterConfig("SIFT example")
+	c.Assert(err, IsNil)
+	c.Assert(config, DeepEquals, map[string]string{})
+
+	c.Assert(db.SetAdapterConfig("SIFT example", "port", "8080"), IsNil)
+	c.Assert(db.SetAdapterConfig("SIFT example", "port", "8081"), IsNil)
+	c.Assert(db.SetAdapterConfig("SIFT example", "host", "example.local"), IsNil)
+	c.Assert(db.SetAdapterConfig("hue", "port", "80"), IsNil)
+	c.Assert(db.SetAdapterConfig("", "port", "80"), NotNil)
+
+	config, err = db.GetAdapterConfig("SIFT example")
+	c.Assert(err, IsNil)
+	c.Assert(config, DeepEquals, map[string]string{"port": "8081", "host": "example.local"})
+
+	c.Assert(db.DeleteAdapterConfig("SIFT example", "port"), IsNil)
+	c.Assert(db.DeleteAdapterConfig("SIFT example", "port"), NotNil)
+	config, err = db.GetAdapterConfig("SIFT example")
+	c.Assert(err, IsNil)
+	c.Assert(config, DeepEquals, map[string]string{"host": "example.local"})
+	config, err = db.GetAdapterConfig("hue")
+	c.Assert(err, IsNil)
+	c.Assert(config, DeepEquals, map[string]string{"port": "80"})
+}
+
+func (s *DBTestSuite) TestStaticServices(c *C) {
+	db, err := Open("")
+	c.Assert(err, IsNil)
+	defer db.Close()
+	testStaticServices(c, db)
+}
+
+func testStaticServices(c *C, db Store) {
+	svcs, err := db.GetStaticServices()
+	c.Assert(err, IsNil)
+	c.Assert(svcs, DeepEquals, []StaticService{})
+
+	exampleID, err := db.AddStaticService("SIFT example", "10.0.0.5", 8080)
+	c.Assert(err, IsNil)
+	hueID, err := db.AddStaticService("hue", "10.0.0.12", 0)
+	c.Assert(err, IsNil)
+	_, err = db.AddStaticService("SIFT example", "10.0.0.5", 8080) // already registered
+	c.Assert(err, NotNil)
+	_, err = db.AddStaticService("SIFT example", "10.0.0.5", 8081) // a different port is a different service
+	c.Assert(err, IsNil)
+	_, err = db.AddStaticService("", "10.0.0.5", 8080)
+	c.Assert(err, NotNil)
+	_, err = db.AddStaticService("SIFT example", "example.local", 8080)
+	c.Assert(err, NotNil)
+	_, err = db.AddStaticService("SIFT example", "fe80::1", 8080)
+	c.Assert(err, NotNil)
+
+	svcs, err = db.GetStaticServices()
+	c.Assert(err, IsNil)
+	c.Assert(len(svcs), Equals, 3)
+	c.Assert(svcs[0], DeepEquals, StaticService{ID: exampleID, FactoryName: "SIFT example", IP: "10.0.0.5", Port: 8080})
+	c.Assert(svcs[1], DeepEquals, StaticService{ID: hueID, FactoryName: "hue", IP: "10.0.0.12"})
+
+	c.Assert(db.DeleteStaticService(exampleID), IsNil)
+	c.Assert(db.DeleteStaticService(exampleID), NotNil)
+	svcs, err = db.GetStaticServices()
+	c.Assert(err, IsNil)
+	c.Assert(len(svcs), Equals, 2)
+	c.Assert(svcs[0].ID, Equals, hueID)
+}
+
+func (s *DBTestSuite) TestEncryptedCredentials(c *C) {
+	oldKey := CredentialKey{ID: "old", Key: bytes.Repeat([]byte{1}, 32)}
+	newKey := CredentialKey{ID: "new", Key: bytes.Repeat([]byte{2}, 16)}
+	os.Setenv(CredentialKeyEnv, "old:"+base64.StdEncoding.EncodeToString(oldKey.Key))
+	db, err := Open("")
+	os.Unsetenv(CredentialKeyEnv)
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	storedValue := func(adapterName, key string) string {
+		var stored string
+		err := db.db.Get(&stored, "SELECT value FROM adapter_credential WHERE adapter_name=? AND key=?", adapterName, key)
+		c.Assert(err, IsNil)
+		return stored
+	}
+
+	// values are encrypted at rest
+	c.Assert(db.UpsertAdapterCredential("hue", "token", "secret"), IsNil)
+	c.Assert(storedValue("hue", "token"), Not(Matches), ".*secret.*")
+	value, err := db.GetAdapterCredential("hue", "token")
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, "secret")
+
+	// encrypted values cannot be moved to another credential
+	_, err = db.db.Exec("INSERT INTO adapter_credential (adapter_name, key, value) VALUES (?, ?, ?)", "evil", "token", storedValue("hue", "token"))
+	c.Assert(err, IsNil)
+	_, err = db.GetAdapterCredential("evil", "token")
+	c.Assert(err, NotNil)
+	c.Assert(db.RevokeAdapterCredential("evil", "token"), IsNil)
+
+	// values stored before encryption was enabled are still readable
+	_, err = db.db.Exec("INSERT INTO adapter_credential (adapter_name, key, value) VALUES (?, ?, ?)", "chromecast", "token", "plain")
+	c.Assert(err, IsNil)
+	value, err = db.GetAdapterCredential("chromecast", "token")
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, "plain")
+
+	// after rotation, only the new key is needed
+	c.Assert(db.SetCredentialKeys(newKey, oldKey), IsNil)
+	n, err := db.RotateCredentials()
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+	c.Assert(storedValue("chromecast", "token"), Not(Equals), "plain")
+	c.Assert(db.SetCredentialKeys(newKey), IsNil)
+	for adapterName, expected := range map[string]string{"hue": "secret", "chromecast": "plain"} {
+		value, err = db.GetAdapterCredential(adapterName, "token")
+		c.Assert(err, IsNil)
+		c.Assert(value, Equals, expected)
+	}
+
+	// values cannot be read without their key
+	c.Assert(db.SetCredentialKeys(oldKey), IsNil)
+	_, err = db.GetAdapterCredential("hue", "token")
+	c.Assert(err, NotNil)
+
+	// invalid keys are rejected
+	c.Assert(db.SetCredentialKeys(CredentialKey{ID: "short", Key: []byte("abc")}), NotNil)
+	_, err = ParseCredentialKeys("no-separator")
+	c.Assert(err, NotNil)
+}
+
 func (s *DBTestSuite) TestGetComponents(c *C) {
 	// logging.SetLevelStr("debug")
 	db, err := Open("test.db") // "" indicates temporary file; replace with filename to inspect using sqlite
@@ -252,3 +638,490 @@ func (s *DBTestSuite) TestGetComponents(c *C) {
 	}
 	c.Assert(bulbv1, DeepEquals, bulbv1Expected)
 }
+
+// doorbell is a Component type defined outside of the types package, used to
+// test the component type registry
+type doorbell struct {
+	types.BaseComponent
+	State struct {
+		IsRinging bool `db:"is_ringing"`
+	}
+}
+
+func (d doorbell) Type() string          { return "test_doorbell" }
+func (d doorbell) GetTyped() interface{} { return d }
+
+type doorbellStorage struct{}
+
+func (doorbellStorage) Schema() string {
+	return `CREATE TABLE IF NOT EXISTS test_doorbell_state (
+		id INTEGER PRIMARY KEY,
+		is_ringing INTEGER NOT NULL
+	);`
+}
+
+func (doorbellStorage) Get(tx types.StorageTx, id int64, base types.BaseComponent) (types.Component, error) {
+	d := doorbell{BaseComponent: base}
+	err := tx.Get(&d.State, "SELECT is_ringing FROM test_doorbell_state WHERE id=?", id)
+	return d, err
+}
+
+func (doorbellStorage) Upsert(tx types.StorageTx, id int64, c types.Component) error {
+	_, err := tx.Exec("INSERT OR REPLACE INTO test_doorbell_state (id, is_ringing) VALUES (?, ?)", id, c.(doorbell).State.IsRinging)
+	return err
+}
+
+func (doorbellStorage) Delete(tx types.StorageTx, id int64) error {
+	_, err := tx.Exec("DELETE FROM test_doorbell_state WHERE id=?", id)
+	return err
+}
+
+func (doorbellStorage) GetSpecs(tx types.StorageTx, c types.Component) (types.Component, error) {
+	return c, nil
+}
+
+func init() {
+	if err := types.RegisterComponentType(types.ComponentType{
+		Name:    "test_doorbell",
+		New:     func() types.Component { return doorbell{} },
+		Storage: doorbellStorage{},
+	}); err != nil {
+		panic(err)
+	}
+}
+
+func (s *DBTestSuite) TestRegisteredComponentType(c *C) {
+	db, err := Open("")
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	ring := doorbell{BaseComponent: types.BaseComponent{Make: "acme", Model: "ding"}}
+	ring.State.IsRinging = true
+	dev := types.Device{
+		Name:       "front door",
+		IsOnline:   true,
+		Components: map[string]types.Component{"bell": ring},
+	}
+	id := types.ExternalDeviceID{Manufacturer: "acme", ID: "door1"}
+	resp, err := db.UpsertDevice(id, dev)
+	c.Assert(err, IsNil)
+
+	var fromDB types.Device
+	c.Assert(db.getDevice(&fromDB, resp.DeviceID, ExpandSpecs), IsNil)
+	c.Assert(fromDB, DeepEquals, dev)
+}
+
+func (s *DBTestSuite) TestLoadSpecCatalog(c *C) {
+	db, err := Open("")
+	c.Assert(err, IsNil)
+	defer db.Close()
+	testLoadSpecCatalog(c, db)
+}
+
+func testLoadSpecCatalog(c *C, db Store) {
+	catalog := `{
+		"media_player": [
+			{"make": "acme", "model": "tv_1", "specs": {"supported_audio_types": "mp3,aac"}}
+		],
+		"thermostat": [
+			{"make": "acme", "model": "stat_1", "specs": {"supported_modes": "OFF,HEAT", "min_setpoint_in_celsius": 5, "max_setpoint_in_celsius": 30}}
+		]
+	}`
+	n, err := db.LoadSpecCatalog(strings.NewReader(catalog))
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+
+	dev := types.Device{
+		Name:     "living room",
+		IsOnline: true,
+		Components: map[string]types.Component{
+			"tv":      types.MediaPlayer{BaseComponent: types.BaseComponent{Make: "acme", Model: "tv_1"}},
+			"stat":    types.Thermostat{BaseComponent: types.BaseComponent{Make: "acme", Model: "stat_1"}},
+			"unknown": types.MediaPlayer{BaseComponent: types.BaseComponent{Make: "acme", Model: "tv_2"}},
+		},
+	}
+	resp, err := db.UpsertDevice(types.ExternalDeviceID{Manufacturer: "acme", ID: "lr1"}, dev)
+	c.Assert(err, IsNil)
+
+	devs, err := db.GetDevices(ExpandSpecs)
+	c.Assert(err, IsNil)
+	fromDB, ok := devs[resp.DeviceID]
+	c.Assert(ok, Equals, true)
+	c.Assert(fromDB.Components["tv"].(types.MediaPlayer).Specs, DeepEquals, &types.MediaPlayerSpecs{SupportedAudioTypes: "mp3,aac"})
+	c.Assert(fromDB.Components["stat"].(types.Thermostat).Specs, DeepEquals,
+		&types.ThermostatSpecs{SupportedModes: "OFF,HEAT", MinSetpointInCelsius: 5, MaxSetpointInCelsius: 30})
+	// specs for unknown makes and models are left empty
+	c.Assert(fromDB.Components["unknown"].(types.MediaPlayer).Specs, IsNil)
+
+	// reloading replaces the existing specs
+	_, err = db.LoadSpecCatalog(strings.NewReader(`{"media_player": [{"make": "acme", "model": "tv_1", "specs": {"supported_video_types": "h264"}}]}`))
+	c.Assert(err, IsNil)
+	comp, err := db.GetComponent(types.ComponentID{DeviceID: resp.DeviceID, Name: "tv"}, ExpandSpecs)
+	c.Assert(err, IsNil)
+	c.Assert(comp.(types.MediaPlayer).Specs, DeepEquals, &types.MediaPlayerSpecs{SupportedVideoTypes: "h264"})
+
+	// catalogs for unknown types are rejected
+	_, err = db.LoadSpecCatalog(strings.NewReader(`{"flux_capacitor": [{"make": "doc", "model": "1", "specs": {}}]}`))
+	c.Assert(err, NotNil)
+}
+
+func (s *DBTestSuite) TestFindComponents(c *C) {
+	db, err := Open("")
+	c.Assert(err, IsNil)
+	defer db.Close()
+	testFindComponents(c, db)
+}
+
+func testFindComponents(c *C, db Store) {
+	player := func(state string) types.MediaPlayer {
+		return types.MediaPlayer{
+			BaseComponent: types.BaseComponent{Make: "Google", Model: "Chromecast"},
+			State:         types.MediaPlayerState{PlayState: state},
+		}
+	}
+	light := types.LightEmitter{BaseComponent: types.BaseComponent{Make: "example", Model: "light_emitter_1"}}
+	devices := map[string]types.Device{
+		"den_tv":     {IsOnline: true, Components: map[string]types.Component{"player": player(types.MediaPlayerStatePlaying)}},
+		"den_light":  {IsOnline: true, Components: map[string]types.Component{"bulb": light}},
+		"hall_tv":    {IsOnline: false, Components: map[string]types.Component{"player": player(types.MediaPlayerStatePaused)}},
+		"hall_light": {IsOnline: true, Components: map[string]types.Component{"bulb": light}},
+	}
+	ids := map[string]types.DeviceID{}
+	compNames := map[types.DeviceID]string{}
+	for extID, dev := range devices {
+		resp, err := db.UpsertDevice(types.ExternalDeviceID{Manufacturer: "test", ID: extID}, dev)
+		c.Assert(err, IsNil)
+		ids[extID] = resp.DeviceID
+		for name := range dev.Components {
+			compNames[resp.DeviceID] = name
+		}
+	}
+
+	// put the devices into rooms on the same floor
+	floor, err := db.CreateLocation("first floor", 0)
+	c.Assert(err, IsNil)
+	rooms := map[string]types.LocationID{}
+	for _, room := range []string{"den", "hall"} {
+		rooms[room], err = db.CreateLocation(room, floor)
+		c.Assert(err, IsNil)
+		c.Assert(db.SetDeviceLocation(ids[room+"_tv"], rooms[room]), IsNil)
+		c.Assert(db.SetDeviceLocation(ids[room+"_light"], rooms[room]), IsNil)
+	}
+
+	tests := []struct {
+		query    Query
+		expected []types.DeviceID
+	}{
+		{Query{}, []types.DeviceID{ids["den_tv"], ids["den_light"], ids["hall_tv"], ids["hall_light"]}},
+		{Query{}.OfType(types.ComponentTypeMediaPlayer), []types.DeviceID{ids["den_tv"], ids["hall_tv"]}},
+		{Query{}.OfType(types.ComponentTypeMediaPlayer).Online(true), []types.DeviceID{ids["den_tv"]}},
+		{Query{}.InLocation(rooms["hall"]), []types.DeviceID{ids["hall_tv"], ids["hall_light"]}},
+		{Query{}.InLocation(floor).OfType(types.ComponentTypeLightEmitter), []types.DeviceID{ids["den_light"], ids["hall_light"]}},
+		{Query{}.InLocationOf(ids["den_light"]).OfType(types.ComponentTypeMediaPlayer), []types.DeviceID{ids["den_tv"]}},
+		{Query{}.WithMakeModel("example", ""), []types.DeviceID{ids["den_light"], ids["hall_light"]}},
+		{Query{}.OfType(types.ComponentTypeMediaPlayer).Where("play_state", "=", types.MediaPlayerStatePlaying), []types.DeviceID{ids["den_tv"]}},
+		{Query{}.OfType(types.ComponentTypeMediaPlayer).Where("play_state", "!=", types.MediaPlayerStatePlaying), []types.DeviceID{ids["hall_tv"]}},
+		{Query{}.InLocationOf(ids["hall_light"]).OfType(types.ComponentTypeMediaPlayer).Where("play_state", "=", types.MediaPlayerStatePlaying), nil},
+	}
+	for i, test := range tests {
+		comps, err := db.FindComponents(test.query, ExpandNone)
+		c.Assert(err, IsNil, Commentf("test %v", i))
+		c.Assert(len(comps), Equals, len(test.expected), Commentf("test %v: %v", i, comps))
+		for _, id := range test.expected {
+			_, ok := comps[types.ComponentID{DeviceID: id, Name: compNames[id]}]
+			c.Assert(ok, Equals, true, Commentf("test %v: device %v not found in %v", i, id, comps))
+		}
+		n, err := db.CountComponents(test.query)
+		c.Assert(err, IsNil)
+		c.Assert(n, Equals, len(test.expected))
+	}
+
+	// state predicates require a known type and field
+	for _, q := range []Query{
+		Query{}.Where("play_state", "=", "PLAYING"),
+		Query{}.OfType(types.ComponentTypeMediaPlayer).Where("volume; DROP TABLE device", "=", 1),
+		Query{}.OfType(types.ComponentTypeMediaPlayer).Where("play_state", "LIKE", "P%"),
+	} {
+		_, err := db.FindComponents(q, ExpandNone)
+		c.Assert(err, NotNil)
+	}
+}
+
+func (s *DBTestSuite) TestLocations(c *C) {
+	db, err := Open("")
+	c.Assert(err, IsNil)
+	defer db.Close()
+	testLocations(c, db)
+}
+
+func testLocations(c *C, db Store) {
+	house, err := db.CreateLocation("house", 0)
+	c.Assert(err, IsNil)
+	floor, err := db.CreateLocation("first floor", house)
+	c.Assert(err, IsNil)
+	den, err := db.CreateLocation("den", floor)
+	c.Assert(err, IsNil)
+	_, err = db.CreateLocation("", floor)
+	c.Assert(err, NotNil) // locations must have names
+	_, err = db.CreateLocation("attic", 1000)
+	c.Assert(err, NotNil) // the parent must exist
+
+	c.Assert(db.RenameLocation(den, "living room"), IsNil)
+	c.Assert(db.RenameLocation(1000, "nowhere"), NotNil)
+	loc, err := db.GetLocation(den)
+	c.Assert(err, IsNil)
+	c.Assert(loc, DeepEquals, types.Location{Name: "living room", ParentID: floor})
+
+	// locations cannot be moved within themselves
+	c.Assert(db.MoveLocation(house, den), NotNil)
+	c.Assert(db.MoveLocation(floor, floor), NotNil)
+	c.Assert(db.MoveLocation(den, house), IsNil)
+	c.Assert(db.MoveLocation(den, floor), IsNil)
+
+	resp, err := db.UpsertDevice(types.ExternalDeviceID{Manufacturer: "test", ID: "tv"}, types.Device{Name: "tv"})
+	c.Assert(err, IsNil)
+	c.Assert(db.SetDeviceLocation(resp.DeviceID, floor), IsNil)
+	c.Assert(db.SetDeviceLocation(1000, floor), NotNil)
+	lamp, err := db.UpsertDevice(types.ExternalDeviceID{Manufacturer: "test", ID: "lamp"}, types.Device{Name: "lamp"})
+	c.Assert(err, IsNil)
+	c.Assert(db.SetDeviceLocation(lamp.DeviceID, floor), IsNil)
+
+	// deleting the floor moves its devices and locations to the house; moved
+	// items are listed by ID
+	delResp, err := db.DeleteLocation(floor)
+	c.Assert(err, IsNil)
+	c.Assert(delResp.MovedDevices, DeepEquals, []types.DeviceID{resp.DeviceID, lamp.DeviceID})
+	c.Assert(delResp.MovedLocations, DeepEquals, []types.LocationID{den})
+	locID, err := db.GetDeviceLocation(resp.DeviceID)
+	c.Assert(err, IsNil)
+	c.Assert(locID, Equals, house)
+
+	locs, err := db.GetLocations()
+	c.Assert(err, IsNil)
+	c.Assert(locs, DeepEquals, map[types.LocationID]types.Location{
+		house: {Name: "house"},
+		den:   {Name: "living room", ParentID: house},
+	})
+
+	// deleting a top-level location leaves its devices without a location
+	_, err = db.DeleteLocation(house)
+	c.Assert(err, IsNil)
+	locID, err = db.GetDeviceLocation(resp.DeviceID)
+	c.Assert(err, IsNil)
+	c.Assert(locID, Equals, types.LocationID(0))
+	loc, err = db.GetLocation(den)
+	c.Assert(err, IsNil)
+	c.Assert(loc.ParentID, Equals, types.LocationID(0))
+}
+
+func (s *DBTestSuite) TestMigrateLocationParent(c *C) {
+	// create a database with the original, flat location table
+	file, err := ioutil.TempFile(os.TempDir(), "siftdb_")
+	c.Assert(err, IsNil)
+	defer os.Remove(file.Name())
+	db, err := Open(file.Name())
+	c.Assert(err, IsNil)
+	_, err = db.db.Exec(`ALTER TABLE location RENAME TO old_location;
+		CREATE TABLE location (id INTEGER PRIMARY KEY, name TEXT NOT NULL);
+		DROP TABLE old_location;`)
+	c.Assert(err, IsNil)
+	c.Assert(db.Close(), IsNil)
+
+	// reopening the database should add the parent_id column
+	db, err = Open(file.Name())
+	c.Assert(err, IsNil)
+	defer db.Close()
+	outer, err := db.CreateLocation("outer", 0)
+	c.Assert(err, IsNil)
+	inner, err := db.CreateLocation("inner", outer)
+	c.Assert(err, IsNil)
+	loc, err := db.GetLocation(inner)
+	c.Assert(err, IsNil)
+	c.Assert(loc.ParentID, Equals, outer)
+}
+
+func (s *DBTestSuite) TestMetadata(c *C) {
+	db, err := Open("")
+	c.Assert(err, IsNil)
+	defer db.Close()
+	testMetadata(c, db)
+}
+
+func testMetadata(c *C, db Store) {
+	extID := types.ExternalDeviceID{Manufacturer: "example", ID: "1"}
+	dev := types.Device{
+		Name:     "Light 1",
+		IsOnline: true,
+		Components: map[string]types.Component{
+			"bulb": types.LightEmitter{BaseComponent: types.BaseComponent{Make: "example", Model: "light_emitter_1"}},
+		},
+	}
+	resp, err := db.UpsertDevice(extID, dev)
+	c.Assert(err, IsNil)
+	compID := types.ComponentID{DeviceID: resp.DeviceID, Name: "bulb"}
+
+	// no metadata has been set
+	md, err := db.GetDeviceMetadata(resp.DeviceID)
+	c.Assert(err, IsNil)
+	c.Assert(md, DeepEquals, types.Metadata{})
+	fromDB, err := db.GetDevice(resp.DeviceID, ExpandMetadata)
+	c.Assert(err, IsNil)
+	c.Assert(fromDB.Metadata, IsNil)
+
+	devMD := types.Metadata{DisplayName: "Reading Lamp", Icon: "lamp", Tags: []string{"bedroom", "dimmable"}}
+	c.Assert(db.SetDeviceMetadata(resp.DeviceID, devMD), IsNil)
+	compMD := types.Metadata{Hidden: true}
+	c.Assert(db.SetComponentMetadata(compID, compMD), IsNil)
+
+	// adapter updates do not clobber the metadata
+	dev.Name = "Light 1 (renamed by adapter)"
+	_, err = db.UpsertDevice(extID, dev)
+	c.Assert(err, IsNil)
+
+	// metadata is merged in when requested...
+	fromDB, err = db.GetDevice(resp.DeviceID, ExpandMetadata)
+	c.Assert(err, IsNil)
+	c.Assert(fromDB.Name, Equals, "Reading Lamp")
+	c.Assert(fromDB.Metadata, DeepEquals, &devMD)
+	c.Assert(fromDB.Components["bulb"].GetBaseComponent().Metadata, DeepEquals, &compMD)
+
+	// ...and left out otherwise
+	fromDB, err = db.GetDevice(resp.DeviceID, ExpandNone)
+	c.Assert(err, IsNil)
+	c.Assert(fromDB, DeepEquals, dev)
+
+	// component metadata survives the component being removed and re-added
+	_, err = db.UpsertDevice(extID, types.Device{Name: dev.Name, IsOnline: true, Components: map[string]types.Component{}})
+	c.Assert(err, IsNil)
+	_, err = db.UpsertDevice(extID, dev)
+	c.Assert(err, IsNil)
+	md, err = db.GetComponentMetadata(compID)
+	c.Assert(err, IsNil)
+	c.Assert(md, DeepEquals, compMD)
+}
+
+func (s *DBTestSuite) TestExportImport(c *C) {
+	src, err := Open("")
+	c.Assert(err, IsNil)
+	defer src.Close()
+
+	extID := types.ExternalDeviceID{Manufacturer: "example", ID: "1"}
+	resp, err := src.UpsertDevice(extID, types.Device{
+		Name:     "Light 1",
+		IsOnline: true,
+		Components: map[string]types.Component{
+			"bulb": types.LightEmitter{BaseComponent: types.BaseComponent{Make: "example", Model: "light_emitter_1"}},
+		},
+	})
+	c.Assert(err, IsNil)
+	floor, err := src.CreateLocation("first floor", 0)
+	c.Assert(err, IsNil)
+	den, err := src.CreateLocation("den", floor)
+	c.Assert(err, IsNil)
+	c.Assert(src.SetDeviceLocation(resp.DeviceID, den), IsNil)
+	devMD := types.Metadata{DisplayName: "Reading Lamp", Tags: []string{"dimmable"}}
+	c.Assert(src.SetDeviceMetadata(resp.DeviceID, devMD), IsNil)
+	compMD := types.Metadata{Icon: "bulb"}
+	c.Assert(src.SetComponentMetadata(types.ComponentID{DeviceID: resp.DeviceID, Name: "bulb"}, compMD), IsNil)
+	aliasID := types.ExternalDeviceID{Manufacturer: "hue", ID: "light-1"}
+	aliasResp, err := src.UpsertDevice(aliasID, types.Device{Name: "Hue Light 1"})
+	c.Assert(err, IsNil)
+	c.Assert(src.MergeDevices(resp.DeviceID, aliasResp.DeviceID), IsNil)
+	c.Assert(src.UpsertAdapterCredential("hue", "token", "xyz"), IsNil)
+	c.Assert(src.SetAdapterConfig("hue", "poll_interval", "30s"), IsNil)
+	_, err = src.AddStaticService("hue", "10.0.0.12", 0)
+	c.Assert(err, IsNil)
+	_, err = src.LoadSpecCatalog(strings.NewReader(`{"switch": [{"make": "acme", "model": "plug_1", "specs": {"max_load_in_watts": 1800, "is_metered": true}}]}`))
+	c.Assert(err, IsNil)
+
+	var buf bytes.Buffer
+	c.Assert(src.Export(&buf), IsNil)
+	exported := buf.String()
+
+	// import into a database which already knows about a different device
+	dst, err := Open("")
+	c.Assert(err, IsNil)
+	defer dst.Close()
+	_, err = dst.UpsertDevice(types.ExternalDeviceID{Manufacturer: "example", ID: "2"}, types.Device{Name: "other"})
+	c.Assert(err, IsNil)
+	c.Assert(dst.Import(strings.NewReader(exported)), IsNil)
+	c.Assert(dst.Import(strings.NewReader(exported)), IsNil) // importing again changes nothing
+
+	devs, err := dst.GetDevices(ExpandMetadata)
+	c.Assert(err, IsNil)
+	c.Assert(len(devs), Equals, 2)
+	var imported types.DeviceID
+	for id := range devs {
+		if extIDFromDB, err := dst.GetExternalDeviceID(id); err == nil && extIDFromDB == extID {
+			imported = id
+		}
+	}
+	c.Assert(imported, Not(Equals), types.DeviceID(0))
+	c.Assert(devs[imported].IsOnline, Equals, false) // until it is found by an adapter
+	c.Assert(devs[imported].Metadata, DeepEquals, &devMD)
+	md, err := dst.GetComponentMetadata(types.ComponentID{DeviceID: imported, Name: "bulb"})
+	c.Assert(err, IsNil)
+	c.Assert(md, DeepEquals, compMD)
+
+	locs, err := dst.GetLocations()
+	c.Assert(err, IsNil)
+	c.Assert(len(locs), Equals, 2)
+	locID, err := dst.GetDeviceLocation(imported)
+	c.Assert(err, IsNil)
+	c.Assert(locs[locID].Name, Equals, "den")
+	c.Assert(locs[locs[locID].ParentID].Name, Equals, "first floor")
+	aliasedID, err := dst.ResolveExternalDeviceID(aliasID)
+	c.Assert(err, IsNil)
+	c.Assert(aliasedID, Equals, imported)
+
+	value, err := dst.GetAdapterCredential("hue", "token")
+	c.Assert(err, IsNil)
+	c.Assert(value, Equals, "xyz")
+	config, err := dst.GetAdapterConfig("hue")
+	c.Assert(err, IsNil)
+	c.Assert(config, DeepEquals, map[string]string{"poll_interval": "30s"})
+	svcs, err := dst.GetStaticServices()
+	c.Assert(err, IsNil)
+	c.Assert(len(svcs), Equals, 1) // not duplicated by the second import
+	c.Assert(svcs[0].FactoryName, Equals, "hue")
+	c.Assert(svcs[0].IP, Equals, "10.0.0.12")
+	n, err := dst.CountComponents(Query{})
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0) // component state is not exported
+
+	// the imported specs are used once the device is found
+	_, err = dst.UpsertDevice(extID, types.Device{
+		Name:       "Plug",
+		IsOnline:   true,
+		Components: map[string]types.Component{"plug": types.Switch{BaseComponent: types.BaseComponent{Make: "acme", Model: "plug_1"}}},
+	})
+	c.Assert(err, IsNil)
+	comp, err := dst.GetComponent(types.ComponentID{DeviceID: imported, Name: "plug"}, ExpandSpecs)
+	c.Assert(err, IsNil)
+	c.Assert(comp.(types.Switch).Specs, DeepEquals, &types.SwitchSpecs{MaxLoadInWatts: 1800, IsMetered: true})
+
+	// exports from newer versions of SIFT are rejected
+	c.Assert(dst.Import(strings.NewReader(`{"version": 1000}`)), NotNil)
+}
+
+func (s *DBTestSuite) TestBackup(c *C) {
+	db, err := Open("")
+	c.Assert(err, IsNil)
+	defer db.Close()
+	resp, err := db.UpsertDevice(types.ExternalDeviceID{Manufacturer: "example", ID: "1"}, types.Device{Name: "lamp", IsOnline: true})
+	c.Assert(err, IsNil)
+
+	dir, err := ioutil.TempDir(os.TempDir(), "siftdb_backup_")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "backup.db")
+	c.Assert(db.Backup(path), IsNil)
+	c.Assert(db.Backup(path), NotNil) // existing files are not overwritten
+
+	backup, err := Open(path)
+	c.Assert(err, IsNil)
+	defer backup.Close()
+	dev, err := backup.GetDevice(resp.DeviceID, ExpandNone)
+	c.Assert(err, IsNil)
+	c.Assert(dev.Name, Equals, "lamp")
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	rawsql "github.com/upwrd/sift/db/sql"
+)
+
+// Names of the database drivers supported by SiftDB
+const (
+	driverSQLite   = "sqlite3"
+	driverPostgres = "postgres"
+)
+
+// A siftConn is a connection pool which accepts queries written with '?'
+// placeholders, rebinding them to suit the underlying database. All queries
+// in this package are written for it.
+type siftConn struct {
+	*sqlx.DB
+}
+
+// Beginx begins a transaction which also rebinds its queries
+func (c siftConn) Beginx() (siftTx, error) {
+	tx, err := c.DB.Beginx()
+	return siftTx{tx}, err
+}
+
+func (c siftConn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.DB.Exec(c.Rebind(query), args...)
+}
+
+func (c siftConn) Get(dest interface{}, query string, args ...interface{}) error {
+	return c.DB.Get(dest, c.Rebind(query), args...)
+}
+
+func (c siftConn) Select(dest interface{}, query string, args ...interface{}) error {
+	return c.DB.Select(dest, c.Rebind(query), args...)
+}
+
+// A siftTx is a transaction which accepts queries written with '?'
+// placeholders. It satisfies types.StorageTx.
+type siftTx struct {
+	*sqlx.Tx
+}
+
+func (tx siftTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.Exec(tx.Rebind(query), args...)
+}
+
+func (tx siftTx) Get(dest interface{}, query string, args ...interface{}) error {
+	return tx.Tx.Get(dest, tx.Rebind(query), args...)
+}
+
+func (tx siftTx) Select(dest interface{}, query string, args ...interface{}) error {
+	return tx.Tx.Select(dest, tx.Rebind(query), args...)
+}
+
+// insertReturningID runs an INSERT statement and returns the id of the new
+// row
+func insertReturningID(tx siftTx, query string, args ...interface{}) (int64, error) {
+	if tx.DriverName() == driverPostgres {
+		// postgres does not support LastInsertId
+		var id int64
+		err := tx.Get(&id, query+" RETURNING id", args...)
+		return id, err
+	}
+	res, err := tx.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// tableColumns returns the names of the columns in a table. If the table does
+// not exist, no columns are returned.
+func tableColumns(q interface {
+	Select(dest interface{}, query string, args ...interface{}) error
+	DriverName() string
+}, table string) ([]string, error) {
+	query := "SELECT name FROM pragma_table_info(?)"
+	if q.DriverName() == driverPostgres {
+		query = "SELECT column_name FROM information_schema.columns WHERE table_schema=current_schema() AND table_name=?"
+	}
+	names := []string{}
+	if err := q.Select(&names, query, table); err != nil {
+		return nil, fmt.Errorf("could not get columns of %v: %v", table, err)
+	}
+	return names, nil
+}
+
+// initSQL returns the statements which create the SIFT schema for the given
+// database driver
+func initSQL(driverName string) string {
+	if driverName == driverPostgres {
+		return rawsql.PostgresInitSql
+	}
+	return rawsql.InitSql
+}
@@ -0,0 +1,424 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/upwrd/sift/types"
+	"io"
+	"sort"
+)
+
+// ExportVersion is the version of the document written by Export. Import
+// accepts documents of this version or earlier.
+const ExportVersion = 1
+
+// An Export is a snapshot of the parts of a SIFT database which cannot be
+// rediscovered from the network: Locations, user-provided metadata, Adapter
+// credentials and configuration, static services and spec catalogs. The state
+// of Components is not included; it is restored by Adapters once their Devices
+// are found again.
+type Export struct {
+	Version        int                  `json:"version"`
+	Locations      []ExportedLocation   `json:"locations"`
+	Devices        []ExportedDevice     `json:"devices"`
+	Credentials    []ExportedCredential `json:"credentials"`
+	Config         []ExportedConfig     `json:"config,omitempty"`
+	StaticServices []StaticService      `json:"static_services,omitempty"`
+	SpecCatalog    SpecCatalog          `json:"spec_catalog"`
+}
+
+// An ExportedLocation is a Location within an Export. Its ID is only
+// meaningful within the Export; Locations are given new IDs when imported.
+type ExportedLocation struct {
+	ID       types.LocationID `json:"id"`
+	Name     string           `json:"name"`
+	ParentID types.LocationID `json:"parent_id,omitempty"`
+}
+
+// An ExportedDevice holds the user-managed parts of a Device, identified by
+// its ExternalDeviceID
+type ExportedDevice struct {
+	ExternalID        types.ExternalDeviceID    `json:"external_id"`
+	Aliases           []types.ExternalDeviceID  `json:"aliases,omitempty"` // see MergeDevices
+	Name              string                    `json:"name,omitempty"`
+	LocationID        types.LocationID          `json:"location_id,omitempty"` // refers to an ExportedLocation
+	Metadata          *types.Metadata           `json:"metadata,omitempty"`
+	ComponentMetadata map[string]types.Metadata `json:"component_metadata,omitempty"` // indexed by Component name
+}
+
+// An ExportedCredential is a value stored for an Adapter (see
+// UpsertAdapterCredential)
+type ExportedCredential struct {
+	AdapterName string `db:"adapter_name" json:"adapter_name"`
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+}
+
+// An ExportedConfig is a configuration value set for an Adapter (see
+// SetAdapterConfig)
+type ExportedConfig struct {
+	AdapterName string `db:"adapter_name" json:"adapter_name"`
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+}
+
+// Export writes a JSON-encoded Export of the SIFT database to w. Export runs
+// in a single read-only transaction, so the snapshot is consistent even if
+// the database is being updated. Adapter credentials are decrypted, so the
+// Export should be kept as securely as the credential keys.
+func (sdb *SiftDB) Export(w io.Writer) error {
+	// begin a database transaction
+	tx, err := sdb.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %v", err)
+	}
+	defer tx.Rollback() // read-only
+
+	export, err := exportTx(tx)
+	if err != nil {
+		return err
+	}
+	for i, cred := range export.Credentials {
+		if export.Credentials[i].Value, err = sdb.creds.decrypt(cred.AdapterName, cred.Key, cred.Value); err != nil {
+			return fmt.Errorf("could not decrypt credential %v for %v: %v", cred.Key, cred.AdapterName, err)
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	if err := enc.Encode(export); err != nil {
+		return fmt.Errorf("could not encode export: %v", err)
+	}
+	return nil
+}
+
+func exportTx(tx siftTx) (Export, error) {
+	export := Export{Version: ExportVersion}
+
+	dbLocs := []Location{}
+	if err := tx.Select(&dbLocs, "SELECT * FROM location ORDER BY id"); err != nil {
+		return Export{}, fmt.Errorf("could not get locations: %v", err)
+	}
+	for _, dbLoc := range dbLocs {
+		export.Locations = append(export.Locations, ExportedLocation{
+			ID:       types.LocationID(dbLoc.ID),
+			Name:     dbLoc.Name,
+			ParentID: types.LocationID(dbLoc.ParentID.Int64),
+		})
+	}
+
+	dbDevs := []Device{}
+	if err := tx.Select(&dbDevs, "SELECT * FROM device ORDER BY id"); err != nil {
+		return Export{}, fmt.Errorf("could not get devices: %v", err)
+	}
+	devIndices := make(map[int64]int, len(dbDevs)) // device ID -> index in export.Devices
+	for i, dbDev := range dbDevs {
+		dev := ExportedDevice{
+			ExternalID: types.ExternalDeviceID{Manufacturer: dbDev.Manufacturer, ID: dbDev.ExternalID},
+			Name:       dbDev.Name.String,
+			LocationID: types.LocationID(dbDev.LocationID.Int64),
+		}
+		md, found, err := getDeviceMetadataTx(tx, types.DeviceID(dbDev.ID))
+		if err != nil {
+			return Export{}, err
+		}
+		if found {
+			dev.Metadata = &md
+		}
+		if dev.Aliases, err = getDeviceAliasesTx(tx, types.DeviceID(dbDev.ID)); err != nil {
+			return Export{}, err
+		} else if len(dev.Aliases) == 0 {
+			dev.Aliases = nil
+		}
+		export.Devices = append(export.Devices, dev)
+		devIndices[dbDev.ID] = i
+	}
+
+	compMDs := []struct {
+		DeviceID      int64  `db:"device_id"`
+		ComponentName string `db:"component_name"`
+		dbMetadata
+	}{}
+	q := "SELECT device_id, component_name, display_name, icon, tags, hidden FROM component_metadata"
+	if err := tx.Select(&compMDs, q); err != nil {
+		return Export{}, fmt.Errorf("could not get component metadata: %v", err)
+	}
+	for _, compMD := range compMDs {
+		i, ok := devIndices[compMD.DeviceID]
+		if !ok {
+			continue
+		}
+		md, err := dbToMetadata(compMD.dbMetadata)
+		if err != nil {
+			return Export{}, err
+		}
+		if export.Devices[i].ComponentMetadata == nil {
+			export.Devices[i].ComponentMetadata = make(map[string]types.Metadata)
+		}
+		export.Devices[i].ComponentMetadata[compMD.ComponentName] = md
+	}
+
+	q = "SELECT adapter_name, key, COALESCE(value, '') AS value FROM adapter_credential ORDER BY adapter_name, key"
+	if err := tx.Select(&export.Credentials, q); err != nil {
+		return Export{}, fmt.Errorf("could not get adapter credentials: %v", err)
+	}
+
+	q = "SELECT adapter_name, key, value FROM adapter_config ORDER BY adapter_name, key"
+	if err := tx.Select(&export.Config, q); err != nil {
+		return Export{}, fmt.Errorf("could not get adapter config: %v", err)
+	}
+
+	q = "SELECT id, factory_name, ip, port FROM static_service ORDER BY id"
+	if err := tx.Select(&export.StaticServices, q); err != nil {
+		return Export{}, fmt.Errorf("could not get static services: %v", err)
+	}
+
+	catalog, err := getSpecCatalogTx(tx)
+	if err != nil {
+		return Export{}, err
+	}
+	export.SpecCatalog = catalog
+	return export, nil
+}
+
+// Backup writes a copy of the SIFT database to a new file at the given path.
+// The copy is made within a single read transaction, which (as the database
+// uses write-ahead logging) does not block the Server from reading or writing
+// while the backup runs. The backup may be opened with Open. Backups are only
+// supported for SQLite databases.
+func (sdb *SiftDB) Backup(path string) error {
+	if sdb.db.DriverName() != driverSQLite {
+		return fmt.Errorf("backups are only supported for SQLite databases")
+	}
+	if _, err := sdb.db.Exec("VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("could not back up database to %v: %v", path, err)
+	}
+	sdb.log.Info("database backed up", "path", path)
+	return nil
+}
+
+// Import merges a JSON-encoded Export (see Export) into the SIFT database.
+// Devices are matched by their ExternalDeviceIDs; Devices which are not yet
+// known are added, and are marked offline until they are found by an
+// Adapter. Locations are matched by name within their parent, so importing
+// the same Export twice does not create duplicates. Metadata, credentials,
+// Adapter configuration and specs in the Export replace any existing values;
+// static services are added unless already registered. Either the whole
+// Export is imported, or none of it is.
+func (sdb *SiftDB) Import(r io.Reader) (err error) {
+	var export Export
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return fmt.Errorf("could not decode export: %v", err)
+	}
+	if export.Version < 1 || export.Version > ExportVersion {
+		return fmt.Errorf("unsupported export version: %v", export.Version)
+	}
+	for i, cred := range export.Credentials {
+		if export.Credentials[i].Value, err = sdb.creds.encrypt(cred.AdapterName, cred.Key, cred.Value); err != nil {
+			return fmt.Errorf("could not encrypt credential: %v", err)
+		}
+	}
+
+	// begin a database transaction
+	tx, err := sdb.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %v", err)
+	}
+	// If something bad happens, roll back the transaction
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				sdb.log.Error("could not roll back db transaction", "original_err", err, "rollback_err", rbErr)
+			}
+			sdb.log.Warn("rolled back db transaction", "original_err", err)
+		} else {
+			if cmErr := tx.Commit(); cmErr != nil {
+				sdb.log.Error("could not commit transaction", "commit_err", cmErr)
+				err = fmt.Errorf("could not commit transaction: %v", cmErr)
+			}
+			sdb.log.Debug("export imported; transaction committed", "num_devices", len(export.Devices))
+		}
+	}()
+
+	err = importTx(tx, export)
+	return
+}
+
+func importTx(tx siftTx, export Export) error {
+	locIDs, err := importLocationsTx(tx, export.Locations)
+	if err != nil {
+		return err
+	}
+
+	for _, dev := range export.Devices {
+		devID, err := importDeviceTx(tx, dev)
+		if err != nil {
+			return fmt.Errorf("could not import device %v: %v", dev.ExternalID, err)
+		}
+		for _, alias := range dev.Aliases {
+			if err := importDeviceAliasTx(tx, devID, alias); err != nil {
+				return fmt.Errorf("could not import alias %v of device %v: %v", alias, dev.ExternalID, err)
+			}
+		}
+		if dev.LocationID != 0 {
+			locID, ok := locIDs[dev.LocationID]
+			if !ok {
+				return fmt.Errorf("device %v is in unknown location %v", dev.ExternalID, dev.LocationID)
+			}
+			if _, err := tx.Exec("UPDATE device SET location_id=? WHERE id=?", locID, devID); err != nil {
+				return fmt.Errorf("could not set location of device %v: %v", dev.ExternalID, err)
+			}
+		}
+		if dev.Metadata != nil {
+			if err := setDeviceMetadataTx(tx, devID, *dev.Metadata); err != nil {
+				return err
+			}
+		}
+		for name, md := range dev.ComponentMetadata {
+			if err := setComponentMetadataTx(tx, types.ComponentID{DeviceID: devID, Name: name}, md); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, cred := range export.Credentials {
+		if err := upsertAdapterCredentialTx(tx, cred.AdapterName, cred.Key, cred.Value); err != nil {
+			return fmt.Errorf("could not import credential %v for %v: %v", cred.Key, cred.AdapterName, err)
+		}
+	}
+
+	for _, config := range export.Config {
+		if err := setAdapterConfigTx(tx, config.AdapterName, config.Key, config.Value); err != nil {
+			return fmt.Errorf("could not import config %v for %v: %v", config.Key, config.AdapterName, err)
+		}
+	}
+
+	for _, svc := range export.StaticServices {
+		if err := importStaticServiceTx(tx, svc); err != nil {
+			return fmt.Errorf("could not import static service %v at %v: %v", svc.FactoryName, svc.IP, err)
+		}
+	}
+
+	if _, err := upsertSpecCatalogTx(tx, export.SpecCatalog); err != nil {
+		return fmt.Errorf("could not import spec catalog: %v", err)
+	}
+	return nil
+}
+
+// importLocationsTx adds the exported Locations to the database (parents
+// before children), returning the new LocationID of each exported Location
+func importLocationsTx(tx siftTx, locs []ExportedLocation) (map[types.LocationID]types.LocationID, error) {
+	newIDs := make(map[types.LocationID]types.LocationID, len(locs))
+	for len(newIDs) < len(locs) {
+		progress := false
+		for _, loc := range locs {
+			if _, done := newIDs[loc.ID]; done {
+				continue
+			}
+			parent, ok := newIDs[loc.ParentID]
+			if loc.ParentID != 0 && !ok {
+				continue // parent has not been imported yet
+			}
+			id, err := importLocationTx(tx, loc.Name, parent)
+			if err != nil {
+				return nil, fmt.Errorf("could not import location %v: %v", loc.Name, err)
+			}
+			newIDs[loc.ID] = id
+			progress = true
+		}
+		if !progress {
+			return nil, fmt.Errorf("exported locations have missing or cyclic parents")
+		}
+	}
+	return newIDs, nil
+}
+
+// importLocationTx returns the Location with the given name and parent,
+// creating it if it does not exist
+func importLocationTx(tx siftTx, name string, parent types.LocationID) (types.LocationID, error) {
+	if name == "" {
+		return 0, fmt.Errorf("location must have a name")
+	}
+	var id int64
+	q, args := "SELECT id FROM location WHERE name=? AND parent_id IS NULL", []interface{}{name}
+	if parent != 0 {
+		q, args = "SELECT id FROM location WHERE name=? AND parent_id=?", []interface{}{name, parent}
+	}
+	if err := tx.Get(&id, q+" ORDER BY id LIMIT 1", args...); err == nil {
+		return types.LocationID(id), nil
+	} else if err != sql.ErrNoRows {
+		return 0, err
+	}
+	id, err := insertReturningID(tx, "INSERT INTO location (name, parent_id) VALUES (?, ?)", name, nullLocationID(parent))
+	return types.LocationID(id), err
+}
+
+// importDeviceTx returns the ID of the Device with the exported
+// ExternalDeviceID, adding an offline Device if none exists
+func importDeviceTx(tx siftTx, dev ExportedDevice) (types.DeviceID, error) {
+	if id, found, err := resolveDeviceTx(tx, dev.ExternalID); err != nil {
+		return 0, err
+	} else if found {
+		return id, nil
+	}
+	q := "INSERT INTO device (manufacturer, external_id, name, is_online) VALUES (?, ?, ?, ?)"
+	name := sql.NullString{String: dev.Name, Valid: dev.Name != ""}
+	id, err := insertReturningID(tx, q, dev.ExternalID.Manufacturer, dev.ExternalID.ID, name, false)
+	if err != nil {
+		return 0, fmt.Errorf("error inserting device: %v", err)
+	}
+	return types.DeviceID(id), nil
+}
+
+// importDeviceAliasTx makes alias an alias of the Device. If a different
+// Device is already known by alias, it is merged into the Device.
+func importDeviceAliasTx(tx siftTx, id types.DeviceID, alias types.ExternalDeviceID) error {
+	aliasedID, found, err := resolveDeviceTx(tx, alias)
+	switch {
+	case err != nil:
+		return err
+	case !found:
+		q := "INSERT INTO device_alias (device_id, manufacturer, external_id) VALUES (?, ?, ?)"
+		_, err = tx.Exec(q, id, alias.Manufacturer, alias.ID)
+		return err
+	case aliasedID != id:
+		return mergeDevicesTx(tx, id, aliasedID)
+	}
+	return nil
+}
+
+// getSpecCatalogTx returns the specs stored for every Component type
+func getSpecCatalogTx(tx siftTx) (SpecCatalog, error) {
+	catalog := SpecCatalog{}
+	for _, ct := range types.ComponentTypes() {
+		specStorage, ok := ct.Storage.(types.SpecStorage)
+		if !ok {
+			continue
+		}
+		list, err := specStorage.ListSpecs(tx)
+		if err != nil {
+			return nil, fmt.Errorf("could not get %v specs: %v", ct.Name, err)
+		}
+		if len(list) == 0 {
+			continue
+		}
+		entries := make([]SpecCatalogEntry, 0, len(list))
+		for _, ms := range list {
+			entries = append(entries, SpecCatalogEntry{Make: ms.Make, Model: ms.Model, Specs: ms.Specs})
+		}
+		sort.Sort(entriesByMakeModel(entries))
+		catalog[ct.Name] = entries
+	}
+	return catalog, nil
+}
+
+type entriesByMakeModel []SpecCatalogEntry
+
+func (s entriesByMakeModel) Len() int      { return len(s) }
+func (s entriesByMakeModel) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s entriesByMakeModel) Less(i, j int) bool {
+	if s[i].Make != s[j].Make {
+		return s[i].Make < s[j].Make
+	}
+	return s[i].Model < s[j].Model
+}
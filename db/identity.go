@@ -0,0 +1,305 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/upwrd/sift/types"
+	"sort"
+	"sync"
+)
+
+// A Device may be reported by several Adapters, each using its own
+// ExternalDeviceID. The first ExternalDeviceID seen for a Device is stored
+// with it (and returned by GetExternalDeviceID); any others are stored as
+// aliases, which resolve to the same types.DeviceID. Aliases are added by
+// merging Devices, either explicitly (see MergeDevices) or when a new
+// ExternalDeviceID reports an identifier which is already known (see
+// SetMergeIdentifiers).
+
+// mergeRules lists the kinds of Device identifiers (e.g. types.IdentifierMAC)
+// which cause Devices to be merged automatically
+type mergeRules struct {
+	mu    sync.RWMutex
+	kinds []string
+}
+
+func (mr *mergeRules) set(kinds []string) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	mr.kinds = append([]string(nil), kinds...)
+}
+
+func (mr *mergeRules) get() []string {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	return mr.kinds
+}
+
+// SetMergeIdentifiers sets the kinds of Device identifiers (e.g.
+// types.IdentifierMAC) which identify a Device across Adapters. When a Device
+// is upserted with an unknown ExternalDeviceID, but with an identifier of one
+// of these kinds which matches an existing Device, the ExternalDeviceID
+// becomes an alias of the existing Device rather than creating a new one. By
+// default, Devices are only merged with MergeDevices.
+func (sdb *SiftDB) SetMergeIdentifiers(kinds ...string) {
+	sdb.merge.set(kinds)
+}
+
+// ResolveExternalDeviceID returns the ID of the Device known by the given
+// ExternalDeviceID, which may be an alias
+func (sdb *SiftDB) ResolveExternalDeviceID(extID types.ExternalDeviceID) (types.DeviceID, error) {
+	tx, err := sdb.db.Beginx()
+	if err != nil {
+		return 0, fmt.Errorf("could not begin transaction: %v", err)
+	}
+	defer tx.Rollback() // read-only
+
+	id, found, err := resolveDeviceTx(tx, extID)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, fmt.Errorf("no device found with external ID %v", extID)
+	}
+	return id, nil
+}
+
+// GetDeviceAliases returns the ExternalDeviceIDs which have been merged into
+// the Device, not including the one returned by GetExternalDeviceID
+func (sdb *SiftDB) GetDeviceAliases(id types.DeviceID) ([]types.ExternalDeviceID, error) {
+	tx, err := sdb.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("could not begin transaction: %v", err)
+	}
+	defer tx.Rollback() // read-only
+	return getDeviceAliasesTx(tx, id)
+}
+
+func getDeviceAliasesTx(tx siftTx, id types.DeviceID) ([]types.ExternalDeviceID, error) {
+	aliases := []types.ExternalDeviceID{}
+	q := "SELECT manufacturer, external_id AS id FROM device_alias WHERE device_id=? ORDER BY manufacturer, external_id"
+	if err := tx.Select(&aliases, q, id); err != nil {
+		return nil, fmt.Errorf("could not get aliases for device %v: %v", id, err)
+	}
+	return aliases, nil
+}
+
+// MergeDevices merges the Device 'from' into the Device 'into'. Every
+// ExternalDeviceID of 'from' becomes an alias of 'into', and 'from' is
+// deleted. Components, metadata and the Location of 'from' are kept if 'into'
+// does not already have them.
+func (sdb *SiftDB) MergeDevices(into, from types.DeviceID) (err error) {
+	if into == from {
+		return fmt.Errorf("cannot merge device %v into itself", into)
+	}
+	// begin a database transaction
+	tx, err := sdb.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %v", err)
+	}
+	// If something bad happens, roll back the transaction
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				sdb.log.Error("could not roll back db transaction", "original_err", err, "rollback_err", rbErr)
+			}
+			sdb.log.Warn("rolled back db transaction", "original_err", err)
+		} else {
+			if cmErr := tx.Commit(); cmErr != nil {
+				sdb.log.Error("could not commit transaction", "commit_err", cmErr)
+				err = fmt.Errorf("could not commit transaction: %v", cmErr)
+			}
+			sdb.log.Info("devices merged; transaction committed", "into", into, "from", from)
+		}
+	}()
+
+	err = mergeDevicesTx(tx, into, from)
+	return
+}
+
+func mergeDevicesTx(tx siftTx, into, from types.DeviceID) error {
+	var intoDev, fromDev Device
+	if err := tx.Get(&intoDev, "SELECT * FROM device WHERE id=?", into); err != nil {
+		return fmt.Errorf("could not get device %v: %v", into, err)
+	}
+	if err := tx.Get(&fromDev, "SELECT * FROM device WHERE id=?", from); err != nil {
+		return fmt.Errorf("could not get device %v: %v", from, err)
+	}
+
+	// The external IDs of 'from' become aliases of 'into'
+	if _, err := tx.Exec("UPDATE device_alias SET device_id=? WHERE device_id=?", into, from); err != nil {
+		return fmt.Errorf("could not move aliases: %v", err)
+	}
+	q := "INSERT INTO device_alias (device_id, manufacturer, external_id) VALUES (?, ?, ?)"
+	if _, err := tx.Exec(q, into, fromDev.Manufacturer, fromDev.ExternalID); err != nil {
+		return fmt.Errorf("could not add alias: %v", err)
+	}
+
+	// Keep the identifiers, Components and metadata of 'from' which 'into' does
+	// not have, and delete the rest
+	q = "DELETE FROM device_identifier WHERE device_id=? AND kind IN (SELECT kind FROM device_identifier WHERE device_id=?)"
+	if _, err := tx.Exec(q, from, into); err != nil {
+		return fmt.Errorf("could not delete duplicate identifiers: %v", err)
+	}
+	if _, err := tx.Exec("UPDATE device_identifier SET device_id=? WHERE device_id=?", into, from); err != nil {
+		return fmt.Errorf("could not move identifiers: %v", err)
+	}
+
+	duplicateNames := []string{}
+	q = "SELECT name FROM component WHERE device_id=? AND name IN (SELECT name FROM component WHERE device_id=?)"
+	if err := tx.Select(&duplicateNames, q, from, into); err != nil {
+		return fmt.Errorf("could not find duplicate components: %v", err)
+	}
+	for _, name := range duplicateNames {
+		if err := deleteComponentTx(tx, from, name); err != nil {
+			return fmt.Errorf("could not delete component %v-%v: %v", from, name, err)
+		}
+	}
+	if _, err := tx.Exec("UPDATE component SET device_id=? WHERE device_id=?", into, from); err != nil {
+		return fmt.Errorf("could not move components: %v", err)
+	}
+
+	q = "DELETE FROM component_metadata WHERE device_id=? AND component_name IN (SELECT component_name FROM component_metadata WHERE device_id=?)"
+	if _, err := tx.Exec(q, from, into); err != nil {
+		return fmt.Errorf("could not delete duplicate component metadata: %v", err)
+	}
+	if _, err := tx.Exec("UPDATE component_metadata SET device_id=? WHERE device_id=?", into, from); err != nil {
+		return fmt.Errorf("could not move component metadata: %v", err)
+	}
+	if _, found, err := getDeviceMetadataTx(tx, into); err != nil {
+		return err
+	} else if found {
+		if _, err := tx.Exec("DELETE FROM device_metadata WHERE device_id=?", from); err != nil {
+			return fmt.Errorf("could not delete device metadata: %v", err)
+		}
+	} else if _, err := tx.Exec("UPDATE device_metadata SET device_id=? WHERE device_id=?", into, from); err != nil {
+		return fmt.Errorf("could not move device metadata: %v", err)
+	}
+
+	if !intoDev.LocationID.Valid && fromDev.LocationID.Valid {
+		if _, err := tx.Exec("UPDATE device SET location_id=? WHERE id=?", fromDev.LocationID, into); err != nil {
+			return fmt.Errorf("could not move device location: %v", err)
+		}
+	}
+	if !intoDev.IsOnline && fromDev.IsOnline {
+		if _, err := tx.Exec("UPDATE device SET is_online=? WHERE id=?", true, into); err != nil {
+			return fmt.Errorf("could not update device status: %v", err)
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM device WHERE id=?", from); err != nil {
+		return fmt.Errorf("could not delete device %v: %v", from, err)
+	}
+	return nil
+}
+
+// RemoveDeviceAlias removes an alias which was added by merging Devices. The
+// next time a Device is upserted with the ExternalDeviceID, a new Device is
+// created for it (unless it is merged again by identifier).
+func (sdb *SiftDB) RemoveDeviceAlias(extID types.ExternalDeviceID) error {
+	res, err := sdb.db.Exec("DELETE FROM device_alias WHERE manufacturer=? AND external_id=?", extID.Manufacturer, extID.ID)
+	if err != nil {
+		return fmt.Errorf("could not remove alias %v: %v", extID, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("error getting row count: %v", err)
+	} else if n == 0 {
+		return fmt.Errorf("%v is not an alias of any device", extID)
+	}
+	sdb.log.Info("removed device alias", "external_id", extID)
+	return nil
+}
+
+// resolveDeviceTx returns the ID of the Device known by the ExternalDeviceID,
+// checking aliases if no Device has it as its own
+func resolveDeviceTx(tx siftTx, extID types.ExternalDeviceID) (types.DeviceID, bool, error) {
+	var id int64
+	err := tx.Get(&id, "SELECT id FROM device WHERE manufacturer=? AND external_id=?", extID.Manufacturer, extID.ID)
+	if err == sql.ErrNoRows {
+		err = tx.Get(&id, "SELECT device_id FROM device_alias WHERE manufacturer=? AND external_id=?", extID.Manufacturer, extID.ID)
+	}
+	switch {
+	case err == sql.ErrNoRows:
+		return 0, false, nil
+	case err != nil:
+		return 0, false, fmt.Errorf("could not resolve external ID %v: %v", extID, err)
+	}
+	return types.DeviceID(id), true, nil
+}
+
+// matchDeviceTx finds a Device which shares an identifier with those given,
+// considering only identifiers of the listed kinds
+func matchDeviceTx(tx siftTx, identifiers map[string]string, kinds []string) (types.DeviceID, bool, error) {
+	for _, kind := range kinds {
+		value := identifiers[kind]
+		if value == "" {
+			continue
+		}
+		var id int64
+		q := "SELECT device_id FROM device_identifier WHERE kind=? AND value=? ORDER BY device_id LIMIT 1"
+		err := tx.Get(&id, q, kind, types.NormalizeIdentifier(kind, value))
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return 0, false, fmt.Errorf("could not match device by %v: %v", kind, err)
+		}
+		return types.DeviceID(id), true, nil
+	}
+	return 0, false, nil
+}
+
+// setDeviceIdentifiersTx stores the identifiers reported for a Device.
+// Identifiers are only added or changed, never removed, since each Adapter
+// which reports the Device may only know some of them.
+func setDeviceIdentifiersTx(tx siftTx, id types.DeviceID, identifiers map[string]string) error {
+	for kind, value := range identifiers {
+		if kind == "" || value == "" {
+			continue
+		}
+		value = types.NormalizeIdentifier(kind, value)
+		res, err := tx.Exec("UPDATE device_identifier SET value=? WHERE device_id=? AND kind=?", value, id, kind)
+		if err != nil {
+			return fmt.Errorf("error updating device identifier: %v", err)
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return fmt.Errorf("error getting row count (required for update): %v", err)
+		} else if n == 0 {
+			q := "INSERT INTO device_identifier (device_id, kind, value) VALUES (?, ?, ?)"
+			if _, err := tx.Exec(q, id, kind, value); err != nil {
+				return fmt.Errorf("error inserting device identifier: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+func getDeviceIdentifiersTx(tx siftTx, id types.DeviceID) (map[string]string, error) {
+	rows := []struct{ Kind, Value string }{}
+	if err := tx.Select(&rows, "SELECT kind, value FROM device_identifier WHERE device_id=?", id); err != nil {
+		return nil, fmt.Errorf("could not get identifiers for device %v: %v", id, err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	identifiers := make(map[string]string, len(rows))
+	for _, row := range rows {
+		identifiers[row.Kind] = row.Value
+	}
+	return identifiers, nil
+}
+
+// sortExternalIDs sorts ExternalDeviceIDs by manufacturer, then ID
+func sortExternalIDs(ids []types.ExternalDeviceID) {
+	sort.Sort(externalIDsByValue(ids))
+}
+
+type externalIDsByValue []types.ExternalDeviceID
+
+func (s externalIDsByValue) Len() int      { return len(s) }
+func (s externalIDsByValue) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s externalIDsByValue) Less(i, j int) bool {
+	if s[i].Manufacturer != s[j].Manufacturer {
+		return s[i].Manufacturer < s[j].Manufacturer
+	}
+	return s[i].ID < s[j].ID
+}
@@ -0,0 +1,246 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/upwrd/sift/types"
+)
+
+// A LocationDeleteResponse describes the result of a call to DeleteLocation.
+// Devices and Locations within the deleted Location are moved to its parent.
+type LocationDeleteResponse struct {
+	Location       types.Location     // the deleted Location
+	MovedDevices   []types.DeviceID   // Devices which were in the deleted Location, by ID
+	MovedLocations []types.LocationID // Locations which were directly within the deleted Location, by ID
+}
+
+// nullLocationID converts a LocationID into a nullable database value, where
+// 0 is NULL
+func nullLocationID(id types.LocationID) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
+func dbToLocation(dbLoc Location) types.Location {
+	return types.Location{
+		Name:     dbLoc.Name,
+		ParentID: types.LocationID(dbLoc.ParentID.Int64),
+	}
+}
+
+// GetLocations returns all Locations in the SIFT database, indexed by their
+// SIFT-internal LocationIDs
+func (sdb *SiftDB) GetLocations() (map[types.LocationID]types.Location, error) {
+	dbLocs := []Location{}
+	if err := sdb.db.Select(&dbLocs, "SELECT * FROM location"); err != nil {
+		return nil, fmt.Errorf("could not get locations: %v", err)
+	}
+	locs := make(map[types.LocationID]types.Location, len(dbLocs))
+	for _, dbLoc := range dbLocs {
+		locs[types.LocationID(dbLoc.ID)] = dbToLocation(dbLoc)
+	}
+	return locs, nil
+}
+
+// GetLocation returns the Location with the given LocationID
+func (sdb *SiftDB) GetLocation(id types.LocationID) (types.Location, error) {
+	var dbLoc Location
+	if err := sdb.db.Get(&dbLoc, "SELECT * FROM location WHERE id=?", id); err != nil {
+		return types.Location{}, fmt.Errorf("could not get location %v: %v", id, err)
+	}
+	return dbToLocation(dbLoc), nil
+}
+
+func getLocationTx(tx siftTx, id types.LocationID) (types.Location, error) {
+	var dbLoc Location
+	if err := tx.Get(&dbLoc, "SELECT * FROM location WHERE id=?", id); err != nil {
+		return types.Location{}, fmt.Errorf("could not get location %v: %v", id, err)
+	}
+	return dbToLocation(dbLoc), nil
+}
+
+// CreateLocation adds a new Location with the given name to the SIFT
+// database. If parent is non-zero, the new Location is placed within it.
+func (sdb *SiftDB) CreateLocation(name string, parent types.LocationID) (id types.LocationID, err error) {
+	if name == "" {
+		return 0, fmt.Errorf("location must have a name")
+	}
+	// begin a database transaction
+	tx, err := sdb.db.Beginx()
+	if err != nil {
+		return 0, fmt.Errorf("could not begin transaction: %v", err)
+	}
+	// If something bad happens, roll back the transaction
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				sdb.log.Error("could not roll back db transaction", "original_err", err, "rollback_err", rbErr)
+			}
+			sdb.log.Warn("rolled back db transaction", "original_err", err)
+		} else {
+			if cmErr := tx.Commit(); cmErr != nil {
+				sdb.log.Error("could not commit transaction", "commit_err", cmErr)
+				err = fmt.Errorf("could not commit transaction: %v", cmErr)
+			}
+			sdb.log.Debug("location created; transaction committed", "id", id)
+		}
+	}()
+
+	if parent != 0 {
+		if _, err = getLocationTx(tx, parent); err != nil {
+			err = fmt.Errorf("could not find parent: %v", err)
+			return
+		}
+	}
+	rawID, err := insertReturningID(tx, "INSERT INTO location (name, parent_id) VALUES (?, ?)", name, nullLocationID(parent))
+	if err != nil {
+		err = fmt.Errorf("error inserting location: %v", err)
+		return
+	}
+	id = types.LocationID(rawID)
+	return
+}
+
+// RenameLocation changes the name of an existing Location
+func (sdb *SiftDB) RenameLocation(id types.LocationID, name string) error {
+	if name == "" {
+		return fmt.Errorf("location must have a name")
+	}
+	res, err := sdb.db.Exec("UPDATE location SET name=? WHERE id=?", name, id)
+	if err != nil {
+		return fmt.Errorf("error renaming location: %v", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("error getting row count: %v", err)
+	} else if n == 0 {
+		return fmt.Errorf("no location found with id %v", id)
+	}
+	return nil
+}
+
+// MoveLocation places an existing Location within another. If parent is 0,
+// the Location is moved to the top level. A Location may not be moved within
+// itself, or within any of the Locations it contains.
+func (sdb *SiftDB) MoveLocation(id, parent types.LocationID) (err error) {
+	// begin a database transaction
+	tx, err := sdb.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %v", err)
+	}
+	// If something bad happens, roll back the transaction
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				sdb.log.Error("could not roll back db transaction", "original_err", err, "rollback_err", rbErr)
+			}
+			sdb.log.Warn("rolled back db transaction", "original_err", err)
+		} else {
+			if cmErr := tx.Commit(); cmErr != nil {
+				sdb.log.Error("could not commit transaction", "commit_err", cmErr)
+				err = fmt.Errorf("could not commit transaction: %v", cmErr)
+			}
+			sdb.log.Debug("location moved; transaction committed", "id", id, "parent", parent)
+		}
+	}()
+
+	if _, err = getLocationTx(tx, id); err != nil {
+		return
+	}
+	// Walk up from the new parent; if the Location being moved is found, the
+	// move would create a cycle
+	for ancestor := parent; ancestor != 0; {
+		if ancestor == id {
+			err = fmt.Errorf("location %v cannot be moved within itself", id)
+			return
+		}
+		var loc types.Location
+		if loc, err = getLocationTx(tx, ancestor); err != nil {
+			err = fmt.Errorf("could not find parent: %v", err)
+			return
+		}
+		ancestor = loc.ParentID
+	}
+
+	if _, err = tx.Exec("UPDATE location SET parent_id=? WHERE id=?", nullLocationID(parent), id); err != nil {
+		err = fmt.Errorf("error moving location: %v", err)
+	}
+	return
+}
+
+// DeleteLocation removes a Location from the SIFT database. Any Devices or
+// Locations within it are moved to its parent (or, if it has no parent, are
+// left without a Location).
+func (sdb *SiftDB) DeleteLocation(id types.LocationID) (resp LocationDeleteResponse, err error) {
+	// begin a database transaction
+	tx, err := sdb.db.Beginx()
+	if err != nil {
+		return LocationDeleteResponse{}, fmt.Errorf("could not begin transaction: %v", err)
+	}
+	// If something bad happens, roll back the transaction
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				sdb.log.Error("could not roll back db transaction", "original_err", err, "rollback_err", rbErr)
+			}
+			sdb.log.Warn("rolled back db transaction", "original_err", err)
+		} else {
+			if cmErr := tx.Commit(); cmErr != nil {
+				sdb.log.Error("could not commit transaction", "commit_err", cmErr)
+				err = fmt.Errorf("could not commit transaction: %v", cmErr)
+			}
+			sdb.log.Debug("location deleted; transaction committed", "id", id)
+		}
+	}()
+
+	if resp.Location, err = getLocationTx(tx, id); err != nil {
+		return
+	}
+	parent := nullLocationID(resp.Location.ParentID)
+
+	// Move the Devices and Locations within the deleted Location to its parent
+	if err = tx.Select(&resp.MovedDevices, "SELECT id FROM device WHERE location_id=? ORDER BY id", id); err != nil {
+		err = fmt.Errorf("could not get devices in location: %v", err)
+		return
+	}
+	if _, err = tx.Exec("UPDATE device SET location_id=? WHERE location_id=?", parent, id); err != nil {
+		err = fmt.Errorf("could not move devices out of location: %v", err)
+		return
+	}
+	if err = tx.Select(&resp.MovedLocations, "SELECT id FROM location WHERE parent_id=? ORDER BY id", id); err != nil {
+		err = fmt.Errorf("could not get locations in location: %v", err)
+		return
+	}
+	if _, err = tx.Exec("UPDATE location SET parent_id=? WHERE parent_id=?", parent, id); err != nil {
+		err = fmt.Errorf("could not move locations out of location: %v", err)
+		return
+	}
+
+	if _, err = tx.Exec("DELETE FROM location WHERE id=?", id); err != nil {
+		err = fmt.Errorf("error deleting location: %v", err)
+	}
+	return
+}
+
+// SetDeviceLocation places a Device in a Location. If the LocationID is 0, the
+// Device is removed from its Location.
+func (sdb *SiftDB) SetDeviceLocation(devID types.DeviceID, locID types.LocationID) error {
+	res, err := sdb.db.Exec("UPDATE device SET location_id=? WHERE id=?", nullLocationID(locID), devID)
+	if err != nil {
+		return fmt.Errorf("could not set location of device %v: %v", devID, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("error getting row count: %v", err)
+	} else if n == 0 {
+		return fmt.Errorf("no device found with id %v", devID)
+	}
+	return nil
+}
+
+// GetDeviceLocation returns the LocationID of the Location containing the
+// Device, or 0 if the Device is not in a Location.
+func (sdb *SiftDB) GetDeviceLocation(devID types.DeviceID) (types.LocationID, error) {
+	var locID sql.NullInt64
+	if err := sdb.db.Get(&locID, "SELECT location_id FROM device WHERE id=?", devID); err != nil {
+		return 0, fmt.Errorf("could not get location of device %v: %v", devID, err)
+	}
+	return types.LocationID(locID.Int64), nil
+}
@@ -0,0 +1,1116 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	rawsql "github.com/upwrd/sift/db/sql"
+	"github.com/upwrd/sift/lib"
+	"github.com/upwrd/sift/types"
+	log "gopkg.in/inconshreveable/log15.v2"
+	logext "gopkg.in/inconshreveable/log15.v2/ext"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A MemoryStore is a Store which holds everything in memory. Nothing is kept
+// after the process exits, which makes it useful for tests and for embedding
+// SIFT where persistence is not needed. A MemoryStore is safe for concurrent
+// use.
+//
+// Like SiftDB, a MemoryStore keeps only the Make, Model and State of each
+// Component; Specs are filled in from its spec catalog when requested, and
+// Stats are not stored.
+type MemoryStore struct {
+	mu                sync.RWMutex
+	devices           map[types.DeviceID]*memDevice
+	deviceIDs         map[types.ExternalDeviceID]types.DeviceID
+	locations         map[types.LocationID]types.Location
+	deviceMetadata    map[types.DeviceID]types.Metadata
+	componentMetadata map[types.ComponentID]types.Metadata
+	specs             map[specKey]json.RawMessage
+	credentials       map[credentialKey]string
+	config            map[credentialKey]string
+	staticServices    map[int64]StaticService
+	mergeKinds        []string
+	lastDeviceID      types.DeviceID
+	lastLocationID    types.LocationID
+	lastStaticID      int64
+	log               log.Logger
+}
+
+type memDevice struct {
+	extID       types.ExternalDeviceID
+	name        string
+	isOnline    bool
+	locationID  types.LocationID
+	components  map[string]types.Component
+	identifiers map[string]string
+}
+
+type specKey struct {
+	componentType, make, model string
+}
+
+type credentialKey struct {
+	adapterName, key string
+}
+
+// NewMemoryStore returns an empty MemoryStore, with the default spec catalog
+// loaded
+func NewMemoryStore() *MemoryStore {
+	ms := &MemoryStore{
+		devices:           make(map[types.DeviceID]*memDevice),
+		deviceIDs:         make(map[types.ExternalDeviceID]types.DeviceID),
+		locations:         make(map[types.LocationID]types.Location),
+		deviceMetadata:    make(map[types.DeviceID]types.Metadata),
+		componentMetadata: make(map[types.ComponentID]types.Metadata),
+		specs:             make(map[specKey]json.RawMessage),
+		credentials:       make(map[credentialKey]string),
+		config:            make(map[credentialKey]string),
+		staticServices:    make(map[int64]StaticService),
+		log:               Log.New("obj", "memory_store", "id", logext.RandId(8)),
+	}
+	if _, err := ms.LoadSpecCatalog(strings.NewReader(rawsql.DefaultSpecCatalog)); err != nil {
+		ms.log.Error("could not load default spec catalog", "err", err)
+	}
+	return ms
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+//
+// Devices and Components
+//
+
+// UpsertDevice updates or inserts a Device using the provided
+// types.ExternalDeviceID. As with SiftDB, the Device is considered "whole";
+// any Components which are not in its Components map are deleted.
+func (ms *MemoryStore) UpsertDevice(extID types.ExternalDeviceID, d types.Device) (DeviceUpsertResponse, error) {
+	if extID.Manufacturer == "" || extID.ID == "" {
+		return DeviceUpsertResponse{}, fmt.Errorf("could not upsert device: external ID must have a manufacturer and ID")
+	}
+	// Components are stored without the parts which are not kept by SiftDB
+	comps := make(map[string]types.Component, len(d.Components))
+	for name, comp := range d.Components {
+		if _, ok := types.LookupComponentType(comp.Type()); !ok {
+			return DeviceUpsertResponse{}, fmt.Errorf("could not upsert components for device: unhandled component type: %v", comp.Type())
+		}
+		comps[name] = storedComponent(comp)
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	// Find the device known by the external ID (which may be an alias). If
+	// there is none, it may be the same as a known device which shares one of
+	// its identifiers.
+	id, found := ms.deviceIDs[extID]
+	if !found {
+		if id, found = ms.matchDevice(d.Identifiers); found {
+			ms.deviceIDs[extID] = id
+			ms.log.Info("merged device by identifier", "device_id", id, "external_id", extID)
+		}
+	}
+	if !found {
+		ms.lastDeviceID++
+		id = ms.lastDeviceID
+		ms.deviceIDs[extID] = id
+		ms.devices[id] = &memDevice{extID: extID, components: make(map[string]types.Component)}
+	}
+	dev := ms.devices[id]
+	for kind, value := range d.Identifiers {
+		if kind == "" || value == "" {
+			continue
+		}
+		if dev.identifiers == nil {
+			dev.identifiers = make(map[string]string)
+		}
+		dev.identifiers[kind] = types.NormalizeIdentifier(kind, value)
+	}
+
+	// Compare the new device against the previous device
+	old := types.Device{Name: dev.name, Components: dev.components}
+	toUpsert, toDelete, hasDeviceChanged := lib.DiffDevice(old, types.Device{Name: d.Name, Components: comps})
+	changes := componentChanges(dev.components, toUpsert)
+
+	dev.name, dev.isOnline = d.Name, d.IsOnline
+	for name, comp := range toUpsert {
+		dev.components[name] = comp
+	}
+	for name := range toDelete {
+		delete(dev.components, name)
+	}
+	ms.log.Debug("device upserted", "id", id, "device", d)
+
+	return DeviceUpsertResponse{
+		DeviceID:           id,
+		UpsertedComponents: toUpsert,
+		DeletedComponents:  toDelete,
+		HasDeviceChanged:   hasDeviceChanged,
+		ComponentChanges:   changes,
+	}, nil
+}
+
+// GetDevices returns all Devices, indexed by their SIFT-internal DeviceIDs, and
+// expanded to the degree indicated by exFlags
+func (ms *MemoryStore) GetDevices(exFlags ExpansionFlags) (map[types.DeviceID]types.Device, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	devs := make(map[types.DeviceID]types.Device, len(ms.devices))
+	for id := range ms.devices {
+		devs[id] = ms.device(id, exFlags)
+	}
+	return devs, nil
+}
+
+// GetDevice returns the Device with the given DeviceID, expanded to the degree
+// indicated by exFlags
+func (ms *MemoryStore) GetDevice(id types.DeviceID, exFlags ExpansionFlags) (types.Device, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	if _, found := ms.devices[id]; !found {
+		return types.Device{}, fmt.Errorf("could not get device: no device found with id %v", id)
+	}
+	return ms.device(id, exFlags), nil
+}
+
+// device builds a copy of the stored Device. The caller must hold ms.mu.
+func (ms *MemoryStore) device(id types.DeviceID, exFlags ExpansionFlags) types.Device {
+	dev := ms.devices[id]
+	d := types.Device{
+		Name:       dev.name,
+		IsOnline:   dev.isOnline,
+		Components: make(map[string]types.Component, len(dev.components)),
+	}
+	if len(dev.identifiers) > 0 {
+		d.Identifiers = make(map[string]string, len(dev.identifiers))
+		for kind, value := range dev.identifiers {
+			d.Identifiers[kind] = value
+		}
+	}
+	for name, comp := range dev.components {
+		d.Components[name] = ms.expandComponent(types.ComponentID{DeviceID: id, Name: name}, comp, exFlags)
+	}
+	if exFlags&(ExpandAll|ExpandMetadata) != 0 {
+		if md, found := ms.deviceMetadata[id]; found {
+			md = copyMetadata(md)
+			d.Metadata = &md
+			if md.DisplayName != "" {
+				d.Name = md.DisplayName
+			}
+		}
+	}
+	return d
+}
+
+// expandComponent returns a copy of a stored Component, expanded to the degree
+// indicated by exFlags. The caller must hold ms.mu.
+func (ms *MemoryStore) expandComponent(id types.ComponentID, comp types.Component, exFlags ExpansionFlags) types.Component {
+	if exFlags&(ExpandAll|ExpandMetadata) != 0 {
+		if md, found := ms.componentMetadata[id]; found {
+			md = copyMetadata(md)
+			comp = withField(comp, []string{"BaseComponent", "Metadata"}, reflect.ValueOf(&md))
+		}
+	}
+	if exFlags&(ExpandAll|ExpandSpecs) != 0 {
+		base := comp.GetBaseComponent()
+		if raw, found := ms.specs[specKey{comp.Type(), base.Make, base.Model}]; found {
+			if specs, err := decodeSpecs(comp, raw); err != nil {
+				ms.log.Warn("could not decode specs", "type", comp.Type(), "make", base.Make, "model", base.Model, "err", err)
+			} else {
+				comp = withField(comp, []string{"Specs"}, specs)
+			}
+		}
+	}
+	if exFlags&(ExpandAll|ExpandStats) != 0 {
+		Log.Debug("STUB: component stats are not yet expanded", "type", comp.Type())
+	}
+	return comp
+}
+
+// GetExternalDeviceID returns the types.ExternalDeviceID matching the given
+// SIFT-internal types.DeviceID
+func (ms *MemoryStore) GetExternalDeviceID(id types.DeviceID) (types.ExternalDeviceID, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	dev, found := ms.devices[id]
+	if !found {
+		return types.ExternalDeviceID{}, fmt.Errorf("no device found with id %v", id)
+	}
+	return dev.extID, nil
+}
+
+// SetMergeIdentifiers sets the kinds of Device identifiers (e.g.
+// types.IdentifierMAC) which identify a Device across Adapters (see
+// SiftDB.SetMergeIdentifiers)
+func (ms *MemoryStore) SetMergeIdentifiers(kinds ...string) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.mergeKinds = append([]string(nil), kinds...)
+}
+
+// matchDevice finds a Device which shares an identifier with those given. The
+// caller must hold ms.mu.
+func (ms *MemoryStore) matchDevice(identifiers map[string]string) (types.DeviceID, bool) {
+	for _, kind := range ms.mergeKinds {
+		value := identifiers[kind]
+		if value == "" {
+			continue
+		}
+		value = types.NormalizeIdentifier(kind, value)
+		var match types.DeviceID
+		for id, dev := range ms.devices {
+			if dev.identifiers[kind] == value && (match == 0 || id < match) {
+				match = id
+			}
+		}
+		if match != 0 {
+			return match, true
+		}
+	}
+	return 0, false
+}
+
+// ResolveExternalDeviceID returns the ID of the Device known by the given
+// ExternalDeviceID, which may be an alias
+func (ms *MemoryStore) ResolveExternalDeviceID(extID types.ExternalDeviceID) (types.DeviceID, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	id, found := ms.deviceIDs[extID]
+	if !found {
+		return 0, fmt.Errorf("no device found with external ID %v", extID)
+	}
+	return id, nil
+}
+
+// GetDeviceAliases returns the ExternalDeviceIDs which have been merged into
+// the Device, not including the one returned by GetExternalDeviceID
+func (ms *MemoryStore) GetDeviceAliases(id types.DeviceID) ([]types.ExternalDeviceID, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	aliases := []types.ExternalDeviceID{}
+	dev, found := ms.devices[id]
+	if !found {
+		return aliases, nil
+	}
+	for extID, devID := range ms.deviceIDs {
+		if devID == id && extID != dev.extID {
+			aliases = append(aliases, extID)
+		}
+	}
+	sortExternalIDs(aliases)
+	return aliases, nil
+}
+
+// MergeDevices merges the Device 'from' into the Device 'into' (see
+// SiftDB.MergeDevices)
+func (ms *MemoryStore) MergeDevices(into, from types.DeviceID) error {
+	if into == from {
+		return fmt.Errorf("cannot merge device %v into itself", into)
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	intoDev, found := ms.devices[into]
+	if !found {
+		return fmt.Errorf("could not get device %v: not found", into)
+	}
+	fromDev, found := ms.devices[from]
+	if !found {
+		return fmt.Errorf("could not get device %v: not found", from)
+	}
+
+	for extID, id := range ms.deviceIDs {
+		if id == from {
+			ms.deviceIDs[extID] = into
+		}
+	}
+	for kind, value := range fromDev.identifiers {
+		if _, found := intoDev.identifiers[kind]; !found {
+			if intoDev.identifiers == nil {
+				intoDev.identifiers = make(map[string]string)
+			}
+			intoDev.identifiers[kind] = value
+		}
+	}
+	for name, comp := range fromDev.components {
+		if _, found := intoDev.components[name]; !found {
+			intoDev.components[name] = comp
+			fromID, intoID := types.ComponentID{DeviceID: from, Name: name}, types.ComponentID{DeviceID: into, Name: name}
+			if md, found := ms.componentMetadata[fromID]; found {
+				if _, found := ms.componentMetadata[intoID]; !found {
+					ms.componentMetadata[intoID] = md
+				}
+			}
+		}
+	}
+	for compID := range ms.componentMetadata {
+		if compID.DeviceID == from {
+			delete(ms.componentMetadata, compID)
+		}
+	}
+	if md, found := ms.deviceMetadata[from]; found {
+		if _, found := ms.deviceMetadata[into]; !found {
+			ms.deviceMetadata[into] = md
+		}
+		delete(ms.deviceMetadata, from)
+	}
+	if intoDev.locationID == 0 {
+		intoDev.locationID = fromDev.locationID
+	}
+	intoDev.isOnline = intoDev.isOnline || fromDev.isOnline
+	delete(ms.devices, from)
+	ms.log.Info("devices merged", "into", into, "from", from)
+	return nil
+}
+
+// RemoveDeviceAlias removes an alias which was added by merging Devices
+func (ms *MemoryStore) RemoveDeviceAlias(extID types.ExternalDeviceID) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	id, found := ms.deviceIDs[extID]
+	if !found || ms.devices[id].extID == extID {
+		return fmt.Errorf("%v is not an alias of any device", extID)
+	}
+	delete(ms.deviceIDs, extID)
+	return nil
+}
+
+// GetComponents returns all Components, indexed by their SIFT-internal
+// ComponentIDs, and expanded to the degree indicated by exFlags
+func (ms *MemoryStore) GetComponents(exFlags ExpansionFlags) (map[types.ComponentID]types.Component, error) {
+	return ms.FindComponents(Query{}, exFlags)
+}
+
+// GetComponent returns the Component matching the given ComponentID, expanded
+// to the degree indicated by exFlags
+func (ms *MemoryStore) GetComponent(id types.ComponentID, exFlags ExpansionFlags) (types.Component, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	if dev, found := ms.devices[id.DeviceID]; found {
+		if comp, found := dev.components[id.Name]; found {
+			return ms.expandComponent(id, comp, exFlags), nil
+		}
+	}
+	return nil, fmt.Errorf("no component found with id %v", id)
+}
+
+// FindComponents returns the Components matching the Query, indexed by their
+// SIFT-internal ComponentIDs, and expanded to the degree indicated by exFlags
+func (ms *MemoryStore) FindComponents(q Query, exFlags ExpansionFlags) (map[types.ComponentID]types.Component, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	comps := make(map[types.ComponentID]types.Component)
+	err := ms.eachMatch(q, func(id types.ComponentID, comp types.Component) {
+		comps[id] = ms.expandComponent(id, comp, exFlags)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return comps, nil
+}
+
+// CountComponents returns the number of Components matching the Query
+func (ms *MemoryStore) CountComponents(q Query) (int, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	n := 0
+	err := ms.eachMatch(q, func(types.ComponentID, types.Component) { n++ })
+	return n, err
+}
+
+// eachMatch calls fn with each stored Component matching the Query. The caller
+// must hold ms.mu.
+func (ms *MemoryStore) eachMatch(q Query, fn func(types.ComponentID, types.Component)) error {
+	if err := validateMemoryQuery(q); err != nil {
+		return fmt.Errorf("invalid query: %v", err)
+	}
+
+	// Find the Location which matching Devices must be in, if any
+	var locationOf *types.LocationID
+	if q.locationOfDevice != nil {
+		var locID types.LocationID // a missing device has no location
+		if dev, found := ms.devices[*q.locationOfDevice]; found {
+			locID = dev.locationID
+		}
+		locationOf = &locID
+	}
+
+	for devID, dev := range ms.devices {
+		if q.isOnline != nil && dev.isOnline != *q.isOnline {
+			continue
+		}
+		if q.locationID != nil && !ms.isWithin(dev.locationID, *q.locationID) {
+			continue
+		}
+		if locationOf != nil && (dev.locationID == 0 || dev.locationID != *locationOf) {
+			continue
+		}
+		for name, comp := range dev.components {
+			base := comp.GetBaseComponent()
+			if q.componentType != "" && comp.Type() != q.componentType {
+				continue
+			}
+			if (q.make != "" && base.Make != q.make) || (q.model != "" && base.Model != q.model) {
+				continue
+			}
+			if !matchesPredicates(comp, q.predicates) {
+				continue
+			}
+			fn(types.ComponentID{DeviceID: devID, Name: name}, comp)
+		}
+	}
+	return nil
+}
+
+// isWithin returns true if the Location is, or is nested within, ancestor. The
+// caller must hold ms.mu.
+func (ms *MemoryStore) isWithin(id, ancestor types.LocationID) bool {
+	for id != 0 {
+		if id == ancestor {
+			return true
+		}
+		id = ms.locations[id].ParentID
+	}
+	return false
+}
+
+// LoadSpecCatalog imports a JSON-encoded SpecCatalog, replacing the existing
+// specs of any matching make and model. Either all entries are loaded, or none
+// are. The number of entries loaded is returned.
+func (ms *MemoryStore) LoadSpecCatalog(r io.Reader) (int, error) {
+	var catalog SpecCatalog
+	if err := json.NewDecoder(r).Decode(&catalog); err != nil {
+		return 0, fmt.Errorf("could not decode spec catalog: %v", err)
+	}
+
+	// Check every entry before storing any of them
+	loaded := make(map[specKey]json.RawMessage)
+	for typeName, entries := range catalog {
+		ct, ok := types.LookupComponentType(typeName)
+		if !ok {
+			return 0, fmt.Errorf("unhandled component type: %v", typeName)
+		}
+		for _, entry := range entries {
+			if entry.Make == "" || entry.Model == "" {
+				return 0, fmt.Errorf("%v spec catalog entry must have a make and model", typeName)
+			}
+			if _, err := decodeSpecs(ct.New(), entry.Specs); err != nil {
+				return 0, fmt.Errorf("could not load %v specs for %v %v: %v", typeName, entry.Make, entry.Model, err)
+			}
+			loaded[specKey{typeName, entry.Make, entry.Model}] = entry.Specs
+		}
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for key, raw := range loaded {
+		ms.specs[key] = raw
+	}
+	return len(loaded), nil
+}
+
+//
+// Locations
+//
+
+// GetLocations returns all Locations, indexed by their SIFT-internal
+// LocationIDs
+func (ms *MemoryStore) GetLocations() (map[types.LocationID]types.Location, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	locs := make(map[types.LocationID]types.Location, len(ms.locations))
+	for id, loc := range ms.locations {
+		locs[id] = loc
+	}
+	return locs, nil
+}
+
+// GetLocation returns the Location with the given LocationID
+func (ms *MemoryStore) GetLocation(id types.LocationID) (types.Location, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.location(id)
+}
+
+// location returns the Location with the given LocationID. The caller must
+// hold ms.mu.
+func (ms *MemoryStore) location(id types.LocationID) (types.Location, error) {
+	loc, found := ms.locations[id]
+	if !found {
+		return types.Location{}, fmt.Errorf("could not get location %v: no location found", id)
+	}
+	return loc, nil
+}
+
+// CreateLocation adds a new Location with the given name. If parent is
+// non-zero, the new Location is placed within it.
+func (ms *MemoryStore) CreateLocation(name string, parent types.LocationID) (types.LocationID, error) {
+	if name == "" {
+		return 0, fmt.Errorf("location must have a name")
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if parent != 0 {
+		if _, err := ms.location(parent); err != nil {
+			return 0, fmt.Errorf("could not find parent: %v", err)
+		}
+	}
+	ms.lastLocationID++
+	ms.locations[ms.lastLocationID] = types.Location{Name: name, ParentID: parent}
+	return ms.lastLocationID, nil
+}
+
+// RenameLocation changes the name of an existing Location
+func (ms *MemoryStore) RenameLocation(id types.LocationID, name string) error {
+	if name == "" {
+		return fmt.Errorf("location must have a name")
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	loc, found := ms.locations[id]
+	if !found {
+		return fmt.Errorf("no location found with id %v", id)
+	}
+	loc.Name = name
+	ms.locations[id] = loc
+	return nil
+}
+
+// MoveLocation places an existing Location within another. If parent is 0,
+// the Location is moved to the top level. A Location may not be moved within
+// itself, or within any of the Locations it contains.
+func (ms *MemoryStore) MoveLocation(id, parent types.LocationID) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	loc, err := ms.location(id)
+	if err != nil {
+		return err
+	}
+	// Walk up from the new parent; if the Location being moved is found, the
+	// move would create a cycle
+	for ancestor := parent; ancestor != 0; {
+		if ancestor == id {
+			return fmt.Errorf("location %v cannot be moved within itself", id)
+		}
+		ancestorLoc, err := ms.location(ancestor)
+		if err != nil {
+			return fmt.Errorf("could not find parent: %v", err)
+		}
+		ancestor = ancestorLoc.ParentID
+	}
+	loc.ParentID = parent
+	ms.locations[id] = loc
+	return nil
+}
+
+// DeleteLocation removes a Location. Any Devices or Locations within it are
+// moved to its parent (or, if it has no parent, are left without a Location).
+func (ms *MemoryStore) DeleteLocation(id types.LocationID) (LocationDeleteResponse, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	loc, err := ms.location(id)
+	if err != nil {
+		return LocationDeleteResponse{}, err
+	}
+	resp := LocationDeleteResponse{Location: loc}
+	for devID, dev := range ms.devices {
+		if dev.locationID == id {
+			dev.locationID = loc.ParentID
+			resp.MovedDevices = append(resp.MovedDevices, devID)
+		}
+	}
+	for locID, child := range ms.locations {
+		if child.ParentID == id {
+			child.ParentID = loc.ParentID
+			ms.locations[locID] = child
+			resp.MovedLocations = append(resp.MovedLocations, locID)
+		}
+	}
+	delete(ms.locations, id)
+
+	// list moved items by ID, as SiftDB does
+	sort.Sort(deviceIDsByValue(resp.MovedDevices))
+	sort.Sort(locationIDsByValue(resp.MovedLocations))
+	return resp, nil
+}
+
+// SetDeviceLocation places a Device in a Location. If the LocationID is 0, the
+// Device is removed from its Location.
+func (ms *MemoryStore) SetDeviceLocation(devID types.DeviceID, locID types.LocationID) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	dev, found := ms.devices[devID]
+	if !found {
+		return fmt.Errorf("no device found with id %v", devID)
+	}
+	if locID != 0 {
+		if _, err := ms.location(locID); err != nil {
+			return fmt.Errorf("could not set location of device %v: %v", devID, err)
+		}
+	}
+	dev.locationID = locID
+	return nil
+}
+
+// GetDeviceLocation returns the LocationID of the Location containing the
+// Device, or 0 if the Device is not in a Location.
+func (ms *MemoryStore) GetDeviceLocation(devID types.DeviceID) (types.LocationID, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	dev, found := ms.devices[devID]
+	if !found {
+		return 0, fmt.Errorf("could not get location of device %v: no device found", devID)
+	}
+	return dev.locationID, nil
+}
+
+//
+// Metadata
+//
+
+// SetDeviceMetadata replaces the user-provided metadata for a Device
+func (ms *MemoryStore) SetDeviceMetadata(id types.DeviceID, md types.Metadata) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, found := ms.devices[id]; !found {
+		return fmt.Errorf("could not set metadata for device %v: no device found", id)
+	}
+	ms.deviceMetadata[id] = copyMetadata(md)
+	return nil
+}
+
+// GetDeviceMetadata returns the user-provided metadata for a Device. If none
+// has been set, the zero Metadata is returned.
+func (ms *MemoryStore) GetDeviceMetadata(id types.DeviceID) (types.Metadata, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return copyMetadata(ms.deviceMetadata[id]), nil
+}
+
+// SetComponentMetadata replaces the user-provided metadata for a Component.
+// Component metadata is kept even if the Component is removed from its Device,
+// and will be applied again if the Component returns.
+func (ms *MemoryStore) SetComponentMetadata(id types.ComponentID, md types.Metadata) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, found := ms.devices[id.DeviceID]; !found {
+		return fmt.Errorf("could not set metadata for component %v: no device found", id)
+	}
+	ms.componentMetadata[id] = copyMetadata(md)
+	return nil
+}
+
+// GetComponentMetadata returns the user-provided metadata for a Component. If
+// none has been set, the zero Metadata is returned.
+func (ms *MemoryStore) GetComponentMetadata(id types.ComponentID) (types.Metadata, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return copyMetadata(ms.componentMetadata[id]), nil
+}
+
+//
+// Adapter credentials
+//
+
+// UpsertAdapterCredential stores a value for the named Adapter, retrievable
+// with the given key. Adapters with different names are segregated from
+// eachother.
+func (ms *MemoryStore) UpsertAdapterCredential(adapterName, key, value string) error {
+	if adapterName == "" || key == "" {
+		return fmt.Errorf("adapter credentials must have an adapter name and key")
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.credentials[credentialKey{adapterName, key}] = value
+	return nil
+}
+
+// GetAdapterCredential retrieves the value stored for the named Adapter with
+// the given key.
+func (ms *MemoryStore) GetAdapterCredential(adapterName, key string) (string, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	value, found := ms.credentials[credentialKey{adapterName, key}]
+	if !found {
+		return "", fmt.Errorf("could not get credentials: none stored for %v with key %v", adapterName, key)
+	}
+	return value, nil
+}
+
+// ListAdapterCredentials returns the keys of the credentials stored for the
+// named Adapter, in sorted order
+func (ms *MemoryStore) ListAdapterCredentials(adapterName string) ([]string, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	keys := []string{}
+	for ck := range ms.credentials {
+		if ck.adapterName == adapterName {
+			keys = append(keys, ck.key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// RevokeAdapterCredential deletes the credential stored for the named Adapter
+// with the given key
+func (ms *MemoryStore) RevokeAdapterCredential(adapterName, key string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ck := credentialKey{adapterName, key}
+	if _, found := ms.credentials[ck]; !found {
+		return fmt.Errorf("no credential %v stored for %v", key, adapterName)
+	}
+	delete(ms.credentials, ck)
+	return nil
+}
+
+// RevokeAdapterCredentials deletes every credential stored for the named
+// Adapter, returning the number deleted
+func (ms *MemoryStore) RevokeAdapterCredentials(adapterName string) (int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	n := 0
+	for ck := range ms.credentials {
+		if ck.adapterName == adapterName {
+			delete(ms.credentials, ck)
+			n++
+		}
+	}
+	return n, nil
+}
+
+//
+// Adapter configuration
+//
+
+// SetAdapterConfig sets a configuration value for the named Adapter
+func (ms *MemoryStore) SetAdapterConfig(adapterName, key, value string) error {
+	if adapterName == "" || key == "" {
+		return fmt.Errorf("adapter config must have an adapter name and key")
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.config[credentialKey{adapterName, key}] = value
+	return nil
+}
+
+// GetAdapterConfig returns every configuration value set for the named
+// Adapter, indexed by key
+func (ms *MemoryStore) GetAdapterConfig(adapterName string) (map[string]string, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	config := make(map[string]string)
+	for ck, value := range ms.config {
+		if ck.adapterName == adapterName {
+			config[ck.key] = value
+		}
+	}
+	return config, nil
+}
+
+// DeleteAdapterConfig deletes the configuration value set for the named
+// Adapter with the given key
+func (ms *MemoryStore) DeleteAdapterConfig(adapterName, key string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ck := credentialKey{adapterName, key}
+	if _, found := ms.config[ck]; !found {
+		return fmt.Errorf("no config %v set for %v", key, adapterName)
+	}
+	delete(ms.config, ck)
+	return nil
+}
+
+// AddStaticService registers an IPv4 service to be handled by the named
+// factory (see SiftDB.AddStaticService)
+func (ms *MemoryStore) AddStaticService(factoryName, ip string, port uint16) (int64, error) {
+	svc := StaticService{FactoryName: factoryName, IP: ip, Port: port}
+	if err := svc.validate(); err != nil {
+		return 0, err
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for _, existing := range ms.staticServices {
+		if existing.FactoryName == factoryName && existing.IP == ip && existing.Port == port {
+			return 0, fmt.Errorf("%v service at %v port %v is already registered", factoryName, ip, port)
+		}
+	}
+	ms.lastStaticID++
+	svc.ID = ms.lastStaticID
+	ms.staticServices[svc.ID] = svc
+	return svc.ID, nil
+}
+
+// GetStaticServices returns every registered StaticService, ordered by ID
+func (ms *MemoryStore) GetStaticServices() ([]StaticService, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	svcs := make([]StaticService, 0, len(ms.staticServices))
+	for _, svc := range ms.staticServices {
+		svcs = append(svcs, svc)
+	}
+	sort.Sort(staticServicesByID(svcs))
+	return svcs, nil
+}
+
+// DeleteStaticService removes the StaticService with the given ID
+func (ms *MemoryStore) DeleteStaticService(id int64) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, found := ms.staticServices[id]; !found {
+		return fmt.Errorf("no static service found with id %v", id)
+	}
+	delete(ms.staticServices, id)
+	return nil
+}
+
+// Close marks all Devices as offline. The contents of the MemoryStore are
+// kept, so it may continue to be used.
+func (ms *MemoryStore) Close() error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for _, dev := range ms.devices {
+		dev.isOnline = false
+	}
+	return nil
+}
+
+//
+// Helper functions
+//
+
+func copyMetadata(md types.Metadata) types.Metadata {
+	if md.Tags != nil {
+		md.Tags = append([]string(nil), md.Tags...)
+	}
+	return md
+}
+
+// storedComponent returns a copy of the Component holding only what SiftDB
+// would store: its Make, Model and State
+func storedComponent(comp types.Component) types.Component {
+	comp = withField(comp, []string{"BaseComponent", "Metadata"}, reflect.Value{})
+	comp = withField(comp, []string{"Specs"}, reflect.Value{})
+	return withField(comp, []string{"Stats"}, reflect.Value{})
+}
+
+// withField returns a copy of the Component with the field at the given path
+// set to value, or to its zero value if value is invalid. If the Component
+// does not have the field, it is returned unchanged.
+func withField(comp types.Component, path []string, value reflect.Value) types.Component {
+	v := reflect.ValueOf(comp)
+	if v.Kind() != reflect.Struct {
+		return comp
+	}
+	copied := reflect.New(v.Type()).Elem()
+	copied.Set(v)
+	field := copied
+	for _, name := range path {
+		if field.Kind() != reflect.Struct {
+			return comp
+		}
+		if field = field.FieldByName(name); !field.IsValid() {
+			return comp
+		}
+	}
+	if !field.CanSet() {
+		return comp
+	}
+	if !value.IsValid() {
+		field.Set(reflect.Zero(field.Type()))
+	} else if value.Type().AssignableTo(field.Type()) {
+		field.Set(value)
+	} else {
+		return comp
+	}
+	return copied.Interface().(types.Component)
+}
+
+// decodeSpecs decodes raw specs into a new value for the Component's Specs
+// field, which must be a pointer to a struct
+func decodeSpecs(comp types.Component, raw json.RawMessage) (reflect.Value, error) {
+	t := reflect.TypeOf(comp)
+	if t.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("components of type %v do not have specs", comp.Type())
+	}
+	field, ok := t.FieldByName("Specs")
+	if !ok || field.Type.Kind() != reflect.Ptr || field.Type.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("components of type %v do not have specs", comp.Type())
+	}
+	specs := reflect.New(field.Type.Elem())
+	if err := json.Unmarshal(raw, specs.Interface()); err != nil {
+		return reflect.Value{}, fmt.Errorf("could not decode %v specs: %v", comp.Type(), err)
+	}
+	return specs, nil
+}
+
+// stateFields returns the values of a Component's State, indexed by the
+// names of their database columns
+func stateFields(comp types.Component) map[string]interface{} {
+	fields := make(map[string]interface{})
+	v := reflect.ValueOf(comp)
+	if v.Kind() != reflect.Struct {
+		return fields
+	}
+	state := v.FieldByName("State")
+	if !state.IsValid() || state.Kind() != reflect.Struct {
+		return fields
+	}
+	for i := 0; i < state.NumField(); i++ {
+		name := state.Type().Field(i).Tag.Get("db")
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = state.Field(i).Interface()
+	}
+	return fields
+}
+
+// validateMemoryQuery checks the Query for the same errors reported by
+// SiftDB
+func validateMemoryQuery(q Query) error {
+	if len(q.predicates) == 0 {
+		return nil
+	}
+	if q.componentType == "" {
+		return fmt.Errorf("query must be limited to a component type to filter by state")
+	}
+	ct, ok := types.LookupComponentType(q.componentType)
+	if !ok {
+		return fmt.Errorf("unhandled component type: %v", q.componentType)
+	}
+	fields := stateFields(ct.New())
+	for _, p := range q.predicates {
+		if _, ok := fields[p.field]; !ok {
+			return fmt.Errorf("unknown state field for %v: %v", q.componentType, p.field)
+		}
+		if !queryOperators[p.op] {
+			return fmt.Errorf("unsupported operator: %v", p.op)
+		}
+	}
+	return nil
+}
+
+func matchesPredicates(comp types.Component, predicates []statePredicate) bool {
+	if len(predicates) == 0 {
+		return true
+	}
+	fields := stateFields(comp)
+	for _, p := range predicates {
+		if !compareValues(fields[p.field], p.op, p.value) {
+			return false
+		}
+	}
+	return true
+}
+
+// compareValues compares two values as SQLite would: numbers (and booleans,
+// which are stored as 0 or 1) are compared by value, strings are compared
+// lexically, and values of different kinds never match
+func compareValues(a interface{}, op string, b interface{}) bool {
+	af, aIsNum := toFloat(a)
+	bf, bIsNum := toFloat(b)
+	var cmp int
+	switch {
+	case aIsNum && bIsNum:
+		if af < bf {
+			cmp = -1
+		} else if af > bf {
+			cmp = 1
+		}
+	case !aIsNum && !bIsNum:
+		as, aIsStr := toString(a)
+		bs, bIsStr := toString(b)
+		if !aIsStr || !bIsStr {
+			return false
+		}
+		cmp = strings.Compare(as, bs)
+	default:
+		return false
+	}
+	switch op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+func toFloat(x interface{}) (float64, bool) {
+	v := reflect.ValueOf(x)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.Bool:
+		if v.Bool() {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func toString(x interface{}) (string, bool) {
+	v := reflect.ValueOf(x)
+	if v.Kind() != reflect.String {
+		return "", false
+	}
+	return v.String(), true
+}
+
+type deviceIDsByValue []types.DeviceID
+
+func (s deviceIDsByValue) Len() int           { return len(s) }
+func (s deviceIDsByValue) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s deviceIDsByValue) Less(i, j int) bool { return s[i] < s[j] }
+
+type locationIDsByValue []types.LocationID
+
+func (s locationIDsByValue) Len() int           { return len(s) }
+func (s locationIDsByValue) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s locationIDsByValue) Less(i, j int) bool { return s[i] < s[j] }
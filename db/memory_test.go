@@ -0,0 +1,106 @@
+package db
+
+import (
+	"github.com/upwrd/sift/types"
+	. "gopkg.in/check.v1"
+)
+
+type MemoryStoreTestSuite struct{}
+
+var _ = Suite(&MemoryStoreTestSuite{})
+
+func (s *MemoryStoreTestSuite) TestUpsertAndGet(c *C) {
+	ms := NewMemoryStore()
+	extID := types.ExternalDeviceID{Manufacturer: "example", ID: "1"}
+	bulb := types.LightEmitter{
+		BaseComponent: types.BaseComponent{Make: "example", Model: "light_emitter_1"},
+		State:         types.LightEmitterState{BrightnessInPercent: 55},
+	}
+	dev := types.Device{
+		Name:     "lamp",
+		IsOnline: true,
+		Components: map[string]types.Component{
+			"bulb":   bulb,
+			"switch": types.Switch{State: types.SwitchState{IsOn: true}},
+		},
+	}
+
+	// devices must have an external ID
+	_, err := ms.UpsertDevice(types.ExternalDeviceID{}, dev)
+	c.Assert(err, NotNil)
+
+	resp, err := ms.UpsertDevice(extID, dev)
+	c.Assert(err, IsNil)
+	c.Assert(resp.DeviceID, Not(Equals), types.DeviceID(0))
+	c.Assert(len(resp.UpsertedComponents), Equals, 2)
+	fromStore, err := ms.GetDevice(resp.DeviceID, ExpandNone)
+	c.Assert(err, IsNil)
+	c.Assert(fromStore, DeepEquals, dev)
+
+	// specs come from the default catalog, and are not stored with the component
+	withSpecs := bulb
+	withSpecs.Specs = &types.LightEmitterSpecs{MaxOutputInLumens: 700, ExpectedLifetimeInHours: 10000}
+	comp, err := ms.GetComponent(types.ComponentID{DeviceID: resp.DeviceID, Name: "bulb"}, ExpandSpecs)
+	c.Assert(err, IsNil)
+	c.Assert(comp, DeepEquals, withSpecs)
+	dev.Components["bulb"] = withSpecs
+	resp, err = ms.UpsertDevice(extID, dev)
+	c.Assert(err, IsNil)
+	c.Assert(len(resp.UpsertedComponents), Equals, 0)
+
+	// components missing from an update are deleted
+	delete(dev.Components, "switch")
+	resp, err = ms.UpsertDevice(extID, dev)
+	c.Assert(err, IsNil)
+	c.Assert(len(resp.DeletedComponents), Equals, 1)
+	comps, err := ms.GetComponents(ExpandNone)
+	c.Assert(err, IsNil)
+	c.Assert(comps, DeepEquals, map[types.ComponentID]types.Component{
+		types.ComponentID{DeviceID: resp.DeviceID, Name: "bulb"}: bulb,
+	})
+	gotExtID, err := ms.GetExternalDeviceID(resp.DeviceID)
+	c.Assert(err, IsNil)
+	c.Assert(gotExtID, Equals, extID)
+
+	// closing the store marks devices offline
+	c.Assert(ms.Close(), IsNil)
+	fromStore, err = ms.GetDevice(resp.DeviceID, ExpandNone)
+	c.Assert(err, IsNil)
+	c.Assert(fromStore.IsOnline, Equals, false)
+}
+
+func (s *MemoryStoreTestSuite) TestUpsertChanges(c *C) {
+	testUpsertChanges(c, NewMemoryStore())
+}
+
+func (s *MemoryStoreTestSuite) TestAdapterCredentials(c *C) {
+	testAdapterCredentials(c, NewMemoryStore())
+}
+
+func (s *MemoryStoreTestSuite) TestDeviceIdentity(c *C) {
+	testDeviceIdentity(c, NewMemoryStore())
+}
+
+func (s *MemoryStoreTestSuite) TestAdapterConfig(c *C) {
+	testAdapterConfig(c, NewMemoryStore())
+}
+
+func (s *MemoryStoreTestSuite) TestStaticServices(c *C) {
+	testStaticServices(c, NewMemoryStore())
+}
+
+func (s *MemoryStoreTestSuite) TestLoadSpecCatalog(c *C) {
+	testLoadSpecCatalog(c, NewMemoryStore())
+}
+
+func (s *MemoryStoreTestSuite) TestFindComponents(c *C) {
+	testFindComponents(c, NewMemoryStore())
+}
+
+func (s *MemoryStoreTestSuite) TestLocations(c *C) {
+	testLocations(c, NewMemoryStore())
+}
+
+func (s *MemoryStoreTestSuite) TestMetadata(c *C) {
+	testMetadata(c, NewMemoryStore())
+}
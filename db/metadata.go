@@ -0,0 +1,158 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/upwrd/sift/types"
+)
+
+// dbMetadata contains fields matching those in the 'device_metadata' and
+// 'component_metadata' tables
+type dbMetadata struct {
+	DisplayName string `db:"display_name"`
+	Icon        string
+	Tags        string // JSON-encoded list of strings
+	Hidden      bool
+}
+
+func dbToMetadata(dbmd dbMetadata) (types.Metadata, error) {
+	md := types.Metadata{
+		DisplayName: dbmd.DisplayName,
+		Icon:        dbmd.Icon,
+		Hidden:      dbmd.Hidden,
+	}
+	if dbmd.Tags != "" {
+		if err := json.Unmarshal([]byte(dbmd.Tags), &md.Tags); err != nil {
+			return types.Metadata{}, fmt.Errorf("could not decode tags: %v", err)
+		}
+	}
+	return md, nil
+}
+
+func encodeTags(tags []string) (string, error) {
+	if len(tags) == 0 {
+		return "", nil
+	}
+	encoded, err := json.Marshal(tags)
+	if err != nil {
+		return "", fmt.Errorf("could not encode tags: %v", err)
+	}
+	return string(encoded), nil
+}
+
+func getDeviceMetadataTx(tx siftTx, id types.DeviceID) (types.Metadata, bool, error) {
+	var dbmd dbMetadata
+	q := "SELECT display_name, icon, tags, hidden FROM device_metadata WHERE device_id=?"
+	if err := tx.Get(&dbmd, q, id); err == sql.ErrNoRows {
+		return types.Metadata{}, false, nil
+	} else if err != nil {
+		return types.Metadata{}, false, fmt.Errorf("error getting device metadata: %v", err)
+	}
+	md, err := dbToMetadata(dbmd)
+	return md, err == nil, err
+}
+
+func getComponentMetadataTx(tx siftTx, id types.ComponentID) (types.Metadata, bool, error) {
+	var dbmd dbMetadata
+	q := "SELECT display_name, icon, tags, hidden FROM component_metadata WHERE device_id=? AND component_name=?"
+	if err := tx.Get(&dbmd, q, id.DeviceID, id.Name); err == sql.ErrNoRows {
+		return types.Metadata{}, false, nil
+	} else if err != nil {
+		return types.Metadata{}, false, fmt.Errorf("error getting component metadata: %v", err)
+	}
+	md, err := dbToMetadata(dbmd)
+	return md, err == nil, err
+}
+
+// SetDeviceMetadata replaces the user-provided metadata for a Device. Metadata
+// is stored separately from the values reported by Adapters, so it is not
+// affected by UpsertDevice.
+func (sdb *SiftDB) SetDeviceMetadata(id types.DeviceID, md types.Metadata) error {
+	return setDeviceMetadataTx(sdb.db, id, md)
+}
+
+// setDeviceMetadataTx replaces the metadata for a Device, using either a
+// transaction or the connection pool
+func setDeviceMetadataTx(tx types.StorageTx, id types.DeviceID, md types.Metadata) error {
+	tags, err := encodeTags(md.Tags)
+	if err != nil {
+		return err
+	}
+	// Try updating
+	q := "UPDATE device_metadata SET display_name=?, icon=?, tags=?, hidden=? WHERE device_id=?"
+	res, err := tx.Exec(q, md.DisplayName, md.Icon, tags, md.Hidden, id)
+	if err != nil {
+		return fmt.Errorf("could not set metadata for device %v: %v", id, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("error getting row count (required for update): %v", err)
+	} else if n == 0 {
+		// The update failed, do an insert instead
+		q = "INSERT INTO device_metadata (device_id, display_name, icon, tags, hidden) VALUES (?, ?, ?, ?, ?)"
+		if _, err := tx.Exec(q, id, md.DisplayName, md.Icon, tags, md.Hidden); err != nil {
+			return fmt.Errorf("could not set metadata for device %v: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// GetDeviceMetadata returns the user-provided metadata for a Device. If none
+// has been set, the zero Metadata is returned.
+func (sdb *SiftDB) GetDeviceMetadata(id types.DeviceID) (md types.Metadata, err error) {
+	// begin a database transaction
+	tx, err := sdb.db.Beginx()
+	if err != nil {
+		return types.Metadata{}, fmt.Errorf("could not begin transaction: %v", err)
+	}
+	defer tx.Rollback() // read-only
+
+	md, _, err = getDeviceMetadataTx(tx, id)
+	return
+}
+
+// SetComponentMetadata replaces the user-provided metadata for a Component.
+// Component metadata is kept even if the Component is removed from its Device,
+// and will be applied again if the Component returns.
+func (sdb *SiftDB) SetComponentMetadata(id types.ComponentID, md types.Metadata) error {
+	return setComponentMetadataTx(sdb.db, id, md)
+}
+
+// setComponentMetadataTx replaces the metadata for a Component, using either
+// a transaction or the connection pool
+func setComponentMetadataTx(tx types.StorageTx, id types.ComponentID, md types.Metadata) error {
+	tags, err := encodeTags(md.Tags)
+	if err != nil {
+		return err
+	}
+	// Try updating
+	q := "UPDATE component_metadata SET display_name=?, icon=?, tags=?, hidden=? WHERE device_id=? AND component_name=?"
+	res, err := tx.Exec(q, md.DisplayName, md.Icon, tags, md.Hidden, id.DeviceID, id.Name)
+	if err != nil {
+		return fmt.Errorf("could not set metadata for component %v: %v", id, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("error getting row count (required for update): %v", err)
+	} else if n == 0 {
+		// The update failed, do an insert instead
+		q = "INSERT INTO component_metadata (device_id, component_name, display_name, icon, tags, hidden) VALUES (?, ?, ?, ?, ?, ?)"
+		if _, err := tx.Exec(q, id.DeviceID, id.Name, md.DisplayName, md.Icon, tags, md.Hidden); err != nil {
+			return fmt.Errorf("could not set metadata for component %v: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// GetComponentMetadata returns the user-provided metadata for a Component. If
+// none has been set, the zero Metadata is returned.
+func (sdb *SiftDB) GetComponentMetadata(id types.ComponentID) (md types.Metadata, err error) {
+	// begin a database transaction
+	tx, err := sdb.db.Beginx()
+	if err != nil {
+		return types.Metadata{}, fmt.Errorf("could not begin transaction: %v", err)
+	}
+	defer tx.Rollback() // read-only
+
+	md, _, err = getComponentMetadataTx(tx, id)
+	return
+}
@@ -0,0 +1,263 @@
+package db
+
+import (
+	"fmt"
+	"github.com/upwrd/sift/types"
+	"strings"
+)
+
+// A Query describes a set of Components in the SIFT database, so that apps can
+// find Components without depending on the database schema. The zero Query
+// matches every Component; each method returns a copy of the Query narrowed by
+// an additional filter. For example, to find all playing media players:
+//
+//	q := db.Query{}.
+//		OfType(types.ComponentTypeMediaPlayer).
+//		Where("play_state", "=", types.MediaPlayerStatePlaying)
+//	players, err := siftDB.FindComponents(q, db.ExpandNone)
+type Query struct {
+	componentType    string
+	locationID       *types.LocationID
+	locationOfDevice *types.DeviceID
+	make, model      string
+	isOnline         *bool
+	predicates       []statePredicate
+}
+
+// a statePredicate compares a column of a Component's state to a value
+type statePredicate struct {
+	field string
+	op    string
+	value interface{}
+}
+
+// operators which may be used in Query.Where
+var queryOperators = map[string]bool{
+	"=":  true,
+	"!=": true,
+	"<":  true,
+	"<=": true,
+	">":  true,
+	">=": true,
+}
+
+// OfType limits the Query to Components of the given type, e.g.
+// types.ComponentTypeLightEmitter
+func (q Query) OfType(componentType string) Query {
+	q.componentType = componentType
+	return q
+}
+
+// InLocation limits the Query to Components of Devices in the given Location,
+// including any Locations nested within it
+func (q Query) InLocation(locationID types.LocationID) Query {
+	q.locationID = &locationID
+	return q
+}
+
+// InLocationOf limits the Query to Components of Devices in the same location
+// as the given Device. If that Device has no location, nothing will match.
+func (q Query) InLocationOf(id types.DeviceID) Query {
+	q.locationOfDevice = &id
+	return q
+}
+
+// WithMakeModel limits the Query to Components with the given make and model.
+// An empty make or model matches any.
+func (q Query) WithMakeModel(make, model string) Query {
+	q.make, q.model = make, model
+	return q
+}
+
+// Online limits the Query to Components of Devices which are (or are not)
+// online
+func (q Query) Online(isOnline bool) Query {
+	q.isOnline = &isOnline
+	return q
+}
+
+// Where limits the Query to Components whose state field compares to value
+// using op, which is one of =, !=, <, <=, > or >=. Fields are named as they
+// are in the database, e.g. Where("play_state", "=", "PLAYING"). Where may
+// only be used on a Query which has been limited to a single type with
+// OfType.
+func (q Query) Where(field, op string, value interface{}) Query {
+	// copy the predicates, so that Queries derived from the same parent do not
+	// share them
+	predicates := make([]statePredicate, len(q.predicates), len(q.predicates)+1)
+	copy(predicates, q.predicates)
+	q.predicates = append(predicates, statePredicate{field: field, op: op, value: value})
+	return q
+}
+
+// buildTx builds the SQL for the Query, selecting the given columns. Component
+// columns are prefixed with 'c.', Device columns with 'd.'
+func (q Query) buildTx(tx siftTx, columns string) (string, []interface{}, error) {
+	from := "component c JOIN device d ON c.device_id=d.id"
+	where := []string{}
+	args := []interface{}{}
+
+	if q.componentType != "" {
+		where = append(where, "c.type=?")
+		args = append(args, q.componentType)
+	}
+	if q.locationID != nil {
+		where = append(where, `d.location_id IN (
+			WITH RECURSIVE within(id) AS (
+				SELECT CAST(? AS INTEGER) UNION SELECT l.id FROM location l JOIN within w ON l.parent_id=w.id)
+			SELECT id FROM within)`)
+		args = append(args, *q.locationID)
+	}
+	if q.locationOfDevice != nil {
+		where = append(where, "d.location_id=(SELECT location_id FROM device WHERE id=?)")
+		args = append(args, *q.locationOfDevice)
+	}
+	if q.make != "" {
+		where = append(where, "c.make=?")
+		args = append(args, q.make)
+	}
+	if q.model != "" {
+		where = append(where, "c.model=?")
+		args = append(args, q.model)
+	}
+	if q.isOnline != nil {
+		where = append(where, "d.is_online=?")
+		args = append(args, *q.isOnline)
+	}
+
+	if len(q.predicates) > 0 {
+		if q.componentType == "" {
+			return "", nil, fmt.Errorf("query must be limited to a component type to filter by state")
+		}
+		storage, err := componentStorage(q.componentType)
+		if err != nil {
+			return "", nil, err
+		}
+		queryable, ok := storage.(types.QueryableStorage)
+		if !ok {
+			return "", nil, fmt.Errorf("components of type %v cannot be filtered by state", q.componentType)
+		}
+		table := queryable.StateTable()
+		fields, err := stateFieldsTx(tx, table)
+		if err != nil {
+			return "", nil, err
+		}
+		from += " JOIN " + table + " s ON s.id=c.id"
+		for _, p := range q.predicates {
+			if !fields[p.field] {
+				return "", nil, fmt.Errorf("unknown state field for %v: %v", q.componentType, p.field)
+			}
+			if !queryOperators[p.op] {
+				return "", nil, fmt.Errorf("unsupported operator: %v", p.op)
+			}
+			// the field and operator have been validated above, so they may
+			// be safely included in the query
+			where = append(where, "s."+p.field+p.op+"?")
+			args = append(args, p.value)
+		}
+	}
+
+	sql := "SELECT " + columns + " FROM " + from
+	if len(where) > 0 {
+		sql += " WHERE " + strings.Join(where, " AND ")
+	}
+	return sql, args, nil
+}
+
+// stateFieldsTx returns the set of fields which may be queried in a state
+// table
+func stateFieldsTx(tx siftTx, table string) (map[string]bool, error) {
+	names, err := tableColumns(tx, table)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]bool, len(names))
+	for _, name := range names {
+		if name != "id" {
+			fields[name] = true
+		}
+	}
+	return fields, nil
+}
+
+// FindComponents returns the Components matching the Query, indexed by their
+// SIFT-internal ComponentIDs, and expanded to the degree indicated by exFlags
+func (sdb *SiftDB) FindComponents(q Query, exFlags ExpansionFlags) (comps map[types.ComponentID]types.Component, err error) {
+	// begin a database transaction
+	tx, err := sdb.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("could not begin transaction: %v", err)
+	}
+	// If something bad happens, roll back the transaction
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				sdb.log.Error("could not roll back db transaction", "original_err", err, "rollback_err", rbErr)
+			}
+			sdb.log.Warn("rolled back db transaction", "original_err", err)
+		} else {
+			if cmErr := tx.Commit(); cmErr != nil {
+				sdb.log.Error("could not commit transaction", "commit_err", cmErr)
+			}
+			sdb.log.Debug("components found; transaction committed", "num_found", len(comps))
+		}
+	}()
+
+	query, args, err := q.buildTx(tx, "c.id, c.device_id")
+	if err != nil {
+		err = fmt.Errorf("invalid query: %v", err)
+		return
+	}
+	type result struct {
+		ID       int64
+		DeviceID int64 `db:"device_id"`
+	}
+	results := []result{}
+	if err = tx.Select(&results, query, args...); err != nil {
+		err = fmt.Errorf("error running query: %v", err)
+		return
+	}
+
+	comps = make(map[types.ComponentID]types.Component, len(results))
+	for _, result := range results {
+		name, comp, getErr := getComponentTx(tx, result.ID, exFlags)
+		if getErr != nil {
+			err = fmt.Errorf("error getting component with ID %v: %v", result.ID, getErr)
+			return
+		}
+		comps[types.ComponentID{DeviceID: types.DeviceID(result.DeviceID), Name: name}] = comp
+	}
+	return
+}
+
+// CountComponents returns the number of Components matching the Query
+func (sdb *SiftDB) CountComponents(q Query) (n int, err error) {
+	// begin a database transaction
+	tx, err := sdb.db.Beginx()
+	if err != nil {
+		return 0, fmt.Errorf("could not begin transaction: %v", err)
+	}
+	// If something bad happens, roll back the transaction
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				sdb.log.Error("could not roll back db transaction", "original_err", err, "rollback_err", rbErr)
+			}
+			sdb.log.Warn("rolled back db transaction", "original_err", err)
+		} else {
+			if cmErr := tx.Commit(); cmErr != nil {
+				sdb.log.Error("could not commit transaction", "commit_err", cmErr)
+			}
+		}
+	}()
+
+	query, args, err := q.buildTx(tx, "COUNT(*)")
+	if err != nil {
+		err = fmt.Errorf("invalid query: %v", err)
+		return
+	}
+	if err = tx.Get(&n, query, args...); err != nil {
+		err = fmt.Errorf("error running query: %v", err)
+	}
+	return
+}
@@ -15,9 +15,36 @@ CREATE TABLE IF NOT EXISTS adapter_credential (
 CREATE UNIQUE INDEX IF NOT EXISTS adapter_credential_by_adapter_name_key
     ON adapter_credential ( adapter_name, key );
 
+CREATE TABLE IF NOT EXISTS adapter_config (
+	id INTEGER PRIMARY KEY,
+	adapter_name TEXT NOT NULL,
+	key TEXT NOT NULL,
+	value TEXT NOT NULL,
+	CHECK(adapter_name <> ''),
+	CHECK(key <> '')
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS adapter_config_by_adapter_name_key
+    ON adapter_config ( adapter_name, key );
+
+CREATE TABLE IF NOT EXISTS static_service (
+	id INTEGER PRIMARY KEY,
+	factory_name TEXT NOT NULL,
+	ip TEXT NOT NULL,
+	port INTEGER NOT NULL,
+	CHECK(factory_name <> ''),
+	CHECK(ip <> ''),
+	CHECK(port >= 0 AND port <= 65535)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS static_service_by_factory_name_ip_port
+    ON static_service ( factory_name, ip, port );
+
 CREATE TABLE IF NOT EXISTS location (
     id INTEGER PRIMARY KEY,
-    name TEXT NOT NULL
+    name TEXT NOT NULL,
+    parent_id INTEGER,
+    FOREIGN KEY (parent_id) REFERENCES location(id)
 );
 
 CREATE TABLE IF NOT EXISTS device (
@@ -36,6 +63,34 @@ CREATE TABLE IF NOT EXISTS device (
 CREATE UNIQUE INDEX IF NOT EXISTS device_by_manufacturer_external_id
     ON device ( manufacturer, external_id );
 
+-- other external IDs under which a device is known, e.g. when it is reported
+-- by several adapters
+CREATE TABLE IF NOT EXISTS device_alias (
+    id INTEGER PRIMARY KEY,
+    device_id INTEGER NOT NULL,
+    manufacturer TEXT NOT NULL,
+    external_id TEXT NOT NULL,
+    FOREIGN KEY (device_id) REFERENCES device(id),
+    CHECK(manufacturer <> ''),
+    CHECK(external_id <> '')
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS device_alias_by_manufacturer_external_id
+    ON device_alias ( manufacturer, external_id );
+
+CREATE TABLE IF NOT EXISTS device_identifier (
+    device_id INTEGER NOT NULL,
+    kind TEXT NOT NULL,
+    value TEXT NOT NULL,
+    PRIMARY KEY (device_id, kind),
+    FOREIGN KEY (device_id) REFERENCES device(id),
+    CHECK(kind <> ''),
+    CHECK(value <> '')
+);
+
+CREATE INDEX IF NOT EXISTS device_identifier_by_kind_value
+    ON device_identifier ( kind, value );
+
 CREATE TABLE IF NOT EXISTS component (
     id INTEGER PRIMARY KEY,
     device_id INTEGER,
@@ -53,6 +108,30 @@ CREATE TABLE IF NOT EXISTS component (
 CREATE UNIQUE INDEX IF NOT EXISTS component_by_device_and_name
     ON component ( device_id, name );
 
+--
+-- user-provided metadata, which is never written by adapters
+--
+
+CREATE TABLE IF NOT EXISTS device_metadata (
+    device_id INTEGER PRIMARY KEY,
+    display_name TEXT NOT NULL DEFAULT '',
+    icon TEXT NOT NULL DEFAULT '',
+    tags TEXT NOT NULL DEFAULT '',
+    hidden INTEGER NOT NULL DEFAULT 0,
+    FOREIGN KEY (device_id) REFERENCES device(id)
+);
+
+CREATE TABLE IF NOT EXISTS component_metadata (
+    device_id INTEGER NOT NULL,
+    component_name TEXT NOT NULL,
+    display_name TEXT NOT NULL DEFAULT '',
+    icon TEXT NOT NULL DEFAULT '',
+    tags TEXT NOT NULL DEFAULT '',
+    hidden INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (device_id, component_name),
+    FOREIGN KEY (device_id) REFERENCES device(id)
+);
+
 
 --
 -- light emitters
@@ -107,4 +186,62 @@ CREATE UNIQUE INDEX IF NOT EXISTS media_player_spec_by_make_model
 CREATE TABLE IF NOT EXISTS media_player_stats (
     id INTEGER PRIMARY KEY,
     hours_on INTEGER
+);
+
+--
+-- switches
+--
+
+CREATE TABLE IF NOT EXISTS switch_state (
+    id INTEGER PRIMARY KEY,
+    is_on INTEGER NOT NULL,
+    power_draw_in_watts REAL,
+    FOREIGN KEY (id) REFERENCES component(id),
+    CHECK(id <> 0)
+);
+
+CREATE TABLE IF NOT EXISTS switch_spec (
+    make TEXT NOT NULL,
+    model TEXT NOT NULL,
+    max_load_in_watts REAL,
+    is_metered INTEGER NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS switch_spec_by_make_model
+    ON switch_spec ( make, model );
+
+CREATE TABLE IF NOT EXISTS switch_stats (
+    id INTEGER PRIMARY KEY,
+    hours_on INTEGER
+);
+
+--
+-- thermostats
+--
+
+CREATE TABLE IF NOT EXISTS thermostat_state (
+    id INTEGER PRIMARY KEY,
+    mode TEXT,
+    current_temp_in_celsius REAL,
+    heat_setpoint_in_celsius REAL,
+    cool_setpoint_in_celsius REAL,
+    FOREIGN KEY (id) REFERENCES component(id),
+    CHECK(id <> 0)
+);
+
+CREATE TABLE IF NOT EXISTS thermostat_spec (
+    make TEXT NOT NULL,
+    model TEXT NOT NULL,
+    supported_modes TEXT NOT NULL, -- OFF,HEAT,COOL,AUTO
+    min_setpoint_in_celsius REAL,
+    max_setpoint_in_celsius REAL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS thermostat_spec_by_make_model
+    ON thermostat_spec ( make, model );
+
+CREATE TABLE IF NOT EXISTS thermostat_stats (
+    id INTEGER PRIMARY KEY,
+    hours_heating INTEGER,
+    hours_cooling INTEGER
 );`
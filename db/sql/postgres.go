@@ -0,0 +1,247 @@
+package sql
+
+// PostgresInitSql is a collection of PostgreSQL statements used to initialize
+// a SIFT database. It matches InitSql, with types adjusted for PostgreSQL.
+var PostgresInitSql = `
+CREATE TABLE IF NOT EXISTS adapter_credential (
+	id SERIAL PRIMARY KEY,
+	adapter_name TEXT NOT NULL,
+	key TEXT NOT NULL,
+	value TEXT,
+	CHECK(adapter_name <> ''),
+	CHECK(key <> '')
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS adapter_credential_by_adapter_name_key
+    ON adapter_credential ( adapter_name, key );
+
+CREATE TABLE IF NOT EXISTS adapter_config (
+	id SERIAL PRIMARY KEY,
+	adapter_name TEXT NOT NULL,
+	key TEXT NOT NULL,
+	value TEXT NOT NULL,
+	CHECK(adapter_name <> ''),
+	CHECK(key <> '')
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS adapter_config_by_adapter_name_key
+    ON adapter_config ( adapter_name, key );
+
+CREATE TABLE IF NOT EXISTS static_service (
+	id SERIAL PRIMARY KEY,
+	factory_name TEXT NOT NULL,
+	ip TEXT NOT NULL,
+	port INTEGER NOT NULL,
+	CHECK(factory_name <> ''),
+	CHECK(ip <> ''),
+	CHECK(port >= 0 AND port <= 65535)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS static_service_by_factory_name_ip_port
+    ON static_service ( factory_name, ip, port );
+
+CREATE TABLE IF NOT EXISTS location (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    parent_id INTEGER,
+    FOREIGN KEY (parent_id) REFERENCES location(id)
+);
+
+CREATE TABLE IF NOT EXISTS device (
+    id SERIAL PRIMARY KEY,
+    manufacturer TEXT NOT NULL,
+    external_id TEXT NOT NULL,
+    name TEXT,
+    location_id INTEGER,
+    is_online BOOLEAN NOT NULL,
+    FOREIGN KEY (location_id) REFERENCES location(id),
+    CHECK(manufacturer <> ''),
+    CHECK(external_id <> ''),
+    CHECK(id <> 0)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS device_by_manufacturer_external_id
+    ON device ( manufacturer, external_id );
+
+-- other external IDs under which a device is known, e.g. when it is reported
+-- by several adapters
+CREATE TABLE IF NOT EXISTS device_alias (
+    id SERIAL PRIMARY KEY,
+    device_id INTEGER NOT NULL,
+    manufacturer TEXT NOT NULL,
+    external_id TEXT NOT NULL,
+    FOREIGN KEY (device_id) REFERENCES device(id),
+    CHECK(manufacturer <> ''),
+    CHECK(external_id <> '')
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS device_alias_by_manufacturer_external_id
+    ON device_alias ( manufacturer, external_id );
+
+CREATE TABLE IF NOT EXISTS device_identifier (
+    device_id INTEGER NOT NULL,
+    kind TEXT NOT NULL,
+    value TEXT NOT NULL,
+    PRIMARY KEY (device_id, kind),
+    FOREIGN KEY (device_id) REFERENCES device(id),
+    CHECK(kind <> ''),
+    CHECK(value <> '')
+);
+
+CREATE INDEX IF NOT EXISTS device_identifier_by_kind_value
+    ON device_identifier ( kind, value );
+
+CREATE TABLE IF NOT EXISTS component (
+    id SERIAL PRIMARY KEY,
+    device_id INTEGER,
+    name TEXT NOT NULL,
+    make TEXT NOT NULL,
+    model TEXT NOT NULL,
+    type TEXT NOT NULL,
+    FOREIGN KEY (device_id) REFERENCES device(id),
+    CHECK(name <> ''),
+    CHECK(device_id <> 0),
+    CHECK(type <> ''),
+    UNIQUE(name, device_id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS component_by_device_and_name
+    ON component ( device_id, name );
+
+--
+-- user-provided metadata, which is never written by adapters
+--
+
+CREATE TABLE IF NOT EXISTS device_metadata (
+    device_id INTEGER PRIMARY KEY,
+    display_name TEXT NOT NULL DEFAULT '',
+    icon TEXT NOT NULL DEFAULT '',
+    tags TEXT NOT NULL DEFAULT '',
+    hidden BOOLEAN NOT NULL DEFAULT FALSE,
+    FOREIGN KEY (device_id) REFERENCES device(id)
+);
+
+CREATE TABLE IF NOT EXISTS component_metadata (
+    device_id INTEGER NOT NULL,
+    component_name TEXT NOT NULL,
+    display_name TEXT NOT NULL DEFAULT '',
+    icon TEXT NOT NULL DEFAULT '',
+    tags TEXT NOT NULL DEFAULT '',
+    hidden BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (device_id, component_name),
+    FOREIGN KEY (device_id) REFERENCES device(id)
+);
+
+
+--
+-- light emitters
+--
+
+CREATE TABLE IF NOT EXISTS light_emitter_state (
+    id INTEGER PRIMARY KEY,
+    brightness_in_percent INTEGER,
+    FOREIGN KEY (id) REFERENCES component(id),
+    CHECK(id <> 0)
+);
+
+CREATE TABLE IF NOT EXISTS light_emitter_spec (
+    make TEXT NOT NULL, -- Electro
+    model TEXT NOT NULL, -- HydroFlex0.0.1
+    max_output_in_lumens INTEGER,
+    min_output_in_lumens INTEGER,
+    expected_lifetime_in_hours INTEGER
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS light_emitter_spec_by_make_model
+    ON light_emitter_spec ( make, model );
+
+CREATE TABLE IF NOT EXISTS light_emitter_stats (
+    id INTEGER PRIMARY KEY,
+    hours_on INTEGER
+);
+
+--
+-- media players
+--
+
+CREATE TABLE IF NOT EXISTS media_player_state (
+    id INTEGER PRIMARY KEY,
+    play_state TEXT,
+    media_type TEXT,
+    source TEXT,
+    FOREIGN KEY (id) REFERENCES component(id),
+    CHECK(id <> 0)
+);
+
+CREATE TABLE IF NOT EXISTS media_player_spec (
+    make TEXT NOT NULL, -- Electro
+    model TEXT NOT NULL, -- HydroFlex0.0.1
+    supported_audio_types TEXT NOT NULL,
+    supported_video_types TEXT NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS media_player_spec_by_make_model
+    ON media_player_spec ( make, model );
+
+CREATE TABLE IF NOT EXISTS media_player_stats (
+    id INTEGER PRIMARY KEY,
+    hours_on INTEGER
+);
+
+--
+-- switches
+--
+
+CREATE TABLE IF NOT EXISTS switch_state (
+    id INTEGER PRIMARY KEY,
+    is_on BOOLEAN NOT NULL,
+    power_draw_in_watts DOUBLE PRECISION,
+    FOREIGN KEY (id) REFERENCES component(id),
+    CHECK(id <> 0)
+);
+
+CREATE TABLE IF NOT EXISTS switch_spec (
+    make TEXT NOT NULL,
+    model TEXT NOT NULL,
+    max_load_in_watts DOUBLE PRECISION,
+    is_metered BOOLEAN NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS switch_spec_by_make_model
+    ON switch_spec ( make, model );
+
+CREATE TABLE IF NOT EXISTS switch_stats (
+    id INTEGER PRIMARY KEY,
+    hours_on INTEGER
+);
+
+--
+-- thermostats
+--
+
+CREATE TABLE IF NOT EXISTS thermostat_state (
+    id INTEGER PRIMARY KEY,
+    mode TEXT,
+    current_temp_in_celsius DOUBLE PRECISION,
+    heat_setpoint_in_celsius DOUBLE PRECISION,
+    cool_setpoint_in_celsius DOUBLE PRECISION,
+    FOREIGN KEY (id) REFERENCES component(id),
+    CHECK(id <> 0)
+);
+
+CREATE TABLE IF NOT EXISTS thermostat_spec (
+    make TEXT NOT NULL,
+    model TEXT NOT NULL,
+    supported_modes TEXT NOT NULL, -- OFF,HEAT,COOL,AUTO
+    min_setpoint_in_celsius DOUBLE PRECISION,
+    max_setpoint_in_celsius DOUBLE PRECISION
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS thermostat_spec_by_make_model
+    ON thermostat_spec ( make, model );
+
+CREATE TABLE IF NOT EXISTS thermostat_stats (
+    id INTEGER PRIMARY KEY,
+    hours_heating INTEGER,
+    hours_cooling INTEGER
+);`
@@ -0,0 +1,58 @@
+package sql
+
+// DefaultSpecCatalog is a spec catalog (see db.SiftDB.LoadSpecCatalog) which
+// is loaded into each new SIFT database. It contains the specs of known
+// Components, indexed by component type.
+var DefaultSpecCatalog = `{
+	"light_emitter": [
+		{
+			"make": "example",
+			"model": "light_emitter_1",
+			"specs": {
+				"max_output_in_lumens": 700,
+				"min_output_in_lumens": 0,
+				"expected_lifetime_in_hours": 10000
+			}
+		},
+		{
+			"make": "connected_by_tcp",
+			"model": "bulb",
+			"specs": {
+				"max_output_in_lumens": 950,
+				"min_output_in_lumens": 0,
+				"expected_lifetime_in_hours": 199728
+			}
+		}
+	],
+	"media_player": [
+		{
+			"make": "Google",
+			"model": "Chromecast",
+			"specs": {
+				"supported_audio_types": "AAC,MP3,OPUS,VORBIS,WAV,FLAC",
+				"supported_video_types": "H.264,VP8,VP9"
+			}
+		}
+	],
+	"switch": [
+		{
+			"make": "example",
+			"model": "outlet_1",
+			"specs": {
+				"max_load_in_watts": 1800,
+				"is_metered": true
+			}
+		}
+	],
+	"thermostat": [
+		{
+			"make": "example",
+			"model": "thermostat_1",
+			"specs": {
+				"supported_modes": "OFF,HEAT,COOL,AUTO",
+				"min_setpoint_in_celsius": 10,
+				"max_setpoint_in_celsius": 32
+			}
+		}
+	]
+}`
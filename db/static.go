@@ -0,0 +1,124 @@
+package db
+
+import (
+	"fmt"
+	"net"
+)
+
+// A StaticService is an IPv4 service which has been registered manually,
+// rather than found by scanning. The server hands each StaticService directly
+// to the named factory (see sift.Server.RegisterStaticService).
+type StaticService struct {
+	ID          int64  `db:"id" json:"-"`
+	FactoryName string `db:"factory_name" json:"factory_name"`
+	IP          string `db:"ip" json:"ip"`
+	Port        uint16 `db:"port" json:"port,omitempty"` // 0 if the factory should use its default
+}
+
+func (svc StaticService) validate() error {
+	if svc.FactoryName == "" {
+		return fmt.Errorf("static service must have a factory name")
+	}
+	if ip := net.ParseIP(svc.IP); ip == nil || ip.To4() == nil {
+		return fmt.Errorf("%q is not an IPv4 address", svc.IP)
+	}
+	return nil
+}
+
+// AddStaticService registers an IPv4 service at the given IP and port, to be
+// handled by the named factory, and returns its ID. The same service may not
+// be registered twice.
+func (sdb *SiftDB) AddStaticService(factoryName, ip string, port uint16) (id int64, err error) {
+	svc := StaticService{FactoryName: factoryName, IP: ip, Port: port}
+	if err := svc.validate(); err != nil {
+		return 0, err
+	}
+	// begin a database transaction
+	tx, err := sdb.db.Beginx()
+	if err != nil {
+		return 0, fmt.Errorf("could not begin transaction: %v", err)
+	}
+	// If something bad happens, roll back the transaction
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				sdb.log.Error("could not roll back db transaction", "original_err", err, "rollback_err", rbErr)
+			}
+			sdb.log.Warn("rolled back db transaction", "original_err", err)
+		} else {
+			if cmErr := tx.Commit(); cmErr != nil {
+				sdb.log.Error("could not commit transaction", "commit_err", cmErr)
+				err = fmt.Errorf("could not commit transaction: %v", cmErr)
+			}
+			sdb.log.Debug("static service added; transaction committed", "id", id)
+		}
+	}()
+
+	id, err = addStaticServiceTx(tx, svc)
+	return
+}
+
+func addStaticServiceTx(tx siftTx, svc StaticService) (int64, error) {
+	var n int
+	q := "SELECT COUNT(*) FROM static_service WHERE factory_name=? AND ip=? AND port=?"
+	if err := tx.Get(&n, q, svc.FactoryName, svc.IP, svc.Port); err != nil {
+		return 0, fmt.Errorf("could not check for existing static service: %v", err)
+	}
+	if n > 0 {
+		return 0, fmt.Errorf("%v service at %v port %v is already registered", svc.FactoryName, svc.IP, svc.Port)
+	}
+	q = "INSERT INTO static_service (factory_name, ip, port) VALUES (?, ?, ?)"
+	id, err := insertReturningID(tx, q, svc.FactoryName, svc.IP, svc.Port)
+	if err != nil {
+		return 0, fmt.Errorf("error inserting static service: %v", err)
+	}
+	return id, nil
+}
+
+// GetStaticServices returns every registered StaticService, ordered by ID
+func (sdb *SiftDB) GetStaticServices() ([]StaticService, error) {
+	svcs := []StaticService{}
+	if err := sdb.db.Select(&svcs, "SELECT id, factory_name, ip, port FROM static_service ORDER BY id"); err != nil {
+		return nil, fmt.Errorf("could not get static services: %v", err)
+	}
+	return svcs, nil
+}
+
+// DeleteStaticService removes the StaticService with the given ID. Any
+// Adapter already handling the service is not stopped.
+func (sdb *SiftDB) DeleteStaticService(id int64) error {
+	res, err := sdb.db.Exec("DELETE FROM static_service WHERE id=?", id)
+	if err != nil {
+		return fmt.Errorf("could not delete static service %v: %v", id, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("error getting row count: %v", err)
+	} else if n == 0 {
+		return fmt.Errorf("no static service found with id %v", id)
+	}
+	return nil
+}
+
+// importStaticServiceTx adds an exported StaticService, unless the same
+// service is already registered
+func importStaticServiceTx(tx siftTx, svc StaticService) error {
+	if err := svc.validate(); err != nil {
+		return err
+	}
+	var n int
+	q := "SELECT COUNT(*) FROM static_service WHERE factory_name=? AND ip=? AND port=?"
+	if err := tx.Get(&n, q, svc.FactoryName, svc.IP, svc.Port); err != nil {
+		return fmt.Errorf("could not check for existing static service: %v", err)
+	}
+	if n > 0 {
+		return nil
+	}
+	_, err := addStaticServiceTx(tx, svc)
+	return err
+}
+
+type staticServicesByID []StaticService
+
+func (s staticServicesByID) Len() int           { return len(s) }
+func (s staticServicesByID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s staticServicesByID) Less(i, j int) bool { return s[i].ID < s[j].ID }
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"github.com/upwrd/sift/types"
+	"io"
+)
+
+// A Store persists the state of SIFT: Devices and their Components,
+// Locations, user-provided metadata, Adapter credentials and configuration,
+// and manually registered services. SiftDB (backed by SQLite or PostgreSQL)
+// and MemoryStore both implement Store.
+type Store interface {
+	// Devices and Components
+	UpsertDevice(extID types.ExternalDeviceID, d types.Device) (DeviceUpsertResponse, error)
+	GetDevices(exFlags ExpansionFlags) (map[types.DeviceID]types.Device, error)
+	GetDevice(id types.DeviceID, exFlags ExpansionFlags) (types.Device, error)
+	GetExternalDeviceID(id types.DeviceID) (types.ExternalDeviceID, error)
+	GetComponents(exFlags ExpansionFlags) (map[types.ComponentID]types.Component, error)
+	GetComponent(id types.ComponentID, exFlags ExpansionFlags) (types.Component, error)
+	FindComponents(q Query, exFlags ExpansionFlags) (map[types.ComponentID]types.Component, error)
+	CountComponents(q Query) (int, error)
+	LoadSpecCatalog(r io.Reader) (int, error)
+
+	// Device identity (see MergeDevices)
+	ResolveExternalDeviceID(extID types.ExternalDeviceID) (types.DeviceID, error)
+	GetDeviceAliases(id types.DeviceID) ([]types.ExternalDeviceID, error)
+	MergeDevices(into, from types.DeviceID) error
+	RemoveDeviceAlias(extID types.ExternalDeviceID) error
+	SetMergeIdentifiers(kinds ...string)
+
+	// Locations
+	GetLocations() (map[types.LocationID]types.Location, error)
+	GetLocation(id types.LocationID) (types.Location, error)
+	CreateLocation(name string, parent types.LocationID) (types.LocationID, error)
+	RenameLocation(id types.LocationID, name string) error
+	MoveLocation(id, parent types.LocationID) error
+	DeleteLocation(id types.LocationID) (LocationDeleteResponse, error)
+	SetDeviceLocation(devID types.DeviceID, locID types.LocationID) error
+	GetDeviceLocation(devID types.DeviceID) (types.LocationID, error)
+
+	// Metadata
+	SetDeviceMetadata(id types.DeviceID, md types.Metadata) error
+	GetDeviceMetadata(id types.DeviceID) (types.Metadata, error)
+	SetComponentMetadata(id types.ComponentID, md types.Metadata) error
+	GetComponentMetadata(id types.ComponentID) (types.Metadata, error)
+
+	// Adapter credentials
+	UpsertAdapterCredential(adapterName, key, value string) error
+	GetAdapterCredential(adapterName, key string) (string, error)
+	ListAdapterCredentials(adapterName string) ([]string, error)
+	RevokeAdapterCredential(adapterName, key string) error
+	RevokeAdapterCredentials(adapterName string) (int, error)
+
+	// Adapter configuration
+	SetAdapterConfig(adapterName, key, value string) error
+	GetAdapterConfig(adapterName string) (map[string]string, error)
+	DeleteAdapterConfig(adapterName, key string) error
+
+	// Static services (see StaticService)
+	AddStaticService(factoryName, ip string, port uint16) (int64, error)
+	GetStaticServices() ([]StaticService, error)
+	DeleteStaticService(id int64) error
+
+	// Close marks all Devices as offline and releases any resources held by
+	// the Store
+	Close() error
+}
+
+var _ Store = (*SiftDB)(nil)
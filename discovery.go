@@ -0,0 +1,94 @@
+package sift
+
+import (
+	"github.com/upwrd/sift/network/ipv4"
+	"github.com/upwrd/sift/notif"
+	"sort"
+)
+
+// DiscoveryStats describes what the Server's IPv4 scanner has been finding,
+// to help explain why a device is, or is not, being picked up
+type DiscoveryStats struct {
+	// The most recent scan, browse and discovery. Descriptions are indexed
+	// by the name of the Adapter Factory which they belong to.
+	LastScans []ipv4.ScanStats
+
+	// The IPs which are being handled by Adapters, or are otherwise locked
+	LockedIPs []string
+}
+
+// DiscoveryStats returns stats on the Server's most recent searches for
+// services. To follow searches as they happen, Listen with a
+// notif.DiscoveryFilter.
+func (s *Server) DiscoveryStats() DiscoveryStats {
+	stats := DiscoveryStats{
+		LastScans: s.ipv4Scan.Stats(),
+		LockedIPs: s.ipv4Scan.LockedIPs(),
+	}
+	for i, scan := range stats.LastScans {
+		stats.LastScans[i].Descriptions = s.statsByFactoryName(scan.Descriptions)
+	}
+	return stats
+}
+
+// discoveryTypes converts the types of IPv4 scanner events into the types of
+// discovery notifications
+var discoveryTypes = map[ipv4.ScanEventType]notif.DiscoveryType{
+	ipv4.ScanStarted:    notif.DiscoveryScanStarted,
+	ipv4.ScanFinished:   notif.DiscoveryScanFinished,
+	ipv4.ServiceMatched: notif.DiscoveryServiceMatched,
+	ipv4.IPLocked:       notif.DiscoveryIPLocked,
+	ipv4.IPUnlocked:     notif.DiscoveryIPUnlocked,
+}
+
+// postScanEvent posts a discovery notification for an event from the IPv4
+// scanner, naming the factories whose descriptions were matched
+func (s *Server) postScanEvent(event ipv4.ScanEvent) {
+	dtype, ok := discoveryTypes[event.Type]
+	if !ok {
+		s.log.Warn("ignoring scan event of unknown type", "type", event.Type)
+		return
+	}
+	dnotif := notif.DiscoveryNotification{
+		Type:   dtype,
+		Method: event.Method,
+		Time:   event.Time,
+		IP:     event.IP,
+	}
+	for _, id := range event.DescriptionIDs {
+		if factory, ok := s.factoryByDescriptionID(id); ok {
+			dnotif.Factories = append(dnotif.Factories, factory.Name())
+		}
+	}
+	sort.Strings(dnotif.Factories)
+	if event.Stats != nil {
+		dnotif.Stats = &notif.ScanStats{
+			Method:          event.Stats.Method,
+			Started:         event.Stats.Started,
+			Duration:        event.Stats.Duration,
+			IPsChecked:      event.Stats.IPsChecked,
+			IPsExcluded:     event.Stats.IPsExcluded,
+			IPsAlreadyInUse: event.Stats.IPsAlreadyInUse,
+			IPsBackedOff:    event.Stats.IPsBackedOff,
+			ServicesFound:   event.Stats.ServicesFound,
+			Descriptions:    make(map[string]notif.DescriptionStats, len(event.Stats.Descriptions)),
+		}
+		for name, ds := range s.statsByFactoryName(event.Stats.Descriptions) {
+			dnotif.Stats.Descriptions[name] = notif.DescriptionStats(ds)
+		}
+	}
+	s.PostDiscovery(dnotif)
+}
+
+// statsByFactoryName re-indexes description stats by the names of the
+// factories they belong to. Stats for unknown descriptions keep their IDs.
+func (s *Server) statsByFactoryName(byID map[string]ipv4.DescriptionStats) map[string]ipv4.DescriptionStats {
+	byName := make(map[string]ipv4.DescriptionStats, len(byID))
+	for id, ds := range byID {
+		if factory, ok := s.factoryByDescriptionID(id); ok {
+			id = factory.Name()
+		}
+		byName[id] = ds
+	}
+	return byName
+}
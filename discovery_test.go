@@ -0,0 +1,122 @@
+package sift
+
+import (
+	"fmt"
+	"github.com/upwrd/sift/adapter"
+	"github.com/upwrd/sift/adapter/example"
+	"github.com/upwrd/sift/network/ipv4"
+	"github.com/upwrd/sift/notif"
+	. "gopkg.in/check.v1"
+	"time"
+)
+
+// DiscoverySuite tests how the Server converts events from its scanner into
+// discovery notifications. It is run by TestSIFT, with the other suites.
+type DiscoverySuite struct{}
+
+var _ = Suite(&DiscoverySuite{})
+
+func (s *DiscoverySuite) TestPostScanEvent(c *C) {
+	server, err := NewServer(":memory:")
+	c.Assert(err, IsNil)
+	defer server.Close()
+	_, err = server.AddAdapterFactory(example.NewFactory(1))
+	c.Assert(err, IsNil)
+	var descID string
+	for id := range server.factoriesByDescriptionID {
+		descID = id
+	}
+	c.Assert(descID, Not(Equals), "")
+
+	token := server.Login()
+	listener := server.Listen(token, notif.DiscoveryFilter{})
+	now := time.Now()
+
+	// matched descriptions are named by their factories
+	server.postScanEvent(ipv4.ScanEvent{
+		Type:           ipv4.ServiceMatched,
+		Method:         ipv4.MethodScan,
+		Time:           now,
+		IP:             "192.168.1.5",
+		DescriptionIDs: []string{descID, "unknown"},
+	})
+	c.Assert(<-listener, DeepEquals, notif.DiscoveryNotification{
+		Type:      notif.DiscoveryServiceMatched,
+		Method:    "scan",
+		Time:      now,
+		IP:        "192.168.1.5",
+		Factories: []string{"SIFT example"},
+	})
+
+	// ...as are the stats of finished scans
+	server.postScanEvent(ipv4.ScanEvent{
+		Type:   ipv4.ScanFinished,
+		Method: ipv4.MethodBrowse,
+		Time:   now,
+		Stats: &ipv4.ScanStats{
+			Method:        ipv4.MethodBrowse,
+			Started:       now,
+			IPsChecked:    4,
+			ServicesFound: 1,
+			Descriptions:  map[string]ipv4.DescriptionStats{descID: {Matched: 1, ProbesFailed: 3}},
+		},
+	})
+	c.Assert(<-listener, DeepEquals, notif.DiscoveryNotification{
+		Type:   notif.DiscoveryScanFinished,
+		Method: "browse",
+		Time:   now,
+		Stats: &notif.ScanStats{
+			Method:        "browse",
+			Started:       now,
+			IPsChecked:    4,
+			ServicesFound: 1,
+			Descriptions:  map[string]notif.DescriptionStats{"SIFT example": {Matched: 1, ProbesFailed: 3}},
+		},
+	})
+}
+
+// namedIPv4Factory is an IPv4 factory which never handles its services
+type namedIPv4Factory string
+
+func (f namedIPv4Factory) Name() string                                    { return string(f) }
+func (f namedIPv4Factory) HandleIPv4(*ipv4.ServiceContext) adapter.Adapter { return nil }
+func (f namedIPv4Factory) GetIPv4Description() ipv4.ServiceDescription {
+	return ipv4.ServiceDescription{OpenPorts: []uint16{1}}
+}
+
+func (s *DiscoverySuite) TestAddFactoriesWhileScanning(c *C) {
+	server, err := NewServer(":memory:")
+	c.Assert(err, IsNil)
+	defer server.Close()
+
+	// scan events are posted from the scanner's goroutines, and may arrive
+	// while factories are being added
+	started := make(chan struct{})
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		close(started)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			server.postScanEvent(ipv4.ScanEvent{
+				Type:           ipv4.ServiceMatched,
+				DescriptionIDs: []string{fmt.Sprintf("%v", i%100)},
+				Stats:          &ipv4.ScanStats{Descriptions: map[string]ipv4.DescriptionStats{"1": {}}},
+			})
+		}
+	}()
+	<-started
+	for i := 0; i < 100; i++ {
+		_, err := server.AddAdapterFactory(namedIPv4Factory(fmt.Sprintf("factory %v", i)))
+		c.Assert(err, IsNil)
+	}
+	close(stop)
+	<-done
+	_, err = server.AddAdapterFactory(namedIPv4Factory("factory 0"))
+	c.Assert(err, NotNil) // names must still be unique
+}
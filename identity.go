@@ -0,0 +1,105 @@
+package sift
+
+import (
+	"github.com/upwrd/sift/db"
+	"github.com/upwrd/sift/notif"
+	"github.com/upwrd/sift/types"
+)
+
+// MergeDevices merges the Device 'from' into the Device 'into', so that every
+// ExternalDeviceID which identified 'from' now identifies 'into' (see
+// db.SiftDB.MergeDevices). The Adapters which reported either Device are then
+// prioritized together. Listeners are notified that 'from' has been deleted
+// and that 'into' has been updated.
+func (s *Server) MergeDevices(into, from types.DeviceID) error {
+	fromDev, err := s.Store.GetDevice(from, db.ExpandNone)
+	if err != nil {
+		return err
+	}
+	fromExtID, err := s.Store.GetExternalDeviceID(from)
+	if err != nil {
+		return err
+	}
+	intoExtID, err := s.Store.GetExternalDeviceID(into)
+	if err != nil {
+		return err
+	}
+	if err := s.Store.MergeDevices(into, from); err != nil {
+		return err
+	}
+	s.forgetCanonicalIDs()
+	s.prioritizer.MergeDevices(intoExtID, fromExtID)
+	s.PostDevice(from, fromDev, notif.Delete)
+	intoDev, err := s.Store.GetDevice(into, db.ExpandNone)
+	if err != nil {
+		s.log.Warn("could not get device to post notification", "id", into, "err", err)
+		return nil
+	}
+	s.PostDevice(into, intoDev, notif.Update)
+	return nil
+}
+
+// RemoveDeviceAlias removes an alias which was added by merging Devices (see
+// db.SiftDB.RemoveDeviceAlias). The Adapters which reported the alias are
+// then prioritized apart from the Device it was merged into, so that its
+// updates create a new Device.
+func (s *Server) RemoveDeviceAlias(extID types.ExternalDeviceID) error {
+	id, err := s.Store.ResolveExternalDeviceID(extID)
+	if err != nil {
+		return err
+	}
+	canonical, err := s.Store.GetExternalDeviceID(id)
+	if err != nil {
+		return err
+	}
+	if err := s.Store.RemoveDeviceAlias(extID); err != nil {
+		return err
+	}
+	s.forgetCanonicalIDs()
+	s.prioritizer.SplitDevice(canonical, extID)
+	return nil
+}
+
+// canonicalExternalDeviceID returns the ExternalDeviceID which the Store
+// associates with the Device known by extID. Merged Devices are known by
+// several ExternalDeviceIDs; the prioritizer uses this to rank the Adapters
+// which report each of them against each other. If the Device is not yet
+// known, extID is its own canonical ID.
+//
+// It is called for every update from every Adapter, so IDs which are found in
+// the Store are cached until Devices are merged or aliases are removed. IDs
+// of unknown Devices are not, since they may become aliases of other Devices
+// when they are stored (see db.SiftDB.SetMergeIdentifiers).
+func (s *Server) canonicalExternalDeviceID(extID types.ExternalDeviceID) types.ExternalDeviceID {
+	s.clock.RLock()
+	canonical, ok := s.canonicalIDs[extID]
+	gen := s.canonicalGen
+	s.clock.RUnlock()
+	if ok {
+		return canonical
+	}
+
+	id, err := s.Store.ResolveExternalDeviceID(extID)
+	if err != nil {
+		return extID
+	}
+	canonical, err = s.Store.GetExternalDeviceID(id)
+	if err != nil {
+		return extID
+	}
+	s.clock.Lock()
+	if s.canonicalGen == gen { // otherwise, Devices were merged or split while the Store was read
+		s.canonicalIDs[extID] = canonical
+	}
+	s.clock.Unlock()
+	return canonical
+}
+
+// forgetCanonicalIDs empties the cache of canonicalExternalDeviceID, after
+// Devices have been merged or aliases have been removed
+func (s *Server) forgetCanonicalIDs() {
+	s.clock.Lock()
+	defer s.clock.Unlock()
+	s.canonicalIDs = make(map[types.ExternalDeviceID]types.ExternalDeviceID)
+	s.canonicalGen++
+}
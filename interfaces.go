@@ -0,0 +1,50 @@
+package sift
+
+import (
+	"github.com/upwrd/sift/network/ipv4"
+	"net"
+)
+
+// handleInterfaceEvent responds to a change in the local network interfaces.
+// Services on networks which an interface has left can no longer be reached,
+// so their Adapters are released; if the services are still reachable some
+// other way, they will be found again.
+func (s *Server) handleInterfaceEvent(event ipv4.InterfaceEvent) {
+	s.log.Info("network interface "+event.Type.String(), "interface", event.Name, "added_networks", event.Added, "removed_networks", event.Removed)
+	if len(event.Removed) == 0 {
+		return
+	}
+	if n := s.releaseAdapters(event.Name, event.Removed); n > 0 {
+		s.log.Info("released adapters on removed networks", "interface", event.Name, "num_adapters", n)
+	}
+}
+
+// releaseAdapters tells the supervisors of every Adapter handling a service
+// on one of the given networks of the named interface to stop, and returns the
+// number released. Services at link-local addresses are only released if they
+// were reached through that interface, since every interface shares the same
+// link-local network.
+func (s *Server) releaseAdapters(intf string, networks []*net.IPNet) int {
+	s.alock.Lock()
+	defer s.alock.Unlock()
+
+	n := 0
+	for id, sa := range s.adapters {
+		if sa.released || sa.addr.IP == nil {
+			continue
+		}
+		if sa.addr.Zone != "" && sa.addr.Zone != intf {
+			continue // reached through another interface
+		}
+		for _, network := range networks {
+			if network.Contains(sa.addr.IP) {
+				s.log.Debug("releasing adapter", "id", id, "addr", sa.addr.String(), "network", network)
+				close(sa.release)
+				sa.released = true
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
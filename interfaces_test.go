@@ -0,0 +1,40 @@
+package sift
+
+import (
+	. "gopkg.in/check.v1"
+	"net"
+)
+
+// InterfacesSuite tests the Server's unexported handling of interface events.
+// It is run by TestSIFT, with the other suites.
+type InterfacesSuite struct{}
+
+var _ = Suite(&InterfacesSuite{})
+
+func (s *InterfacesSuite) TestReleaseAdapters(c *C) {
+	server, err := NewServer(":memory:")
+	c.Assert(err, IsNil)
+	defer server.Close()
+
+	_, v4 := server.addAdapter(nil, net.IPAddr{IP: net.IPv4(10, 0, 0, 5)})
+	_, global := server.addAdapter(nil, net.IPAddr{IP: net.ParseIP("2001:db8::5")})
+	_, linkLocalEth := server.addAdapter(nil, net.IPAddr{IP: net.ParseIP("fe80::5"), Zone: "eth0"})
+	_, linkLocalWlan := server.addAdapter(nil, net.IPAddr{IP: net.ParseIP("fe80::6"), Zone: "wlan0"})
+	_, ble := server.addAdapter(nil, net.IPAddr{})
+
+	_, v4Net, _ := net.ParseCIDR("10.0.0.0/24")
+	_, globalNet, _ := net.ParseCIDR("2001:db8::/64")
+	_, linkLocalNet, _ := net.ParseCIDR("fe80::/64")
+
+	// link-local services are only released along with their own interface
+	c.Assert(server.releaseAdapters("eth0", []*net.IPNet{v4Net, globalNet, linkLocalNet}), Equals, 3)
+	c.Assert(v4.released, Equals, true)
+	c.Assert(global.released, Equals, true)
+	c.Assert(linkLocalEth.released, Equals, true)
+	c.Assert(linkLocalWlan.released, Equals, false)
+	c.Assert(ble.released, Equals, false)
+
+	c.Assert(server.releaseAdapters("wlan0", []*net.IPNet{linkLocalNet}), Equals, 1)
+	c.Assert(linkLocalWlan.released, Equals, true)
+	c.Assert(ble.released, Equals, false)
+}
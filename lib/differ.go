@@ -196,3 +196,72 @@ func DiffDevice(old, new types.Device) (upserted, deleted map[string]types.Compo
 	deviceChanged = old.Name != new.Name
 	return
 }
+
+// DiffComponent lists the fields which differ between an 'old' Component and
+// a 'new' Component of the same type, in the order they are declared. If
+// either Component is nil, or they are of different types, nil is returned;
+// the new Component should be considered a replacement for the old one.
+func DiffComponent(old, new types.Component) []types.FieldChange {
+	if old == nil || new == nil {
+		return nil
+	}
+	oldVal, newVal := reflect.ValueOf(old), reflect.ValueOf(new)
+	if oldVal.Type() != newVal.Type() {
+		return nil
+	}
+	changes := []types.FieldChange{}
+	diffValues("", oldVal, newVal, &changes)
+	return changes
+}
+
+// diffValues appends a FieldChange for each difference between old and new,
+// which must have the same type. Structs are compared field-by-field, and
+// pointers are followed if both are set.
+func diffValues(path string, old, new reflect.Value, changes *[]types.FieldChange) {
+	switch old.Kind() {
+	case reflect.Struct:
+		for i := 0; i < old.NumField(); i++ {
+			field := old.Type().Field(i)
+			if field.PkgPath != "" {
+				continue // unexported
+			}
+			fieldPath := path
+			if !field.Anonymous {
+				fieldPath = joinFieldPath(path, field.Name)
+			}
+			diffValues(fieldPath, old.Field(i), new.Field(i), changes)
+		}
+		return
+	case reflect.Ptr:
+		if !old.IsNil() && !new.IsNil() {
+			diffValues(path, old.Elem(), new.Elem(), changes)
+			return
+		}
+	}
+	if !reflect.DeepEqual(old.Interface(), new.Interface()) {
+		*changes = append(*changes, types.FieldChange{
+			Field: path,
+			Old:   fieldValue(old),
+			New:   fieldValue(new),
+		})
+	}
+}
+
+// fieldValue returns the value held by v, following pointers; unset pointers
+// are returned as nil
+func fieldValue(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		return v.Elem().Interface()
+	}
+	return v.Interface()
+}
+
+func joinFieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -220,3 +220,33 @@ func (s *TestSIFTLibSuite) TestDiffDevice(c *C) {
 		c.Assert(deviceChanged, Equals, test.expectedDeviceChanged)
 	}
 }
+
+func (s *TestSIFTLibSuite) TestDiffComponent(c *C) {
+	old := types.LightEmitter{
+		BaseComponent: types.BaseComponent{Make: "example", Model: "light_emitter_1"},
+		State:         types.LightEmitterState{BrightnessInPercent: 100},
+	}
+	new := old
+	c.Assert(DiffComponent(old, new), DeepEquals, []types.FieldChange{})
+
+	new.State.BrightnessInPercent = 10
+	new.Model = "light_emitter_2"
+	new.Stats = &types.LightEmitterStats{HoursOn: 3}
+	c.Assert(DiffComponent(old, new), DeepEquals, []types.FieldChange{
+		{Field: "Model", Old: "light_emitter_1", New: "light_emitter_2"},
+		{Field: "State.BrightnessInPercent", Old: uint8(100), New: uint8(10)},
+		{Field: "Stats", Old: nil, New: types.LightEmitterStats{HoursOn: 3}},
+	})
+
+	// pointers which are set on both sides are compared field-by-field
+	old.Stats = &types.LightEmitterStats{HoursOn: 2}
+	c.Assert(DiffComponent(old, new), DeepEquals, []types.FieldChange{
+		{Field: "Model", Old: "light_emitter_1", New: "light_emitter_2"},
+		{Field: "State.BrightnessInPercent", Old: uint8(100), New: uint8(10)},
+		{Field: "Stats.HoursOn", Old: 2, New: 3},
+	})
+
+	// components of different types cannot be compared
+	c.Assert(DiffComponent(old, types.Switch{}), IsNil)
+	c.Assert(DiffComponent(nil, new), IsNil)
+}
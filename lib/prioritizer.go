@@ -9,15 +9,17 @@ import (
 	"sync"
 )
 
-type controllerType uint8
+// A ControllerType is the kind of network through which an Adapter controls
+// its devices
+type ControllerType uint8
 
 // The values in this list are used to prioritize services. Lower numbers are higher priority.
 const (
-	ControllerTypeZigbee     = 1
-	ControllerTypeZWave      = 2
-	ControllerTypeBluetooth  = 3
-	ControllerTypeIPv4       = 4
-	ControllerTypeAggregator = 255
+	ControllerTypeZigbee     ControllerType = 1
+	ControllerTypeZWave      ControllerType = 2
+	ControllerTypeBluetooth  ControllerType = 3
+	ControllerTypeIPv4       ControllerType = 4
+	ControllerTypeAggregator ControllerType = 255
 )
 
 const (
@@ -26,7 +28,7 @@ const (
 
 // An AdapterDescription describes an adapter for the purpose of prioritization
 type AdapterDescription struct {
-	Type controllerType
+	Type ControllerType
 	ID   string
 }
 
@@ -50,8 +52,30 @@ type IPrioritizer interface {
 	// which is reporting on the state of the Device with id 'id'. An empty string
 	// indicates that no such Adapter was found.
 	GetHighestPriorityAdapterForDevice(id types.ExternalDeviceID) string
+
+	// GetHighestPriorityAdapter is like GetHighestPriorityAdapterForDevice,
+	// but also returns the ExternalDeviceID under which that Adapter reports
+	// the Device. This may differ from 'id' if the Device is known by several
+	// ExternalDeviceIDs (see SetResolver).
+	GetHighestPriorityAdapter(id types.ExternalDeviceID) (string, types.ExternalDeviceID)
+
+	// MergeDevices moves the rankings held for the Device with canonical ID
+	// 'from' to the Device with canonical ID 'into', once the Devices have
+	// been merged (see SetResolver).
+	MergeDevices(into, from types.ExternalDeviceID)
+
+	// SplitDevice moves the rankings of the Adapters which reported 'alias'
+	// away from the Device with canonical ID 'canonical', once 'alias' no
+	// longer identifies it (see SetResolver). It undoes MergeDevices.
+	SplitDevice(canonical, alias types.ExternalDeviceID)
 }
 
+// A Resolver maps an ExternalDeviceID to the canonical ExternalDeviceID of the
+// Device it identifies. Devices which have been merged are reported by several
+// Adapters under different ExternalDeviceIDs; resolving them lets those
+// Adapters be ranked against each other.
+type Resolver func(id types.ExternalDeviceID) types.ExternalDeviceID
+
 // A Prioritizer considers updates from Adapters and determines whether those
 // updates are the highest-priority updates for a particular entity (most
 // often, for a particular Device). If so, the update is passed on to any
@@ -63,7 +87,9 @@ type Prioritizer struct {
 	adapterChannelsByToken       map[string]chan interface{}
 	rankedAdapterIDsByDeviceID   map[types.ExternalDeviceID][]string
 	rankedAdapterDescsByDeviceID map[types.ExternalDeviceID][]AdapterDescription
-	rlock                        *sync.Mutex // protects rankedAdapterIDsByDeviceID
+	reportedIDsByDeviceID        map[types.ExternalDeviceID]map[string]types.ExternalDeviceID // canonical ID -> adapter ID -> ID reported by that adapter
+	rlock                        *sync.Mutex                                                  // protects rankedAdapterIDsByDeviceID
+	resolve                      Resolver
 	log                          log.Logger
 }
 
@@ -83,11 +109,35 @@ func NewPrioritizer(sortFns []lessFunc) *Prioritizer {
 		adapterChannelsByToken:       make(map[string]chan interface{}),
 		rankedAdapterIDsByDeviceID:   make(map[types.ExternalDeviceID][]string),
 		rankedAdapterDescsByDeviceID: make(map[types.ExternalDeviceID][]AdapterDescription),
+		reportedIDsByDeviceID:        make(map[types.ExternalDeviceID]map[string]types.ExternalDeviceID),
 		rlock: &sync.Mutex{},
 		log:   Log.New("obj", "prioritizer", "id", logext.RandId(8)),
 	}
 }
 
+// SetResolver sets the function used to find the canonical ID of each Device
+// which is updated. Updates are ranked by canonical ID, so that an update for
+// a merged Device is only passed on if it comes from the highest-priority
+// Adapter reporting on any of the Device's IDs. If no resolver is set, every
+// ExternalDeviceID is its own canonical ID. Should be called before the first
+// update is considered.
+func (p *Prioritizer) SetResolver(resolve Resolver) {
+	p.rlock.Lock()
+	defer p.rlock.Unlock()
+	p.resolve = resolve
+}
+
+// canonical returns the canonical ID of the given device
+func (p *Prioritizer) canonical(id types.ExternalDeviceID) types.ExternalDeviceID {
+	p.rlock.Lock()
+	resolve := p.resolve
+	p.rlock.Unlock()
+	if resolve == nil {
+		return id
+	}
+	return resolve(id)
+}
+
 // OutputChan returns the output channel of this Prioritizer.
 func (p *Prioritizer) OutputChan() chan interface{} {
 	return p.dest
@@ -134,12 +184,17 @@ func (p *Prioritizer) isHighestPriorityUpdate(ad AdapterDescription, updated Dev
 	}
 
 	// Ensure that this adapter token is in the appropriate list
+	id := p.canonical(updated.ID)
 	p.rlock.Lock() // lock
-	rankedAdapters, ok := p.rankedAdapterDescsByDeviceID[updated.ID]
+	if p.reportedIDsByDeviceID[id] == nil {
+		p.reportedIDsByDeviceID[id] = make(map[string]types.ExternalDeviceID)
+	}
+	p.reportedIDsByDeviceID[id][ad.ID] = updated.ID
+	rankedAdapters, ok := p.rankedAdapterDescsByDeviceID[id]
 	if !ok { // token list for this device doesn't exist yet
 		p.log.Debug("received update for device which has not been seen yet", "device_id", updated.ID)
-		p.rankedAdapterDescsByDeviceID[updated.ID] = []AdapterDescription{ad}
-		rankedAdapters = p.rankedAdapterDescsByDeviceID[updated.ID]
+		p.rankedAdapterDescsByDeviceID[id] = []AdapterDescription{ad}
+		rankedAdapters = p.rankedAdapterDescsByDeviceID[id]
 	} else { // existing token list found
 		// Ensure that this Adapter's token is in the list
 		var found bool
@@ -151,9 +206,9 @@ func (p *Prioritizer) isHighestPriorityUpdate(ad AdapterDescription, updated Dev
 		}
 
 		if !found {
-			p.rankedAdapterDescsByDeviceID[updated.ID] = append(p.rankedAdapterDescsByDeviceID[updated.ID], ad)
-			orderedBy(p.sortFns...).sort(p.rankedAdapterDescsByDeviceID[updated.ID])
-			rankedAdapters = p.rankedAdapterDescsByDeviceID[updated.ID]
+			p.rankedAdapterDescsByDeviceID[id] = append(p.rankedAdapterDescsByDeviceID[id], ad)
+			orderedBy(p.sortFns...).sort(p.rankedAdapterDescsByDeviceID[id])
+			rankedAdapters = p.rankedAdapterDescsByDeviceID[id]
 		}
 	}
 	p.rlock.Unlock()
@@ -164,7 +219,10 @@ func (p *Prioritizer) isHighestPriorityUpdate(ad AdapterDescription, updated Dev
 func (p *Prioritizer) isHighestPriorityDelete(ad AdapterDescription, deleted DeviceDeleted) bool {
 	// Get the sorted list of Adapters registered for this device. If the token
 	// is first in the list, pass along the update.
-	rankedAdapters, ok := p.rankedAdapterDescsByDeviceID[deleted.ID]
+	id := p.canonical(deleted.ID)
+	p.rlock.Lock()
+	defer p.rlock.Unlock()
+	rankedAdapters, ok := p.rankedAdapterDescsByDeviceID[id]
 	if ok {
 		i := 0
 		for i < len(rankedAdapters) {
@@ -175,28 +233,120 @@ func (p *Prioritizer) isHighestPriorityDelete(ad AdapterDescription, deleted Dev
 		}
 
 		if i < len(rankedAdapters) && rankedAdapters[i] == ad {
-			p.rankedAdapterDescsByDeviceID[deleted.ID] = append(rankedAdapters[:i], rankedAdapters[i+1:]...)
+			p.rankedAdapterDescsByDeviceID[id] = append(rankedAdapters[:i], rankedAdapters[i+1:]...)
+			delete(p.reportedIDsByDeviceID[id], ad.ID)
 			return i == 0
 		}
 	}
 	return false
 }
 
+// MergeDevices moves the rankings held for the Device with canonical ID 'from'
+// to the Device with canonical ID 'into'. It should be called once the Devices
+// have been merged, so that the resolver maps 'from' to 'into'; until then,
+// the Adapters which reported 'from' are ranked separately from those which
+// reported 'into'.
+func (p *Prioritizer) MergeDevices(into, from types.ExternalDeviceID) {
+	if into == from {
+		return
+	}
+	p.rlock.Lock()
+	defer p.rlock.Unlock()
+
+	if fromAdapters, ok := p.rankedAdapterDescsByDeviceID[from]; ok {
+		ranked := p.rankedAdapterDescsByDeviceID[into]
+		for _, ad := range fromAdapters {
+			var found bool
+			for _, existingDesc := range ranked {
+				if existingDesc == ad {
+					found = true
+					break
+				}
+			}
+			if !found {
+				ranked = append(ranked, ad)
+			}
+		}
+		orderedBy(p.sortFns...).sort(ranked)
+		p.rankedAdapterDescsByDeviceID[into] = ranked
+		delete(p.rankedAdapterDescsByDeviceID, from)
+	}
+	if fromReported, ok := p.reportedIDsByDeviceID[from]; ok {
+		if p.reportedIDsByDeviceID[into] == nil {
+			p.reportedIDsByDeviceID[into] = make(map[string]types.ExternalDeviceID)
+		}
+		for adapterID, reported := range fromReported {
+			if _, ok := p.reportedIDsByDeviceID[into][adapterID]; !ok {
+				p.reportedIDsByDeviceID[into][adapterID] = reported
+			}
+		}
+		delete(p.reportedIDsByDeviceID, from)
+	}
+	p.log.Debug("merged device rankings", "into", into, "from", from, "ranked", p.rankedAdapterDescsByDeviceID[into])
+}
+
+// SplitDevice moves the rankings of the Adapters which reported 'alias' from
+// the Device with canonical ID 'canonical' to a Device of its own. It should
+// be called once the resolver no longer maps 'alias' to 'canonical'.
+func (p *Prioritizer) SplitDevice(canonical, alias types.ExternalDeviceID) {
+	if canonical == alias {
+		return
+	}
+	p.rlock.Lock()
+	defer p.rlock.Unlock()
+
+	for adapterID, reported := range p.reportedIDsByDeviceID[canonical] {
+		if reported != alias {
+			continue
+		}
+		ranked := p.rankedAdapterDescsByDeviceID[canonical]
+		for i, ad := range ranked {
+			if ad.ID != adapterID {
+				continue
+			}
+			p.rankedAdapterDescsByDeviceID[canonical] = append(ranked[:i], ranked[i+1:]...)
+			p.rankedAdapterDescsByDeviceID[alias] = append(p.rankedAdapterDescsByDeviceID[alias], ad)
+			orderedBy(p.sortFns...).sort(p.rankedAdapterDescsByDeviceID[alias])
+			break
+		}
+		if p.reportedIDsByDeviceID[alias] == nil {
+			p.reportedIDsByDeviceID[alias] = make(map[string]types.ExternalDeviceID)
+		}
+		p.reportedIDsByDeviceID[alias][adapterID] = alias
+		delete(p.reportedIDsByDeviceID[canonical], adapterID)
+	}
+	p.log.Debug("split device rankings", "canonical", canonical, "alias", alias, "ranked", p.rankedAdapterDescsByDeviceID[alias])
+}
+
 // GetHighestPriorityAdapterForDevice returns the highest priority Adapter
 // which is reporting on the state of the Device with id 'id'. An empty string
 // indicates that no such Adapter was found.
 func (p *Prioritizer) GetHighestPriorityAdapterForDevice(id types.ExternalDeviceID) string {
+	adapterID, _ := p.GetHighestPriorityAdapter(id)
+	return adapterID
+}
+
+// GetHighestPriorityAdapter returns the highest priority Adapter which is
+// reporting on the state of the Device with id 'id', and the ExternalDeviceID
+// under which that Adapter reports the Device. An empty string indicates that
+// no such Adapter was found.
+func (p *Prioritizer) GetHighestPriorityAdapter(id types.ExternalDeviceID) (string, types.ExternalDeviceID) {
+	canonical := p.canonical(id)
 	p.rlock.Lock() // lock
 	defer p.rlock.Unlock()
 
-	p.log.Debug("finding highest priority adapter for device", "device_key", id, "priority_map", p.rankedAdapterDescsByDeviceID)
-	descs, ok := p.rankedAdapterDescsByDeviceID[id]
+	p.log.Debug("finding highest priority adapter for device", "device_key", canonical, "priority_map", p.rankedAdapterDescsByDeviceID)
+	descs, ok := p.rankedAdapterDescsByDeviceID[canonical]
 	if ok && len(descs) > 0 {
-		p.log.Debug("prioritizer determined highest priority adapter for update", "device_key", id, "highest_priority", descs[0].ID)
-		return descs[0].ID
+		p.log.Debug("prioritizer determined highest priority adapter for update", "device_key", canonical, "highest_priority", descs[0].ID)
+		reported, ok := p.reportedIDsByDeviceID[canonical][descs[0].ID]
+		if !ok {
+			reported = id
+		}
+		return descs[0].ID, reported
 	}
-	p.log.Debug("no highest priority adapter found for update", "device_key", id)
-	return ""
+	p.log.Debug("no highest priority adapter found for update", "device_key", canonical)
+	return "", types.ExternalDeviceID{}
 }
 
 //
@@ -364,3 +364,121 @@ func (s *TestSIFTLibSuite) TestConsider(c *C) {
 		}
 	}
 }
+
+func (s *TestSIFTLibSuite) TestConsiderWithResolver(c *C) {
+	zigbee := AdapterDescription{Type: ControllerTypeZigbee, ID: "zigbee"}
+	ipv4 := AdapterDescription{Type: ControllerTypeIPv4, ID: "ipv4"}
+	zigbeeID := types.ExternalDeviceID{Manufacturer: "foo", ID: "zigbee-device"}
+	ipv4ID := types.ExternalDeviceID{Manufacturer: "bar", ID: "ipv4-device"}
+
+	// both IDs identify the same device, known canonically by its zigbee ID
+	p := NewPrioritizer(nil)
+	p.SetResolver(func(id types.ExternalDeviceID) types.ExternalDeviceID {
+		if id == ipv4ID {
+			return zigbeeID
+		}
+		return id
+	})
+	updates := p.OutputChan()
+
+	c.Assert(p.Consider(ipv4, DeviceUpdated{ID: ipv4ID}), IsNil)
+	c.Assert(len(updates), Equals, 1) // no other contenders yet
+	<-updates
+	c.Assert(p.Consider(zigbee, DeviceUpdated{ID: zigbeeID}), IsNil)
+	c.Assert(len(updates), Equals, 1) // zigbee outranks ipv4
+	<-updates
+	c.Assert(p.Consider(ipv4, DeviceUpdated{ID: ipv4ID}), IsNil)
+	c.Assert(len(updates), Equals, 0) // ipv4 is now ignored for the device
+
+	// the highest priority adapter is found by either ID, along with the ID
+	// which it reports
+	adapterID, reportedID := p.GetHighestPriorityAdapter(ipv4ID)
+	c.Assert(adapterID, Equals, "zigbee")
+	c.Assert(reportedID, Equals, zigbeeID)
+
+	// once zigbee stops reporting the device, ipv4 takes over
+	c.Assert(p.Consider(zigbee, DeviceDeleted{ID: zigbeeID}), IsNil)
+	c.Assert(len(updates), Equals, 1)
+	<-updates
+	adapterID, reportedID = p.GetHighestPriorityAdapter(zigbeeID)
+	c.Assert(adapterID, Equals, "ipv4")
+	c.Assert(reportedID, Equals, ipv4ID)
+}
+
+func (s *TestSIFTLibSuite) TestMergeDevices(c *C) {
+	zigbee := AdapterDescription{Type: ControllerTypeZigbee, ID: "zigbee"}
+	ipv4 := AdapterDescription{Type: ControllerTypeIPv4, ID: "ipv4"}
+	zigbeeID := types.ExternalDeviceID{Manufacturer: "foo", ID: "zigbee-device"}
+	ipv4ID := types.ExternalDeviceID{Manufacturer: "bar", ID: "ipv4-device"}
+
+	// the IDs identify separate devices until they are merged
+	merged := false
+	p := NewPrioritizer(nil)
+	p.SetResolver(func(id types.ExternalDeviceID) types.ExternalDeviceID {
+		if merged && id == ipv4ID {
+			return zigbeeID
+		}
+		return id
+	})
+	updates := p.OutputChan()
+	c.Assert(p.Consider(ipv4, DeviceUpdated{ID: ipv4ID}), IsNil)
+	c.Assert(p.Consider(zigbee, DeviceUpdated{ID: zigbeeID}), IsNil)
+	c.Assert(len(updates), Equals, 2) // each adapter is alone
+	<-updates
+	<-updates
+
+	// once merged, the adapters which reported either device are ranked
+	// together, without either reporting again
+	merged = true
+	p.MergeDevices(zigbeeID, ipv4ID)
+	adapterID, reportedID := p.GetHighestPriorityAdapter(ipv4ID)
+	c.Assert(adapterID, Equals, "zigbee")
+	c.Assert(reportedID, Equals, zigbeeID)
+	c.Assert(p.Consider(ipv4, DeviceUpdated{ID: ipv4ID}), IsNil)
+	c.Assert(len(updates), Equals, 0) // zigbee outranks ipv4
+
+	// the ipv4 adapter's ID is kept, for when it takes over
+	c.Assert(p.Consider(zigbee, DeviceDeleted{ID: zigbeeID}), IsNil)
+	<-updates
+	adapterID, reportedID = p.GetHighestPriorityAdapter(zigbeeID)
+	c.Assert(adapterID, Equals, "ipv4")
+	c.Assert(reportedID, Equals, ipv4ID)
+}
+
+func (s *TestSIFTLibSuite) TestSplitDevice(c *C) {
+	zigbee := AdapterDescription{Type: ControllerTypeZigbee, ID: "zigbee"}
+	ipv4 := AdapterDescription{Type: ControllerTypeIPv4, ID: "ipv4"}
+	zigbeeID := types.ExternalDeviceID{Manufacturer: "foo", ID: "zigbee-device"}
+	ipv4ID := types.ExternalDeviceID{Manufacturer: "bar", ID: "ipv4-device"}
+
+	// the zigbee ID is an alias of the ipv4 device until it is split off
+	merged := true
+	p := NewPrioritizer(nil)
+	p.SetResolver(func(id types.ExternalDeviceID) types.ExternalDeviceID {
+		if merged && id == zigbeeID {
+			return ipv4ID
+		}
+		return id
+	})
+	updates := p.OutputChan()
+	c.Assert(p.Consider(ipv4, DeviceUpdated{ID: ipv4ID}), IsNil)
+	c.Assert(p.Consider(zigbee, DeviceUpdated{ID: zigbeeID}), IsNil)
+	c.Assert(len(updates), Equals, 2) // each was the highest priority when reporting
+	<-updates
+	<-updates
+	adapterID, reportedID := p.GetHighestPriorityAdapter(ipv4ID)
+	c.Assert(adapterID, Equals, "zigbee")
+	c.Assert(reportedID, Equals, zigbeeID)
+
+	// once split, each adapter is alone again, without either reporting again
+	merged = false
+	p.SplitDevice(ipv4ID, zigbeeID)
+	adapterID, reportedID = p.GetHighestPriorityAdapter(ipv4ID)
+	c.Assert(adapterID, Equals, "ipv4")
+	c.Assert(reportedID, Equals, ipv4ID)
+	adapterID, reportedID = p.GetHighestPriorityAdapter(zigbeeID)
+	c.Assert(adapterID, Equals, "zigbee")
+	c.Assert(reportedID, Equals, zigbeeID)
+	c.Assert(p.Consider(ipv4, DeviceUpdated{ID: ipv4ID}), IsNil)
+	c.Assert(len(updates), Equals, 1)
+}
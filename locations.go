@@ -0,0 +1,85 @@
+package sift
+
+import (
+	"github.com/upwrd/sift/db"
+	"github.com/upwrd/sift/notif"
+	"github.com/upwrd/sift/types"
+)
+
+// The methods below wrap the location management methods of the SIFT
+// database, notifying listeners of each change.
+
+// CreateLocation adds a new Location, placed within parent if it is non-zero,
+// and notifies listeners.
+func (s *Server) CreateLocation(name string, parent types.LocationID) (types.LocationID, error) {
+	id, err := s.Store.CreateLocation(name, parent)
+	if err != nil {
+		return 0, err
+	}
+	s.PostLocation(id, types.Location{Name: name, ParentID: parent}, notif.Create)
+	return id, nil
+}
+
+// RenameLocation changes the name of a Location and notifies listeners.
+func (s *Server) RenameLocation(id types.LocationID, name string) error {
+	if err := s.Store.RenameLocation(id, name); err != nil {
+		return err
+	}
+	s.postLocationByID(id, notif.Update)
+	return nil
+}
+
+// MoveLocation places a Location within another (or at the top level, if
+// parent is 0) and notifies listeners.
+func (s *Server) MoveLocation(id, parent types.LocationID) error {
+	if err := s.Store.MoveLocation(id, parent); err != nil {
+		return err
+	}
+	s.postLocationByID(id, notif.Moved)
+	return nil
+}
+
+// DeleteLocation removes a Location, moving its Devices and Locations to its
+// parent, and notifies listeners of each change.
+func (s *Server) DeleteLocation(id types.LocationID) (db.LocationDeleteResponse, error) {
+	resp, err := s.Store.DeleteLocation(id)
+	if err != nil {
+		return resp, err
+	}
+	s.PostLocation(id, resp.Location, notif.Delete)
+	for _, locID := range resp.MovedLocations {
+		s.postLocationByID(locID, notif.Moved)
+	}
+	for _, devID := range resp.MovedDevices {
+		s.postDeviceMoved(devID)
+	}
+	return resp, nil
+}
+
+// SetDeviceLocation places a Device in a Location (or removes it from its
+// Location, if locID is 0) and notifies listeners.
+func (s *Server) SetDeviceLocation(devID types.DeviceID, locID types.LocationID) error {
+	if err := s.Store.SetDeviceLocation(devID, locID); err != nil {
+		return err
+	}
+	s.postDeviceMoved(devID)
+	return nil
+}
+
+func (s *Server) postLocationByID(id types.LocationID, action notif.ActionsMask) {
+	loc, err := s.Store.GetLocation(id)
+	if err != nil {
+		s.log.Warn("could not get location to post notification", "id", id, "err", err)
+		return
+	}
+	s.PostLocation(id, loc, action)
+}
+
+func (s *Server) postDeviceMoved(id types.DeviceID) {
+	dev, err := s.Store.GetDevice(id, db.ExpandNone)
+	if err != nil {
+		s.log.Warn("could not get device to post notification", "id", id, "err", err)
+		return
+	}
+	s.PostDevice(id, dev, notif.Moved)
+}
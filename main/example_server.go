@@ -11,7 +11,7 @@ import (
 
 func main() {
 	sift.SetLogLevel("info")
-	server := example.NewServer(example.defaultPort)
+	server := example.NewServer(55442) // the port SIFT's default example factory looks on
 	go server.Serve()
 	//	supervisor := suture.NewSimple("SIFT example main")
 	//	supervisor.Add(server)
@@ -19,15 +19,15 @@ func main() {
 	// go server.serveHTTP()
 
 	// Insert a device
-	light1 := example.light{
-		baseComponent:   example.baseComponent{Type: example.componentTypeLight},
+	light1 := example.Light{
 		IsOn:            true,
 		OutputInPercent: 100,
 	}
-	device1 := example.device{
-		Components: map[string]example.component{"light 1": light1},
+	device1 := example.Device{
+		Components: map[string]example.Component{"light 1": light1},
 	}
 	server.SetDevice("device 1", device1)
+	server.AddEmulatedDevices() // an outlet and a thermostat
 
 	fmt.Printf("SIFT example server started\n")
 	select {} // wait forever
@@ -58,17 +58,9 @@ func ghostInTheCircuits(server *sift.Server, minMS, maxMS int) {
 		<-time.After(randTime(minMS, maxMS))
 
 		// Get all lights connected to the system
-		lightsQuery := `
-			SELECT c.name, c.device_id FROM component c
-				JOIN device d ON c.device_id=d.id
-				WHERE is_online=1 AND type=?`
-		lights := []db.Component{}
-		db, err := server.DB()
+		onlineLights := db.Query{}.OfType(types.ComponentTypeLightEmitter).Online(true)
+		lights, err := server.FindComponents(onlineLights, db.ExpandNone)
 		if err != nil {
-			color.Red("could not open DB: %v", err)
-		}
-		// run the query
-		if err = db.Select(&lights, lightsQuery, types.LightEmitter{}.Type()); err != nil {
 			color.Red("could not run query to get light ids: %v", err)
 		}
 
@@ -76,13 +68,7 @@ func ghostInTheCircuits(server *sift.Server, minMS, maxMS int) {
 			color.Red("no lights found for the circuit ghosts to play with...")
 		} else {
 			// For each light found...
-			for _, light := range lights {
-				// ...assemble a component ID...
-				lightID := types.ComponentID{
-					Name:     light.Name,
-					DeviceID: types.DeviceID(light.DeviceID),
-				}
-
+			for lightID := range lights {
 				// ...generate a random brightness value (0-100)...
 				randBrightness := uint8(rand.Intn(100))
 
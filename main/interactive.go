@@ -9,6 +9,7 @@ import (
 	"os"
 	"github.com/upwrd/sift"
 	"github.com/upwrd/sift/db"
+	"github.com/upwrd/sift/types"
 	"strconv"
 	"strings"
 )
@@ -71,16 +72,12 @@ func topLevel(server *sift.Server) {
 
 func locations(server *sift.Server) {
 	// Get the locations from database
-	siftDB, err := server.DB()
+	locs, err := server.GetLocations()
 	checkErr(err)
-	locs := []db.Location{}
-	siftDB.Select(&locs, "SELECT * FROM location")
 
 	// Print the prompt
 	fmt.Printf("-- Locations --\n")
-	for _, loc := range locs {
-		fmt.Printf("   %v %v\n", loc.ID, loc.Name)
-	}
+	printLocations(locs)
 
 	fmt.Printf("[enter R to refresh, A to add a location, an ID to edit, or blank to go back]\n")
 	bio := bufio.NewReader(os.Stdin)
@@ -101,7 +98,17 @@ func locations(server *sift.Server) {
 		if err != nil {
 			locations(server)
 		}
-		editLocation(server, int64(id))
+		editLocation(server, types.LocationID(id))
+	}
+}
+
+func printLocations(locs map[types.LocationID]types.Location) {
+	for id, loc := range locs {
+		if parent, ok := locs[loc.ParentID]; ok {
+			fmt.Printf("   %v %v (in %v)\n", id, loc.Name, parent.Name)
+		} else {
+			fmt.Printf("   %v %v\n", id, loc.Name)
+		}
 	}
 }
 
@@ -118,21 +125,17 @@ func addLocation(server *sift.Server) {
 	case line == "":
 		locations(server) // go back up to locations
 	default:
-		siftDB, err := server.DB()
-		checkErr(err)
-		res, err := siftDB.Exec("INSERT INTO location (name) VALUES (?)", line)
-		checkErr(err)
-		id, err := res.LastInsertId()
+		id, err := server.CreateLocation(line, 0)
 		checkErr(err)
 		fmt.Printf(">> inserted %v as location %v\n", line, id)
 		locations(server)
 	}
 }
 
-func editLocation(server *sift.Server, id int64) {
+func editLocation(server *sift.Server, id types.LocationID) {
 	// Print the prompt
 	fmt.Printf("-- Edit Location %v --\n", id)
-	fmt.Printf("[enter N to change name, D to delete, or blank to go back]\n")
+	fmt.Printf("[enter N to change name, P to change parent, D to delete, or blank to go back]\n")
 	bio := bufio.NewReader(os.Stdin)
 	lineByte, _, err := bio.ReadLine()
 	checkErr(err)
@@ -143,22 +146,24 @@ func editLocation(server *sift.Server, id int64) {
 		locations(server) // go back up to locations
 	case strings.HasPrefix(line, "d"), strings.HasPrefix(line, "D"):
 		// perform delete
-		siftDB, err := server.DB()
+		resp, err := server.DeleteLocation(id)
 		checkErr(err)
-		_, err = siftDB.Exec("DELETE FROM location WHERE id=?", id)
-		checkErr(err)
-		fmt.Printf(">> deleted location %v\n", id)
+		fmt.Printf(">> deleted location %v (moved %v devices and %v locations to its parent)\n",
+			id, len(resp.MovedDevices), len(resp.MovedLocations))
 		locations(server)
 	case strings.HasPrefix(line, "n"), strings.HasPrefix(line, "N"):
 		// change the name
 		editLocationName(server, id)
+	case strings.HasPrefix(line, "p"), strings.HasPrefix(line, "P"):
+		// change the parent
+		editLocationParent(server, id)
 	default:
 		// if unknown, repeat prompt
 		editLocation(server, id)
 	}
 }
 
-func editLocationName(server *sift.Server, id int64) {
+func editLocationName(server *sift.Server, id types.LocationID) {
 	// Print the prompt
 	fmt.Printf("-- Edit name for Location %v--\n", id)
 	fmt.Printf("Name? (blank to go back):\n")
@@ -171,14 +176,8 @@ func editLocationName(server *sift.Server, id int64) {
 	case line == "":
 		locations(server) // go back up to locations
 	default:
-		siftDB, err := server.DB()
-		checkErr(err)
-		res, err := siftDB.Exec("UPDATE location SET name=? WHERE id=?", line, id)
-		checkErr(err)
-		n, err := res.RowsAffected()
-		checkErr(err)
-		if n == 0 {
-			fmt.Printf(">> no rows affected, try again?\n")
+		if err := server.RenameLocation(id, line); err != nil {
+			fmt.Printf(">> could not rename location (%v), try again?\n", err)
 		} else {
 			fmt.Printf(">> location %v is now named %v\n", id, line)
 		}
@@ -186,9 +185,42 @@ func editLocationName(server *sift.Server, id int64) {
 	}
 }
 
+func editLocationParent(server *sift.Server, id types.LocationID) {
+	// Get available locations from database
+	locs, err := server.GetLocations()
+	checkErr(err)
+
+	// Print the prompt
+	fmt.Printf("-- Set parent for Location %v --\n", id)
+	fmt.Printf("Available Locations:\n")
+	printLocations(locs)
+	fmt.Printf("[enter an ID to set the parent, 0 to move to the top level, or blank to go back]\n")
+	bio := bufio.NewReader(os.Stdin)
+	lineByte, _, err := bio.ReadLine()
+	checkErr(err)
+	line := string(lineByte)
+
+	switch {
+	case line == "":
+		editLocation(server, id) // go back up to the location
+	default:
+		// Try to parse the input as a number
+		parentID, err := strconv.Atoi(string(line))
+		if err != nil {
+			editLocationParent(server, id)
+		}
+		if err := server.MoveLocation(id, types.LocationID(parentID)); err != nil {
+			fmt.Printf(">> could not move location (%v), try again?\n", err)
+		} else {
+			fmt.Printf(">> location %v is now in location %v\n", id, parentID)
+		}
+		locations(server)
+	}
+}
+
 func devices(server *sift.Server) {
 	// Get the devices from database
-	devs, err := server.SiftDB.GetDevices(db.ExpandNone)
+	devs, err := server.GetDevices(db.ExpandMetadata)
 	checkErr(err)
 
 	// Print the prompt
@@ -232,30 +264,56 @@ func editDevice(server *sift.Server, id int64) {
 		locations(server) // go back up to locations
 	case strings.HasPrefix(line, "n"), strings.HasPrefix(line, "N"):
 		// change the name
-		fmt.Printf("TODO: go to edit Device name...\n")
-		editDevice(server, id)
+		editDeviceName(server, id)
 	case strings.HasPrefix(line, "l"), strings.HasPrefix(line, "L"):
 		// edit location
 		editDeviceLocation(server, id)
 	default:
 		// if unknown, repeat prompt
-		editLocation(server, id)
+		editDevice(server, id)
+	}
+}
+
+func editDeviceName(server *sift.Server, id int64) {
+	// Print the prompt
+	fmt.Printf("-- Edit name for Device %v--\n", id)
+	fmt.Printf("Name? (blank to go back, - to use the name reported by the device):\n")
+	bio := bufio.NewReader(os.Stdin)
+	lineByte, _, err := bio.ReadLine()
+	checkErr(err)
+	line := string(lineByte)
+
+	switch {
+	case line == "":
+		editDevice(server, id) // go back up to the device
+	default:
+		// Keep any other metadata the user has set
+		md, err := server.GetDeviceMetadata(types.DeviceID(id))
+		checkErr(err)
+		md.DisplayName = line
+		if line == "-" {
+			md.DisplayName = ""
+		}
+		if err := server.SetDeviceMetadata(types.DeviceID(id), md); err != nil {
+			fmt.Printf(">> could not set name (%v), try again?\n", err)
+		} else if md.DisplayName == "" {
+			fmt.Printf(">> device %v now uses the name reported by the device\n", id)
+		} else {
+			fmt.Printf(">> device %v is now named %v\n", id, md.DisplayName)
+		}
+		devices(server)
 	}
 }
 
 func editDeviceLocation(server *sift.Server, id int64) {
 	// Get available locations from database
-	siftDB, err := server.DB()
+	locs, err := server.GetLocations()
 	checkErr(err)
-	locs := []db.Location{}
-	siftDB.Select(&locs, "SELECT * FROM location")
 
 	// Print the prompt
 	fmt.Printf("-- Set Location for Device %v --\n", id)
 	fmt.Printf("Available Locations:\n")
-	for _, loc := range locs {
-		fmt.Printf("   %v %v\n", loc.ID, loc.Name)
-	}
+	printLocations(locs)
 	fmt.Printf("[enter an ID to set Location, R to refresh Locations, or blank to go back]\n")
 
 	bio := bufio.NewReader(os.Stdin)
@@ -274,12 +332,8 @@ func editDeviceLocation(server *sift.Server, id int64) {
 		if err != nil {
 			editDeviceLocation(server, id)
 		}
-		res, err := siftDB.Exec("UPDATE device SET location_id=? WHERE id=?", locID, id)
-		checkErr(err)
-		n, err := res.RowsAffected()
-		checkErr(err)
-		if n == 0 {
-			fmt.Printf(">> no rows affected, try again?\n")
+		if err := server.SetDeviceLocation(types.DeviceID(id), types.LocationID(locID)); err != nil {
+			fmt.Printf(">> could not set location (%v), try again?\n", err)
 		} else {
 			fmt.Printf(">> device %v is now in location %v\n", id, locID)
 		}
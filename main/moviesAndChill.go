@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/thejerf/suture"
 	"github.com/upwrd/sift"
+	"github.com/upwrd/sift/db"
 	"github.com/upwrd/sift/notif"
 	"github.com/upwrd/sift/types"
 )
@@ -58,45 +59,38 @@ func moviesAndChill(server *sift.Server) {
 		//   (A better implementation might look at the updates and only
 		//   recalculate those that need to be recalculated)
 
-		// Run a query against the SIFT sqlite database to find each available
-		// light and the number of PLAYING media players in the same room.
-		lightsQuery := `
-			SELECT c1.device_id, c1.name, num_playing_mpls_in_room
-			FROM light_emitter_state l1
-			JOIN component c1 ON l1.id=c1.id
-			JOIN device d1 ON c1.device_id=d1.id
-			JOIN (SELECT d.location_id loc,
-				SUM (CASE WHEN m.play_state="PLAYING" THEN 1 ELSE 0 END) as num_playing_mpls_in_room
-				FROM media_player_state m
-				JOIN component c ON m.id=c.id
-				JOIN device d ON c.device_id=d.id
-				GROUP BY d.location_id)
-				ON d1.location_id=loc;`
-		type result struct {
-			DeviceID                     int64 `db:"device_id"`
-			Name                         string
-			NumPlayingMediaPlayersInRoom int `db:"num_playing_mpls_in_room"`
-		}
-		results := []result{}
-		db, _ := server.DB()
-		// run the query
-		if err := db.Select(&results, lightsQuery); err != nil {
-			panic(fmt.Sprintf("could not run query to get active media players: %v", err))
+		// Query SIFT to find each light, then count the media players (and
+		// the PLAYING media players) in the same room.
+		lights, err := server.FindComponents(db.Query{}.OfType(types.ComponentTypeLightEmitter), db.ExpandNone)
+		if err != nil {
+			panic(fmt.Sprintf("could not run query to get lights: %v", err))
 		}
 
 		// Check out the results and determine how each light should be set. In
 		// SIFT, this is done using Intents.
-		for _, result := range results {
+		for target := range lights {
+			mediaInRoom := db.Query{}.
+				OfType(types.ComponentTypeMediaPlayer).
+				InLocationOf(target.DeviceID)
+			numMedia, err := server.CountComponents(mediaInRoom)
+			if err != nil {
+				panic(fmt.Sprintf("could not run query to get media players: %v", err))
+			}
+			if numMedia == 0 {
+				continue // only rooms with media players are managed
+			}
+			playingInRoom := mediaInRoom.Where("play_state", "=", types.MediaPlayerStatePlaying)
+			numPlaying, err := server.CountComponents(playingInRoom)
+			if err != nil {
+				panic(fmt.Sprintf("could not run query to get active media players: %v", err))
+			}
+
 			var intent types.SetLightEmitterIntent
-			if result.NumPlayingMediaPlayersInRoom > 0 { // a movie is playing in the room ...
+			if numPlaying > 0 { // a movie is playing in the room ...
 				intent.BrightnessInPercent = lightsLow // ...bring the lights down low
 			} else { // no movies in this room...
 				intent.BrightnessInPercent = lightsHigh // ...bring the lights up
 			}
-			target := types.ComponentID{
-				DeviceID: types.DeviceID(result.DeviceID),
-				Name:     result.Name,
-			}
 			// Send the intent to the SIFT server, which will make it real
 			if err := server.EnactIntent(target, intent); err != nil {
 				fmt.Printf("warning: could not enact intent: %v\n", err)
@@ -0,0 +1,38 @@
+package sift
+
+import (
+	"github.com/upwrd/sift/db"
+	"github.com/upwrd/sift/notif"
+	"github.com/upwrd/sift/types"
+)
+
+// SetDeviceMetadata replaces the user-provided metadata for a Device and
+// notifies listeners.
+func (s *Server) SetDeviceMetadata(id types.DeviceID, md types.Metadata) error {
+	if err := s.Store.SetDeviceMetadata(id, md); err != nil {
+		return err
+	}
+	dev, err := s.Store.GetDevice(id, db.ExpandMetadata)
+	if err != nil {
+		s.log.Warn("could not get device to post notification", "id", id, "err", err)
+		return nil
+	}
+	s.PostDevice(id, dev, notif.Update)
+	return nil
+}
+
+// SetComponentMetadata replaces the user-provided metadata for a Component and
+// notifies listeners.
+func (s *Server) SetComponentMetadata(id types.ComponentID, md types.Metadata) error {
+	if err := s.Store.SetComponentMetadata(id, md); err != nil {
+		return err
+	}
+	comp, err := s.Store.GetComponent(id, db.ExpandMetadata)
+	if err != nil {
+		// the Component may not currently be attached to its Device
+		s.log.Debug("could not get component to post notification", "id", id, "err", err)
+		return nil
+	}
+	s.PostComponent(id, comp, notif.Update)
+	return nil
+}
@@ -0,0 +1,121 @@
+// Package ble discovers Bluetooth Low Energy peripherals, such as locks,
+// sensors and bulbs, by listening for their advertisements.
+package ble
+
+import (
+	"fmt"
+	"github.com/upwrd/sift/logging"
+	"github.com/upwrd/sift/network"
+	"github.com/upwrd/sift/types"
+	"strings"
+)
+
+// Log is used to log messages for the ble package. Logs are disabled by
+// default; use sift/logging.SetLevel() to set log levels for all packages, or
+// Log.SetHandler() to set a custom handler for this package (see:
+// https://godoc.org/gopkg.in/inconshreveable/log15.v2)
+var Log = logging.Log.New("pkg", "network/ble")
+
+// ServiceDescription describes the advertisements of a peripheral. Every
+// non-empty field must match.
+type ServiceDescription struct {
+	NamePrefix     string   // the advertised local name must start with this, e.g. "Kevo"
+	ServiceUUIDs   []string // every one must be advertised, e.g. "180f" or "0000180f-0000-1000-8000-00805f9b34fb"
+	ManufacturerID uint16   // the company identifier of the manufacturer data; 0 matches any
+}
+
+// Matches returns true if the peripheral matches the description
+func (d ServiceDescription) Matches(p Peripheral) bool {
+	if d.NamePrefix != "" && !strings.HasPrefix(p.Name, d.NamePrefix) {
+		return false
+	}
+	for _, want := range d.ServiceUUIDs {
+		if !p.advertises(want) {
+			return false
+		}
+	}
+	if d.ManufacturerID != 0 && d.ManufacturerID != p.ManufacturerID {
+		return false
+	}
+	return true
+}
+
+// A Peripheral is a Bluetooth LE device, as described by its advertisements
+type Peripheral struct {
+	Address          string   // the Bluetooth device address, e.g. "c4:7c:8d:6a:2f:01"
+	Name             string   // the advertised local name, if any
+	RSSI             int      // the signal strength of the last advertisement, in dBm
+	ServiceUUIDs     []string // the advertised service UUIDs
+	ManufacturerID   uint16   // the company identifier of the manufacturer data, if any
+	ManufacturerData []byte   // the manufacturer data, without the company identifier
+}
+
+// key identifies the Peripheral while it is being handled
+func (p Peripheral) key() string {
+	return strings.ToLower(p.Address)
+}
+
+// advertises returns true if the peripheral advertises the service UUID. Short
+// (16-bit) UUIDs match their long forms.
+func (p Peripheral) advertises(uuid string) bool {
+	for _, have := range p.ServiceUUIDs {
+		if normalizeUUID(have) == normalizeUUID(uuid) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeUUID returns the long, lower-case form of a service UUID
+func normalizeUUID(uuid string) string {
+	uuid = strings.ToLower(uuid)
+	switch len(uuid) {
+	case 4: // 16-bit
+		return "0000" + uuid + "-0000-1000-8000-00805f9b34fb"
+	case 8: // 32-bit
+		return uuid + "-0000-1000-8000-00805f9b34fb"
+	}
+	return uuid
+}
+
+// A ServiceFoundNotification indicates that a Peripheral was found which
+// matched all of MatchingDescriptionIDs.
+type ServiceFoundNotification struct {
+	Peripheral             Peripheral
+	MatchingDescriptionIDs []string
+}
+
+// ServiceContext describes (and grants access to) a particular peripheral.
+// Adapters connect to the peripheral through the context (see Connect).
+type ServiceContext struct {
+	network.Context // reports the Adapter's status, and stores data on its behalf
+	Peripheral
+
+	transport Transport
+}
+
+// BuildContext builds a new ServiceContext for the given Peripheral, which is
+// reached through transport. The second return value is a channel which will
+// receive status updates from calls to context.SendStatus() until the Context
+// is killed (see KillContext).
+func BuildContext(p Peripheral, transport Transport, store network.CredentialStore, adapterName string, config types.AdapterConfig) (*ServiceContext, <-chan network.AdapterStatus) {
+	base, status := network.BuildContext(store, adapterName, config)
+	return &ServiceContext{Context: base, Peripheral: p, transport: transport}, status
+}
+
+// KillContext kills the specified context. Subsequent calls on the Context
+// will return errors
+func KillContext(context *ServiceContext) {
+	if context != nil {
+		network.KillContext(&context.Context)
+	}
+}
+
+// Connect opens a connection to the peripheral. The Adapter should close it
+// when it is done.
+func (s *ServiceContext) Connect() (Conn, error) {
+	if s.transport == nil {
+		return nil, fmt.Errorf("context has no bluetooth transport")
+	}
+	return s.transport.Connect(s.Address)
+}
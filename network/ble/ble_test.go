@@ -0,0 +1,140 @@
+package ble
+
+import (
+	"fmt"
+	"github.com/upwrd/sift/types"
+	. "gopkg.in/check.v1"
+	"testing"
+	"time"
+)
+
+// Hook up gocheck into the "go test" runner.
+func TestBLE(t *testing.T) { TestingT(t) }
+
+type BLESuite struct{}
+
+var _ = Suite(&BLESuite{})
+
+var (
+	testLock = Peripheral{
+		Address:        "C4:7C:8D:6A:2F:01",
+		Name:           "Kevo 2F01",
+		ServiceUUIDs:   []string{"180F", "0000fff0-0000-1000-8000-00805f9b34fb"},
+		ManufacturerID: 0x0131,
+	}
+	testBulb = Peripheral{
+		Address:      "c4:7c:8d:6a:2f:02",
+		Name:         "Bulb",
+		ServiceUUIDs: []string{"fff0"},
+	}
+)
+
+func (s *BLESuite) TestMatches(c *C) {
+	c.Assert(ServiceDescription{}.Matches(testLock), Equals, true)
+	c.Assert(ServiceDescription{NamePrefix: "Kevo"}.Matches(testLock), Equals, true)
+	c.Assert(ServiceDescription{NamePrefix: "Kevo"}.Matches(testBulb), Equals, false)
+
+	// short UUIDs match their long forms, regardless of case
+	c.Assert(ServiceDescription{ServiceUUIDs: []string{"fff0"}}.Matches(testLock), Equals, true)
+	c.Assert(ServiceDescription{ServiceUUIDs: []string{"0000180f-0000-1000-8000-00805F9B34FB"}}.Matches(testLock), Equals, true)
+	c.Assert(ServiceDescription{ServiceUUIDs: []string{"180f", "fff0"}}.Matches(testBulb), Equals, false)
+
+	c.Assert(ServiceDescription{ManufacturerID: 0x0131}.Matches(testLock), Equals, true)
+	c.Assert(ServiceDescription{ManufacturerID: 0x0131}.Matches(testBulb), Equals, false)
+}
+
+func (s *BLESuite) TestDiscover(c *C) {
+	transport := NewFakeTransport()
+	transport.SetPeripheral(testLock)
+	transport.SetPeripheral(testBulb)
+
+	// without a transport or descriptions, nothing is found
+	discoverer := NewDiscoverer(nil)
+	c.Assert(discoverer.Discover(), HasLen, 0)
+	all := discoverer.AddDescription(ServiceDescription{ServiceUUIDs: []string{"fff0"}})
+	c.Assert(discoverer.Discover(), HasLen, 0)
+
+	discoverer.SetTransport(transport)
+	c.Assert(discoverer.Transport(), Equals, Transport(transport))
+	found := discoverer.Discover()
+	c.Assert(found, HasLen, 2)
+	c.Assert(found[0].Peripheral.Address, Equals, testLock.Address)
+	c.Assert(found[0].MatchingDescriptionIDs, DeepEquals, []string{all})
+	c.Assert(found[1].Peripheral.Address, Equals, testBulb.Address)
+
+	// found peripherals are locked until they are unlocked
+	c.Assert(discoverer.Discover(), HasLen, 0)
+	discoverer.Unlock(Peripheral{Address: "c4:7c:8d:6a:2f:01"})
+	found = discoverer.Discover()
+	c.Assert(found, HasLen, 1)
+	c.Assert(found[0].Peripheral.Address, Equals, testLock.Address)
+
+	// descriptions can be changed
+	c.Assert(discoverer.UpdateDescription(all, ServiceDescription{NamePrefix: "Bulb"}), IsNil)
+	c.Assert(discoverer.UpdateDescription("no-such-id", ServiceDescription{}), NotNil)
+	discoverer.Unlock(testLock)
+	discoverer.Unlock(testBulb)
+	found = discoverer.Discover()
+	c.Assert(found, HasLen, 1)
+	c.Assert(found[0].Peripheral.Address, Equals, testBulb.Address)
+
+	// failed scans find nothing
+	discoverer.Unlock(testBulb)
+	transport.SetScanError(fmt.Errorf("adapter is powered off"))
+	c.Assert(discoverer.Discover(), HasLen, 0)
+	transport.SetScanError(nil)
+	c.Assert(discoverer.Discover(), HasLen, 1)
+}
+
+func (s *BLESuite) TestContinuousDiscoverer(c *C) {
+	transport := NewFakeTransport()
+	discoverer := NewContinuousDiscoverer(transport, 10*time.Millisecond)
+	id := discoverer.AddDescription(ServiceDescription{NamePrefix: "Kevo"})
+	go discoverer.Serve()
+	defer discoverer.Stop()
+
+	transport.SetPeripheral(testLock)
+	select {
+	case n := <-discoverer.FoundServices():
+		c.Assert(n.Peripheral.Address, Equals, testLock.Address)
+		c.Assert(n.MatchingDescriptionIDs, DeepEquals, []string{id})
+	case <-time.After(5 * time.Second):
+		c.Fatalf("timed out waiting for the discoverer to find %v", testLock.Address)
+	}
+}
+
+func (s *BLESuite) TestContext(c *C) {
+	transport := NewFakeTransport()
+	transport.SetPeripheral(testLock)
+	c.Assert(transport.SetCharacteristic(testLock.Address, "fff0", "fff1", []byte{0}), IsNil)
+	c.Assert(transport.SetCharacteristic("c4:7c:8d:6a:2f:09", "fff0", "fff1", []byte{0}), NotNil)
+
+	context, _ := BuildContext(testLock, transport, nil, "test", types.AdapterConfig{})
+	conn, err := context.Connect()
+	c.Assert(err, IsNil)
+	value, err := conn.ReadCharacteristic("FFF0", "0000fff1-0000-1000-8000-00805f9b34fb")
+	c.Assert(err, IsNil)
+	c.Assert(value, DeepEquals, []byte{0})
+	_, err = conn.ReadCharacteristic("fff0", "fff2")
+	c.Assert(err, NotNil)
+
+	// writes are visible to the transport
+	c.Assert(conn.WriteCharacteristic("fff0", "fff1", []byte{1}), IsNil)
+	value, ok := transport.Characteristic(testLock.Address, "fff0", "fff1")
+	c.Assert(ok, Equals, true)
+	c.Assert(value, DeepEquals, []byte{1})
+
+	c.Assert(conn.Close(), IsNil)
+	_, err = conn.ReadCharacteristic("fff0", "fff1")
+	c.Assert(err, NotNil)
+
+	// peripherals out of range cannot be reached
+	transport.RemovePeripheral(testLock.Address)
+	_, err = context.Connect()
+	c.Assert(err, NotNil)
+	KillContext(context)
+
+	context, _ = BuildContext(testLock, nil, nil, "test", types.AdapterConfig{})
+	_, err = context.Connect()
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,235 @@
+package ble
+
+import (
+	"fmt"
+	"github.com/pborman/uuid"
+	"github.com/thejerf/suture"
+	log "gopkg.in/inconshreveable/log15.v2"
+	logext "gopkg.in/inconshreveable/log15.v2/ext"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	scanTimeout       = 5 * time.Second // how long to listen for advertisements
+	foundServicesSize = 100
+)
+
+// An IDiscoverer searches for Bluetooth LE peripherals matching given
+// descriptions. Once peripherals are found, they are locked and returned to
+// the caller. It is up to the caller to unlock peripherals (via Unlock()) if
+// they are no longer in use.
+type IDiscoverer interface {
+	// Add a description to search for; return the ID used if a match is returned
+	AddDescription(desc ServiceDescription) string
+
+	// Replace the description with the given ID
+	UpdateDescription(id string, desc ServiceDescription) error
+
+	// Listen for advertisements from peripherals matching given descriptions
+	Discover() []ServiceFoundNotification
+
+	// By default, after a peripheral is found it is ignored in future
+	// searches. Unlock instructs the discoverer to include the peripheral in
+	// future searches.
+	Unlock(p Peripheral)
+
+	// Change the Transport used to listen for advertisements. Until one is
+	// set, nothing is found.
+	SetTransport(t Transport)
+
+	// Transport returns the current Transport, or nil
+	Transport() Transport
+}
+
+// Discoverer implements IDiscoverer
+type Discoverer struct {
+	descriptionsByID map[string]ServiceDescription
+	dlock            sync.RWMutex // protects descriptionsByID
+
+	activePeripherals map[string]struct{}
+	slock             sync.Mutex // protects activePeripherals
+
+	transport Transport
+	tlock     sync.RWMutex // protects transport
+
+	log log.Logger
+}
+
+// NewDiscoverer properly instantiates a Discoverer, which listens for
+// advertisements through the given Transport. The Transport may be nil, and
+// set later with SetTransport.
+func NewDiscoverer(transport Transport) *Discoverer {
+	return &Discoverer{
+		descriptionsByID:  make(map[string]ServiceDescription),
+		activePeripherals: make(map[string]struct{}),
+		transport:         transport,
+		log:               Log.New("obj", "ble.discoverer", "id", logext.RandId(8)),
+	}
+}
+
+// AddDescription adds a ServiceDescription to the Discoverer. On following
+// searches, the Discoverer will find peripherals which match the description.
+func (d *Discoverer) AddDescription(desc ServiceDescription) string {
+	d.dlock.Lock()
+	defer d.dlock.Unlock()
+	id := uuid.New()
+	d.descriptionsByID[id] = desc
+	return id
+}
+
+// UpdateDescription replaces the ServiceDescription with the given ID
+func (d *Discoverer) UpdateDescription(id string, desc ServiceDescription) error {
+	d.dlock.Lock()
+	defer d.dlock.Unlock()
+	if _, ok := d.descriptionsByID[id]; !ok {
+		return fmt.Errorf("no description with id %v", id)
+	}
+	d.descriptionsByID[id] = desc
+	return nil
+}
+
+// SetTransport changes the Transport used to listen for advertisements
+func (d *Discoverer) SetTransport(t Transport) {
+	d.tlock.Lock()
+	defer d.tlock.Unlock()
+	d.transport = t
+}
+
+// Transport returns the Transport used to listen for advertisements, or nil
+// if none has been set
+func (d *Discoverer) Transport() Transport {
+	d.tlock.RLock()
+	defer d.tlock.RUnlock()
+	return d.transport
+}
+
+// Discover listens for advertisements, and returns the peripherals which
+// matched any descriptions and are not already in use, ordered by address
+func (d *Discoverer) Discover() []ServiceFoundNotification {
+	d.dlock.RLock()
+	numDescriptions := len(d.descriptionsByID)
+	d.dlock.RUnlock()
+	if numDescriptions == 0 {
+		d.log.Debug("discoverer has no descriptions, ignoring discovery")
+		return nil
+	}
+	transport := d.Transport()
+	if transport == nil {
+		d.log.Debug("discoverer has no bluetooth transport, ignoring discovery")
+		return nil
+	}
+
+	peripherals, err := transport.Scan(scanTimeout)
+	if err != nil {
+		d.log.Warn("could not scan for bluetooth le advertisements", "err", err)
+		return nil
+	}
+	var found []ServiceFoundNotification
+	for _, p := range peripherals {
+		if n, ok := d.consider(p); ok {
+			found = append(found, n)
+		}
+	}
+	d.log.Info("ble discovery complete", "peripherals", len(peripherals), "services_found", len(found))
+	return found
+}
+
+// Unlock unlocks the provided Peripheral, such that it will no longer be
+// ignored in future searches.
+func (d *Discoverer) Unlock(p Peripheral) {
+	d.slock.Lock()
+	defer d.slock.Unlock()
+	delete(d.activePeripherals, p.key())
+	d.log.Debug("ble discoverer unlocked peripheral", "address", p.Address)
+}
+
+// consider checks whether the peripheral matches any descriptions and is not
+// already in use; if so, it locks the peripheral and returns it
+func (d *Discoverer) consider(p Peripheral) (ServiceFoundNotification, bool) {
+	d.dlock.RLock()
+	var ids []string
+	for id, desc := range d.descriptionsByID {
+		if desc.Matches(p) {
+			ids = append(ids, id)
+		}
+	}
+	d.dlock.RUnlock()
+	if len(ids) == 0 {
+		return ServiceFoundNotification{}, false
+	}
+	sort.Strings(ids)
+
+	d.slock.Lock()
+	defer d.slock.Unlock()
+	if _, inUse := d.activePeripherals[p.key()]; inUse {
+		d.log.Debug("discoverer ignoring peripheral that is already in use", "address", p.Address)
+		return ServiceFoundNotification{}, false
+	}
+	d.activePeripherals[p.key()] = struct{}{} // mark peripheral as in use
+	d.log.Debug("found ble peripheral", "address", p.Address, "name", p.Name, "descriptions", ids)
+	return ServiceFoundNotification{Peripheral: p, MatchingDescriptionIDs: ids}, true
+}
+
+// An IContinuousDiscoverer is a Discoverer that searches continuously.
+// Peripherals found are passed to the channel provided by FoundServices()
+type IContinuousDiscoverer interface {
+	suture.Service
+	IDiscoverer
+	FoundServices() chan ServiceFoundNotification
+}
+
+// ContinuousDiscoverer implements IContinuousDiscoverer
+type ContinuousDiscoverer struct {
+	*Discoverer
+	foundChan chan ServiceFoundNotification
+	period    time.Duration
+	stop      chan struct{}
+}
+
+// NewContinuousDiscoverer properly instantiates a ContinuousDiscoverer. The
+// new Discoverer will wait between searches for a time defined by `period`.
+func NewContinuousDiscoverer(transport Transport, period time.Duration) *ContinuousDiscoverer {
+	return &ContinuousDiscoverer{
+		Discoverer: NewDiscoverer(transport),
+		foundChan:  make(chan ServiceFoundNotification, foundServicesSize),
+		period:     period,
+		stop:       make(chan struct{}),
+	}
+}
+
+// FoundServices returns a channel which will be populated with peripherals
+// found by the ContinuousDiscoverer
+func (d *ContinuousDiscoverer) FoundServices() chan ServiceFoundNotification {
+	return d.foundChan
+}
+
+// Serve begins serving the ContinuousDiscoverer.
+func (d *ContinuousDiscoverer) Serve() {
+	d.log.Debug("starting continuous ble discoverer", "period", d.period)
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		for _, n := range d.Discover() {
+			select {
+			case d.foundChan <- n:
+			case <-d.stop:
+				return
+			}
+		}
+
+		// Wait for d.period
+		timer.Reset(d.period)
+		select {
+		case <-d.stop:
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Stop stops the ContinuousDiscoverer
+func (d *ContinuousDiscoverer) Stop() {
+	d.stop <- struct{}{}
+}
@@ -0,0 +1,166 @@
+package ble
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Transport listens for Bluetooth LE advertisements and connects to
+// peripherals. Implementations wrap a platform's Bluetooth stack (such as
+// BlueZ on Linux); FakeTransport simulates one for tests.
+type Transport interface {
+	// Scan listens for advertisements for the given time, and returns the
+	// peripherals heard, one per address
+	Scan(timeout time.Duration) ([]Peripheral, error)
+
+	// Connect opens a connection to the peripheral with the given address
+	Connect(address string) (Conn, error)
+}
+
+// A Conn is a connection to a peripheral, through which Adapters read and
+// write GATT characteristics. Services and characteristics are identified by
+// UUID.
+type Conn interface {
+	ReadCharacteristic(service, characteristic string) ([]byte, error)
+	WriteCharacteristic(service, characteristic string, value []byte) error
+	Close() error
+}
+
+// FakeTransport is a Transport which simulates peripherals, for testing
+// Adapters and the Server without Bluetooth hardware. Peripherals added with
+// SetPeripheral are returned by every Scan until they are removed, and their
+// characteristics can be read and written through connections. It is safe for
+// concurrent use.
+type FakeTransport struct {
+	peripherals     map[string]Peripheral
+	characteristics map[string]map[string][]byte // indexed by peripheral, then by "service/characteristic"
+	scanErr         error
+	lock            sync.Mutex // protects all of the above
+}
+
+// NewFakeTransport returns a FakeTransport with no peripherals
+func NewFakeTransport() *FakeTransport {
+	return &FakeTransport{
+		peripherals:     make(map[string]Peripheral),
+		characteristics: make(map[string]map[string][]byte),
+	}
+}
+
+// SetPeripheral adds the peripheral, or replaces the peripheral with the same
+// address
+func (t *FakeTransport) SetPeripheral(p Peripheral) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.peripherals[p.key()] = p
+	if _, ok := t.characteristics[p.key()]; !ok {
+		t.characteristics[p.key()] = make(map[string][]byte)
+	}
+}
+
+// RemovePeripheral removes the peripheral with the given address, as if it
+// had gone out of range
+func (t *FakeTransport) RemovePeripheral(address string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.peripherals, strings.ToLower(address))
+	delete(t.characteristics, strings.ToLower(address))
+}
+
+// SetCharacteristic sets the value of a characteristic of the peripheral with
+// the given address, which must have been added
+func (t *FakeTransport) SetCharacteristic(address, service, characteristic string, value []byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	chars, ok := t.characteristics[strings.ToLower(address)]
+	if !ok {
+		return fmt.Errorf("no peripheral with address %v", address)
+	}
+	chars[characteristicKey(service, characteristic)] = append([]byte{}, value...)
+	return nil
+}
+
+// Characteristic returns the value of a characteristic of the peripheral with
+// the given address, such as one written by an Adapter
+func (t *FakeTransport) Characteristic(address, service, characteristic string) ([]byte, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	value, ok := t.characteristics[strings.ToLower(address)][characteristicKey(service, characteristic)]
+	return append([]byte{}, value...), ok
+}
+
+// SetScanError makes following scans fail with err, or succeed if err is nil
+func (t *FakeTransport) SetScanError(err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.scanErr = err
+}
+
+// Scan returns the peripherals which have been added, ordered by address. It
+// does not wait for the timeout.
+func (t *FakeTransport) Scan(timeout time.Duration) ([]Peripheral, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.scanErr != nil {
+		return nil, t.scanErr
+	}
+	peripherals := make([]Peripheral, 0, len(t.peripherals))
+	for _, p := range t.peripherals {
+		peripherals = append(peripherals, p)
+	}
+	sort.Sort(peripheralsByAddress(peripherals))
+	return peripherals, nil
+}
+
+// Connect opens a connection to the peripheral with the given address, which
+// must have been added
+func (t *FakeTransport) Connect(address string) (Conn, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if _, ok := t.peripherals[strings.ToLower(address)]; !ok {
+		return nil, fmt.Errorf("peripheral %v is not in range", address)
+	}
+	return &fakeConn{transport: t, address: strings.ToLower(address)}, nil
+}
+
+// fakeConn is a connection to a peripheral of a FakeTransport
+type fakeConn struct {
+	transport *FakeTransport
+	address   string
+	closed    bool
+}
+
+func (c *fakeConn) ReadCharacteristic(service, characteristic string) ([]byte, error) {
+	if c.closed {
+		return nil, fmt.Errorf("connection is closed")
+	}
+	value, ok := c.transport.Characteristic(c.address, service, characteristic)
+	if !ok {
+		return nil, fmt.Errorf("peripheral %v has no characteristic %v", c.address, characteristicKey(service, characteristic))
+	}
+	return value, nil
+}
+
+func (c *fakeConn) WriteCharacteristic(service, characteristic string, value []byte) error {
+	if c.closed {
+		return fmt.Errorf("connection is closed")
+	}
+	return c.transport.SetCharacteristic(c.address, service, characteristic, value)
+}
+
+func (c *fakeConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func characteristicKey(service, characteristic string) string {
+	return normalizeUUID(service) + "/" + normalizeUUID(characteristic)
+}
+
+type peripheralsByAddress []Peripheral
+
+func (s peripheralsByAddress) Len() int           { return len(s) }
+func (s peripheralsByAddress) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s peripheralsByAddress) Less(i, j int) bool { return s[i].key() < s[j].key() }
@@ -0,0 +1,87 @@
+package ipv4
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// arpTablePath is where Linux publishes the ARP table
+const arpTablePath = "/proc/net/arp"
+
+// atfComplete is the ARP flag marking an entry whose hardware address is known
+const atfComplete = 0x2
+
+// An arpReader returns the ARP table of this device, as hardware addresses
+// indexed by IP
+type arpReader func() (map[string]string, error)
+
+// readProcARP reads the ARP table from /proc/net/arp. It fails on systems
+// other than Linux.
+func readProcARP() (map[string]string, error) {
+	f, err := os.Open(arpTablePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseARPTable(f)
+}
+
+// parseARPTable parses an ARP table in the format of /proc/net/arp:
+//
+//	IP address       HW type     Flags       HW address            Mask     Device
+//	192.168.1.1      0x1         0x2         00:11:22:33:44:55     *        wlan0
+//
+// Incomplete entries, whose hardware addresses are not known, are ignored.
+func parseARPTable(r io.Reader) (map[string]string, error) {
+	table := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for first := true; scanner.Scan(); first = false {
+		if first {
+			continue // the header
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		ip := net.ParseIP(fields[0])
+		if ip == nil || ip.To4() == nil {
+			return nil, fmt.Errorf("invalid IP in arp table: %q", fields[0])
+		}
+		flags, err := strconv.ParseUint(fields[2], 0, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid flags in arp table: %q", fields[2])
+		}
+		if flags&atfComplete == 0 {
+			continue
+		}
+		table[ip.To4().String()] = strings.ToLower(fields[3])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read arp table: %v", err)
+	}
+	return table, nil
+}
+
+// diffARPTables returns the IPs which are in after but not before, or whose
+// hardware addresses have changed (such as when a new device takes an old
+// device's IP), sorted
+func diffARPTables(before, after map[string]string) []net.IP {
+	var changed []string
+	for ip, hwAddr := range after {
+		if old, ok := before[ip]; !ok || old != hwAddr {
+			changed = append(changed, ip)
+		}
+	}
+	sort.Strings(changed)
+	ips := make([]net.IP, 0, len(changed))
+	for _, ip := range changed {
+		ips = append(ips, net.ParseIP(ip).To4())
+	}
+	return ips
+}
@@ -0,0 +1,61 @@
+package ipv4
+
+import (
+	"net"
+	"time"
+)
+
+// minBackoff is how long scans skip an address after it first fails to respond
+const minBackoff = 30 * time.Second
+
+// An addrBackoff records how long scans skip an address which has not
+// responded
+type addrBackoff struct {
+	misses int       // consecutive checks to which the address did not respond
+	until  time.Time // the address is skipped until then
+}
+
+// backedOff returns true if scans should skip ip, because it has not
+// responded to recent checks
+func (s *Scanner) backedOff(ip net.IP, now time.Time) bool {
+	s.block.Lock()
+	defer s.block.Unlock()
+	b, ok := s.backoffByIP[ip.String()]
+	return ok && now.Before(b.until)
+}
+
+// recordResponse records whether anything responded at ip when it was
+// checked. Each time an address does not respond, it is skipped for twice as
+// long, from minBackoff up to maxBackoff.
+func (s *Scanner) recordResponse(ip net.IP, responded bool, maxBackoff time.Duration) {
+	s.block.Lock()
+	defer s.block.Unlock()
+	if responded {
+		delete(s.backoffByIP, ip.String())
+		return
+	}
+	b := s.backoffByIP[ip.String()]
+	b.misses++
+	delay := maxBackoff
+	if shift := uint(b.misses - 1); shift < 32 && minBackoff<<shift < maxBackoff {
+		delay = minBackoff << shift
+	}
+	b.until = time.Now().Add(delay)
+	s.backoffByIP[ip.String()] = b
+}
+
+// resetBackoff forgets that ip has not responded, so that it is checked by
+// the next scan
+func (s *Scanner) resetBackoff(ip net.IP) {
+	s.block.Lock()
+	defer s.block.Unlock()
+	delete(s.backoffByIP, ip.String())
+}
+
+// ResetBackoff forgets which addresses have not responded to recent scans, so
+// that following scans check them again
+func (s *Scanner) ResetBackoff() {
+	s.block.Lock()
+	defer s.block.Unlock()
+	s.backoffByIP = make(map[string]addrBackoff)
+}
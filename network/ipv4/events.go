@@ -0,0 +1,200 @@
+package ipv4
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Methods by which the Scanner searches for services
+const (
+	MethodScan      = "scan"      // checking every local IPv4 address (see Scanner.Scan)
+	MethodBrowse    = "browse"    // browsing with mDNS (see Scanner.Browse)
+	MethodDiscover6 = "discover6" // discovering IPv6 hosts (see Scanner.Discover6)
+	MethodReprobe   = "reprobe"   // checking particular addresses (see Scanner.ScanAddresses)
+)
+
+// ScanEventType describes what happened in a ScanEvent
+type ScanEventType int
+
+// Possible scan event types
+const (
+	ScanStarted    ScanEventType = iota // a scan, browse or discovery has started
+	ScanFinished                        // a scan, browse or discovery has finished; see Stats
+	ServiceMatched                      // the service at IP matched DescriptionIDs
+	IPLocked                            // IP is in use, and will be ignored until it is unlocked
+	IPUnlocked                          // IP is no longer in use
+)
+
+func (t ScanEventType) String() string {
+	switch t {
+	case ScanStarted:
+		return "scan_started"
+	case ScanFinished:
+		return "scan_finished"
+	case ServiceMatched:
+		return "service_matched"
+	case IPLocked:
+		return "ip_locked"
+	case IPUnlocked:
+		return "ip_unlocked"
+	}
+	return fmt.Sprintf("ScanEventType(%d)", int(t))
+}
+
+// A ScanEvent describes progress made by the Scanner in searching for
+// services. Events are passed to the handler set with SetEventHandler.
+type ScanEvent struct {
+	Type           ScanEventType
+	Method         string     // e.g. MethodScan; empty for IPs locked or unlocked by the caller
+	Time           time.Time  //
+	IP             string     // for ServiceMatched, IPLocked and IPUnlocked; may include a zone
+	DescriptionIDs []string   // for ServiceMatched
+	Stats          *ScanStats // for ScanFinished
+}
+
+// ScanStats summarizes a single scan, browse or discovery
+type ScanStats struct {
+	Method          string
+	Started         time.Time
+	Duration        time.Duration
+	IPsChecked      int                         // IPs whose services were checked against the descriptions
+	IPsExcluded     int                         // IPs skipped because they are excluded (see ScannerOptions)
+	IPsAlreadyInUse int                         // IPs skipped because they are locked
+	IPsBackedOff    int                         // IPs skipped because they have not responded to recent scans
+	ServicesFound   int                         // IPs which matched at least one description
+	Descriptions    map[string]DescriptionStats // indexed by description ID
+}
+
+// DescriptionStats counts how the IPs checked in a scan compared with a single
+// ServiceDescription. They can explain why a service is not being found: for
+// example, a service whose port is open but which fails a probe is counted in
+// ProbesFailed.
+type DescriptionStats struct {
+	Matched      int // IPs which matched the description
+	PortsClosed  int // IPs rejected because an expected port was closed
+	ProbesFailed int // IPs rejected because a probe failed
+}
+
+// A scanTally collects ScanStats as a scan progresses. It is safe for
+// concurrent use; a nil scanTally ignores everything.
+type scanTally struct {
+	name  string     // the method of the scan
+	mu    sync.Mutex // protects stats
+	stats ScanStats
+}
+
+func newScanTally(method string) *scanTally {
+	return &scanTally{name: method, stats: ScanStats{
+		Method:       method,
+		Started:      time.Now(),
+		Descriptions: make(map[string]DescriptionStats),
+	}}
+}
+
+func (t *scanTally) add(fn func(stats *ScanStats)) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fn(&t.stats)
+}
+
+func (t *scanTally) method() string {
+	if t == nil {
+		return ""
+	}
+	return t.name
+}
+
+func (t *scanTally) addDescription(id string, fn func(stats *DescriptionStats)) {
+	t.add(func(stats *ScanStats) {
+		ds := stats.Descriptions[id]
+		fn(&ds)
+		stats.Descriptions[id] = ds
+	})
+}
+
+// SetEventHandler sets a function which is called with every ScanEvent. The
+// function is called from the goroutines doing the scan, so it should return
+// quickly. A nil handler turns events off.
+func (s *Scanner) SetEventHandler(handler func(ScanEvent)) {
+	s.elock.Lock()
+	defer s.elock.Unlock()
+	s.eventHandler = handler
+}
+
+// Stats returns the stats of the most recent scan, browse and discovery which
+// the Scanner has finished, ordered by method
+func (s *Scanner) Stats() []ScanStats {
+	s.elock.RLock()
+	defer s.elock.RUnlock()
+	stats := make([]ScanStats, 0, len(s.lastStats))
+	for _, st := range s.lastStats {
+		stats = append(stats, copyStats(st))
+	}
+	sort.Sort(scanStatsByMethod(stats))
+	return stats
+}
+
+// LockedIPs returns the IPs which are currently locked, sorted
+func (s *Scanner) LockedIPs() []string {
+	s.slock.RLock()
+	defer s.slock.RUnlock()
+	ips := make([]string, 0, len(s.activeServicesByIP))
+	for ip := range s.activeServicesByIP {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	return ips
+}
+
+func (s *Scanner) emit(event ScanEvent) {
+	event.Time = time.Now()
+	s.elock.RLock()
+	handler := s.eventHandler
+	s.elock.RUnlock()
+	if handler != nil {
+		handler(event)
+	}
+}
+
+// startScan emits a ScanStarted event, and returns a tally for the scan
+func (s *Scanner) startScan(method string) *scanTally {
+	s.emit(ScanEvent{Type: ScanStarted, Method: method})
+	return newScanTally(method)
+}
+
+// finishScan records the stats of a finished scan, and emits a ScanFinished
+// event
+func (s *Scanner) finishScan(tally *scanTally) ScanStats {
+	tally.mu.Lock()
+	tally.stats.Duration = time.Since(tally.stats.Started)
+	stats := copyStats(tally.stats)
+	tally.mu.Unlock()
+
+	s.elock.Lock()
+	s.lastStats[stats.Method] = stats
+	s.elock.Unlock()
+
+	eventStats := copyStats(stats)
+	s.emit(ScanEvent{Type: ScanFinished, Method: stats.Method, Stats: &eventStats})
+	return stats
+}
+
+func copyStats(stats ScanStats) ScanStats {
+	descs := make(map[string]DescriptionStats, len(stats.Descriptions))
+	for id, ds := range stats.Descriptions {
+		descs[id] = ds
+	}
+	stats.Descriptions = descs
+	return stats
+}
+
+type scanStatsByMethod []ScanStats
+
+func (s scanStatsByMethod) Len() int           { return len(s) }
+func (s scanStatsByMethod) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s scanStatsByMethod) Less(i, j int) bool { return s[i].Method < s[j].Method }
@@ -0,0 +1,77 @@
+package ipv4
+
+import (
+	"fmt"
+	. "gopkg.in/check.v1"
+	"net"
+	"sync"
+	"time"
+)
+
+// failingProbe is a Probe which every service fails
+type failingProbe struct{}
+
+func (failingProbe) Check(addr net.IPAddr, timeout time.Duration) error {
+	return fmt.Errorf("failing probe")
+}
+
+func (s *MySuite) TestScanEvents(c *C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer listener.Close()
+	port := uint16(listener.Addr().(*net.TCPAddr).Port)
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	closedPort := uint16(closed.Addr().(*net.TCPAddr).Port)
+	closed.Close()
+
+	scanner := NewScanner()
+	var mu sync.Mutex
+	var events []ScanEvent
+	scanner.SetEventHandler(func(e ScanEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	})
+	matchID := scanner.AddDescription(ServiceDescription{OpenPorts: []uint16{port}})
+	closedID := scanner.AddDescription(ServiceDescription{OpenPorts: []uint16{closedPort}})
+	probeID := scanner.AddDescription(ServiceDescription{OpenPorts: []uint16{port}, Probes: []Probe{failingProbe{}}})
+	targets, err := ParseNetworks("127.0.0.1", "127.0.0.2", "127.0.0.3")
+	c.Assert(err, IsNil)
+	excluded, err := ParseNetworks("127.0.0.3")
+	c.Assert(err, IsNil)
+	c.Assert(scanner.SetOptions(ScannerOptions{Targets: targets, Exclude: excluded}), IsNil)
+	c.Assert(scanner.Lock(net.IPv4(127, 0, 0, 2)), Equals, true)
+
+	c.Assert(scanner.Scan(), DeepEquals, map[string][]string{"127.0.0.1": {matchID}})
+	c.Assert(scanner.LockedIPs(), DeepEquals, []string{"127.0.0.1", "127.0.0.2"})
+	scanner.Unlock(net.IPAddr{IP: net.IPv4(127, 0, 0, 2)})
+	scanner.Unlock(net.IPAddr{IP: net.IPv4(127, 0, 0, 2)}) // already unlocked; no event
+
+	mu.Lock()
+	defer mu.Unlock()
+	var types []ScanEventType
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	c.Assert(types, DeepEquals, []ScanEventType{IPLocked, ScanStarted, ServiceMatched, IPLocked, ScanFinished, IPUnlocked})
+	c.Assert(events[0].IP, Equals, "127.0.0.2")
+	c.Assert(events[0].Method, Equals, "")
+	c.Assert(events[2].Method, Equals, MethodScan)
+	c.Assert(events[2].IP, Equals, "127.0.0.1")
+	c.Assert(events[2].DescriptionIDs, DeepEquals, []string{matchID})
+
+	stats := events[4].Stats
+	c.Assert(stats, NotNil)
+	c.Assert(stats.Method, Equals, MethodScan)
+	c.Assert(stats.IPsChecked, Equals, 1)
+	c.Assert(stats.IPsExcluded, Equals, 1)
+	c.Assert(stats.IPsAlreadyInUse, Equals, 1)
+	c.Assert(stats.ServicesFound, Equals, 1)
+	c.Assert(stats.Descriptions, DeepEquals, map[string]DescriptionStats{
+		matchID:  {Matched: 1},
+		closedID: {PortsClosed: 1},
+		probeID:  {ProbesFailed: 1},
+	})
+	c.Assert(scanner.Stats(), DeepEquals, []ScanStats{*stats})
+}
@@ -0,0 +1,170 @@
+package ipv4
+
+import (
+	"fmt"
+	"net"
+	"sort"
+)
+
+// InterfaceEventType describes how a local network interface has changed
+type InterfaceEventType int
+
+// Possible interface event types
+const (
+	InterfaceAdded   InterfaceEventType = iota // the interface has appeared, or come up
+	InterfaceRemoved                           // the interface has disappeared, or gone down
+	InterfaceChanged                           // the interface's networks have changed
+)
+
+func (t InterfaceEventType) String() string {
+	switch t {
+	case InterfaceAdded:
+		return "added"
+	case InterfaceRemoved:
+		return "removed"
+	case InterfaceChanged:
+		return "changed"
+	}
+	return fmt.Sprintf("InterfaceEventType(%d)", int(t))
+}
+
+// An InterfaceEvent indicates that a local network interface has appeared,
+// disappeared, or moved to different networks (such as when a laptop joins a
+// different WiFi network). Services on Removed networks are no longer
+// reachable through that interface. Networks may be IPv4 or IPv6; link-local
+// IPv6 networks (fe80::/64) are only reachable through the interface named.
+type InterfaceEvent struct {
+	Name    string
+	Type    InterfaceEventType
+	Added   []*net.IPNet // networks which the interface has joined
+	Removed []*net.IPNet // networks which the interface has left
+}
+
+// A localInterface is a network interface of this device, along with the
+// networks it was on when it was listed
+type localInterface struct {
+	net.Interface
+	networks  []*net.IPNet // IPv4 networks
+	networks6 []*net.IPNet // IPv6 networks, including link-local
+}
+
+// activeNetworks returns the IPv4 and IPv6 networks of the interface, or none
+// if it is down
+func (i localInterface) activeNetworks() []*net.IPNet {
+	if i.Flags&net.FlagUp == 0 {
+		return nil
+	}
+	nets := make([]*net.IPNet, 0, len(i.networks)+len(i.networks6))
+	return append(append(nets, i.networks...), i.networks6...)
+}
+
+// An interfaceLister lists the network interfaces of this device
+type interfaceLister func() ([]localInterface, error)
+
+// systemInterfaces lists the network interfaces of this device with their
+// IPv4 and IPv6 networks
+func systemInterfaces() ([]localInterface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	intfs := make([]localInterface, 0, len(ifaces))
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("could not get addresses from interface %v: %v", iface.Name, err)
+		}
+		intf := localInterface{Interface: iface}
+		for _, a := range addrs {
+			n, ok := a.(*net.IPNet)
+			switch {
+			case !ok:
+				continue // not a network
+			case n.IP.To4() != nil:
+				intf.networks = append(intf.networks, n)
+			default:
+				intf.networks6 = append(intf.networks6, n)
+			}
+		}
+		intfs = append(intfs, intf)
+	}
+	return intfs, nil
+}
+
+// refreshInterfaces searches the device for any new, removed or changed
+// network interfaces, and returns an event for each, ordered by interface
+// name. Loopback interfaces, and those ignored by default, are not reported.
+func (s *Scanner) refreshInterfaces() ([]InterfaceEvent, error) {
+	intfs, err := s.listInterfaces()
+	if err != nil {
+		return nil, fmt.Errorf("error while refreshing ipv4 interfaces: %v", err)
+	}
+
+	s.ilock.Lock() // Lock the interfaces for writing
+	defer s.ilock.Unlock()
+
+	foundInterfaces := make(map[string]localInterface)
+	for _, intf := range intfs {
+		if _, ok := ignoredIPv4Interfaces[intf.Name]; ok || intf.Flags&net.FlagLoopback != 0 {
+			continue // ignore certain interfaces
+		}
+		foundInterfaces[intf.Name] = intf
+	}
+
+	var events []InterfaceEvent
+	for name, intf := range foundInterfaces {
+		old, existed := s.interfaces[name]
+		added, removed := diffNetworks(old.activeNetworks(), intf.activeNetworks())
+		switch {
+		case !existed || (old.Flags&net.FlagUp == 0 && intf.Flags&net.FlagUp != 0):
+			events = append(events, InterfaceEvent{Name: name, Type: InterfaceAdded, Added: added, Removed: removed})
+		case old.Flags&net.FlagUp != 0 && intf.Flags&net.FlagUp == 0:
+			events = append(events, InterfaceEvent{Name: name, Type: InterfaceRemoved, Added: added, Removed: removed})
+		case len(added) > 0 || len(removed) > 0:
+			events = append(events, InterfaceEvent{Name: name, Type: InterfaceChanged, Added: added, Removed: removed})
+		}
+	}
+	for name, old := range s.interfaces {
+		if _, ok := foundInterfaces[name]; !ok {
+			events = append(events, InterfaceEvent{Name: name, Type: InterfaceRemoved, Removed: old.activeNetworks()})
+		}
+	}
+	s.interfaces = foundInterfaces
+
+	sort.Sort(interfaceEventsByName(events))
+	for _, e := range events {
+		s.log.Info("network interface "+e.Type.String(), "interface", e.Name, "added_networks", e.Added, "removed_networks", e.Removed)
+	}
+	return events, nil
+}
+
+// diffNetworks returns the networks in after but not before, and those in
+// before but not after. Networks are compared by their address ranges, so an
+// interface which is given a new address on the same network has not changed.
+func diffNetworks(before, after []*net.IPNet) (added, removed []*net.IPNet) {
+	contains := func(nets []*net.IPNet, n *net.IPNet) bool {
+		for _, other := range nets {
+			if other.IP.Mask(other.Mask).Equal(n.IP.Mask(n.Mask)) && other.Mask.String() == n.Mask.String() {
+				return true
+			}
+		}
+		return false
+	}
+	for _, n := range after {
+		if !contains(before, n) {
+			added = append(added, n)
+		}
+	}
+	for _, n := range before {
+		if !contains(after, n) {
+			removed = append(removed, n)
+		}
+	}
+	return added, removed
+}
+
+type interfaceEventsByName []InterfaceEvent
+
+func (s interfaceEventsByName) Len() int           { return len(s) }
+func (s interfaceEventsByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s interfaceEventsByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
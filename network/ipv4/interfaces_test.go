@@ -0,0 +1,111 @@
+package ipv4
+
+import (
+	. "gopkg.in/check.v1"
+	"net"
+)
+
+func testInterface(c *C, name string, flags net.Flags, cidrs ...string) localInterface {
+	intf := localInterface{Interface: net.Interface{Name: name, Flags: flags}}
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		c.Assert(err, IsNil)
+		if n.IP.To4() != nil {
+			intf.networks = append(intf.networks, n)
+		} else {
+			intf.networks6 = append(intf.networks6, n)
+		}
+	}
+	return intf
+}
+
+func (s *MySuite) TestRefreshInterfaces(c *C) {
+	var listed []localInterface
+	scanner := NewScanner()
+	scanner.listInterfaces = func() ([]localInterface, error) { return listed, nil }
+	scanner.interfaces = make(map[string]localInterface)
+
+	// new interfaces are reported; loopback and ignored interfaces are not
+	listed = []localInterface{
+		testInterface(c, "wlan0", net.FlagUp, "192.168.1.0/24"),
+		testInterface(c, "eth0", 0, "10.0.0.0/24"),
+		testInterface(c, "lo", net.FlagUp|net.FlagLoopback, "127.0.0.0/8"),
+		testInterface(c, "docker0", net.FlagUp, "172.17.0.0/16"),
+	}
+	events, err := scanner.refreshInterfaces()
+	c.Assert(err, IsNil)
+	c.Assert(len(events), Equals, 2)
+	c.Assert(events[0].Name, Equals, "eth0")
+	c.Assert(events[0].Type, Equals, InterfaceAdded)
+	c.Assert(len(events[0].Added), Equals, 0) // it is down
+	c.Assert(events[1].Name, Equals, "wlan0")
+	c.Assert(events[1].Added[0].String(), Equals, "192.168.1.0/24")
+	c.Assert(scanner.scanRanges(ScannerOptions{}), DeepEquals, []scanRange{{base: ipToUint32(net.IPv4(192, 168, 1, 0)), size: 256}})
+
+	// nothing has changed
+	events, err = scanner.refreshInterfaces()
+	c.Assert(err, IsNil)
+	c.Assert(len(events), Equals, 0)
+
+	// a new address on the same network is not a change, but a new network is
+	listed[0] = testInterface(c, "wlan0", net.FlagUp, "192.168.1.77/24")
+	events, err = scanner.refreshInterfaces()
+	c.Assert(err, IsNil)
+	c.Assert(len(events), Equals, 0)
+	listed[0] = testInterface(c, "wlan0", net.FlagUp, "10.8.0.0/16")
+	events, err = scanner.refreshInterfaces()
+	c.Assert(err, IsNil)
+	c.Assert(len(events), Equals, 1)
+	c.Assert(events[0].Type, Equals, InterfaceChanged)
+	c.Assert(events[0].Added[0].String(), Equals, "10.8.0.0/16")
+	c.Assert(events[0].Removed[0].String(), Equals, "192.168.1.0/24")
+
+	// interfaces which come up are added; those which go down or disappear
+	// are removed, along with their networks
+	listed = []localInterface{
+		testInterface(c, "eth0", net.FlagUp, "10.0.0.0/24"),
+		testInterface(c, "wlan0", 0, "10.8.0.0/16"),
+	}
+	events, err = scanner.refreshInterfaces()
+	c.Assert(err, IsNil)
+	c.Assert(len(events), Equals, 2)
+	c.Assert(events[0].Type, Equals, InterfaceAdded)
+	c.Assert(events[0].Added[0].String(), Equals, "10.0.0.0/24")
+	c.Assert(events[1].Type, Equals, InterfaceRemoved)
+	c.Assert(events[1].Removed[0].String(), Equals, "10.8.0.0/16")
+
+	listed = listed[1:]
+	events, err = scanner.refreshInterfaces()
+	c.Assert(err, IsNil)
+	c.Assert(events, DeepEquals, []InterfaceEvent{{Name: "eth0", Type: InterfaceRemoved, Removed: events[0].Removed}})
+	c.Assert(events[0].Removed[0].String(), Equals, "10.0.0.0/24")
+	c.Assert(len(scanner.scanRanges(ScannerOptions{})), Equals, 0)
+}
+
+func (s *MySuite) TestRefreshInterfacesIPv6(c *C) {
+	var listed []localInterface
+	scanner := NewScanner()
+	scanner.listInterfaces = func() ([]localInterface, error) { return listed, nil }
+	scanner.interfaces = make(map[string]localInterface)
+
+	// IPv6 networks, including link-local ones, are reported with IPv4 ones
+	listed = []localInterface{testInterface(c, "eth0", net.FlagUp, "10.0.0.0/24", "fe80::1/64", "2001:db8::1/64")}
+	events, err := scanner.refreshInterfaces()
+	c.Assert(err, IsNil)
+	c.Assert(len(events), Equals, 1)
+	c.Assert(len(events[0].Added), Equals, 3)
+
+	listed = []localInterface{testInterface(c, "eth0", net.FlagUp, "10.0.0.0/24", "fe80::1/64")}
+	events, err = scanner.refreshInterfaces()
+	c.Assert(err, IsNil)
+	c.Assert(len(events), Equals, 1)
+	c.Assert(events[0].Type, Equals, InterfaceChanged)
+	c.Assert(events[0].Removed[0].String(), Equals, "2001:db8::/64")
+
+	listed = nil
+	events, err = scanner.refreshInterfaces()
+	c.Assert(err, IsNil)
+	c.Assert(len(events), Equals, 1)
+	c.Assert(events[0].Type, Equals, InterfaceRemoved)
+	c.Assert(events[0].Removed[1].String(), Equals, "fe80::/64")
+}
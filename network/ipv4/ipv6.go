@@ -0,0 +1,245 @@
+package ipv4
+
+import (
+	"fmt"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	neighborDiscoveryTimeout = 2 * time.Second
+	maxICMPPacketSize        = 1500
+)
+
+// allNodes is the link-local multicast address of every IPv6 host on a link
+var allNodes = net.ParseIP("ff02::1")
+
+// A neighborFinder returns the addresses of the IPv6 hosts on the links of
+// the given interfaces. If some interfaces could not be searched, the hosts
+// found on the others are returned along with an error.
+type neighborFinder func(intfs []localInterface, timeout time.Duration) ([]net.IPAddr, error)
+
+// Discover6 searches the local IPv6 networks for services matching the
+// Scanner's descriptions. IPv6 networks are far too large to visit every
+// address, so instead an ICMPv6 echo request is sent to the link-local
+// all-nodes address (ff02::1) on each interface, and only the hosts which
+// reply are checked. Returns results in the same form as Scan; link-local IPs
+// include their zone (e.g. "fe80::1%eth0"). As with Scan, IPs which are found
+// are locked.
+func (s *Scanner) Discover6() map[string][]string {
+	if s.numPortScanDescriptions() == 0 {
+		s.log.Debug("scanner has no descriptions, ignoring ipv6 discovery")
+		return map[string][]string{}
+	}
+	opts := s.getOptions()
+	if opts.DisableIPv6 || len(opts.Targets) > 0 {
+		s.log.Debug("ipv6 discovery is disabled, or scanner has explicit targets; ignoring ipv6 discovery")
+		return map[string][]string{}
+	}
+
+	s.ilock.RLock()
+	var intfs []localInterface
+	for name, intf := range s.interfaces {
+		if opts.isExcludedInterface(name) || intf.Flags&net.FlagUp == 0 || intf.Flags&net.FlagMulticast == 0 || len(intf.networks6) == 0 {
+			continue
+		}
+		intfs = append(intfs, intf)
+	}
+	s.ilock.RUnlock()
+	if len(intfs) == 0 {
+		s.log.Debug("scanner has no ipv6 interfaces, ignoring ipv6 discovery")
+		return map[string][]string{}
+	}
+
+	neighbors, err := s.findNeighbors(intfs, neighborDiscoveryTimeout)
+	if err != nil {
+		s.log.Warn("could not search every ipv6 link for neighbors", "err", err)
+	}
+
+	tally := s.startScan(MethodDiscover6)
+	foundServices := make(map[string][]string)
+	flock := sync.Mutex{} // protects foundServices
+	var wg sync.WaitGroup
+	dials := make(chan struct{}, opts.maxConcurrentDials()) // limits concurrent checks
+	for _, addr := range neighbors {
+		wg.Add(1)
+		dials <- struct{}{}
+		go func(addr net.IPAddr) {
+			defer func() {
+				<-dials
+				wg.Done()
+			}()
+			ids, _, _ := s.checkAddress(addr, tally)
+			if len(ids) > 0 {
+				flock.Lock()
+				foundServices[addr.String()] = ids
+				flock.Unlock()
+			}
+		}(addr)
+	}
+	wg.Wait()
+	stats := s.finishScan(tally)
+	s.log.Info("ipv6 discovery complete", "interfaces", len(intfs), "neighbors", len(neighbors), "possibilities_found", stats.ServicesFound, "ips_already_in_use", stats.IPsAlreadyInUse, "duration", stats.Duration)
+	return foundServices
+}
+
+// parseAddr parses an address as returned by Scan or Discover6, which may
+// include a zone (e.g. "fe80::1%eth0")
+func parseAddr(s string) net.IPAddr {
+	if i := strings.LastIndex(s, "%"); i >= 0 {
+		return net.IPAddr{IP: net.ParseIP(s[:i]), Zone: s[i+1:]}
+	}
+	return net.IPAddr{IP: net.ParseIP(s)}
+}
+
+// pingAllNodes finds IPv6 hosts by sending an echo request to the all-nodes
+// address on the link of each interface, at the same time
+func pingAllNodes(intfs []localInterface, timeout time.Duration) ([]net.IPAddr, error) {
+	var (
+		mu    sync.Mutex // protects found, seen and errs
+		found []net.IPAddr
+		seen  = make(map[string]struct{})
+		errs  []string
+		wg    sync.WaitGroup
+	)
+	for _, intf := range intfs {
+		wg.Add(1)
+		go func(intf localInterface) {
+			defer wg.Done()
+			addrs, err := pingAllNodesOn(intf, timeout)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err.Error())
+			}
+			for _, addr := range addrs {
+				if _, dup := seen[addr.String()]; !dup {
+					seen[addr.String()] = struct{}{}
+					found = append(found, addr)
+				}
+			}
+		}(intf)
+	}
+	wg.Wait()
+
+	sort.Sort(ipAddrsByValue(found))
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return found, fmt.Errorf("%v", strings.Join(errs, "; "))
+	}
+	return found, nil
+}
+
+// pingAllNodesOn sends an echo request to the all-nodes address on the link of
+// the interface, and returns the addresses of the hosts which reply. The
+// request is sent from the interface's global address if it has one, so that
+// hosts reply from their own global addresses, which need no zone.
+func pingAllNodesOn(intf localInterface, timeout time.Duration) ([]net.IPAddr, error) {
+	src, ok := preferredSource(intf)
+	if !ok {
+		return nil, nil
+	}
+
+	// Unprivileged ICMP ("ping") sockets are tried first, since raw sockets
+	// need extra privileges
+	var dst net.Addr = &net.UDPAddr{IP: allNodes, Zone: intf.Name}
+	conn, err := icmp.ListenPacket("udp6", src.String())
+	if err != nil {
+		dst = &net.IPAddr{IP: allNodes, Zone: intf.Name}
+		if conn, err = icmp.ListenPacket("ip6:ipv6-icmp", src.String()); err != nil {
+			return nil, fmt.Errorf("could not listen for icmpv6 replies on %v: %v", intf.Name, err)
+		}
+	}
+	defer conn.Close()
+
+	req := icmp.Message{
+		Type: ipv6.ICMPTypeEchoRequest,
+		Body: &icmp.Echo{ID: os.Getpid() & 0xffff, Seq: 1, Data: []byte("sift")},
+	}
+	msg, err := req.Marshal(nil) // the checksum is filled in by the kernel
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.WriteTo(msg, dst); err != nil {
+		return nil, fmt.Errorf("could not send echo request on %v: %v", intf.Name, err)
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	var found []net.IPAddr
+	buf := make([]byte, maxICMPPacketSize)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return found, nil // done waiting
+			}
+			return found, err
+		}
+		reply, err := icmp.ParseMessage(ipv6.ICMPTypeEchoReply.Protocol(), buf[:n])
+		if err != nil || reply.Type != ipv6.ICMPTypeEchoReply {
+			continue // e.g. neighbor discovery messages on a raw socket
+		}
+		var addr net.IPAddr
+		switch typed := peer.(type) {
+		case *net.UDPAddr:
+			addr = net.IPAddr{IP: typed.IP, Zone: typed.Zone}
+		case *net.IPAddr:
+			addr = *typed
+		default:
+			continue
+		}
+		if isLocalAddress(intf, addr.IP) {
+			continue // this device answers too
+		}
+		if addr.IP.IsLinkLocalUnicast() {
+			addr.Zone = intf.Name
+		} else {
+			addr.Zone = ""
+		}
+		found = append(found, addr)
+	}
+}
+
+// preferredSource returns the address from which to send requests on the
+// interface's link: a global (or unique local) address if there is one,
+// otherwise a link-local address
+func preferredSource(intf localInterface) (net.IPAddr, bool) {
+	var linkLocal net.IP
+	for _, n := range intf.networks6 {
+		switch {
+		case n.IP.IsLinkLocalUnicast():
+			if linkLocal == nil {
+				linkLocal = n.IP
+			}
+		case n.IP.IsGlobalUnicast():
+			return net.IPAddr{IP: n.IP}, true
+		}
+	}
+	if linkLocal == nil {
+		return net.IPAddr{}, false
+	}
+	return net.IPAddr{IP: linkLocal, Zone: intf.Name}, true
+}
+
+func isLocalAddress(intf localInterface, ip net.IP) bool {
+	for _, n := range intf.networks6 {
+		if n.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+type ipAddrsByValue []net.IPAddr
+
+func (s ipAddrsByValue) Len() int           { return len(s) }
+func (s ipAddrsByValue) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s ipAddrsByValue) Less(i, j int) bool { return s[i].String() < s[j].String() }
@@ -0,0 +1,103 @@
+package ipv4
+
+import (
+	. "gopkg.in/check.v1"
+	"net"
+	"time"
+)
+
+func (s *MySuite) TestDiscover6(c *C) {
+	listener, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		c.Skip("ipv6 loopback is not available: " + err.Error())
+	}
+	defer listener.Close()
+	port := uint16(listener.Addr().(*net.TCPAddr).Port)
+
+	scanner := NewScanner()
+	_, linkLocal, _ := net.ParseCIDR("fe80::1/64")
+	linkLocal.IP = net.ParseIP("fe80::1")
+	scanner.interfaces = map[string]localInterface{
+		"eth0":  {Interface: net.Interface{Name: "eth0", Flags: net.FlagUp | net.FlagMulticast}, networks6: []*net.IPNet{linkLocal}},
+		"wlan0": {Interface: net.Interface{Name: "wlan0", Flags: net.FlagMulticast}, networks6: []*net.IPNet{linkLocal}}, // down
+	}
+	var searched []string
+	scanner.findNeighbors = func(intfs []localInterface, timeout time.Duration) ([]net.IPAddr, error) {
+		searched = nil
+		for _, intf := range intfs {
+			searched = append(searched, intf.Name)
+		}
+		return []net.IPAddr{{IP: net.IPv6loopback}, {IP: net.ParseIP("fe80::99"), Zone: "eth0"}}, nil
+	}
+	c.Assert(scanner.Discover6(), DeepEquals, map[string][]string{}) // no descriptions, no discovery
+	c.Assert(searched, IsNil)
+
+	id := scanner.AddDescription(ServiceDescription{OpenPorts: []uint16{port}})
+	c.Assert(scanner.Discover6(), DeepEquals, map[string][]string{"::1": {id}})
+	c.Assert(searched, DeepEquals, []string{"eth0"})
+
+	// found IPs are locked, as with Scan
+	c.Assert(scanner.Discover6(), DeepEquals, map[string][]string{})
+	scanner.Unlock(net.IPAddr{IP: net.IPv6loopback})
+
+	// discovery can be turned off
+	c.Assert(scanner.SetOptions(ScannerOptions{DisableIPv6: true}), IsNil)
+	searched = nil
+	c.Assert(scanner.Discover6(), DeepEquals, map[string][]string{})
+	c.Assert(searched, IsNil)
+}
+
+func (s *MySuite) TestLockLinkLocalZones(c *C) {
+	scanner := NewScanner()
+	var events []ScanEvent
+	scanner.SetEventHandler(func(e ScanEvent) { events = append(events, e) })
+	eth0 := net.IPAddr{IP: net.ParseIP("fe80::1"), Zone: "eth0"}
+	wlan0 := net.IPAddr{IP: net.ParseIP("fe80::1"), Zone: "wlan0"}
+
+	// the same link-local IP on different links are different hosts
+	tally := scanner.startScan(MethodDiscover6)
+	scanner.lockFound(eth0, []string{"1"}, tally)
+	scanner.lockFound(wlan0, []string{"1"}, tally)
+	c.Assert(scanner.LockedIPs(), DeepEquals, []string{"fe80::1%eth0", "fe80::1%wlan0"})
+	c.Assert(events[2].Type, Equals, IPLocked)
+	c.Assert(events[2].IP, Equals, "fe80::1%eth0")
+
+	// ...and are unlocked separately
+	scanner.Unlock(eth0)
+	c.Assert(scanner.LockedIPs(), DeepEquals, []string{"fe80::1%wlan0"})
+	_, inUse, _ := scanner.checkAddress(wlan0, tally)
+	c.Assert(inUse, Equals, true)
+	scanner.Unlock(net.IPAddr{IP: net.ParseIP("fe80::1")}) // no zone; not locked
+	c.Assert(scanner.LockedIPs(), DeepEquals, []string{"fe80::1%wlan0"})
+	c.Assert(events[len(events)-1].Type, Equals, IPUnlocked)
+	c.Assert(events[len(events)-1].IP, Equals, "fe80::1%eth0")
+}
+
+func (s *MySuite) TestAddresses(c *C) {
+	c.Assert(parseAddr("10.0.0.5"), DeepEquals, net.IPAddr{IP: net.ParseIP("10.0.0.5")})
+	c.Assert(parseAddr("fe80::1%eth0"), DeepEquals, net.IPAddr{IP: net.ParseIP("fe80::1"), Zone: "eth0"})
+
+	context := &ServiceContext{IP: net.IPv4(10, 0, 0, 5)}
+	c.Assert(context.HostPort(80), Equals, "10.0.0.5:80")
+	c.Assert(context.URLHost(80), Equals, "10.0.0.5:80")
+	c.Assert(context.URLHost(0), Equals, "10.0.0.5")
+
+	context = &ServiceContext{IP: net.ParseIP("fe80::1"), Zone: "eth0"}
+	c.Assert(context.HostPort(80), Equals, "[fe80::1%eth0]:80")
+	c.Assert(context.URLHost(80), Equals, "[fe80::1%25eth0]:80")
+	c.Assert(context.URLHost(0), Equals, "[fe80::1%25eth0]")
+
+	src, ok := preferredSource(localInterface{Interface: net.Interface{Name: "eth0"}, networks6: []*net.IPNet{
+		{IP: net.ParseIP("fe80::1"), Mask: net.CIDRMask(64, 128)},
+		{IP: net.ParseIP("fd00::2"), Mask: net.CIDRMask(64, 128)},
+	}})
+	c.Assert(ok, Equals, true)
+	c.Assert(src.String(), Equals, "fd00::2")
+	src, ok = preferredSource(localInterface{Interface: net.Interface{Name: "eth0"}, networks6: []*net.IPNet{
+		{IP: net.ParseIP("fe80::1"), Mask: net.CIDRMask(64, 128)},
+	}})
+	c.Assert(ok, Equals, true)
+	c.Assert(src.String(), Equals, "fe80::1%eth0")
+	_, ok = preferredSource(localInterface{Interface: net.Interface{Name: "eth0"}})
+	c.Assert(ok, Equals, false)
+}
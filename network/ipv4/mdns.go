@@ -0,0 +1,260 @@
+package ipv4
+
+import (
+	"fmt"
+	"golang.org/x/net/dns/dnsmessage"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	mdnsAddr          = "224.0.0.251:5353"
+	mdnsBrowseTimeout = 2 * time.Second
+	mdnsMaxPacketSize = 9000 // as recommended by RFC 6762 section 17
+)
+
+// An mdnsResponse is a single packet received in response to an mDNS query
+type mdnsResponse struct {
+	from net.IP
+	msg  []byte
+}
+
+// An mdnsQuerier sends an mDNS query and returns every response received
+// before the timeout expires
+type mdnsQuerier func(query []byte, timeout time.Duration) ([]mdnsResponse, error)
+
+// An mdnsService is a single DNS-SD service instance described by an mDNS
+// response
+type mdnsService struct {
+	ServiceType string // fully-qualified, e.g. "_googlecast._tcp.local."
+	Instance    string // fully-qualified, e.g. "Living Room._googlecast._tcp.local."
+	IP          net.IP // nil if the response did not include an address record
+	Port        uint16
+}
+
+// Browse searches the local network for services matching the DNS-SD service
+// types of the Scanner's descriptions (see ServiceDescription.ServiceTypes),
+// by sending a single mDNS query and waiting briefly for responses. Unlike
+// Scan, it does not need to visit every address on the network. Returns a map
+// of IPs (string encoded) pointing to the IDs of those descriptions which
+// matched. As with Scan, IPs which are found are locked.
+func (s *Scanner) Browse() map[string][]string {
+	s.dlock.RLock()
+	idsByServiceName := make(map[string][]string)
+	for id, desc := range s.descriptionsByID {
+		for _, serviceType := range desc.ServiceTypes {
+			name := mdnsServiceName(serviceType)
+			idsByServiceName[name] = append(idsByServiceName[name], id)
+		}
+	}
+	s.dlock.RUnlock()
+	if len(idsByServiceName) == 0 {
+		s.log.Debug("scanner has no service types to browse for, ignoring browse")
+		return map[string][]string{}
+	}
+
+	serviceNames := make([]string, 0, len(idsByServiceName))
+	for name := range idsByServiceName {
+		serviceNames = append(serviceNames, name)
+	}
+	sort.Strings(serviceNames)
+	query, err := buildMDNSQuery(serviceNames)
+	if err != nil {
+		s.log.Error("could not build mdns query", "service_types", serviceNames, "err", err)
+		return map[string][]string{}
+	}
+	tally := s.startScan(MethodBrowse)
+	responses, err := s.mdnsQuery(query, mdnsBrowseTimeout)
+	if err != nil {
+		s.log.Warn("could not send mdns query", "service_types", serviceNames, "err", err)
+		s.finishScan(tally)
+		return map[string][]string{}
+	}
+
+	// Collect the descriptions whose service types were found at each IP
+	candidates := make(map[string]map[string]struct{})
+	for _, resp := range responses {
+		services, err := parseMDNSResponse(resp.msg)
+		if err != nil {
+			s.log.Debug("ignoring unparseable mdns response", "from", resp.from, "err", err)
+			continue
+		}
+		for _, svc := range services {
+			ids, ok := idsByServiceName[svc.ServiceType]
+			if !ok {
+				continue
+			}
+			ip := svc.IP
+			if ip == nil {
+				ip = resp.from // the responder is the service
+			}
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+			}
+			if candidates[ip.String()] == nil {
+				candidates[ip.String()] = make(map[string]struct{})
+			}
+			for _, id := range ids {
+				candidates[ip.String()][id] = struct{}{}
+			}
+			s.log.Debug("mdns browse found a service", "instance", svc.Instance, "ip", ip, "port", svc.Port)
+		}
+	}
+
+	foundServices := make(map[string][]string)
+	for ipStr, ids := range candidates {
+		s.slock.RLock()
+		_, inUse := s.activeServicesByIP[ipStr]
+		s.slock.RUnlock()
+		if inUse {
+			s.log.Debug("scanner ignoring IP that is already in use", "ip", ipStr)
+			tally.add(func(stats *ScanStats) { stats.IPsAlreadyInUse++ })
+			continue
+		}
+		tally.add(func(stats *ScanStats) { stats.IPsChecked++ })
+
+		// Descriptions may also require ports to be open, and probes to pass
+		addr := net.IPAddr{IP: net.ParseIP(ipStr)}
+		matchedPorts := make(map[uint16]bool)
+		var matched []string
+		s.dlock.RLock()
+		for id := range ids {
+			if desc, ok := s.descriptionsByID[id]; ok && s.matches(addr, id, desc, matchedPorts, tally) {
+				matched = append(matched, id)
+			}
+		}
+		s.dlock.RUnlock()
+		if len(matched) == 0 {
+			continue
+		}
+		sort.Strings(matched)
+		foundServices[ipStr] = matched
+		s.lockFound(addr, matched, tally)
+	}
+	stats := s.finishScan(tally)
+	s.log.Info("mdns browse complete", "service_types", len(serviceNames), "responses", len(responses), "services_found", stats.ServicesFound, "duration", stats.Duration)
+	return foundServices
+}
+
+// mdnsServiceName returns the fully-qualified name used to browse for a
+// DNS-SD service type, e.g. "_googlecast._tcp" becomes
+// "_googlecast._tcp.local."
+func mdnsServiceName(serviceType string) string {
+	name := strings.ToLower(strings.TrimSuffix(serviceType, "."))
+	if !strings.HasSuffix(name, ".local") {
+		name += ".local"
+	}
+	return name + "."
+}
+
+// buildMDNSQuery builds a query for PTR records of each of the given
+// fully-qualified service names
+func buildMDNSQuery(serviceNames []string) ([]byte, error) {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	for _, serviceName := range serviceNames {
+		name, err := dnsmessage.NewName(serviceName)
+		if err != nil {
+			return nil, fmt.Errorf("invalid service name %q: %v", serviceName, err)
+		}
+		q := dnsmessage.Question{Name: name, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET}
+		if err := b.Question(q); err != nil {
+			return nil, err
+		}
+	}
+	return b.Finish()
+}
+
+// parseMDNSResponse returns the service instances described by an mDNS
+// response. Services are found from PTR records; their ports and addresses
+// are filled from any SRV and A records in the same response.
+func parseMDNSResponse(msg []byte) ([]mdnsService, error) {
+	var p dnsmessage.Parser
+	if _, err := p.Start(msg); err != nil {
+		return nil, err
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil, err
+	}
+
+	// Records may appear in any section; answers and additionals are read
+	var resources []dnsmessage.Resource
+	answers, err := p.AllAnswers()
+	if err != nil {
+		return nil, err
+	}
+	resources = append(resources, answers...)
+	if err := p.SkipAllAuthorities(); err != nil {
+		return nil, err
+	}
+	additionals, err := p.AllAdditionals()
+	if err != nil {
+		return nil, err
+	}
+	resources = append(resources, additionals...)
+
+	var services []mdnsService
+	srvs := make(map[string]*dnsmessage.SRVResource)
+	addrs := make(map[string]net.IP)
+	for _, r := range resources {
+		name := strings.ToLower(r.Header.Name.String())
+		switch body := r.Body.(type) {
+		case *dnsmessage.PTRResource:
+			services = append(services, mdnsService{ServiceType: name, Instance: body.PTR.String()})
+		case *dnsmessage.SRVResource:
+			srvs[name] = body
+		case *dnsmessage.AResource:
+			addrs[name] = net.IP(body.A[:])
+		}
+	}
+	for i := range services {
+		srv, ok := srvs[strings.ToLower(services[i].Instance)]
+		if !ok {
+			continue
+		}
+		services[i].Port = srv.Port
+		services[i].IP = addrs[strings.ToLower(srv.Target.String())]
+	}
+	return services, nil
+}
+
+// queryMDNS sends an mDNS query from an ephemeral port. Responders answer
+// queries from ports other than 5353 directly to the sender (see RFC 6762
+// section 6.7), so there is no need to join the multicast group.
+func queryMDNS(query []byte, timeout time.Duration) ([]mdnsResponse, error) {
+	dst, err := net.ResolveUDPAddr("udp4", mdnsAddr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, fmt.Errorf("could not listen for mdns responses: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.WriteTo(query, dst); err != nil {
+		return nil, fmt.Errorf("could not send mdns query: %v", err)
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	var responses []mdnsResponse
+	buf := make([]byte, mdnsMaxPacketSize)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return responses, nil // done waiting
+			}
+			return responses, err
+		}
+		msg := make([]byte, n)
+		copy(msg, buf[:n])
+		responses = append(responses, mdnsResponse{from: from.IP, msg: msg})
+	}
+}
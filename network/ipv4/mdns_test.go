@@ -0,0 +1,124 @@
+package ipv4
+
+import (
+	"golang.org/x/net/dns/dnsmessage"
+	. "gopkg.in/check.v1"
+	"net"
+	"time"
+)
+
+func mustName(c *C, name string) dnsmessage.Name {
+	n, err := dnsmessage.NewName(name)
+	c.Assert(err, IsNil)
+	return n
+}
+
+// buildTestMDNSResponse builds a response announcing a single service
+// instance, with its address record only if ip is non-nil
+func buildTestMDNSResponse(c *C, serviceName, instance, host string, port uint16, ip net.IP) []byte {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{Response: true, Authoritative: true})
+	c.Assert(b.StartAnswers(), IsNil)
+	hdr := func(name string) dnsmessage.ResourceHeader {
+		return dnsmessage.ResourceHeader{Name: mustName(c, name), Class: dnsmessage.ClassINET, TTL: 120}
+	}
+	c.Assert(b.PTRResource(hdr(serviceName), dnsmessage.PTRResource{PTR: mustName(c, instance)}), IsNil)
+	c.Assert(b.StartAdditionals(), IsNil)
+	c.Assert(b.SRVResource(hdr(instance), dnsmessage.SRVResource{Port: port, Target: mustName(c, host)}), IsNil)
+	if ip != nil {
+		var a [4]byte
+		copy(a[:], ip.To4())
+		c.Assert(b.AResource(hdr(host), dnsmessage.AResource{A: a}), IsNil)
+	}
+	msg, err := b.Finish()
+	c.Assert(err, IsNil)
+	return msg
+}
+
+func (s *MySuite) TestMDNSServiceName(c *C) {
+	c.Assert(mdnsServiceName("_googlecast._tcp"), Equals, "_googlecast._tcp.local.")
+	c.Assert(mdnsServiceName("_googlecast._tcp.local."), Equals, "_googlecast._tcp.local.")
+	c.Assert(mdnsServiceName("_HAP._tcp.local"), Equals, "_hap._tcp.local.")
+}
+
+func (s *MySuite) TestParseMDNSResponse(c *C) {
+	query, err := buildMDNSQuery([]string{"_googlecast._tcp.local."})
+	c.Assert(err, IsNil)
+	var p dnsmessage.Parser
+	_, err = p.Start(query)
+	c.Assert(err, IsNil)
+	q, err := p.Question()
+	c.Assert(err, IsNil)
+	c.Assert(q.Type, Equals, dnsmessage.TypePTR)
+	c.Assert(q.Name.String(), Equals, "_googlecast._tcp.local.")
+
+	msg := buildTestMDNSResponse(c, "_googlecast._tcp.local.", "Den._googlecast._tcp.local.", "den.local.", 8009, net.IPv4(10, 0, 0, 5))
+	services, err := parseMDNSResponse(msg)
+	c.Assert(err, IsNil)
+	c.Assert(len(services), Equals, 1)
+	c.Assert(services[0].ServiceType, Equals, "_googlecast._tcp.local.")
+	c.Assert(services[0].Instance, Equals, "Den._googlecast._tcp.local.")
+	c.Assert(services[0].Port, Equals, uint16(8009))
+	c.Assert(services[0].IP.Equal(net.IPv4(10, 0, 0, 5)), Equals, true)
+
+	_, err = parseMDNSResponse([]byte{0x01})
+	c.Assert(err, NotNil)
+}
+
+func (s *MySuite) TestBrowse(c *C) {
+	scanner := NewScanner()
+	castID := scanner.AddDescription(ServiceDescription{ServiceTypes: []string{"_googlecast._tcp"}})
+	scanner.AddDescription(ServiceDescription{ServiceTypes: []string{"_hap._tcp"}})
+	scanner.AddDescription(ServiceDescription{OpenPorts: []uint16{12345}}) // found by Scan only
+
+	var queries int
+	scanner.mdnsQuery = func(query []byte, timeout time.Duration) ([]mdnsResponse, error) {
+		queries++
+		return []mdnsResponse{
+			{from: net.IPv4(10, 0, 0, 5), msg: buildTestMDNSResponse(c, "_googlecast._tcp.local.", "Den._googlecast._tcp.local.", "den.local.", 8009, net.IPv4(10, 0, 0, 5))},
+			// the responder's address is used if the response has no address record
+			{from: net.IPv4(10, 0, 0, 6), msg: buildTestMDNSResponse(c, "_googlecast._tcp.local.", "Hall._googlecast._tcp.local.", "hall.local.", 8009, nil)},
+			// unrequested services and garbage are ignored
+			{from: net.IPv4(10, 0, 0, 7), msg: buildTestMDNSResponse(c, "_ipp._tcp.local.", "Printer._ipp._tcp.local.", "printer.local.", 631, nil)},
+			{from: net.IPv4(10, 0, 0, 8), msg: []byte("not dns")},
+		}, nil
+	}
+
+	found := scanner.Browse()
+	c.Assert(queries, Equals, 1)
+	c.Assert(found, DeepEquals, map[string][]string{
+		"10.0.0.5": {castID},
+		"10.0.0.6": {castID},
+	})
+
+	// found IPs are locked until they are unlocked
+	c.Assert(scanner.Browse(), DeepEquals, map[string][]string{})
+	scanner.Unlock(net.IPAddr{IP: net.IPv4(10, 0, 0, 6)})
+	c.Assert(scanner.Browse(), DeepEquals, map[string][]string{"10.0.0.6": {castID}})
+}
+
+func (s *MySuite) TestBrowseWithoutServiceTypes(c *C) {
+	scanner := NewScanner()
+	scanner.AddDescription(ServiceDescription{OpenPorts: []uint16{12345}})
+	scanner.mdnsQuery = func(query []byte, timeout time.Duration) ([]mdnsResponse, error) {
+		c.Fatal("no query should be sent")
+		return nil, nil
+	}
+	c.Assert(scanner.Browse(), DeepEquals, map[string][]string{})
+}
+
+func (s *MySuite) TestScanWithServiceTypes(c *C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer listener.Close()
+	port := uint16(listener.Addr().(*net.TCPAddr).Port)
+
+	// descriptions with ports are still found by Scan, in case multicast is
+	// unavailable; those with only service types are left to Browse
+	scanner := NewScanner()
+	castID := scanner.AddDescription(ServiceDescription{OpenPorts: []uint16{port}, ServiceTypes: []string{"_googlecast._tcp"}})
+	scanner.AddDescription(ServiceDescription{ServiceTypes: []string{"_hap._tcp"}})
+	targets, err := ParseNetworks("127.0.0.1")
+	c.Assert(err, IsNil)
+	c.Assert(scanner.SetOptions(ScannerOptions{Targets: targets}), IsNil)
+	c.Assert(scanner.Scan(), DeepEquals, map[string][]string{"127.0.0.1": {castID}})
+}
@@ -0,0 +1,181 @@
+package ipv4
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	// DefaultMaxConcurrentDials is the default number of addresses which the
+	// Scanner checks at once
+	DefaultMaxConcurrentDials = numIPv4Checkers
+
+	// DefaultMaxAddressesPerScan is the default number of addresses checked in
+	// a single scan. Larger networks are covered over several scans.
+	DefaultMaxAddressesPerScan = 4096
+
+	// DefaultMaxBackoff is the default longest time for which scans skip an
+	// address which has not responded
+	DefaultMaxBackoff = 30 * time.Minute
+)
+
+// ScannerOptions controls which addresses the Scanner checks, and how
+// quickly. The zero value scans the networks of every local interface (except
+// those ignored by default) using the default limits.
+type ScannerOptions struct {
+	// Targets, if set, are scanned instead of the networks of local interfaces
+	Targets []*net.IPNet
+
+	// Exclude lists networks which are never scanned
+	Exclude []*net.IPNet
+
+	// ExcludeInterfaces lists interfaces whose networks are not scanned, in
+	// addition to loopback interfaces and those ignored by default (such as
+	// "tun0" or "docker0"). Not used if Targets is set.
+	ExcludeInterfaces []string
+
+	// MaxConcurrentDials limits the number of addresses checked at once;
+	// 0 means DefaultMaxConcurrentDials
+	MaxConcurrentDials int
+
+	// MaxAddressesPerScan limits the number of addresses checked in each scan;
+	// 0 means DefaultMaxAddressesPerScan. If there are more addresses, each
+	// scan continues where the last left off. Sweeps requested with
+	// ContinuousScanner.Rescan are not limited.
+	MaxAddressesPerScan int
+
+	// MaxBackoff limits how long scans skip an address which has not
+	// responded to recent scans; 0 means DefaultMaxBackoff. Each time an
+	// address does not respond it is skipped for twice as long, starting
+	// from 30 seconds.
+	MaxBackoff time.Duration
+
+	// DisableIPv6 turns off discovery of IPv6 hosts (see Scanner.Discover6).
+	// IPv6 discovery is also skipped if Targets is set.
+	DisableIPv6 bool
+}
+
+// Validate checks that the options are usable
+func (o ScannerOptions) Validate() error {
+	for _, n := range append(append([]*net.IPNet{}, o.Targets...), o.Exclude...) {
+		if n == nil || n.IP.To4() == nil {
+			return fmt.Errorf("%v is not an IPv4 network", n)
+		}
+	}
+	if o.MaxConcurrentDials < 0 {
+		return fmt.Errorf("max concurrent dials cannot be negative")
+	}
+	if o.MaxAddressesPerScan < 0 {
+		return fmt.Errorf("max addresses per scan cannot be negative")
+	}
+	if o.MaxBackoff < 0 {
+		return fmt.Errorf("max backoff cannot be negative")
+	}
+	return nil
+}
+
+// ParseNetworks parses networks in CIDR notation (e.g. "192.168.1.0/24"). A
+// bare IP address is treated as a network containing only that address.
+func ParseNetworks(cidrs ...string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+			nets = append(nets, &net.IPNet{IP: ip.To4(), Mask: net.CIDRMask(32, 32)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse network %q: %v", cidr, err)
+		}
+		if n.IP.To4() == nil {
+			return nil, fmt.Errorf("%v is not an IPv4 network", cidr)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func (o ScannerOptions) maxConcurrentDials() int {
+	if o.MaxConcurrentDials == 0 {
+		return DefaultMaxConcurrentDials
+	}
+	return o.MaxConcurrentDials
+}
+
+func (o ScannerOptions) maxAddressesPerScan() int {
+	if o.MaxAddressesPerScan == 0 {
+		return DefaultMaxAddressesPerScan
+	}
+	return o.MaxAddressesPerScan
+}
+
+func (o ScannerOptions) maxBackoff() time.Duration {
+	if o.MaxBackoff == 0 {
+		return DefaultMaxBackoff
+	}
+	return o.MaxBackoff
+}
+
+func (o ScannerOptions) isExcluded(ip net.IP) bool {
+	for _, n := range o.Exclude {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o ScannerOptions) isExcludedInterface(name string) bool {
+	if _, ok := ignoredIPv4Interfaces[name]; ok {
+		return true
+	}
+	for _, excluded := range o.ExcludeInterfaces {
+		if excluded == name {
+			return true
+		}
+	}
+	return false
+}
+
+// scanRange is a range of addresses to scan: size addresses, starting at base
+type scanRange struct {
+	base uint32
+	size uint64
+}
+
+func newScanRange(n *net.IPNet) (scanRange, bool) {
+	ip := n.IP.To4()
+	if ip == nil {
+		return scanRange{}, false
+	}
+	ones, bits := n.Mask.Size()
+	if bits == 128 && ones >= 96 { // IPv4 mask in IPv6 form
+		ones, bits = ones-96, 32
+	}
+	if bits != 32 {
+		return scanRange{}, false
+	}
+	mask := net.CIDRMask(ones, 32)
+	return scanRange{base: ipToUint32(ip.Mask(mask)), size: 1 << uint(32-ones)}, true
+}
+
+// addressAt returns the i'th address of the ranges, taken in order
+func addressAt(ranges []scanRange, i uint64) net.IP {
+	for _, r := range ranges {
+		if i < r.size {
+			return uint32ToIP(r.base + uint32(i))
+		}
+		i -= r.size
+	}
+	return nil
+}
+
+func ipToUint32(ip net.IP) uint32 {
+	ip = ip.To4()
+	return uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])
+}
+
+func uint32ToIP(n uint32) net.IP {
+	return net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n)).To4()
+}
@@ -0,0 +1,90 @@
+package ipv4
+
+import (
+	. "gopkg.in/check.v1"
+	"net"
+)
+
+func (s *MySuite) TestParseNetworks(c *C) {
+	nets, err := ParseNetworks("192.168.1.0/24", "10.0.0.7", "10.1.2.3/16")
+	c.Assert(err, IsNil)
+	c.Assert(len(nets), Equals, 3)
+	c.Assert(nets[0].String(), Equals, "192.168.1.0/24")
+	c.Assert(nets[1].String(), Equals, "10.0.0.7/32")
+	c.Assert(nets[2].String(), Equals, "10.1.0.0/16")
+
+	_, err = ParseNetworks("fe80::/64")
+	c.Assert(err, NotNil)
+	_, err = ParseNetworks("192.168.1.0/33")
+	c.Assert(err, NotNil)
+}
+
+func (s *MySuite) TestScannerOptionsValidate(c *C) {
+	c.Assert(ScannerOptions{}.Validate(), IsNil)
+	c.Assert(ScannerOptions{MaxConcurrentDials: -1}.Validate(), NotNil)
+	c.Assert(ScannerOptions{MaxAddressesPerScan: -1}.Validate(), NotNil)
+	_, v6, err := net.ParseCIDR("fe80::/64")
+	c.Assert(err, IsNil)
+	c.Assert(ScannerOptions{Exclude: []*net.IPNet{v6}}.Validate(), NotNil)
+	c.Assert(NewScanner().SetOptions(ScannerOptions{Targets: []*net.IPNet{nil}}), NotNil)
+}
+
+func (s *MySuite) TestScanRanges(c *C) {
+	targets, err := ParseNetworks("10.0.0.0/30", "10.0.0.0/30", "10.0.1.5")
+	c.Assert(err, IsNil)
+	ranges := NewScanner().scanRanges(ScannerOptions{Targets: targets})
+	c.Assert(ranges, DeepEquals, []scanRange{
+		{base: ipToUint32(net.IPv4(10, 0, 0, 0)), size: 4}, // duplicates are scanned once
+		{base: ipToUint32(net.IPv4(10, 0, 1, 5)), size: 1},
+	})
+	c.Assert(addressAt(ranges, 3).String(), Equals, "10.0.0.3")
+	c.Assert(addressAt(ranges, 4).String(), Equals, "10.0.1.5")
+	c.Assert(addressAt(ranges, 5), IsNil)
+
+	// IPv4 masks may be given in IPv6 form
+	r, ok := newScanRange(&net.IPNet{IP: net.IPv4(192, 168, 1, 20), Mask: net.CIDRMask(120, 128)})
+	c.Assert(ok, Equals, true)
+	c.Assert(r, DeepEquals, scanRange{base: ipToUint32(net.IPv4(192, 168, 1, 0)), size: 256})
+}
+
+func (s *MySuite) TestScanWithOptions(c *C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer listener.Close()
+	port := uint16(listener.Addr().(*net.TCPAddr).Port)
+
+	scanner := NewScanner()
+	id := scanner.AddDescription(ServiceDescription{OpenPorts: []uint16{port}})
+	targets, err := ParseNetworks("127.0.0.0/30")
+	c.Assert(err, IsNil)
+	c.Assert(scanner.SetOptions(ScannerOptions{Targets: targets, MaxAddressesPerScan: 2, MaxConcurrentDials: 1}), IsNil)
+
+	// each scan covers two addresses, continuing where the last left off
+	c.Assert(scanner.Scan(), DeepEquals, map[string][]string{"127.0.0.1": {id}})
+	scanner.Unlock(net.IPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	c.Assert(scanner.Scan(), DeepEquals, map[string][]string{}) // 127.0.0.2 and 127.0.0.3
+	c.Assert(scanner.Scan(), DeepEquals, map[string][]string{"127.0.0.1": {id}})
+	scanner.Unlock(net.IPAddr{IP: net.IPv4(127, 0, 0, 1)})
+
+	// a full scan covers every address, leaving the next scan where it was
+	c.Assert(scanner.Scan(), DeepEquals, map[string][]string{}) // 127.0.0.2 and 127.0.0.3
+	c.Assert(scanner.scan(true), DeepEquals, map[string][]string{"127.0.0.1": {id}})
+	scanner.Unlock(net.IPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	c.Assert(scanner.Scan(), DeepEquals, map[string][]string{"127.0.0.1": {id}})
+	scanner.Unlock(net.IPAddr{IP: net.IPv4(127, 0, 0, 1)})
+
+	// locked addresses are ignored until unlocked
+	c.Assert(scanner.Lock(net.IPv4(127, 0, 0, 1)), Equals, true)
+	c.Assert(scanner.Lock(net.IPv4(127, 0, 0, 1)), Equals, false)
+	c.Assert(scanner.Scan(), DeepEquals, map[string][]string{})
+	c.Assert(scanner.Scan(), DeepEquals, map[string][]string{})
+	scanner.Unlock(net.IPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	c.Assert(scanner.Lock(net.IPv4(127, 0, 0, 1)), Equals, true)
+	scanner.Unlock(net.IPAddr{IP: net.IPv4(127, 0, 0, 1)})
+
+	// excluded addresses are never scanned
+	excluded, err := ParseNetworks("127.0.0.1")
+	c.Assert(err, IsNil)
+	c.Assert(scanner.SetOptions(ScannerOptions{Targets: targets, Exclude: excluded}), IsNil)
+	c.Assert(scanner.Scan(), DeepEquals, map[string][]string{})
+}
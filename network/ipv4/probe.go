@@ -0,0 +1,197 @@
+package ipv4
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	probeTimeout     = 2 * time.Second
+	maxProbeBodySize = 64 * 1024
+)
+
+// A Probe checks that a service at an IP is the service described, beyond
+// having the right ports open. Probes are run by the scanner, so that Adapters
+// are only created for services which pass every probe of their factory's
+// ServiceDescription.
+type Probe interface {
+	// Check returns nil if the service at addr passes the probe, or an error
+	// describing why it does not
+	Check(addr net.IPAddr, timeout time.Duration) error
+}
+
+// probeTransport is shared by all HTTPProbes. Keep-alives are disabled, since
+// each service is probed once per scan; otherwise every probed host would keep
+// an idle connection (and its goroutines) open between scans.
+var probeTransport = &http.Transport{
+	TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+	DisableKeepAlives: true,
+}
+
+// An HTTPProbe sends an HTTP GET request to the service and checks the
+// response.
+type HTTPProbe struct {
+	Port           uint16
+	Path           string // e.g. "/status"; defaults to "/"
+	TLS            bool   // use HTTPS; the certificate is not verified (see TLSProbe)
+	ExpectedStatus int    // defaults to any 2xx status
+	BodyContains   string // if set, the body must contain this
+	BodyMatches    string // if set, the body must match this regular expression
+}
+
+// Check sends the request and checks the response
+func (p HTTPProbe) Check(addr net.IPAddr, timeout time.Duration) error {
+	scheme := "http"
+	if p.TLS {
+		scheme = "https"
+	}
+	path := p.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	url := scheme + "://" + urlHost(addr, p.Port) + path
+
+	client := &http.Client{Timeout: timeout, Transport: probeTransport}
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("could not get %v: %v", url, err)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxProbeBodySize))
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("could not read %v: %v", url, err)
+	}
+
+	if p.ExpectedStatus != 0 {
+		if resp.StatusCode != p.ExpectedStatus {
+			return fmt.Errorf("%v returned status %v, expected %v", url, resp.StatusCode, p.ExpectedStatus)
+		}
+	} else if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%v returned status %v", url, resp.StatusCode)
+	}
+	if p.BodyContains != "" && !strings.Contains(string(body), p.BodyContains) {
+		return fmt.Errorf("body of %v does not contain %q", url, p.BodyContains)
+	}
+	if p.BodyMatches != "" {
+		re, err := regexp.Compile(p.BodyMatches)
+		if err != nil {
+			return fmt.Errorf("invalid body pattern %q: %v", p.BodyMatches, err)
+		}
+		if !re.Match(body) {
+			return fmt.Errorf("body of %v does not match %q", url, p.BodyMatches)
+		}
+	}
+	return nil
+}
+
+// A TLSProbe connects to the service with TLS and checks the subject of the
+// certificate it presents. The certificate is not verified, since devices on
+// local networks often use self-signed certificates.
+type TLSProbe struct {
+	Port                uint16
+	SubjectCommonName   string // if set, the subject's common name must contain this
+	SubjectOrganization string // if set, one of the subject's organizations must contain this
+}
+
+// Check connects to the service and checks its certificate
+func (p TLSProbe) Check(target net.IPAddr, timeout time.Duration) error {
+	addr := hostPort(target, p.Port)
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return fmt.Errorf("could not connect to %v with tls: %v", addr, err)
+	}
+	defer conn.Close()
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return fmt.Errorf("%v presented no certificate", addr)
+	}
+	subject := certs[0].Subject
+	if p.SubjectCommonName != "" && !strings.Contains(subject.CommonName, p.SubjectCommonName) {
+		return fmt.Errorf("certificate of %v has common name %q, expected %q", addr, subject.CommonName, p.SubjectCommonName)
+	}
+	if p.SubjectOrganization != "" {
+		found := false
+		for _, org := range subject.Organization {
+			if strings.Contains(org, p.SubjectOrganization) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("certificate of %v has organizations %q, expected %q", addr, subject.Organization, p.SubjectOrganization)
+		}
+	}
+	return nil
+}
+
+// A BannerProbe connects to the service over TCP, optionally sends a
+// greeting, and checks the first line which the service sends back.
+type BannerProbe struct {
+	Port    uint16
+	Send    string // if set, sent before reading the banner
+	Pattern string // the banner must match this regular expression
+}
+
+// Check connects to the service and checks its banner
+func (p BannerProbe) Check(target net.IPAddr, timeout time.Duration) error {
+	re, err := regexp.Compile(p.Pattern)
+	if err != nil {
+		return fmt.Errorf("invalid banner pattern %q: %v", p.Pattern, err)
+	}
+	addr := hostPort(target, p.Port)
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return fmt.Errorf("could not connect to %v: %v", addr, err)
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	if p.Send != "" {
+		if _, err := io.WriteString(conn, p.Send); err != nil {
+			return fmt.Errorf("could not send to %v: %v", addr, err)
+		}
+	}
+	banner, err := bufio.NewReader(io.LimitReader(conn, maxProbeBodySize)).ReadString('\n')
+	if err != nil && (err != io.EOF || banner == "") {
+		return fmt.Errorf("could not read banner from %v: %v", addr, err)
+	}
+	banner = strings.TrimRight(banner, "\r\n")
+	if !re.MatchString(banner) {
+		return fmt.Errorf("banner of %v is %q, which does not match %q", addr, banner, p.Pattern)
+	}
+	return nil
+}
+
+// hostPort returns the address of a port at addr, in the form used by
+// net.Dial
+func hostPort(addr net.IPAddr, port uint16) string {
+	return net.JoinHostPort(addr.String(), strconv.Itoa(int(port)))
+}
+
+// urlHost returns the host of a URL for a port at addr. Zones are escaped, as
+// required within URLs (see RFC 6874). If port is 0, it is left out.
+func urlHost(addr net.IPAddr, port uint16) string {
+	host := addr.IP.String()
+	if addr.Zone != "" {
+		host += "%25" + addr.Zone
+	}
+	if port == 0 {
+		if addr.IP.To4() == nil {
+			return "[" + host + "]"
+		}
+		return host
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(port)))
+}
@@ -0,0 +1,141 @@
+package ipv4
+
+import (
+	"fmt"
+	. "gopkg.in/check.v1"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// testServerAddr returns the IP and port of a test server
+func testServerAddr(c *C, serverURL string) (net.IP, uint16) {
+	u, err := url.Parse(serverURL)
+	c.Assert(err, IsNil)
+	port, err := strconv.Atoi(u.Port())
+	c.Assert(err, IsNil)
+	return net.ParseIP(u.Hostname()), uint16(port)
+}
+
+func (s *MySuite) TestHTTPProbe(c *C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/status" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"type": "all_at_once"}`)
+	}))
+	defer server.Close()
+	ip, port := testServerAddr(c, server.URL)
+
+	c.Assert(HTTPProbe{Port: port, Path: "/status"}.Check(net.IPAddr{IP: ip}, time.Second), IsNil)
+	c.Assert(HTTPProbe{Port: port, Path: "status", BodyContains: "all_at_once"}.Check(net.IPAddr{IP: ip}, time.Second), IsNil)
+	c.Assert(HTTPProbe{Port: port, Path: "/status", BodyMatches: `"type"\s*:\s*"all_at_once"`}.Check(net.IPAddr{IP: ip}, time.Second), IsNil)
+	c.Assert(HTTPProbe{Port: port, Path: "/missing", ExpectedStatus: http.StatusNotFound}.Check(net.IPAddr{IP: ip}, time.Second), IsNil)
+
+	c.Assert(HTTPProbe{Port: port, Path: "/missing"}.Check(net.IPAddr{IP: ip}, time.Second), NotNil)
+	c.Assert(HTTPProbe{Port: port, Path: "/status", ExpectedStatus: http.StatusNoContent}.Check(net.IPAddr{IP: ip}, time.Second), NotNil)
+	c.Assert(HTTPProbe{Port: port, Path: "/status", BodyContains: "one_at_a_time"}.Check(net.IPAddr{IP: ip}, time.Second), NotNil)
+	c.Assert(HTTPProbe{Port: port, Path: "/status", BodyMatches: `^\[`}.Check(net.IPAddr{IP: ip}, time.Second), NotNil)
+	c.Assert(HTTPProbe{Port: port, Path: "/status", BodyMatches: `(`}.Check(net.IPAddr{IP: ip}, time.Second), NotNil)
+	c.Assert(HTTPProbe{Port: port, Path: "/status", TLS: true}.Check(net.IPAddr{IP: ip}, time.Second), NotNil)
+}
+
+func (s *MySuite) TestHTTPProbeClosesConnections(c *C) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "not the service you are looking for")
+	}))
+	var lock sync.Mutex
+	open := 0
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		lock.Lock()
+		defer lock.Unlock()
+		switch state {
+		case http.StateNew:
+			open++
+		case http.StateClosed, http.StateHijacked:
+			open--
+		}
+	}
+	server.Start()
+	defer server.Close()
+	ip, port := testServerAddr(c, server.URL)
+
+	// probes are repeated on every scan, so connections must not be kept alive
+	for i := 0; i < 3; i++ {
+		c.Assert(HTTPProbe{Port: port, BodyContains: "all_at_once"}.Check(net.IPAddr{IP: ip}, time.Second), NotNil)
+	}
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		lock.Lock()
+		n := open
+		lock.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			c.Fatalf("%v probe connections were left open", n)
+		}
+	}
+}
+
+func (s *MySuite) TestTLSProbe(c *C) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Missing input")
+	}))
+	defer server.Close()
+	ip, port := testServerAddr(c, server.URL)
+
+	// the test server's certificate is self-signed, for organization "Acme Co"
+	c.Assert(TLSProbe{Port: port}.Check(net.IPAddr{IP: ip}, time.Second), IsNil)
+	c.Assert(TLSProbe{Port: port, SubjectOrganization: "Acme"}.Check(net.IPAddr{IP: ip}, time.Second), IsNil)
+	c.Assert(TLSProbe{Port: port, SubjectOrganization: "Philips"}.Check(net.IPAddr{IP: ip}, time.Second), NotNil)
+	c.Assert(TLSProbe{Port: port, SubjectCommonName: "hub.local"}.Check(net.IPAddr{IP: ip}, time.Second), NotNil)
+	c.Assert(HTTPProbe{Port: port, TLS: true, BodyContains: "Missing input"}.Check(net.IPAddr{IP: ip}, time.Second), IsNil)
+}
+
+func (s *MySuite) TestBannerProbe(c *C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			fmt.Fprint(conn, "220 hub.local ESMTP ready\r\n")
+			conn.Close()
+		}
+	}()
+	port := uint16(listener.Addr().(*net.TCPAddr).Port)
+	ip := net.IPv4(127, 0, 0, 1)
+
+	c.Assert(BannerProbe{Port: port, Pattern: `^220 .* ESMTP`}.Check(net.IPAddr{IP: ip}, time.Second), IsNil)
+	c.Assert(BannerProbe{Port: port, Pattern: `^SSH-2\.0`}.Check(net.IPAddr{IP: ip}, time.Second), NotNil)
+	c.Assert(BannerProbe{Port: port, Pattern: `[`}.Check(net.IPAddr{IP: ip}, time.Second), NotNil)
+}
+
+func (s *MySuite) TestProbesFilterDescriptions(c *C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"type": "all_at_once"}`)
+	}))
+	defer server.Close()
+	ip, port := testServerAddr(c, server.URL)
+
+	scanner := NewScanner()
+	matchID := scanner.AddDescription(ServiceDescription{
+		OpenPorts: []uint16{port},
+		Probes:    []Probe{HTTPProbe{Port: port, BodyContains: "all_at_once"}},
+	})
+	scanner.AddDescription(ServiceDescription{
+		OpenPorts: []uint16{port},
+		Probes:    []Probe{HTTPProbe{Port: port, BodyContains: "one_at_a_time"}},
+	})
+	ids, responded := scanner.getMatchingDescriptions(net.IPAddr{IP: ip}, nil)
+	c.Assert(ids, DeepEquals, []string{matchID})
+	c.Assert(responded, Equals, true)
+}
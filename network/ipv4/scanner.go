@@ -7,7 +7,7 @@ import (
 	log "gopkg.in/inconshreveable/log15.v2"
 	logext "gopkg.in/inconshreveable/log15.v2/ext"
 	"net"
-	"strconv"
+	"sort"
 	"sync"
 	"time"
 )
@@ -21,6 +21,9 @@ var (
 		// DARWIN
 		"lo0":  struct{}{}, // loopback
 		"tun0": struct{}{}, // tunnel (VPN)
+		// LINUX
+		"lo":      struct{}{}, // loopback
+		"docker0": struct{}{}, // docker bridge (often a /16)
 		// TODO: Windows ignored?
 	}
 )
@@ -33,19 +36,59 @@ type IScanner interface {
 	// Add a description to search for; return the ID used if a match is returned
 	AddDescription(desc ServiceDescription) string
 
+	// Replace the description with the given ID
+	UpdateDescription(id string, desc ServiceDescription) error
+
 	// Scan the IPv4 network for services matching given descriptions.
 	// Returns a map of IPs (string encoded) pointing to the IDs of those descriptions which matched
 	Scan() map[string][]string
 
+	// Browse the IPv4 network with mDNS for services matching the service
+	// types of given descriptions. Returns results in the same form as Scan.
+	Browse() map[string][]string
+
+	// Discover services on IPv6 networks, by checking the hosts which answer
+	// a link-local multicast echo request. Returns results in the same form as
+	// Scan.
+	Discover6() map[string][]string
+
+	// Check only the given IPv4 addresses, such as those of services which
+	// were recently lost. Returns results in the same form as Scan.
+	ScanAddresses(ips []net.IP) map[string][]string
+
+	// Forget which addresses have not responded to recent scans, so that
+	// following scans check them again
+	ResetBackoff()
+
+	// Change which addresses are scanned, and how quickly
+	SetOptions(opts ScannerOptions) error
+
 	// By default, after an IP is found with Scan it is ignored in future searches.
-	// Unlock instructs the scanner to include responses for that IP address in future scans.
-	Unlock(ip net.IP)
+	// Unlock instructs the scanner to include responses for that address in
+	// future scans. Link-local IPv6 addresses must include their zone.
+	Unlock(addr net.IPAddr)
+
+	// Lock marks an IP as in use, as if it had been found with Scan, so that
+	// it is ignored until unlocked. Returns false if the IP is already in use.
+	Lock(ip net.IP) bool
+
+	// SetEventHandler sets a function to receive events as the scanner
+	// searches, and as IPs are locked and unlocked
+	SetEventHandler(handler func(ScanEvent))
+
+	// Stats returns the stats of the most recent scan, browse and discovery
+	Stats() []ScanStats
+
+	// LockedIPs returns the IPs which are currently in use
+	LockedIPs() []string
 }
 
 // A ServiceFoundNotification indicates that a service was found at ip IP which
-// matched all of MatchingDescriptionIDs.
+// matched all of MatchingDescriptionIDs. Zone is set for link-local IPv6
+// addresses (see Scanner.Discover6).
 type ServiceFoundNotification struct {
 	IP                     net.IP
+	Zone                   string
 	MatchingDescriptionIDs []string
 }
 
@@ -54,8 +97,9 @@ type ServiceFoundNotification struct {
 // returned to the caller. It is up to the caller to unlock IPs (via Unlock())
 // if they are no longer in use.
 type Scanner struct {
-	interfaces map[string]net.Interface
-	ilock      sync.RWMutex // protects interfaces
+	interfaces     map[string]localInterface
+	ilock          sync.RWMutex // protects interfaces
+	listInterfaces interfaceLister
 
 	descriptionsByID map[string]ServiceDescription
 	dlock            sync.RWMutex // protects descriptionsByID
@@ -63,14 +107,29 @@ type Scanner struct {
 	activeServicesByIP map[string]struct{}
 	slock              *sync.RWMutex // protects activeServicesByIP
 
+	options ScannerOptions
+	cursor  uint64       // the offset at which the next scan starts
+	olock   sync.RWMutex // protects options and cursor
+
+	backoffByIP map[string]addrBackoff
+	block       sync.Mutex // protects backoffByIP
+
+	mdnsQuery     mdnsQuerier
+	findNeighbors neighborFinder
+
+	eventHandler func(ScanEvent)
+	lastStats    map[string]ScanStats // indexed by method
+	elock        sync.RWMutex         // protects eventHandler and lastStats
+
 	log log.Logger
 }
 
 // NewScanner properly instantiates a Scanner.
 func NewScanner() *Scanner {
 	s := &Scanner{
-		interfaces: make(map[string]net.Interface),
-		ilock:      sync.RWMutex{},
+		interfaces:     make(map[string]localInterface),
+		ilock:          sync.RWMutex{},
+		listInterfaces: systemInterfaces,
 
 		descriptionsByID: make(map[string]ServiceDescription),
 		dlock:            sync.RWMutex{},
@@ -78,10 +137,18 @@ func NewScanner() *Scanner {
 		activeServicesByIP: make(map[string]struct{}),
 		slock:              &sync.RWMutex{},
 
+		backoffByIP: make(map[string]addrBackoff),
+
+		mdnsQuery:     queryMDNS,
+		findNeighbors: pingAllNodes,
+
+		lastStats: make(map[string]ScanStats),
+
 		log: Log.New("obj", "ipv4.scanner", "id", logext.RandId(8)),
 	}
 
-	err := s.refreshInterfaces()
+	// every interface is new at this point, so there are no events to report
+	_, err := s.refreshInterfaces()
 	if err != nil {
 		panic("ipv4.NewScanner(): scanner could not refresh interfaces: " + err.Error())
 	}
@@ -99,182 +166,370 @@ func (s *Scanner) AddDescription(desc ServiceDescription) string {
 	return id
 }
 
+// UpdateDescription replaces the ServiceDescription with the given ID. On
+// following scans, the Scanner will find services which match the new
+// description; services which have already been found are not affected.
+func (s *Scanner) UpdateDescription(id string, desc ServiceDescription) error {
+	s.dlock.Lock()
+	defer s.dlock.Unlock()
+	if _, ok := s.descriptionsByID[id]; !ok {
+		return fmt.Errorf("no description with id %v", id)
+	}
+	s.descriptionsByID[id] = desc
+	return nil
+}
+
 // Scan the IPv4 network for services matching given descriptions.
 // Returns a map of IPs (string encoded) pointing to the IDs of those descriptions which matched
 func (s *Scanner) Scan() map[string][]string {
-	if len(s.descriptionsByID) == 0 {
+	return s.scan(false)
+}
+
+// scan checks the addresses of the IPv4 networks. Unless all is true, at most
+// MaxAddressesPerScan are checked, starting where the last scan left off. If
+// all is true, every address is checked, starting at the same place and
+// continuing until it is reached again.
+func (s *Scanner) scan(all bool) map[string][]string {
+	if s.numPortScanDescriptions() == 0 {
 		s.log.Debug("scanner has no descriptions, ignoring scan")
 		return map[string][]string{}
 	}
 
-	s.log.Debug("ip4v scanner beginning scan", "interfaces", s.interfaces, "target_descriptions", s.descriptionsByID)
+	// Work out which addresses to check in this scan. If there are more than
+	// the per-scan limit, continue from where the last scan left off.
+	opts := s.getOptions()
+	ranges := s.scanRanges(opts)
+	var total uint64
+	for _, r := range ranges {
+		total += r.size
+	}
+	if total == 0 {
+		s.log.Debug("scanner has no networks to scan, ignoring scan")
+		return map[string][]string{}
+	}
+	count := uint64(opts.maxAddressesPerScan())
+	if all || count > total {
+		count = total
+	}
+	s.olock.Lock()
+	start := s.cursor % total
+	s.cursor = (start + count) % total // after a full scan, the cursor is back at start
+	s.olock.Unlock()
+	if count < total {
+		s.log.Debug("ipv4 scanner scanning part of its networks", "num_addrs", total, "start", start, "count", count)
+	}
+
+	s.log.Debug("ip4v scanner beginning scan", "ranges", len(ranges), "target_descriptions", s.descriptionsByID)
+	now := time.Now()
+	tally := s.startScan(MethodScan)
 	foundServices := make(map[string][]string)
 	flock := sync.Mutex{} // protects foundServices
 	var wg sync.WaitGroup
-	var numChecked, numFound, numAlreadyInUse int
+	dials := make(chan struct{}, opts.maxConcurrentDials()) // limits concurrent checks
 
-	s.ilock.RLock()
-	defer s.ilock.RUnlock()
-	for name, intf := range s.interfaces {
-		addrs, err := intf.Addrs()
-		if err != nil {
-			panic("could not get addresses from " + name + ": " + err.Error())
+	for i := uint64(0); i < count; i++ {
+		ip := addressAt(ranges, (start+i)%total)
+		if opts.isExcluded(ip) {
+			tally.add(func(stats *ScanStats) { stats.IPsExcluded++ })
+			continue
 		}
-		s.log.Debug("ip4v scanner scanning interface", "interface", name, "num_addrs", len(addrs))
-		for _, a := range addrs {
-			switch v := a.(type) {
-			case *net.IPAddr:
-				s.log.Warn("ipv4 scanner got a *net.IPAddr, which isn't useful and maybe shoudln't happen?", "interface", intf.Name, "*net.IPAddr", v)
-			case *net.IPNet:
-				if v.IP.DefaultMask() != nil { // ignore IPs without default mask (IPv6?)
-					ip := v.IP
-
-					for ip := ip.Mask(v.Mask); v.Contains(ip); incrementIP(ip) {
-						wg.Add(1)
-						numChecked++
-
-						// To save space, try and only use 4 bytes
-						if x := ip.To4(); x != nil {
-							ip = x
-						}
-						dup := make(net.IP, len(ip)) // make a copy of the IP ([]byte)
-						copy(dup, ip)
-						go func() {
-							defer wg.Done()
-							s.slock.RLock()
-							_, ok := s.activeServicesByIP[dup.String()] // ignore IPs already in use
-							s.slock.RUnlock()
-
-							if ok { // ignore IPs already in use
-								s.log.Debug("scanner ignoring IP that is already in use", "ip", dup.String())
-								numAlreadyInUse++
-							} else {
-								ids := s.getMatchingDescriptions(dup)
-								if len(ids) > 0 { // At least one service matches
-									s.log.Debug("found possible matches for ipv4 service", "num_matches", len(ids), "matching_ids", ids)
-									numFound++
-									flock.Lock()
-									foundServices[dup.String()] = ids
-									flock.Unlock()
-									s.slock.Lock()
-									s.activeServicesByIP[dup.String()] = struct{}{} // mark IP as in use
-									s.slock.Unlock()
-								}
-							}
-						}()
-					}
-				}
-			default:
-				s.log.Warn("ipv4 scanner encountered address of unknown type", "type", fmt.Sprintf("%T", a))
-			}
+		if s.backedOff(ip, now) {
+			tally.add(func(stats *ScanStats) { stats.IPsBackedOff++ })
+			continue
 		}
+		wg.Add(1)
+		dials <- struct{}{}
+		go func(ip net.IP) {
+			defer func() {
+				<-dials
+				wg.Done()
+			}()
+			ids, inUse, responded := s.checkAddress(net.IPAddr{IP: ip}, tally)
+			if !inUse {
+				s.recordResponse(ip, responded, opts.maxBackoff())
+			}
+			if len(ids) > 0 {
+				flock.Lock()
+				foundServices[ip.String()] = ids
+				flock.Unlock()
+			}
+		}(ip)
 	}
 	s.log.Debug("ipv4 scanner waiting for waitgroup to finish")
 	wg.Wait()
 	s.log.Debug("ipv4 scanner done waiting (all waitgroup items completed)")
-	s.log.Info("ipv4 scan complete", "ips_checked", numChecked, "possibilities_found", numFound, "ips_already_in_use", numAlreadyInUse)
+	stats := s.finishScan(tally)
+	s.log.Info("ipv4 scan complete", "ips_checked", stats.IPsChecked, "ips_excluded", stats.IPsExcluded, "ips_backed_off", stats.IPsBackedOff, "possibilities_found", stats.ServicesFound, "ips_already_in_use", stats.IPsAlreadyInUse, "duration", stats.Duration)
+	return foundServices
+}
+
+// ScanAddresses checks only the given IPv4 addresses for services matching
+// the Scanner's descriptions, whether or not they have responded to recent
+// scans. Addresses which are excluded, or are not IPv4, are ignored. Returns
+// results in the same form as Scan; as with Scan, IPs which are found are
+// locked.
+func (s *Scanner) ScanAddresses(ips []net.IP) map[string][]string {
+	if s.numPortScanDescriptions() == 0 || len(ips) == 0 {
+		return map[string][]string{}
+	}
+	opts := s.getOptions()
+	tally := s.startScan(MethodReprobe)
+	foundServices := make(map[string][]string)
+	flock := sync.Mutex{} // protects foundServices
+	var wg sync.WaitGroup
+	dials := make(chan struct{}, opts.maxConcurrentDials()) // limits concurrent checks
+	seen := make(map[string]struct{})
+	for _, ip := range ips {
+		if ip = ip.To4(); ip == nil {
+			continue
+		}
+		if _, dup := seen[ip.String()]; dup {
+			continue
+		}
+		seen[ip.String()] = struct{}{}
+		if opts.isExcluded(ip) {
+			tally.add(func(stats *ScanStats) { stats.IPsExcluded++ })
+			continue
+		}
+		wg.Add(1)
+		dials <- struct{}{}
+		go func(ip net.IP) {
+			defer func() {
+				<-dials
+				wg.Done()
+			}()
+			ids, inUse, responded := s.checkAddress(net.IPAddr{IP: ip}, tally)
+			if !inUse {
+				s.recordResponse(ip, responded, opts.maxBackoff())
+			}
+			if len(ids) > 0 {
+				flock.Lock()
+				foundServices[ip.String()] = ids
+				flock.Unlock()
+			}
+		}(ip)
+	}
+	wg.Wait()
+	stats := s.finishScan(tally)
+	s.log.Debug("ipv4 reprobe complete", "ips_checked", stats.IPsChecked, "possibilities_found", stats.ServicesFound, "ips_already_in_use", stats.IPsAlreadyInUse)
 	return foundServices
 }
 
-// Unlock unlocks the provided IP, such that it will no longer be ignored in
-// future scans.
-func (s *Scanner) Unlock(ip net.IP) {
+// SetOptions changes which addresses are checked by following scans, and how
+// quickly (see ScannerOptions)
+func (s *Scanner) SetOptions(opts ScannerOptions) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	s.olock.Lock()
+	defer s.olock.Unlock()
+	s.options = opts
+	s.cursor = 0
+	return nil
+}
+
+func (s *Scanner) getOptions() ScannerOptions {
+	s.olock.RLock()
+	defer s.olock.RUnlock()
+	return s.options
+}
+
+// scanRanges returns the ranges of addresses to scan: either the targets
+// given in the options, or the networks of local interfaces
+func (s *Scanner) scanRanges(opts ScannerOptions) []scanRange {
+	var ranges []scanRange
+	seen := make(map[scanRange]struct{})
+	add := func(n *net.IPNet) {
+		r, ok := newScanRange(n)
+		if !ok {
+			return // ignore networks which aren't IPv4
+		}
+		if _, dup := seen[r]; !dup {
+			seen[r] = struct{}{}
+			ranges = append(ranges, r)
+		}
+	}
+
+	if len(opts.Targets) > 0 {
+		for _, n := range opts.Targets {
+			add(n)
+		}
+		return ranges
+	}
+
+	s.ilock.RLock()
+	defer s.ilock.RUnlock()
+	names := make([]string, 0, len(s.interfaces))
+	for name := range s.interfaces {
+		names = append(names, name)
+	}
+	sort.Strings(names) // so that scans continue where the last left off
+	for _, name := range names {
+		intf := s.interfaces[name]
+		if opts.isExcludedInterface(name) || intf.Flags&net.FlagUp == 0 {
+			continue
+		}
+		for _, n := range intf.networks {
+			add(n)
+		}
+	}
+	return ranges
+}
+
+// Unlock unlocks the provided address, such that it will no longer be
+// ignored in future scans. Link-local IPv6 addresses are locked with their
+// zone, so the same IP on different links is unlocked separately.
+func (s *Scanner) Unlock(addr net.IPAddr) {
+	s.slock.Lock()
+	_, wasLocked := s.activeServicesByIP[addr.String()]
+	delete(s.activeServicesByIP, addr.String())
+	s.slock.Unlock()
+	s.resetBackoff(addr.IP) // the service may come back soon; check it on the next scan
+	s.log.Debug("ipv4 scanner unlocked IP", "ip", addr.String())
+	if wasLocked {
+		s.emit(ScanEvent{Type: IPUnlocked, IP: addr.String()})
+	}
+}
+
+// Lock marks the provided IP as in use, such that it will be ignored in
+// future scans until it is unlocked. Returns false if the IP was already in
+// use.
+func (s *Scanner) Lock(ip net.IP) bool {
+	s.slock.Lock()
+	if _, inUse := s.activeServicesByIP[ip.String()]; inUse {
+		s.slock.Unlock()
+		return false
+	}
+	s.activeServicesByIP[ip.String()] = struct{}{}
+	s.slock.Unlock()
+	s.log.Debug("ipv4 scanner locked IP", "ip", ip.String())
+	s.emit(ScanEvent{Type: IPLocked, IP: ip.String()})
+	return true
+}
+
+// numPortScanDescriptions returns the number of descriptions which are found
+// by Scan, rather than Browse
+func (s *Scanner) numPortScanDescriptions() int {
+	s.dlock.RLock()
+	defer s.dlock.RUnlock()
+	n := 0
+	for _, desc := range s.descriptionsByID {
+		if desc.portScanned() {
+			n++
+		}
+	}
+	return n
+}
+
+// checkAddress returns the IDs of the descriptions matched by the services at
+// addr, and locks its IP if there are any. IPs which are already in use are
+// not checked; inUse is true if so. responded is true if any service answered
+// at addr, even if it did not match. The results are counted in tally.
+func (s *Scanner) checkAddress(addr net.IPAddr, tally *scanTally) (ids []string, inUse, responded bool) {
+	s.slock.RLock()
+	_, inUse = s.activeServicesByIP[addr.String()]
+	s.slock.RUnlock()
+	if inUse { // ignore IPs already in use
+		s.log.Debug("scanner ignoring IP that is already in use", "ip", addr.String())
+		tally.add(func(stats *ScanStats) { stats.IPsAlreadyInUse++ })
+		return nil, true, false
+	}
+	tally.add(func(stats *ScanStats) { stats.IPsChecked++ })
+	ids, responded = s.getMatchingDescriptions(addr, tally)
+	if len(ids) > 0 { // At least one service matches
+		s.log.Debug("found possible matches for ip service", "ip", addr.String(), "num_matches", len(ids), "matching_ids", ids)
+		s.lockFound(addr, ids, tally)
+	}
+	return ids, false, responded
+}
+
+// lockFound marks the address of a service which has been found as in use,
+// and emits events for the match and the lock. The address includes its zone,
+// if any, so that the same link-local IP on another link is not ignored.
+func (s *Scanner) lockFound(addr net.IPAddr, ids []string, tally *scanTally) {
 	s.slock.Lock()
-	defer s.slock.Unlock()
-	delete(s.activeServicesByIP, ip.String())
-	s.log.Debug("ipv4 scanner unlocked IP", "ip", ip.String())
+	s.activeServicesByIP[addr.String()] = struct{}{} // mark address as in use
+	s.slock.Unlock()
+	tally.add(func(stats *ScanStats) { stats.ServicesFound++ })
+	s.emit(ScanEvent{Type: ServiceMatched, Method: tally.method(), IP: addr.String(), DescriptionIDs: ids})
+	s.emit(ScanEvent{Type: IPLocked, Method: tally.method(), IP: addr.String()})
 }
 
-func (s *Scanner) getMatchingDescriptions(ip net.IP) []string {
+// getMatchingDescriptions returns the IDs of the descriptions matched by the
+// services at addr, and whether any port which was tried was open
+func (s *Scanner) getMatchingDescriptions(addr net.IPAddr, tally *scanTally) (ids []string, responded bool) {
 	var matchedDrivers []string
 	matchedPorts := make(map[uint16]bool) // true if found open, false if not, nil key if untested
 	s.dlock.RLock()
 	defer s.dlock.RUnlock()
 	for id, desc := range s.descriptionsByID {
-		match := true
-		for _, port := range desc.OpenPorts {
-			// Try the cache first
-			if portIsOpen, ok := matchedPorts[port]; ok {
-				if !portIsOpen {
-					match = false
-					s.log.Debug("ipv4 scanner found a service description which is not a match for services available at the target IP, because a port which is expected to be open is closed (according to cache)", "ip", ip.String(), "description_id", id, "port", port, "desc_ports", desc.OpenPorts)
-					break
-				}
-			} else {
-				// No cached entry, try dialing
-				timeout := 1 * time.Second
-				url := ip.String() + ":" + strconv.Itoa(int(port))
-				conn, err := net.DialTimeout("tcp", url, timeout)
-				if err != nil {
-					match = false
-					matchedPorts[port] = false
-					s.log.Debug("ipv4 scanner found a service description which is not a match for the services available at the target IP, because a port which is expected to be open is closed (timed out trying)", "ip", ip.String(), "description_id", id, "port", port, "url", url, "timeout", timeout, "err", err, "desc_ports", desc.OpenPorts)
-					break
-				}
-				conn.Close()
-			}
+		if !desc.portScanned() {
+			continue // found by Browse instead
 		}
-		if match {
+		if s.matches(addr, id, desc, matchedPorts, tally) {
 			matchedDrivers = append(matchedDrivers, id) // add
-			s.log.Debug("ipv4 scanner found a service description match", "ip", ip.String(), "service_desc", id)
+			s.log.Debug("ipv4 scanner found a service description match", "ip", addr.String(), "service_desc", id)
 		}
 	}
-	return matchedDrivers
-}
-
-// refreshInterfaces searches the device for any new or removed network interfaces
-func (s *Scanner) refreshInterfaces() error {
-	s.ilock.Lock() // Lock the interfaces for writing
-	defer s.ilock.Unlock()
-
-	ifaces, err := net.Interfaces()
-	if err != nil {
-		return fmt.Errorf("error while refreshing ipv4 interfaces: %v", err)
+	responded = len(matchedDrivers) > 0
+	for _, open := range matchedPorts {
+		responded = responded || open
 	}
-	foundInterfaces := make(map[string]net.Interface)
-	newInterfaces := make(map[string]struct{})
+	return matchedDrivers, responded
+}
 
-	for _, iface := range ifaces {
-		name := iface.Name
-		if _, ok := ignoredIPv4Interfaces[name]; !ok { // ignore certain interfaces
-			foundInterfaces[name] = iface
-			if _, ok := s.interfaces[name]; !ok {
-				newInterfaces[name] = struct{}{}
-			}
-			delete(s.interfaces, name) // unmark the interface - anything left once we're done has disappeared
-		}
+// matches returns true if the services at addr match the description: every
+// port it expects is open, and every probe passes. The result is counted in
+// tally.
+func (s *Scanner) matches(addr net.IPAddr, id string, desc ServiceDescription, matchedPorts map[uint16]bool, tally *scanTally) bool {
+	if !s.portsAreOpen(addr, id, desc.OpenPorts, matchedPorts) {
+		tally.addDescription(id, func(stats *DescriptionStats) { stats.PortsClosed++ })
+		return false
 	}
-
-	if len(s.interfaces) > 0 {
-		names := make([]string, len(s.interfaces))
-		i := 0
-		for name := range s.interfaces {
-			names[i] = name
-		}
-		s.log.Warn("STUB: IPv4 interfaces have disappeared, but handling logic is unimplemented! Services on the missing interfaces may still be active", "deleted_interfaces", names)
+	if !s.probesPass(addr, id, desc.Probes) {
+		tally.addDescription(id, func(stats *DescriptionStats) { stats.ProbesFailed++ })
+		return false
 	}
-	s.interfaces = foundInterfaces
+	tally.addDescription(id, func(stats *DescriptionStats) { stats.Matched++ })
+	return true
+}
 
-	if len(newInterfaces) > 0 {
-		names := make([]string, len(newInterfaces))
-		i := 0
-		for name := range newInterfaces {
-			names[i] = name
-			i++
+// probesPass returns true if the service at addr passes every probe
+func (s *Scanner) probesPass(addr net.IPAddr, id string, probes []Probe) bool {
+	for _, probe := range probes {
+		if err := probe.Check(addr, probeTimeout); err != nil {
+			s.log.Debug("ipv4 scanner found a service description which is not a match for the services available at the target IP, because a probe failed", "ip", addr.String(), "description_id", id, "probe", fmt.Sprintf("%T", probe), "err", err)
+			return false
 		}
-		s.log.Debug("new IPv4 interfaces found", "interfaces", names)
 	}
-	return nil
+	return true
 }
 
-// incrementIP increments an IPv4 address
-func incrementIP(ip net.IP) {
-	for j := len(ip) - 1; j >= 0; j-- {
-		ip[j]++
-		if ip[j] > 0 {
-			break
+// portsAreOpen returns true if every given port is open at addr. Closed ports
+// are cached in matchedPorts, which may be shared between descriptions.
+func (s *Scanner) portsAreOpen(addr net.IPAddr, id string, ports []uint16, matchedPorts map[uint16]bool) bool {
+	for _, port := range ports {
+		// Try the cache first
+		if portIsOpen, ok := matchedPorts[port]; ok {
+			if !portIsOpen {
+				s.log.Debug("ipv4 scanner found a service description which is not a match for services available at the target IP, because a port which is expected to be open is closed (according to cache)", "ip", addr.String(), "description_id", id, "port", port, "desc_ports", ports)
+				return false
+			}
+		} else {
+			// No cached entry, try dialing
+			timeout := 1 * time.Second
+			url := hostPort(addr, port)
+			conn, err := net.DialTimeout("tcp", url, timeout)
+			if err != nil {
+				matchedPorts[port] = false
+				s.log.Debug("ipv4 scanner found a service description which is not a match for the services available at the target IP, because a port which is expected to be open is closed (timed out trying)", "ip", addr.String(), "description_id", id, "port", port, "url", url, "timeout", timeout, "err", err, "desc_ports", ports)
+				return false
+			}
+			conn.Close()
+			matchedPorts[port] = true
 		}
 	}
+	return true
 }
 
 // An IContinuousScanner is a Scanner that scans continuously. Scan results are
@@ -283,25 +538,55 @@ type IContinuousScanner interface {
 	suture.Service
 	IScanner
 	FoundServices() chan ServiceFoundNotification
+
+	// InterfaceEvents returns a channel which receives an event whenever a
+	// local network interface appears, disappears or changes networks.
+	// Interfaces are checked before each scan.
+	InterfaceEvents() chan InterfaceEvent
+
+	// Change when the scanner searches
+	SetSchedule(sched ScanSchedule) error
+
+	// Start a full sweep now, checking every address, however many there
+	// are and whether or not they have responded to recent scans
+	Rescan()
 }
 
 // ContinuousScanner implements IContinuousScanner. It scans continuously,
-// putting results into the channel provided by FoundServices().
+// putting results into the channel provided by FoundServices(). Full sweeps
+// of the network are spaced out, while the IPs of recently lost services and
+// changes to the ARP table are checked quickly (see ScanSchedule).
 type ContinuousScanner struct {
 	*Scanner
-	foundIPChan chan ServiceFoundNotification
-	period      time.Duration
-	stop        chan struct{}
+	foundIPChan     chan ServiceFoundNotification
+	interfaceEvents chan InterfaceEvent
+
+	schedule ScanSchedule
+	schlock  sync.RWMutex  // protects schedule
+	rescan   chan struct{} // signalled by Rescan
+
+	lostIPs map[string]time.Time // when each recently lost IP was unlocked
+	llock   sync.Mutex           // protects lostIPs
+
+	readARP  arpReader
+	arpTable map[string]string // as last read; nil until the first read
+
+	stop chan struct{}
 }
 
 // NewContinousScanner properly instantiates a ContinuousScanner. The new
-// Scanner will wait between scans for a time defined by `period`.
+// Scanner will wait between full sweeps for a time defined by `period`; use
+// SetSchedule to change this and other timings.
 func NewContinousScanner(period time.Duration) *ContinuousScanner {
 	return &ContinuousScanner{
-		Scanner:     NewScanner(),
-		foundIPChan: make(chan ServiceFoundNotification),
-		period:      period,
-		stop:        make(chan struct{}),
+		Scanner:         NewScanner(),
+		foundIPChan:     make(chan ServiceFoundNotification),
+		interfaceEvents: make(chan InterfaceEvent, 10),
+		schedule:        ScanSchedule{SweepPeriod: period},
+		rescan:          make(chan struct{}, 1),
+		lostIPs:         make(map[string]time.Time),
+		readARP:         readProcARP,
+		stop:            make(chan struct{}),
 	}
 }
 
@@ -311,28 +596,95 @@ func (s *ContinuousScanner) FoundServices() chan ServiceFoundNotification {
 	return s.foundIPChan
 }
 
+// InterfaceEvents returns a channel which will be populated with changes to
+// local network interfaces, as found by the ContinuousScanner
+func (s *ContinuousScanner) InterfaceEvents() chan InterfaceEvent {
+	return s.interfaceEvents
+}
+
 // Serve begins serving the ContinuousScanner.
 func (s *ContinuousScanner) Serve() {
-	s.log.Debug("starting continuous ipv4 scanner", "period", s.period)
-	timer := time.NewTimer(time.Hour)
+	s.log.Debug("starting continuous ipv4 scanner", "schedule", s.getSchedule())
+	full := false // whether the next sweep was requested by Rescan
+	select {
+	case <-s.rescan: // the first sweep starts now anyway
+		full = true
+	default:
+	}
+	sweepTimer := time.NewTimer(0)
+	reprobeTimer := time.NewTimer(s.getSchedule().reprobePeriod())
+	defer sweepTimer.Stop()
+	defer reprobeTimer.Stop()
 	for {
-		// Perform a scan
-		s.log.Debug("doing ipv4 scan")
-		for ip, serviceIDs := range s.Scan() {
-			s.log.Debug("found ipv4 scan", "ip", net.ParseIP(ip), "descriptions", serviceIDs)
-			s.foundIPChan <- ServiceFoundNotification{
-				IP: net.ParseIP(ip),
-				MatchingDescriptionIDs: serviceIDs,
-			}
-		}
-
-		// Wait for s.period
-		s.log.Debug("waiting", "duration", s.period)
-		timer.Reset(s.period)
 		select {
 		case <-s.stop:
 			return
-		case <-timer.C:
+		case <-s.rescan:
+			s.log.Debug("rescan requested")
+			if !sweepTimer.Stop() {
+				select { // drain the timer if it fired
+				case <-sweepTimer.C:
+				default:
+				}
+			}
+			s.ResetBackoff()
+			s.sweep(true)
+			sweepTimer.Reset(s.getSchedule().sweepPeriod())
+		case <-sweepTimer.C:
+			s.sweep(full)
+			full = false
+			s.log.Debug("waiting for next sweep", "duration", s.getSchedule().sweepPeriod())
+			sweepTimer.Reset(s.getSchedule().sweepPeriod())
+		case <-reprobeTimer.C:
+			s.reprobe()
+			reprobeTimer.Reset(s.getSchedule().reprobePeriod())
+		}
+	}
+}
+
+// sweep searches every network for services: by browsing with mDNS, scanning
+// IPv4 networks and discovering IPv6 hosts. If full is true, the scan checks
+// every IPv4 address, rather than at most MaxAddressesPerScan.
+func (s *ContinuousScanner) sweep(full bool) {
+	// Check for interfaces which have appeared or disappeared (e.g. if
+	// this device has moved to a different network) before searching
+	if events, err := s.refreshInterfaces(); err != nil {
+		s.log.Warn("could not refresh ipv4 interfaces", "err", err)
+	} else {
+		for _, event := range events {
+			s.interfaceEvents <- event
+		}
+	}
+
+	// Browse with mDNS first, since it is much quicker than a scan
+	s.log.Debug("doing mdns browse")
+	for ip, serviceIDs := range s.Browse() {
+		s.log.Debug("found mdns service", "ip", net.ParseIP(ip), "descriptions", serviceIDs)
+		s.foundIPChan <- ServiceFoundNotification{
+			IP:                     net.ParseIP(ip),
+			MatchingDescriptionIDs: serviceIDs,
+		}
+	}
+
+	// Perform a scan
+	s.log.Debug("doing ipv4 scan")
+	for ip, serviceIDs := range s.scan(full) {
+		s.log.Debug("found ipv4 scan", "ip", net.ParseIP(ip), "descriptions", serviceIDs)
+		s.foundIPChan <- ServiceFoundNotification{
+			IP:                     net.ParseIP(ip),
+			MatchingDescriptionIDs: serviceIDs,
+		}
+	}
+
+	// IPv6 networks are too large to scan; discover their hosts instead
+	s.log.Debug("doing ipv6 discovery")
+	for ip, serviceIDs := range s.Discover6() {
+		addr := parseAddr(ip)
+		s.log.Debug("found ipv6 service", "ip", addr.String(), "descriptions", serviceIDs)
+		s.foundIPChan <- ServiceFoundNotification{
+			IP:                     addr.IP,
+			Zone:                   addr.Zone,
+			MatchingDescriptionIDs: serviceIDs,
 		}
 	}
 }
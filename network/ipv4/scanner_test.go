@@ -122,7 +122,7 @@ func (s *MySuite) TestIPv4Scanner(c *C) {
 	results = scanner.Scan()
 	c.Assert(len(results), Equals, 0) // Original IP should now be "locked"
 
-	scanner.Unlock(net.ParseIP(foundIP))
+	scanner.Unlock(parseAddr(foundIP))
 	<-time.After(5 * time.Second)
 	results = scanner.Scan()
 	c.Assert(len(results), Equals, 1, Commentf("expected to find %s on the next scan after it was unlocked", foundIP))
@@ -138,7 +138,7 @@ func (s *MySuite) TestIPv4Scanner(c *C) {
 	d2ID := scanner.AddDescription(d2)
 	c.Assert(len(d2ID), Not(Equals), 0)
 
-	scanner.Unlock(net.ParseIP(foundIP))
+	scanner.Unlock(parseAddr(foundIP))
 	results = scanner.Scan()
 	c.Assert(len(results), Equals, 1)
 	for _, result := range results {
@@ -0,0 +1,179 @@
+package ipv4
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultSweepPeriod is the default time between the full sweeps of a
+	// ContinuousScanner
+	DefaultSweepPeriod = time.Minute
+
+	// DefaultReprobePeriod is the default time between checks of recently
+	// lost IPs and the ARP table
+	DefaultReprobePeriod = 5 * time.Second
+
+	// DefaultLostIPWindow is the default time for which a lost service's IP
+	// is re-probed
+	DefaultLostIPWindow = 5 * time.Minute
+)
+
+// ScanSchedule controls when a ContinuousScanner searches. Full sweeps
+// (browsing, scanning and IPv6 discovery) can be slow on large networks, so
+// they are spaced out. In between, the IPs of services which were recently
+// lost, and IPs which have newly appeared in this device's ARP table, are
+// checked quickly. The zero value uses the defaults.
+type ScanSchedule struct {
+	// SweepPeriod is the time between the end of one sweep and the start of
+	// the next; 0 means DefaultSweepPeriod
+	SweepPeriod time.Duration
+
+	// ReprobePeriod is the time between checks of recently lost IPs and the
+	// ARP table; 0 means DefaultReprobePeriod
+	ReprobePeriod time.Duration
+
+	// LostIPWindow is how long after it is unlocked an IP is re-probed; 0
+	// means DefaultLostIPWindow
+	LostIPWindow time.Duration
+}
+
+// Validate checks that the schedule is usable
+func (sched ScanSchedule) Validate() error {
+	if sched.SweepPeriod < 0 || sched.ReprobePeriod < 0 || sched.LostIPWindow < 0 {
+		return fmt.Errorf("scan schedule periods cannot be negative")
+	}
+	return nil
+}
+
+func (sched ScanSchedule) sweepPeriod() time.Duration {
+	if sched.SweepPeriod == 0 {
+		return DefaultSweepPeriod
+	}
+	return sched.SweepPeriod
+}
+
+func (sched ScanSchedule) reprobePeriod() time.Duration {
+	if sched.ReprobePeriod == 0 {
+		return DefaultReprobePeriod
+	}
+	return sched.ReprobePeriod
+}
+
+func (sched ScanSchedule) lostIPWindow() time.Duration {
+	if sched.LostIPWindow == 0 {
+		return DefaultLostIPWindow
+	}
+	return sched.LostIPWindow
+}
+
+// SetSchedule changes when the ContinuousScanner searches (see ScanSchedule).
+// The new schedule takes effect after the current wait.
+func (s *ContinuousScanner) SetSchedule(sched ScanSchedule) error {
+	if err := sched.Validate(); err != nil {
+		return err
+	}
+	s.schlock.Lock()
+	defer s.schlock.Unlock()
+	s.schedule = sched
+	return nil
+}
+
+func (s *ContinuousScanner) getSchedule() ScanSchedule {
+	s.schlock.RLock()
+	defer s.schlock.RUnlock()
+	return s.schedule
+}
+
+// Rescan asks the ContinuousScanner to start a full sweep now, rather than
+// waiting for the next. The sweep checks every address, even those which have
+// not responded to recent scans; if there are more than MaxAddressesPerScan,
+// it continues from where the last scan left off until it gets back there.
+func (s *ContinuousScanner) Rescan() {
+	select {
+	case s.rescan <- struct{}{}:
+	default: // a rescan is already pending
+	}
+}
+
+// Unlock unlocks the provided address, such that it will no longer be ignored
+// in future scans. The service at the IP is assumed to have been lost, so the
+// IP is re-probed frequently for a while in case it comes back.
+func (s *ContinuousScanner) Unlock(addr net.IPAddr) {
+	s.Scanner.Unlock(addr)
+	if addr.IP.To4() == nil {
+		return // lost IPv6 services are found again by discovery
+	}
+	s.llock.Lock()
+	defer s.llock.Unlock()
+	s.lostIPs[addr.IP.To4().String()] = time.Now()
+}
+
+// recentlyLostIPs returns the IPs which were lost within the window, sorted,
+// and forgets those lost before it
+func (s *ContinuousScanner) recentlyLostIPs(window time.Duration) []net.IP {
+	s.llock.Lock()
+	defer s.llock.Unlock()
+	var lost []string
+	for ip, when := range s.lostIPs {
+		if time.Since(when) > window {
+			delete(s.lostIPs, ip)
+			continue
+		}
+		lost = append(lost, ip)
+	}
+	sort.Strings(lost)
+	ips := make([]net.IP, 0, len(lost))
+	for _, ip := range lost {
+		ips = append(ips, net.ParseIP(ip).To4())
+	}
+	return ips
+}
+
+// arpChanges returns the IPs which have appeared in this device's ARP table,
+// or changed hardware address, since it was last read. If the table cannot be
+// read (such as on systems other than Linux), it is not read again.
+func (s *ContinuousScanner) arpChanges() []net.IP {
+	if s.readARP == nil {
+		return nil
+	}
+	table, err := s.readARP()
+	if err != nil {
+		s.log.Debug("could not read arp table; arp changes will not trigger scans", "err", err)
+		s.readARP = nil
+		return nil
+	}
+	first := s.arpTable == nil
+	changed := diffARPTables(s.arpTable, table)
+	s.arpTable = table
+	if first {
+		return nil // every entry is new; the sweeps cover them
+	}
+	return changed
+}
+
+// reprobe checks the IPs of recently lost services, and any IPs which have
+// changed in the ARP table, passing the services found to FoundServices
+func (s *ContinuousScanner) reprobe() {
+	lost := s.recentlyLostIPs(s.getSchedule().lostIPWindow())
+	changed := s.arpChanges()
+	if len(changed) > 0 {
+		s.log.Debug("arp table changed; probing new neighbors", "ips", changed)
+	}
+	ips := append(lost, changed...)
+	if len(ips) == 0 {
+		return
+	}
+	for ip, serviceIDs := range s.ScanAddresses(ips) {
+		s.llock.Lock()
+		delete(s.lostIPs, ip) // found again
+		s.llock.Unlock()
+		s.log.Debug("found ipv4 service by reprobe", "ip", ip, "descriptions", serviceIDs)
+		s.foundIPChan <- ServiceFoundNotification{
+			IP:                     net.ParseIP(ip),
+			MatchingDescriptionIDs: serviceIDs,
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package ipv4
+
+import (
+	"fmt"
+	. "gopkg.in/check.v1"
+	"net"
+	"strings"
+	"time"
+)
+
+func (s *MySuite) TestBackoff(c *C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer listener.Close()
+	port := uint16(listener.Addr().(*net.TCPAddr).Port)
+
+	scanner := NewScanner()
+	id := scanner.AddDescription(ServiceDescription{OpenPorts: []uint16{port}})
+	targets, err := ParseNetworks("127.0.0.1", "127.0.0.2")
+	c.Assert(err, IsNil)
+	c.Assert(scanner.SetOptions(ScannerOptions{Targets: targets}), IsNil)
+	backedOff := func() int { return scanner.Stats()[0].IPsBackedOff }
+
+	// 127.0.0.2 does not respond, so it is skipped by the next scan
+	c.Assert(scanner.Scan(), DeepEquals, map[string][]string{"127.0.0.1": {id}})
+	c.Assert(backedOff(), Equals, 0)
+	scanner.Unlock(net.IPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	c.Assert(scanner.Scan(), DeepEquals, map[string][]string{"127.0.0.1": {id}})
+	c.Assert(backedOff(), Equals, 1)
+	scanner.Unlock(net.IPAddr{IP: net.IPv4(127, 0, 0, 1)})
+
+	// unless the backoff is reset, or the address is asked for explicitly
+	scanner.ResetBackoff()
+	c.Assert(scanner.Scan(), DeepEquals, map[string][]string{"127.0.0.1": {id}})
+	c.Assert(backedOff(), Equals, 0)
+	c.Assert(scanner.ScanAddresses([]net.IP{net.IPv4(127, 0, 0, 2), net.IPv4(127, 0, 0, 1)}), DeepEquals, map[string][]string{})
+	c.Assert(scanner.Stats()[1].Method, Equals, MethodScan)
+	c.Assert(scanner.Stats()[0].Method, Equals, MethodReprobe)
+	c.Assert(scanner.Stats()[0].IPsChecked, Equals, 1)
+	c.Assert(scanner.Stats()[0].IPsAlreadyInUse, Equals, 1)
+
+	// each miss doubles the backoff, up to the maximum
+	ip := net.IPv4(10, 0, 0, 1)
+	for i := 0; i < 100; i++ {
+		scanner.recordResponse(ip, false, time.Hour)
+	}
+	c.Assert(scanner.backedOff(ip, time.Now().Add(59*time.Minute)), Equals, true)
+	c.Assert(scanner.backedOff(ip, time.Now().Add(61*time.Minute)), Equals, false)
+	scanner.recordResponse(ip, true, time.Hour)
+	c.Assert(scanner.backedOff(ip, time.Now()), Equals, false)
+	scanner.recordResponse(ip, false, time.Hour)
+	c.Assert(scanner.backedOff(ip, time.Now().Add(minBackoff-time.Second)), Equals, true)
+	c.Assert(scanner.backedOff(ip, time.Now().Add(minBackoff+time.Second)), Equals, false)
+}
+
+func (s *MySuite) TestParseARPTable(c *C) {
+	table, err := parseARPTable(strings.NewReader(`IP address       HW type     Flags       HW address            Mask     Device
+192.168.1.1      0x1         0x2         00:11:22:33:44:55     *        wlan0
+192.168.1.7      0x1         0x0         00:00:00:00:00:00     *        wlan0
+192.168.1.9      0x1         0x6         AA:BB:CC:DD:EE:FF     *        wlan0
+`))
+	c.Assert(err, IsNil)
+	c.Assert(table, DeepEquals, map[string]string{
+		"192.168.1.1": "00:11:22:33:44:55",
+		"192.168.1.9": "aa:bb:cc:dd:ee:ff",
+	})
+	_, err = parseARPTable(strings.NewReader("header\nnot-an-ip 0x1 0x2 00:11:22:33:44:55 * eth0\n"))
+	c.Assert(err, NotNil)
+
+	after := map[string]string{
+		"192.168.1.1": "00:11:22:33:44:66", // a new device has taken the IP
+		"192.168.1.9": "aa:bb:cc:dd:ee:ff",
+		"192.168.1.3": "aa:bb:cc:dd:ee:00", // new
+	}
+	c.Assert(diffARPTables(table, after), DeepEquals, []net.IP{net.IPv4(192, 168, 1, 1).To4(), net.IPv4(192, 168, 1, 3).To4()})
+	c.Assert(diffARPTables(after, after), DeepEquals, []net.IP{})
+}
+
+func (s *MySuite) TestScanSchedule(c *C) {
+	c.Assert(ScanSchedule{}.Validate(), IsNil)
+	c.Assert(ScanSchedule{ReprobePeriod: -1}.Validate(), NotNil)
+	c.Assert(ScanSchedule{}.sweepPeriod(), Equals, DefaultSweepPeriod)
+	c.Assert(ScanSchedule{SweepPeriod: time.Second}.sweepPeriod(), Equals, time.Second)
+}
+
+// expectFound waits for the scanner to find a service at ip
+func expectFound(c *C, scanner *ContinuousScanner, ip string) {
+	select {
+	case n := <-scanner.FoundServices():
+		c.Assert(n.IP.String(), Equals, ip)
+	case <-time.After(5 * time.Second):
+		c.Fatalf("timed out waiting for the scanner to find %v", ip)
+	}
+}
+
+// expectNotFound checks that the scanner finds nothing for a while
+func expectNotFound(c *C, scanner *ContinuousScanner) {
+	select {
+	case n := <-scanner.FoundServices():
+		c.Fatalf("unexpectedly found %v", n.IP)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func newTestContinuousScanner(c *C, sched ScanSchedule, arp arpReader) *ContinuousScanner {
+	scanner := NewContinousScanner(time.Hour)
+	c.Assert(scanner.SetSchedule(sched), IsNil)
+	scanner.readARP = arp
+	return scanner
+}
+
+func (s *MySuite) TestReprobe(c *C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer listener.Close()
+	port := uint16(listener.Addr().(*net.TCPAddr).Port)
+	listener2, err := net.Listen("tcp", fmt.Sprintf("127.0.0.2:%d", port))
+	if err != nil {
+		c.Skip("cannot listen on 127.0.0.2: " + err.Error())
+	}
+	defer listener2.Close()
+
+	arpTable := make(chan map[string]string, 1)
+	arpTable <- map[string]string{}
+	lastTable := map[string]string{}
+	readARP := func() (map[string]string, error) {
+		select {
+		case lastTable = <-arpTable:
+		default:
+		}
+		return lastTable, nil
+	}
+	scanner := newTestContinuousScanner(c, ScanSchedule{ReprobePeriod: 20 * time.Millisecond}, readARP)
+	scanner.AddDescription(ServiceDescription{OpenPorts: []uint16{port}})
+	targets, err := ParseNetworks("127.0.0.1")
+	c.Assert(err, IsNil)
+	c.Assert(scanner.SetOptions(ScannerOptions{Targets: targets}), IsNil)
+	go scanner.Serve()
+	defer scanner.Stop()
+
+	// the first sweep finds the service; sweeps are then an hour apart
+	expectFound(c, scanner, "127.0.0.1")
+	expectNotFound(c, scanner)
+
+	// a lost IP is re-probed quickly
+	scanner.Unlock(net.IPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	expectFound(c, scanner, "127.0.0.1")
+
+	// as is an IP which appears in the ARP table, even if it is not a target
+	arpTable <- map[string]string{"127.0.0.2": "00:11:22:33:44:55"}
+	expectFound(c, scanner, "127.0.0.2")
+	expectNotFound(c, scanner)
+}
+
+func (s *MySuite) TestRescan(c *C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer listener.Close()
+	port := uint16(listener.Addr().(*net.TCPAddr).Port)
+
+	scanner := newTestContinuousScanner(c, ScanSchedule{ReprobePeriod: time.Hour}, nil)
+	scanner.AddDescription(ServiceDescription{OpenPorts: []uint16{port}})
+	targets, err := ParseNetworks("127.0.0.1")
+	c.Assert(err, IsNil)
+	c.Assert(scanner.SetOptions(ScannerOptions{Targets: targets}), IsNil)
+	scanner.Rescan() // before serving; the first sweep covers it
+	go scanner.Serve()
+	defer scanner.Stop()
+
+	expectFound(c, scanner, "127.0.0.1")
+	expectNotFound(c, scanner)
+	scanner.Scanner.Unlock(net.IPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	expectNotFound(c, scanner) // no sweep or reprobe is due
+
+	scanner.Rescan()
+	expectFound(c, scanner, "127.0.0.1")
+}
+
+func (s *MySuite) TestRescanBeyondMaxAddresses(c *C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer listener.Close()
+	port := uint16(listener.Addr().(*net.TCPAddr).Port)
+	listener6, err := net.Listen("tcp", fmt.Sprintf("127.0.0.6:%d", port))
+	if err != nil {
+		c.Skip("cannot listen on 127.0.0.6: " + err.Error())
+	}
+	defer listener6.Close()
+
+	scanner := newTestContinuousScanner(c, ScanSchedule{SweepPeriod: time.Hour, ReprobePeriod: time.Hour}, nil)
+	scanner.AddDescription(ServiceDescription{OpenPorts: []uint16{port}})
+	targets, err := ParseNetworks("127.0.0.0/29")
+	c.Assert(err, IsNil)
+	c.Assert(scanner.SetOptions(ScannerOptions{Targets: targets, MaxAddressesPerScan: 2}), IsNil)
+	go scanner.Serve()
+	defer scanner.Stop()
+
+	// the first sweep only covers 127.0.0.0 and 127.0.0.1...
+	expectFound(c, scanner, "127.0.0.1")
+	expectNotFound(c, scanner)
+
+	// ...but a rescan covers the rest of the network
+	scanner.Rescan()
+	expectFound(c, scanner, "127.0.0.6")
+	expectNotFound(c, scanner)
+}
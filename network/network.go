@@ -0,0 +1,126 @@
+// Package network holds what SIFT's discovery packages (ipv4, ssdp and ble)
+// share: the statuses Adapters report, and the Context through which they
+// report them and store data, whichever network their services are found on.
+package network
+
+import (
+	"fmt"
+	"github.com/upwrd/sift/types"
+	"sync"
+)
+
+// AdapterStatus describes the status of an Adapter
+type AdapterStatus int
+
+// Possible Adapter statuses
+const (
+	AdapterStatusIncorrectService AdapterStatus = iota // Context pointed to a service that the Adapter does not control
+	AdapterStatusHandling                              // Adapter is handling the Context
+	AdapterStatusDone                                  // Adapter is done handling the Context
+	AdapterStatusError                                 // Adapter received an error
+)
+
+// A CredentialStore persists data (such as credentials) on behalf of Adapters.
+// It is satisfied by db.Store.
+type CredentialStore interface {
+	UpsertAdapterCredential(adapterName, key, value string) error
+	GetAdapterCredential(adapterName, key string) (string, error)
+}
+
+// Context is the part of a service context which does not depend on the
+// network of the service. It is embedded by the ServiceContexts of each
+// discovery package (e.g. ipv4.ServiceContext), which add the service's
+// address.
+type Context struct {
+	Config types.AdapterConfig // the configuration of the Adapter's factory, as set by the operator
+
+	status      chan AdapterStatus
+	slock       *sync.Mutex
+	store       CredentialStore
+	adapterName string
+}
+
+// BuildContext builds a new Context. The second return value is a channel
+// which will receive status updates from calls to context.SendStatus() until
+// the Context is killed. Data stored with the Context is kept in the provided
+// CredentialStore, and config is made available to the Adapter as the
+// Context's Config.
+func BuildContext(store CredentialStore, adapterName string, config types.AdapterConfig) (Context, <-chan AdapterStatus) {
+	status := make(chan AdapterStatus, 10)
+	return Context{
+		Config:      config,
+		status:      status,
+		slock:       &sync.Mutex{},
+		store:       store,
+		adapterName: adapterName,
+	}, status
+}
+
+// KillContext kills the specified context. Subsequent calls on the Context
+// will return errors
+func KillContext(context *Context) {
+	if context != nil {
+		context.slock.Lock()
+		defer context.slock.Unlock()
+		if context.status != nil {
+			close(context.status)
+		}
+		// Unset the status channel so future callers to SendStatus will know that
+		// the Context has been killed
+		context.status = nil
+	}
+}
+
+// SendStatus sends a status to the creator of the Context. Will return an
+// error if the Context has been killed, otherwise nil.
+func (c Context) SendStatus(ds AdapterStatus) error {
+	c.slock.Lock()
+	defer c.slock.Unlock()
+
+	// If the status channel is nil, that means it has been closed by a call to
+	// KillContext()
+	if c.status == nil {
+		return fmt.Errorf("context has been killed")
+	}
+	// If the status channel is non-nil, send the status
+	c.status <- ds
+	return nil
+}
+
+// StoreData will store a string of data with the Context, which is retrievable
+// with the given key.
+//
+// Note that Adapters with different names (e.g. "google chromecast" vs "amazon
+// fire") are segregated from eachother and will not be able to read or write
+// over eachother's data. The SIFT database encrypts stored data when a
+// credential key is configured (see db.CredentialKeyEnv).
+func (c Context) StoreData(key, value string) (err error) {
+	if !c.isAlive() {
+		return fmt.Errorf("Context is dead")
+	}
+	if c.store == nil {
+		return fmt.Errorf("Context does not have a credential store")
+	}
+	return c.store.UpsertAdapterCredential(c.adapterName, key, value)
+}
+
+// GetData retrieves the string data which has been stored for this context.
+//
+// Note that Adapters with different names (e.g. "google chromecast" vs "amazon
+// fire") are segregated from eachother and will not be able to read or write
+// over eachother's data.
+func (c Context) GetData(key string) (string, error) {
+	if !c.isAlive() {
+		return "", fmt.Errorf("Context is dead")
+	}
+	if c.store == nil {
+		return "", fmt.Errorf("Context does not have a credential store")
+	}
+	return c.store.GetAdapterCredential(c.adapterName, key)
+}
+
+func (c Context) isAlive() bool {
+	c.slock.Lock()
+	defer c.slock.Unlock()
+	return c.status != nil
+}
@@ -0,0 +1,60 @@
+package network
+
+import (
+	"fmt"
+	"github.com/upwrd/sift/types"
+	. "gopkg.in/check.v1"
+	"testing"
+)
+
+// Hook up gocheck into the "go test" runner.
+func TestNetwork(t *testing.T) { TestingT(t) }
+
+type NetworkSuite struct{}
+
+var _ = Suite(&NetworkSuite{})
+
+// testStore is a CredentialStore which keeps data in memory
+type testStore map[string]string
+
+func (s testStore) UpsertAdapterCredential(adapterName, key, value string) error {
+	s[adapterName+"/"+key] = value
+	return nil
+}
+
+func (s testStore) GetAdapterCredential(adapterName, key string) (string, error) {
+	value, ok := s[adapterName+"/"+key]
+	if !ok {
+		return "", fmt.Errorf("no credential %v for %v", key, adapterName)
+	}
+	return value, nil
+}
+
+func (s *NetworkSuite) TestContext(c *C) {
+	store := testStore{}
+	context, status := BuildContext(store, "test adapter", types.AdapterConfig{})
+
+	c.Assert(context.SendStatus(AdapterStatusHandling), IsNil)
+	c.Assert(<-status, Equals, AdapterStatusHandling)
+
+	// data is kept in the store, under the adapter's name
+	c.Assert(context.StoreData("token", "abc"), IsNil)
+	c.Assert(store, DeepEquals, testStore{"test adapter/token": "abc"})
+	token, err := context.GetData("token")
+	c.Assert(err, IsNil)
+	c.Assert(token, Equals, "abc")
+
+	// once killed, the status channel is closed and calls fail
+	KillContext(&context)
+	_, more := <-status
+	c.Assert(more, Equals, false)
+	c.Assert(context.SendStatus(AdapterStatusHandling), NotNil)
+	c.Assert(context.StoreData("token", "def"), NotNil)
+	_, err = context.GetData("token")
+	c.Assert(err, NotNil)
+	KillContext(&context) // killing twice is harmless
+
+	// without a store, data cannot be kept
+	context, _ = BuildContext(nil, "test adapter", types.AdapterConfig{})
+	c.Assert(context.StoreData("token", "abc"), NotNil)
+}
@@ -0,0 +1,308 @@
+package ssdp
+
+import (
+	"fmt"
+	"github.com/pborman/uuid"
+	"github.com/thejerf/suture"
+	log "gopkg.in/inconshreveable/log15.v2"
+	logext "gopkg.in/inconshreveable/log15.v2/ext"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	searchMX          = 2 * time.Second // how long devices may wait before responding
+	maxMessageSize    = 8192
+	foundServicesSize = 100
+)
+
+// A message is a single SSDP packet
+type message struct {
+	from net.IP
+	data []byte
+}
+
+// A searchFunc sends an M-SEARCH for each of the given targets, and returns
+// every response received before devices stop responding
+type searchFunc func(targets []string, mx time.Duration) ([]message, error)
+
+// An ISearcher searches for SSDP services matching given descriptions. Once
+// services are found, they are locked and returned to the caller. It is up to
+// the caller to unlock services (via Unlock()) if they are no longer in use.
+type ISearcher interface {
+	// Add a description to search for; return the ID used if a match is returned
+	AddDescription(desc ServiceDescription) string
+
+	// Replace the description with the given ID
+	UpdateDescription(id string, desc ServiceDescription) error
+
+	// Search for services matching given descriptions
+	Search() []ServiceFoundNotification
+
+	// By default, after a service is found it is ignored in future searches.
+	// Unlock instructs the searcher to include the service in future searches.
+	Unlock(svc Service)
+}
+
+// Searcher implements ISearcher
+type Searcher struct {
+	descriptionsByID map[string]ServiceDescription
+	dlock            sync.RWMutex // protects descriptionsByID
+
+	activeServices map[string]struct{}
+	slock          sync.Mutex // protects activeServices
+
+	search searchFunc
+	log    log.Logger
+}
+
+// NewSearcher properly instantiates a Searcher
+func NewSearcher() *Searcher {
+	return &Searcher{
+		descriptionsByID: make(map[string]ServiceDescription),
+		activeServices:   make(map[string]struct{}),
+		search:           sendSearch,
+		log:              Log.New("obj", "ssdp.searcher", "id", logext.RandId(8)),
+	}
+}
+
+// AddDescription adds a ServiceDescription to the Searcher. On following
+// searches, the Searcher will find services which match the description.
+func (s *Searcher) AddDescription(desc ServiceDescription) string {
+	s.dlock.Lock()
+	defer s.dlock.Unlock()
+	id := uuid.New()
+	s.descriptionsByID[id] = desc
+	return id
+}
+
+// UpdateDescription replaces the ServiceDescription with the given ID
+func (s *Searcher) UpdateDescription(id string, desc ServiceDescription) error {
+	s.dlock.Lock()
+	defer s.dlock.Unlock()
+	if _, ok := s.descriptionsByID[id]; !ok {
+		return fmt.Errorf("no description with id %v", id)
+	}
+	s.descriptionsByID[id] = desc
+	return nil
+}
+
+// Search sends an M-SEARCH for the search target of each description, and
+// returns the services which responded and matched, in the order they
+// responded.
+func (s *Searcher) Search() []ServiceFoundNotification {
+	s.dlock.RLock()
+	targetSet := make(map[string]struct{})
+	for _, desc := range s.descriptionsByID {
+		targetSet[desc.searchTarget()] = struct{}{}
+	}
+	s.dlock.RUnlock()
+	if len(targetSet) == 0 {
+		s.log.Debug("searcher has no descriptions, ignoring search")
+		return nil
+	}
+	targets := make([]string, 0, len(targetSet))
+	for target := range targetSet {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	msgs, err := s.search(targets, searchMX)
+	if err != nil {
+		s.log.Warn("could not send ssdp search", "targets", targets, "err", err)
+	}
+	var found []ServiceFoundNotification
+	for _, msg := range msgs {
+		if n, ok := s.consider(msg); ok {
+			found = append(found, n)
+		}
+	}
+	s.log.Info("ssdp search complete", "targets", len(targets), "responses", len(msgs), "services_found", len(found))
+	return found
+}
+
+// Unlock unlocks the provided Service, such that it will no longer be ignored
+// in future searches.
+func (s *Searcher) Unlock(svc Service) {
+	s.slock.Lock()
+	defer s.slock.Unlock()
+	delete(s.activeServices, svc.key())
+	s.log.Debug("ssdp searcher unlocked service", "usn", svc.USN, "location", svc.Location)
+}
+
+// consider parses a message and, if it describes a service which matches any
+// descriptions and is not already in use, locks the service and returns it
+func (s *Searcher) consider(msg message) (ServiceFoundNotification, bool) {
+	svc, alive, err := parseMessage(msg.data, msg.from)
+	if err != nil {
+		s.log.Debug("ignoring ssdp message", "from", msg.from, "err", err)
+		return ServiceFoundNotification{}, false
+	}
+	if !alive {
+		s.log.Debug("ssdp service is leaving the network", "usn", svc.USN)
+		return ServiceFoundNotification{}, false
+	}
+
+	s.dlock.RLock()
+	var ids []string
+	for id, desc := range s.descriptionsByID {
+		if desc.Matches(svc) {
+			ids = append(ids, id)
+		}
+	}
+	s.dlock.RUnlock()
+	if len(ids) == 0 {
+		return ServiceFoundNotification{}, false
+	}
+	sort.Strings(ids)
+
+	s.slock.Lock()
+	defer s.slock.Unlock()
+	if _, inUse := s.activeServices[svc.key()]; inUse {
+		s.log.Debug("searcher ignoring service that is already in use", "usn", svc.USN)
+		return ServiceFoundNotification{}, false
+	}
+	s.activeServices[svc.key()] = struct{}{} // mark service as in use
+	s.log.Debug("found ssdp service", "usn", svc.USN, "location", svc.Location, "descriptions", ids)
+	return ServiceFoundNotification{Service: svc, MatchingDescriptionIDs: ids}, true
+}
+
+// sendSearch sends an M-SEARCH for each target from an ephemeral port, and
+// collects the (unicast) responses.
+func sendSearch(targets []string, mx time.Duration) ([]message, error) {
+	dst, err := net.ResolveUDPAddr("udp4", ssdpAddr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, fmt.Errorf("could not listen for ssdp responses: %v", err)
+	}
+	defer conn.Close()
+	for _, target := range targets {
+		req := fmt.Sprintf("M-SEARCH * HTTP/1.1\r\nHOST: %v\r\nMAN: \"ssdp:discover\"\r\nMX: %d\r\nST: %v\r\n\r\n", ssdpAddr, int(mx/time.Second), target)
+		if _, err := conn.WriteTo([]byte(req), dst); err != nil {
+			return nil, fmt.Errorf("could not send ssdp search: %v", err)
+		}
+	}
+	// devices respond at a random time within MX; allow for some latency
+	if err := conn.SetReadDeadline(time.Now().Add(mx + time.Second)); err != nil {
+		return nil, err
+	}
+	return readMessages(conn, nil)
+}
+
+// readMessages reads messages from conn until it times out or is closed. If
+// found is nil, the messages are returned; otherwise, each is passed to found
+// as it is read.
+func readMessages(conn *net.UDPConn, found func(message)) ([]message, error) {
+	var msgs []message
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return msgs, nil // done waiting
+			}
+			return msgs, err
+		}
+		data := make([]byte, n)
+		copy(data, buf[:n])
+		if found != nil {
+			found(message{from: from.IP, data: data})
+		} else {
+			msgs = append(msgs, message{from: from.IP, data: data})
+		}
+	}
+}
+
+// An IContinuousSearcher is a Searcher that searches continuously, and listens
+// for announcements between searches. Services found are passed to the
+// channel provided by FoundServices()
+type IContinuousSearcher interface {
+	suture.Service
+	ISearcher
+	FoundServices() chan ServiceFoundNotification
+}
+
+// ContinuousSearcher implements IContinuousSearcher
+type ContinuousSearcher struct {
+	*Searcher
+	foundChan chan ServiceFoundNotification
+	period    time.Duration
+	stop      chan struct{}
+}
+
+// NewContinuousSearcher properly instantiates a ContinuousSearcher. The new
+// Searcher will wait between searches for a time defined by `period`.
+func NewContinuousSearcher(period time.Duration) *ContinuousSearcher {
+	return &ContinuousSearcher{
+		Searcher:  NewSearcher(),
+		foundChan: make(chan ServiceFoundNotification, foundServicesSize),
+		period:    period,
+		stop:      make(chan struct{}),
+	}
+}
+
+// FoundServices returns a channel which will be populated with services found
+// by the ContinuousSearcher
+func (s *ContinuousSearcher) FoundServices() chan ServiceFoundNotification {
+	return s.foundChan
+}
+
+// Serve begins serving the ContinuousSearcher.
+func (s *ContinuousSearcher) Serve() {
+	s.log.Debug("starting continuous ssdp searcher", "period", s.period)
+	done := make(chan struct{})
+	defer close(done)
+
+	// Listen for announcements in the background. If the multicast group
+	// cannot be joined, services are still found by searching.
+	if conn, err := listenForAnnouncements(); err != nil {
+		s.log.Warn("could not listen for ssdp announcements; relying on searches", "err", err)
+	} else {
+		defer conn.Close()
+		go readMessages(conn, func(msg message) {
+			if n, ok := s.consider(msg); ok {
+				select {
+				case s.foundChan <- n:
+				case <-done:
+				}
+			}
+		})
+	}
+
+	timer := time.NewTimer(time.Hour)
+	for {
+		for _, n := range s.Search() {
+			select {
+			case s.foundChan <- n:
+			case <-s.stop:
+				return
+			}
+		}
+
+		// Wait for s.period
+		timer.Reset(s.period)
+		select {
+		case <-s.stop:
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Stop stops the ContinuousSearcher
+func (s *ContinuousSearcher) Stop() {
+	s.stop <- struct{}{}
+}
+
+func listenForAnnouncements() (*net.UDPConn, error) {
+	addr, err := net.ResolveUDPAddr("udp4", ssdpAddr)
+	if err != nil {
+		return nil, err
+	}
+	return net.ListenMulticastUDP("udp4", nil, addr)
+}
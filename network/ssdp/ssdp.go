@@ -0,0 +1,165 @@
+// Package ssdp discovers UPnP devices and services which announce themselves
+// with SSDP (the Simple Service Discovery Protocol), such as media renderers
+// and hubs.
+package ssdp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/upwrd/sift/logging"
+	"github.com/upwrd/sift/network"
+	"github.com/upwrd/sift/network/ipv4"
+	"github.com/upwrd/sift/types"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Log is used to log messages for the ssdp package. Logs are disabled by
+// default; use sift/logging.SetLevel() to set log levels for all packages, or
+// Log.SetHandler() to set a custom handler for this package (see:
+// https://godoc.org/gopkg.in/inconshreveable/log15.v2)
+var Log = logging.Log.New("pkg", "network/ssdp")
+
+const (
+	ssdpAddr = "239.255.255.250:1900"
+
+	// SearchAll is the search target which matches every device and service
+	SearchAll = "ssdp:all"
+)
+
+// ServiceDescription describes the SSDP announcements of a service. Every
+// non-empty field must match.
+type ServiceDescription struct {
+	ST             string // search target, e.g. "urn:schemas-upnp-org:device:MediaRenderer:1"; empty matches everything
+	USNPrefix      string // the USN must start with this, e.g. "uuid:RINCON_"
+	ServerContains string // the SERVER header must contain this (case-insensitive), e.g. "Sonos"
+}
+
+// searchTarget returns the ST used to search for the description
+func (d ServiceDescription) searchTarget() string {
+	if d.ST == "" {
+		return SearchAll
+	}
+	return d.ST
+}
+
+// Matches returns true if the service matches the description
+func (d ServiceDescription) Matches(svc Service) bool {
+	if st := d.searchTarget(); st != SearchAll && !strings.EqualFold(st, svc.ST) {
+		return false
+	}
+	if d.USNPrefix != "" && !strings.HasPrefix(svc.USN, d.USNPrefix) {
+		return false
+	}
+	if d.ServerContains != "" && !strings.Contains(strings.ToLower(svc.Server), strings.ToLower(d.ServerContains)) {
+		return false
+	}
+	return true
+}
+
+// A Service is a device or service found with SSDP, either in response to a
+// search or from an announcement
+type Service struct {
+	IP       net.IP // the host of Location, or the sender if Location has no IP
+	Location string // the URL of the UPnP device description
+	USN      string // unique service name, e.g. "uuid:...::urn:schemas-upnp-org:device:MediaRenderer:1"
+	ST       string // search target (or notification type, for announcements)
+	Server   string
+}
+
+// key identifies the Service while it is being handled
+func (svc Service) key() string {
+	if svc.USN != "" {
+		return svc.USN
+	}
+	return svc.Location
+}
+
+// A ServiceFoundNotification indicates that a Service was found which matched
+// all of MatchingDescriptionIDs.
+type ServiceFoundNotification struct {
+	Service                Service
+	MatchingDescriptionIDs []string
+}
+
+// ServiceContext describes (and grants access to) a particular SSDP service.
+// It embeds an ipv4.ServiceContext for the service's IP, which is used to
+// report the Adapter's status and to store data.
+type ServiceContext struct {
+	*ipv4.ServiceContext
+	Location string // the URL of the UPnP device description
+	USN      string
+	ST       string
+	Server   string
+}
+
+// BuildContext builds a new ServiceContext for the given Service. The second
+// return value is a channel which will receive status updates from calls to
+// context.SendStatus() until the Context is killed (see KillContext).
+func BuildContext(svc Service, store network.CredentialStore, adapterName string, config types.AdapterConfig) (*ServiceContext, <-chan network.AdapterStatus) {
+	ipv4Context, status := ipv4.BuildContext(svc.IP, store, adapterName, config)
+	return &ServiceContext{
+		ServiceContext: ipv4Context,
+		Location:       svc.Location,
+		USN:            svc.USN,
+		ST:             svc.ST,
+		Server:         svc.Server,
+	}, status
+}
+
+// KillContext kills the specified context. Subsequent calls on the Context
+// will return errors
+func KillContext(context *ServiceContext) {
+	if context != nil {
+		ipv4.KillContext(context.ServiceContext)
+	}
+}
+
+// parseMessage parses an SSDP message: either a response to a search, or a
+// NOTIFY announcement. alive is false if the message announces that the
+// service is leaving the network (ssdp:byebye).
+func parseMessage(data []byte, from net.IP) (svc Service, alive bool, err error) {
+	var header http.Header
+	r := bufio.NewReader(bytes.NewReader(data))
+	if bytes.HasPrefix(data, []byte("HTTP/")) {
+		resp, err := http.ReadResponse(r, nil)
+		if err != nil {
+			return Service{}, false, fmt.Errorf("could not parse ssdp response: %v", err)
+		}
+		resp.Body.Close()
+		header = resp.Header
+		svc.ST = header.Get("ST")
+		alive = true
+	} else {
+		req, err := http.ReadRequest(r)
+		if err != nil {
+			return Service{}, false, fmt.Errorf("could not parse ssdp request: %v", err)
+		}
+		if req.Method != "NOTIFY" {
+			return Service{}, false, fmt.Errorf("not an ssdp announcement: %v", req.Method)
+		}
+		header = req.Header
+		svc.ST = header.Get("NT")
+		alive = header.Get("NTS") != "ssdp:byebye"
+	}
+	svc.Location = header.Get("Location")
+	svc.USN = header.Get("USN")
+	svc.Server = header.Get("Server")
+	if svc.USN == "" && svc.Location == "" {
+		return Service{}, false, fmt.Errorf("ssdp message has neither USN nor LOCATION")
+	}
+
+	svc.IP = from
+	if u, err := url.Parse(svc.Location); err == nil {
+		if ip := net.ParseIP(u.Hostname()); ip != nil {
+			svc.IP = ip
+		}
+	}
+	if ip4 := svc.IP.To4(); ip4 != nil {
+		svc.IP = ip4
+	}
+	return svc, alive, nil
+}
@@ -0,0 +1,129 @@
+package ssdp
+
+import (
+	. "gopkg.in/check.v1"
+	"net"
+	"testing"
+	"time"
+)
+
+// Hook up gocheck into the "go test" runner.
+func TestSSDP(t *testing.T) { TestingT(t) }
+
+type SSDPSuite struct{}
+
+var _ = Suite(&SSDPSuite{})
+
+const (
+	rendererST  = "urn:schemas-upnp-org:device:MediaRenderer:1"
+	rendererUSN = "uuid:RINCON_000E58A0123401400::urn:schemas-upnp-org:device:MediaRenderer:1"
+
+	searchResponse = "HTTP/1.1 200 OK\r\n" +
+		"CACHE-CONTROL: max-age=1800\r\n" +
+		"EXT:\r\n" +
+		"LOCATION: http://10.0.0.9:1400/xml/device_description.xml\r\n" +
+		"SERVER: Linux UPnP/1.0 Sonos/34.16-37101 (ZPS1)\r\n" +
+		"ST: " + rendererST + "\r\n" +
+		"USN: " + rendererUSN + "\r\n\r\n"
+	aliveNotify = "NOTIFY * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"LOCATION: http://10.0.0.12:49152/description.xml\r\n" +
+		"NT: urn:schemas-upnp-org:device:Basic:1\r\n" +
+		"NTS: ssdp:alive\r\n" +
+		"SERVER: Linux/3.14 UPnP/1.0 IpBridge/1.26.0\r\n" +
+		"USN: uuid:2f402f80-da50-11e1-9b23-001788255acc::urn:schemas-upnp-org:device:Basic:1\r\n\r\n"
+	byebyeNotify = "NOTIFY * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"NT: " + rendererST + "\r\n" +
+		"NTS: ssdp:byebye\r\n" +
+		"USN: " + rendererUSN + "\r\n\r\n"
+	otherSearch = "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n" +
+		"ST: ssdp:all\r\n\r\n"
+)
+
+func (s *SSDPSuite) TestParseMessage(c *C) {
+	svc, alive, err := parseMessage([]byte(searchResponse), net.IPv4(10, 0, 0, 9))
+	c.Assert(err, IsNil)
+	c.Assert(alive, Equals, true)
+	c.Assert(svc, DeepEquals, Service{
+		IP:       net.IPv4(10, 0, 0, 9).To4(),
+		Location: "http://10.0.0.9:1400/xml/device_description.xml",
+		USN:      rendererUSN,
+		ST:       rendererST,
+		Server:   "Linux UPnP/1.0 Sonos/34.16-37101 (ZPS1)",
+	})
+
+	// announcements use NT rather than ST; the IP comes from the location
+	svc, alive, err = parseMessage([]byte(aliveNotify), net.IPv4(10, 0, 0, 99))
+	c.Assert(err, IsNil)
+	c.Assert(alive, Equals, true)
+	c.Assert(svc.ST, Equals, "urn:schemas-upnp-org:device:Basic:1")
+	c.Assert(svc.IP.String(), Equals, "10.0.0.12")
+
+	// services leaving the network have no location; the sender is used
+	svc, alive, err = parseMessage([]byte(byebyeNotify), net.IPv4(10, 0, 0, 9))
+	c.Assert(err, IsNil)
+	c.Assert(alive, Equals, false)
+	c.Assert(svc.IP.String(), Equals, "10.0.0.9")
+
+	// searches from other control points, and garbage, are rejected
+	_, _, err = parseMessage([]byte(otherSearch), net.IPv4(10, 0, 0, 9))
+	c.Assert(err, NotNil)
+	_, _, err = parseMessage([]byte("hello"), net.IPv4(10, 0, 0, 9))
+	c.Assert(err, NotNil)
+}
+
+func (s *SSDPSuite) TestMatches(c *C) {
+	svc := Service{ST: rendererST, USN: rendererUSN, Server: "Linux UPnP/1.0 Sonos/34.16-37101 (ZPS1)"}
+	c.Assert(ServiceDescription{}.Matches(svc), Equals, true)
+	c.Assert(ServiceDescription{ST: rendererST}.Matches(svc), Equals, true)
+	c.Assert(ServiceDescription{ST: "urn:schemas-upnp-org:device:Basic:1"}.Matches(svc), Equals, false)
+	c.Assert(ServiceDescription{ST: rendererST, USNPrefix: "uuid:RINCON_"}.Matches(svc), Equals, true)
+	c.Assert(ServiceDescription{USNPrefix: "uuid:2f402f80"}.Matches(svc), Equals, false)
+	c.Assert(ServiceDescription{ServerContains: "sonos"}.Matches(svc), Equals, true)
+	c.Assert(ServiceDescription{ServerContains: "IpBridge"}.Matches(svc), Equals, false)
+}
+
+func (s *SSDPSuite) TestSearch(c *C) {
+	searcher := NewSearcher()
+	c.Assert(searcher.Search(), IsNil) // no descriptions, no search
+
+	sonosID := searcher.AddDescription(ServiceDescription{ST: rendererST, ServerContains: "Sonos"})
+	rendererID := searcher.AddDescription(ServiceDescription{ST: rendererST})
+	searcher.AddDescription(ServiceDescription{ST: "urn:schemas-upnp-org:device:Basic:1"})
+
+	var searched []string
+	searcher.search = func(targets []string, mx time.Duration) ([]message, error) {
+		searched = targets
+		return []message{
+			{from: net.IPv4(10, 0, 0, 9), data: []byte(searchResponse)},
+			{from: net.IPv4(10, 0, 0, 9), data: []byte(searchResponse)}, // duplicate responses are ignored
+			{from: net.IPv4(10, 0, 0, 20), data: []byte("garbage")},
+		}, nil
+	}
+
+	found := searcher.Search()
+	c.Assert(searched, DeepEquals, []string{"urn:schemas-upnp-org:device:Basic:1", rendererST})
+	c.Assert(len(found), Equals, 1)
+	c.Assert(found[0].Service.USN, Equals, rendererUSN)
+	expectedIDs := []string{sonosID, rendererID}
+	if expectedIDs[0] > expectedIDs[1] {
+		expectedIDs[0], expectedIDs[1] = expectedIDs[1], expectedIDs[0]
+	}
+	c.Assert(found[0].MatchingDescriptionIDs, DeepEquals, expectedIDs)
+
+	// the service is locked until it is unlocked
+	c.Assert(len(searcher.Search()), Equals, 0)
+	searcher.Unlock(found[0].Service)
+	c.Assert(len(searcher.Search()), Equals, 1)
+
+	// announcements are matched in the same way
+	n, ok := searcher.consider(message{from: net.IPv4(10, 0, 0, 12), data: []byte(aliveNotify)})
+	c.Assert(ok, Equals, true)
+	c.Assert(n.Service.Location, Equals, "http://10.0.0.12:49152/description.xml")
+	_, ok = searcher.consider(message{from: net.IPv4(10, 0, 0, 9), data: []byte(byebyeNotify)})
+	c.Assert(ok, Equals, false)
+}
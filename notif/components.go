@@ -5,6 +5,7 @@ import "github.com/upwrd/sift/types"
 // A ComponentNotifier can notify listeners of changes to Components
 type ComponentNotifier interface {
 	PostComponent(id types.ComponentID, comp types.Component, amask ActionsMask)
+	PostComponentChanges(id types.ComponentID, comp types.Component, amask ActionsMask, changes []types.FieldChange)
 }
 
 // A ComponentFilter is used by a listener to select noficiations from specific
@@ -20,6 +21,10 @@ type ComponentNotification struct {
 	ID        types.ComponentID
 	Component types.Component
 	Action    ActionsMask
+
+	// Changes lists the fields which changed within the Component, if they
+	// are known. It is nil for Components which were created or deleted.
+	Changes []types.FieldChange
 }
 
 func (n *Notifier) addComponentListener(nchan chan interface{}, filter ComponentFilter) {
@@ -54,6 +59,12 @@ func (n *Notifier) addComponentListener(nchan chan interface{}, filter Component
 // Component. The specific type of change should by provided in the
 // ActionsMask.
 func (n *Notifier) PostComponent(id types.ComponentID, comp types.Component, amask ActionsMask) {
+	n.PostComponentChanges(id, comp, amask, nil)
+}
+
+// PostComponentChanges is like PostComponent, but also tells listeners which
+// fields changed within the Component (see lib.DiffComponent).
+func (n *Notifier) PostComponentChanges(id types.ComponentID, comp types.Component, amask ActionsMask, changes []types.FieldChange) {
 	nchans := make(map[chan interface{}]struct{}) // A list of channels to notify
 
 	// Get all of the notification channels that match this component & action
@@ -108,6 +119,7 @@ func (n *Notifier) PostComponent(id types.ComponentID, comp types.Component, ama
 		ID:        id,
 		Component: comp,
 		Action:    amask,
+		Changes:   changes,
 	}
 	for nchan := range nchans {
 		if token, ok := n.authTokenByChannel[nchan]; ok {
@@ -99,3 +99,21 @@ func (s *MySuite) TestComponents(c *C) {
 	c.Assert(<-fooOnly, DeepEquals, expected)
 	c.Assert(<-fooUpdatesAndDeletes, DeepEquals, expected)
 }
+
+func (s *MySuite) TestComponentChanges(c *C) {
+	a := auth.New()
+	n := notif.New(a)
+	token := a.Login()
+	fooID := types.ComponentID{DeviceID: 1, Name: "foo"}
+	listener := n.Listen(token, notif.ComponentFilter{ID: fooID})
+
+	light := types.LightEmitter{State: types.LightEmitterState{BrightnessInPercent: 10}}
+	changes := []types.FieldChange{{Field: "State.BrightnessInPercent", Old: uint8(100), New: uint8(10)}}
+	n.PostComponentChanges(fooID, light, notif.Update, changes)
+	c.Assert(<-listener, DeepEquals, notif.ComponentNotification{
+		ID:        fooID,
+		Action:    notif.Update,
+		Component: light,
+		Changes:   changes,
+	})
+}
@@ -0,0 +1,96 @@
+package notif
+
+import "time"
+
+// A DiscoveryNotifier can notify listeners of the progress of service
+// discovery: scans starting and finishing, services matching descriptions,
+// and IPs being locked and unlocked
+type DiscoveryNotifier interface {
+	PostDiscovery(notif DiscoveryNotification)
+}
+
+// DiscoveryType describes what happened in a DiscoveryNotification
+type DiscoveryType string
+
+// Possible discovery types
+const (
+	DiscoveryScanStarted    DiscoveryType = "scan_started"    // a scan, browse or discovery has started
+	DiscoveryScanFinished   DiscoveryType = "scan_finished"   // a scan, browse or discovery has finished; see Stats
+	DiscoveryServiceMatched DiscoveryType = "service_matched" // the service at IP matched the descriptions of Factories
+	DiscoveryIPLocked       DiscoveryType = "ip_locked"       // IP is in use, and will be ignored until it is unlocked
+	DiscoveryIPUnlocked     DiscoveryType = "ip_unlocked"     // IP is no longer in use
+)
+
+// A DiscoveryFilter is used by a listener to select discovery notifications.
+// If Types is empty, notifications of every type are selected. Discovery
+// notifications are frequent, so unlike other notifications they are only
+// sent to listeners with a DiscoveryFilter.
+type DiscoveryFilter struct {
+	Types []DiscoveryType
+}
+
+// A DiscoveryNotification describes progress made in searching for services
+type DiscoveryNotification struct {
+	Type      DiscoveryType
+	Method    string     // how services were searched for, e.g. "scan" or "browse"; empty for IPs locked or unlocked by the Server
+	Time      time.Time  // when it happened
+	IP        string     // for DiscoveryServiceMatched, DiscoveryIPLocked and DiscoveryIPUnlocked; may include a zone
+	Factories []string   // for DiscoveryServiceMatched: the names of the Adapter Factories whose descriptions were matched
+	Stats     *ScanStats // for DiscoveryScanFinished
+}
+
+// ScanStats summarizes a single scan, browse or discovery
+type ScanStats struct {
+	Method          string
+	Started         time.Time
+	Duration        time.Duration
+	IPsChecked      int                         // IPs whose services were checked against the descriptions
+	IPsExcluded     int                         // IPs skipped because they are excluded
+	IPsAlreadyInUse int                         // IPs skipped because they are locked
+	IPsBackedOff    int                         // IPs skipped because they have not responded to recent scans
+	ServicesFound   int                         // IPs which matched at least one description
+	Descriptions    map[string]DescriptionStats // indexed by the name of the Adapter Factory which each description belongs to
+}
+
+// DescriptionStats counts how the IPs checked in a scan compared with a single
+// service description
+type DescriptionStats struct {
+	Matched      int // IPs which matched the description
+	PortsClosed  int // IPs rejected because an expected port was closed
+	ProbesFailed int // IPs rejected because a probe failed
+}
+
+func (n *Notifier) addDiscoveryListener(nchan chan interface{}, filter DiscoveryFilter) {
+	if n == nil {
+		return
+	}
+
+	types := make(map[DiscoveryType]struct{}, len(filter.Types))
+	for _, t := range filter.Types {
+		types[t] = struct{}{}
+	}
+	n.discoveryListeners[nchan] = types
+}
+
+// PostDiscovery will notify listeners with a matching DiscoveryFilter of the
+// provided discovery notification
+func (n *Notifier) PostDiscovery(dnotif DiscoveryNotification) {
+	if n == nil {
+		return
+	}
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	for nchan, types := range n.discoveryListeners {
+		if len(types) > 0 {
+			if _, ok := types[dnotif.Type]; !ok {
+				continue
+			}
+		}
+		if token, ok := n.authTokenByChannel[nchan]; ok {
+			if n.authorizor.Authorize(token, "discovery:-unimplemented-data-type:") {
+				n.doPost(nchan, dnotif)
+			}
+		}
+	}
+}
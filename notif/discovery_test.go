@@ -0,0 +1,36 @@
+package notif_test
+
+import (
+	"github.com/upwrd/sift/auth"
+	"github.com/upwrd/sift/notif"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestDiscovery(c *C) {
+	a := auth.New()
+	n := notif.New(a)
+	token := a.Login()
+
+	// Discovery notifications are only sent to listeners which ask for them
+	everything := n.Listen(token)
+	allDiscovery := n.Listen(token, "discovery")
+	matchesOnly := n.Listen(token, notif.DiscoveryFilter{Types: []notif.DiscoveryType{notif.DiscoveryServiceMatched}})
+
+	started := notif.DiscoveryNotification{Type: notif.DiscoveryScanStarted, Method: "scan"}
+	n.PostDiscovery(started)
+	c.Assert(len(everything), Equals, 0)
+	c.Assert(len(allDiscovery), Equals, 1)
+	c.Assert(len(matchesOnly), Equals, 0)
+	c.Assert(<-allDiscovery, DeepEquals, started)
+
+	matched := notif.DiscoveryNotification{
+		Type:      notif.DiscoveryServiceMatched,
+		Method:    "scan",
+		IP:        "192.168.1.5",
+		Factories: []string{"example"},
+	}
+	n.PostDiscovery(matched)
+	c.Assert(len(everything), Equals, 0)
+	c.Assert(<-allDiscovery, DeepEquals, matched)
+	c.Assert(<-matchesOnly, DeepEquals, matched)
+}
@@ -0,0 +1,91 @@
+package notif
+
+import "github.com/upwrd/sift/types"
+
+// A LocationNotifier can notify listeners of changes to Locations
+type LocationNotifier interface {
+	PostLocation(id types.LocationID, loc types.Location, atype ActionsMask)
+}
+
+// A LocationFilter is used by a listener to select notifications from specific
+// Locations. Nil values are interpreted as "don't care".
+type LocationFilter struct {
+	ID      types.LocationID
+	Actions ActionsMask
+}
+
+// A LocationNotification describes a change to a single Location
+type LocationNotification struct {
+	ID       types.LocationID
+	Location types.Location
+	Action   ActionsMask
+}
+
+func (n *Notifier) addLocationListener(nchan chan interface{}, filter LocationFilter) {
+	if n == nil {
+		return
+	}
+
+	// Add the listener to the most appropriate list, based on values in the filter
+	switch {
+	case filter.ID != 0: // User specified an ID
+		if _, ok := n.locationListenersFilteredByID[filter.ID]; ok {
+			// Listeners already exist for this location; add this new channel to the list
+			n.locationListenersFilteredByID[filter.ID][nchan] = filter.Actions
+		} else {
+			// This is the first listener for this location; create a new map.
+			n.locationListenersFilteredByID[filter.ID] = map[chan interface{}]ActionsMask{nchan: filter.Actions}
+		}
+	default: // User did not specify an ID, so they will listen to all locations
+		n.unfilteredLocationListeners[nchan] = filter.Actions
+	}
+}
+
+// PostLocation will notify all listeners of a change to the provided Location.
+// The specific type of change should by provided in the ActionsMask.
+func (n *Notifier) PostLocation(id types.LocationID, loc types.Location, atype ActionsMask) {
+	nchans := make(map[chan interface{}]struct{}) // A list of channels to notify
+
+	// Get all of the notification channels that match this location & action
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	// Get notification channels listening for locations with matching IDs
+	if filterList, ok := n.locationListenersFilteredByID[id]; ok {
+		for nchan, atypes := range filterList {
+			// atypes == 0 means the filter is listening to all actions
+			// atypes & atype should be nonzero if atypes contains the bit representing atype
+			if atypes == 0 || atypes&atype != 0 {
+				nchans[nchan] = struct{}{}
+			}
+		}
+	}
+
+	// Get notification channels listening for all locations
+	for nchan, atypes := range n.unfilteredLocationListeners {
+		if atypes == 0 || atypes&atype != 0 {
+			nchans[nchan] = struct{}{}
+		}
+	}
+
+	// Get notification channels listening for any-and-all notifications
+	for nchan, atypes := range n.allNotificationListeners {
+		if atypes == 0 || atypes&atype != 0 {
+			nchans[nchan] = struct{}{}
+		}
+	}
+
+	// Post to authorized channels
+	lnotif := LocationNotification{
+		ID:       id,
+		Location: loc,
+		Action:   atype,
+	}
+	for nchan := range nchans {
+		if token, ok := n.authTokenByChannel[nchan]; ok {
+			if n.authorizor.Authorize(token, "locations:-unimplemented-data-type:") {
+				n.doPost(nchan, lnotif)
+			}
+		}
+	}
+}
@@ -41,6 +41,8 @@ type Provider interface {
 type Receiver interface {
 	ComponentNotifier
 	DeviceNotifier
+	LocationNotifier
+	DiscoveryNotifier
 }
 
 // A ProviderReceiver provides methods for listeners to listen for notifications,
@@ -82,6 +84,13 @@ type Notifier struct {
 	componentListenersFilteredByID   map[types.ComponentID]map[chan interface{}]ActionsMask
 	unfilteredComponentListeners     map[chan interface{}]ActionsMask
 
+	// Indices for Locations
+	locationListenersFilteredByID map[types.LocationID]map[chan interface{}]ActionsMask
+	unfilteredLocationListeners   map[chan interface{}]ActionsMask
+
+	// Listeners for discovery, and the event types each selects (all if empty)
+	discoveryListeners map[chan interface{}]map[DiscoveryType]struct{}
+
 	log log.Logger
 }
 
@@ -112,6 +121,11 @@ func New(authorizor auth.Authorizor) *Notifier {
 		componentListenersFilteredByID:   make(map[types.ComponentID]map[chan interface{}]ActionsMask),
 		unfilteredComponentListeners:     make(map[chan interface{}]ActionsMask),
 
+		locationListenersFilteredByID: make(map[types.LocationID]map[chan interface{}]ActionsMask),
+		unfilteredLocationListeners:   make(map[chan interface{}]ActionsMask),
+
+		discoveryListeners: make(map[chan interface{}]map[DiscoveryType]struct{}),
+
 		log: Log.New("obj", "notifier", "id", logext.RandId(8)),
 	}
 }
@@ -147,6 +161,12 @@ func (n *Notifier) Listen(token auth.Token, filters ...interface{}) <-chan inter
 		switch typed := filter.(type) {
 		case ComponentFilter:
 			n.addComponentListener(nChan, typed)
+		case DeviceFilter:
+			n.addDeviceListener(nChan, typed)
+		case LocationFilter:
+			n.addLocationListener(nChan, typed)
+		case DiscoveryFilter:
+			n.addDiscoveryListener(nChan, typed)
 		default:
 			n.log.Warn("unhandled filter type", "filter_type", fmt.Sprintf("%T", filter))
 		}
@@ -180,6 +200,12 @@ func parseStr(str string) interface{} {
 	switch str {
 	case "components":
 		return ComponentFilter{}
+	case "devices":
+		return DeviceFilter{}
+	case "locations":
+		return LocationFilter{}
+	case "discovery":
+		return DiscoveryFilter{}
 	default:
 		return nil
 	}
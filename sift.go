@@ -22,11 +22,15 @@ import (
 	"github.com/upwrd/sift/db"
 	"github.com/upwrd/sift/lib"
 	"github.com/upwrd/sift/logging"
+	"github.com/upwrd/sift/network"
+	"github.com/upwrd/sift/network/ble"
 	"github.com/upwrd/sift/network/ipv4"
+	"github.com/upwrd/sift/network/ssdp"
 	"github.com/upwrd/sift/notif"
 	"github.com/upwrd/sift/types"
 	log "gopkg.in/inconshreveable/log15.v2"
 	logext "gopkg.in/inconshreveable/log15.v2/ext"
+	"net"
 	"os"
 	"os/signal"
 	"sync"
@@ -38,7 +42,10 @@ import (
 const DefaultDBFilepath = "sift.db"
 
 const (
-	ipv4ScanFrequency           = 5 * time.Second
+	ipv4SweepPeriod             = time.Minute
+	staticServiceFrequency      = 5 * time.Second
+	ssdpSearchFrequency         = 30 * time.Second
+	bleDiscoveryFrequency       = 30 * time.Second
 	adapterTimeout              = 15 * time.Second
 	updateChanWidth             = 1000
 	numAdapterUpdateListeners   = 5
@@ -60,12 +67,12 @@ func SetLogLevel(lvlstr string) { logging.SetLevelStr(lvlstr) }
 
 // Server maintains the state of SIFT objects and provides methods for
 // listening to, retrieving, and manipulating them.
-// You should always initialize Servers with a call to NewServer()
+// You should always initialize Servers with a call to NewServer() or
+// NewServerWithStore()
 type Server struct {
-	// SiftDB provides direct access to the underlying sqlite database through
-	// Jason Moiron's wonderful sqlx API (see: github.com/jmoiron/sqlx)
-	*db.SiftDB
-	dbpath string
+	// Store holds the state of SIFT: Devices, Components, Locations, and
+	// Adapter credentials and configuration
+	db.Store
 
 	auth.Authorizor // Provides login/authorize methods
 	notif.Provider  // Provides notification pub/sub methods
@@ -73,12 +80,23 @@ type Server struct {
 
 	// Factories, adapters and their updates
 	factoriesByDescriptionID map[string]adapter.Factory
-	adapters                 map[string]adapter.Adapter
+	factoriesByName          map[string]adapter.Factory
+	flock                    sync.RWMutex // protects factoriesByDescriptionID and factoriesByName
+	adapters                 map[string]*supervisedAdapter
+	alock                    sync.RWMutex // protects adapters
 	updatesFromAdapters      chan updatePackage
 	prioritizer              lib.IPrioritizer
+	canonicalIDs             map[types.ExternalDeviceID]types.ExternalDeviceID // see canonicalExternalDeviceID
+	canonicalGen             int                                               // incremented whenever canonicalIDs is emptied
+	clock                    sync.RWMutex                                      // protects canonicalIDs and canonicalGen
 
 	// Scanners
-	ipv4Scan ipv4.IContinuousScanner
+	ipv4Scan     ipv4.IContinuousScanner
+	ssdpSearch   ssdp.IContinuousSearcher
+	bleDiscovery ble.IContinuousDiscoverer
+
+	// Signalled when a static service is registered (see RegisterStaticService)
+	staticServicesChanged chan struct{}
 
 	// Others
 	stop                    chan struct{}
@@ -88,35 +106,55 @@ type Server struct {
 }
 
 // NewServer constructs a new SIFT Server, using the SIFT database at the
-// provided path (or creating a new one it does not exist). Be sure to start
-// the Server with Serve()
+// provided path (or creating a new one it does not exist). If the path is
+// ":memory:", the Server keeps its state in memory (see db.MemoryStore). Be
+// sure to start the Server with Serve()
 func NewServer(dbpath string) (*Server, error) {
+	if dbpath == ":memory:" {
+		return NewServerWithStore(db.NewMemoryStore()), nil
+	}
 	newDB, err := db.Open(dbpath)
 	if err != nil {
 		return nil, fmt.Errorf("could not open sift db: %v", err)
 	}
+	return NewServerWithStore(newDB), nil
+}
+
+// NewServerWithStore constructs a new SIFT Server which keeps its state in the
+// provided Store, such as a SiftDB opened with db.OpenPostgres. The Store is
+// closed when the Server stops. Be sure to start the Server with Serve()
+func NewServerWithStore(store db.Store) *Server {
 	authorizor := auth.New()
 	notifier := notif.New(authorizor)
 
-	return &Server{
-		SiftDB: newDB,
-		dbpath: dbpath,
+	prioritizer := lib.NewPrioritizer(nil) // uses default sorting
+	s := &Server{
+		Store: store,
 
 		Authorizor: authorizor,
 		Provider:   notifier,
 		Receiver:   notifier,
 
 		factoriesByDescriptionID: make(map[string]adapter.Factory),
-		adapters:                 make(map[string]adapter.Adapter),
+		factoriesByName:          make(map[string]adapter.Factory),
+		adapters:                 make(map[string]*supervisedAdapter),
 		updatesFromAdapters:      make(chan updatePackage, updateChanWidth),
-		prioritizer:              lib.NewPrioritizer(nil), // uses default sorting
+		prioritizer:              prioritizer,
+		canonicalIDs:             make(map[types.ExternalDeviceID]types.ExternalDeviceID),
+
+		ipv4Scan:     ipv4.NewContinousScanner(ipv4SweepPeriod),
+		ssdpSearch:   ssdp.NewContinuousSearcher(ssdpSearchFrequency),
+		bleDiscovery: ble.NewContinuousDiscoverer(nil, bleDiscoveryFrequency), // see SetBLETransport
 
-		ipv4Scan: ipv4.NewContinousScanner(ipv4ScanFrequency),
+		staticServicesChanged: make(chan struct{}, 1),
 
 		stop:    make(chan struct{}),
 		stopped: make(chan struct{}),
 		log:     Log.New("obj", "server", "id", logext.RandId(8)),
-	}, nil
+	}
+	prioritizer.SetResolver(s.canonicalExternalDeviceID)
+	s.ipv4Scan.SetEventHandler(s.postScanEvent)
+	return s
 }
 
 // Serve starts running the SIFT server. Most of the time you'll want to call
@@ -125,6 +163,8 @@ func (s *Server) Serve() {
 	s.stopOnExitSignal() // capture ^c and SIGTERM, and close gracefully (see: http://stackoverflow.com/a/18158859/3088592)
 	supervisor := suture.NewSimple("sift server")
 	supervisor.Add(s.ipv4Scan)
+	supervisor.Add(s.ssdpSearch)
+	supervisor.Add(s.bleDiscovery)
 	go supervisor.ServeBackground()
 
 	// Listen for updates from adapters and consider them.
@@ -155,6 +195,12 @@ func (s *Server) Serve() {
 		}()
 	}
 
+	// Hand registered static services to their factories now, and again
+	// whenever they are no longer being handled
+	s.handleStaticServices()
+	staticServiceTicker := time.NewTicker(staticServiceFrequency)
+	defer staticServiceTicker.Stop()
+
 	// Wait for less-frequent signals
 	for {
 		select {
@@ -175,7 +221,7 @@ func (s *Server) Serve() {
 			//				s.log.Warn("timed out waiting for workers to stop, closing instead")
 			//			case <-workersStopped:
 			//			}
-			if err := s.SiftDB.Close(); err != nil {
+			if err := s.Store.Close(); err != nil {
 				s.log.Crit("could not gracefully close sift database", "err", err)
 			}
 			s.stopped <- struct{}{}
@@ -183,6 +229,19 @@ func (s *Server) Serve() {
 		case ipv4Service := <-s.ipv4Scan.FoundServices():
 			// new IPv4 service found
 			go s.tryHandlingIPv4Service(ipv4Service)
+		case ssdpService := <-s.ssdpSearch.FoundServices():
+			// new SSDP service found
+			go s.tryHandlingSSDPService(ssdpService)
+		case bleService := <-s.bleDiscovery.FoundServices():
+			// new Bluetooth LE peripheral found
+			go s.tryHandlingBLEService(bleService)
+		case event := <-s.ipv4Scan.InterfaceEvents():
+			// a local network interface has changed
+			s.handleInterfaceEvent(event)
+		case <-staticServiceTicker.C:
+			s.handleStaticServices()
+		case <-s.staticServicesChanged:
+			s.handleStaticServices()
 		}
 	}
 }
@@ -211,8 +270,38 @@ type updatePackage struct {
 // AddAdapterFactory adds an AdapterFactory to the Server. Once added, the
 // Server will begin searching for services matching the AdapterFactory's
 // description. If any are found, the Server will use the AdapterFactory to
-// create an Adapter to handle the sevice.
+// create an Adapter to handle the sevice. If the AdapterFactory accepts
+// configuration (see adapter.ConfigurableFactory), it is first given the
+// configuration stored for its name.
 func (s *Server) AddAdapterFactory(factory adapter.Factory) (string, error) {
+	// reserve the factory's name, so that it can only be added once
+	s.flock.Lock()
+	if _, dup := s.factoriesByName[factory.Name()]; dup {
+		s.flock.Unlock()
+		return "", fmt.Errorf("an adapter factory named %v has already been added", factory.Name())
+	}
+	s.factoriesByName[factory.Name()] = factory
+	s.flock.Unlock()
+	id, err := s.addDescription(factory)
+	if err != nil {
+		s.flock.Lock()
+		delete(s.factoriesByName, factory.Name())
+		s.flock.Unlock()
+		return "", err
+	}
+	s.log.Info("added adapter factory", "name", factory.Name(), "id", id)
+	return id, nil
+}
+
+// addDescription configures the factory, then adds its description to the
+// matching scanner. Returns the ID of the description.
+func (s *Server) addDescription(factory adapter.Factory) (string, error) {
+	if configurable, ok := factory.(adapter.ConfigurableFactory); ok {
+		if err := s.configureFactory(configurable); err != nil {
+			return "", err
+		}
+	}
+
 	var id string
 	switch typed := factory.(type) {
 	default:
@@ -220,12 +309,37 @@ func (s *Server) AddAdapterFactory(factory adapter.Factory) (string, error) {
 		return "", fmt.Errorf("unhandled adapter factory type: %T", factory)
 	case adapter.IPv4Factory:
 		id = s.ipv4Scan.AddDescription(typed.GetIPv4Description())
-		s.factoriesByDescriptionID[id] = factory
+	case adapter.SSDPFactory:
+		id = s.ssdpSearch.AddDescription(typed.GetSSDPDescription())
+	case adapter.BLEFactory:
+		id = s.bleDiscovery.AddDescription(typed.GetBLEDescription())
+	}
+	s.flock.Lock()
+	s.factoriesByDescriptionID[id] = factory
+	s.flock.Unlock()
+	if _, ok := factory.(adapter.IPv4Factory); ok {
+		s.ipv4Scan.Rescan() // look for the new factory's services now
 	}
-	s.log.Info("added adapter factory", "name", factory.Name(), "id", id)
 	return id, nil
 }
 
+// factoryByDescriptionID returns the factory which the description with the
+// given ID belongs to
+func (s *Server) factoryByDescriptionID(id string) (adapter.Factory, bool) {
+	s.flock.RLock()
+	defer s.flock.RUnlock()
+	factory, ok := s.factoriesByDescriptionID[id]
+	return factory, ok
+}
+
+// factoryByName returns the added factory with the given name
+func (s *Server) factoryByName(name string) (adapter.Factory, bool) {
+	s.flock.RLock()
+	defer s.flock.RUnlock()
+	factory, ok := s.factoriesByName[name]
+	return factory, ok
+}
+
 var defaultAdapterFactories = []func() adapter.Factory{
 	func() adapter.Factory { return example.NewFactory(55442) }, // SIFT example server
 	func() adapter.Factory { return cbtcp.NewFactory() },        // Connected by TCP
@@ -243,16 +357,69 @@ func (s *Server) AddDefaults() error {
 	return nil
 }
 
-func (s *Server) addAdapter(adapter adapter.Adapter) string {
+// SetIPv4ScannerOptions changes which addresses the Server scans for IPv4
+// services, and how quickly (see ipv4.ScannerOptions)
+func (s *Server) SetIPv4ScannerOptions(opts ipv4.ScannerOptions) error {
+	return s.ipv4Scan.SetOptions(opts)
+}
+
+// SetIPv4ScanSchedule changes how often the Server sweeps for IPv4 services,
+// and how often it re-probes the IPs of lost services (see
+// ipv4.ScanSchedule)
+func (s *Server) SetIPv4ScanSchedule(sched ipv4.ScanSchedule) error {
+	return s.ipv4Scan.SetSchedule(sched)
+}
+
+// SetBLETransport sets the Transport through which the Server listens for
+// Bluetooth LE advertisements, and through which BLE Adapters connect to their
+// peripherals. Until a Transport is set, BLE peripherals are not discovered.
+func (s *Server) SetBLETransport(t ble.Transport) {
+	s.bleDiscovery.SetTransport(t)
+}
+
+// Rescan asks the Server to sweep for IPv4 services now, rather than waiting
+// for the next scheduled sweep. The sweep checks every address, including
+// those beyond the per-scan limit and those which have not responded to
+// recent scans (see ipv4.ContinuousScanner.Rescan).
+func (s *Server) Rescan() {
+	s.log.Debug("rescan requested")
+	s.ipv4Scan.Rescan()
+}
+
+// A supervisedAdapter is an Adapter handling the service at ip. Closing
+// release tells its supervisor to stop handling the service.
+type supervisedAdapter struct {
+	adapter.Adapter
+	addr     net.IPAddr // the address of the service; IP is nil for services not reached over IP
+	release  chan struct{}
+	released bool
+}
+
+func (s *Server) addAdapter(adapter adapter.Adapter, addr net.IPAddr) (string, *supervisedAdapter) {
 	id := uuid.New()
-	s.adapters[id] = adapter
-	return id
+	sa := &supervisedAdapter{Adapter: adapter, addr: addr, release: make(chan struct{})}
+	s.alock.Lock()
+	defer s.alock.Unlock()
+	s.adapters[id] = sa
+	return id, sa
 }
 
 func (s *Server) removeAdapter(id string) {
+	s.alock.Lock()
+	defer s.alock.Unlock()
 	delete(s.adapters, id)
 }
 
+func (s *Server) getAdapter(id string) (adapter.Adapter, bool) {
+	s.alock.RLock()
+	defer s.alock.RUnlock()
+	sa, ok := s.adapters[id]
+	if !ok {
+		return nil, false
+	}
+	return sa.Adapter, true
+}
+
 //
 // Handling updates from adapters
 //
@@ -270,7 +437,7 @@ func (s *Server) handleUpdate(update interface{}) {
 func (s *Server) handleDeviceUpdated(update lib.DeviceUpdated) {
 	s.log.Debug("handling device update", "update", update)
 	// upsert the updated Device, and get the changes
-	resp, err := s.SiftDB.UpsertDevice(update.ID, update.NewState)
+	resp, err := s.Store.UpsertDevice(update.ID, update.NewState)
 	if err != nil {
 		s.log.Warn("could not upsert device indicated in update", "err", err, "update", update)
 		panic(fmt.Sprintf("could not upsert device indicated in update: %v", err))
@@ -279,7 +446,7 @@ func (s *Server) handleDeviceUpdated(update lib.DeviceUpdated) {
 	// notify listeners of changes
 	for name, comp := range resp.UpsertedComponents {
 		id := types.ComponentID{Name: name, DeviceID: resp.DeviceID}
-		s.PostComponent(id, comp, notif.Update)
+		s.PostComponentChanges(id, comp, notif.Update, resp.ComponentChanges[name])
 	}
 	for name, comp := range resp.DeletedComponents {
 		id := types.ComponentID{Name: name, DeviceID: resp.DeviceID}
@@ -302,9 +469,21 @@ func (s *Server) EnactIntent(target types.ComponentID, intent types.Intent) erro
 	}
 	s.log.Debug("submitting intent", "target", target, "intent", intent)
 
+	// Check that the intent makes sense for the target component. Specs may
+	// not be known for every make and model, in which case the intent is
+	// validated against the component alone.
+	comp, err := s.Store.GetComponent(target, db.ExpandSpecs)
+	if err != nil {
+		return fmt.Errorf("could not get component %v: %v", target, err)
+	}
+	if err := types.ValidateIntent(intent, comp); err != nil {
+		s.log.Debug("intent failed validation", "target", target, "intent", intent, "err", err)
+		return err // *types.IntentValidationError
+	}
+
 	// Translate the internal intent (using types.ComponentID) into an external
 	// intent (using types.ExternalComponentID)
-	externalDevID, err := s.SiftDB.GetExternalDeviceID(target.DeviceID)
+	externalDevID, err := s.Store.GetExternalDeviceID(target.DeviceID)
 	if err != nil {
 		return fmt.Errorf("could not get external ID for device %v: %v", target.DeviceID, err)
 	}
@@ -312,12 +491,14 @@ func (s *Server) EnactIntent(target types.ComponentID, intent types.Intent) erro
 		return fmt.Errorf("no active adapters are currently handling component %v", target)
 	}
 
-	// Determine the highest-priority Adapter currently serving the connected Device
-	adapterID := s.prioritizer.GetHighestPriorityAdapterForDevice(externalDevID)
-	adapter, ok := s.adapters[adapterID]
+	// Determine the highest-priority Adapter currently serving the connected
+	// Device, and the external ID by which that Adapter knows it
+	adapterID, reportedDevID := s.prioritizer.GetHighestPriorityAdapter(externalDevID)
+	adapter, ok := s.getAdapter(adapterID)
 	if !ok {
 		return fmt.Errorf("could not find adapter matching highest priority ID '%v': %v", adapterID, err)
 	}
+	externalDevID = reportedDevID
 
 	// Pass the external intent to the Adapter
 	externalTarget := types.ExternalComponentID{Device: externalDevID, Name: target.Name}
@@ -328,86 +509,163 @@ func (s *Server) EnactIntent(target types.ComponentID, intent types.Intent) erro
 //IPv4
 
 // tryHandlingIPv4Service will walk through each of the provided
+// descriptions, giving the service to each matching factory's Adapter in
+// turn until one handles it
 func (s *Server) tryHandlingIPv4Service(n ipv4.ServiceFoundNotification) {
 	for _, id := range n.MatchingDescriptionIDs {
 		// Find the factory matching the id
-		if factory, ok := s.factoriesByDescriptionID[id]; ok {
+		if factory, ok := s.factoryByDescriptionID(id); ok {
 			// ...it should be an IPv4 Factory
 			if asIPv4Factory, ok := factory.(adapter.IPv4Factory); !ok {
 				s.log.Error("expected an IPv4 factory, got something different!", "got", fmt.Sprintf("%T", factory))
 			} else {
 				// build a context for the given IP
-				context, statusChan := ipv4.BuildContext(n.IP, s.dbpath, factory.Name())
+				config, err := s.getAdapterConfig(factory)
+				if err != nil {
+					s.log.Warn("could not get adapter config; using defaults", "factory", factory.Name(), "err", err)
+				}
+				context, statusChan := ipv4.BuildContext(n.IP, s.Store, factory.Name(), config)
+				context.Zone = n.Zone
 
 				// build a new adapter from the factory, which will attempt to handle the context
-				adapter := asIPv4Factory.HandleIPv4(context)
-				adapterID := s.addAdapter(adapter)
-
-				// keep listening to the adapter until it fails or times out
-				adapterDied := make(chan bool, 10)
-				go func() {
-					for update := range adapter.UpdateChan() {
-						// pass the update and adapter to the main channel
-						pkg := updatePackage{
-							AdapterDescription: lib.AdapterDescription{
-								Type: lib.ControllerTypeIPv4,
-								ID:   adapterID,
-							},
-							update: update,
-						}
-						// This passes the update to be eval'd by the server
-						s.updatesFromAdapters <- pkg
-						// This signals that the Adapter should be allowed to
-						// continue handling the context (NOTE: it should also be
-						// heartbeating)
-						adapterDied <- false
-					}
-					adapterDied <- true
-				}()
-
-				timer := time.NewTimer(adapterTimeout)
-			waitUntilFailure:
-				for {
-					timer.Reset(adapterTimeout)
-
-					select {
-					case <-timer.C:
-						s.log.Debug("adapter timed out")
-
-						break waitUntilFailure // timed out
-					case itDied := <-adapterDied:
-						// if it died, break. if it didn't, keep going
-						if itDied {
-							s.log.Debug("adapter died")
-							break waitUntilFailure
-						}
-					case status, more := <-statusChan:
-						if !more {
-							s.log.Debug("adapter status channel closed")
-							break waitUntilFailure
-						}
-						// The adapter can send messages through the context.Status channel.
-						// If the value is ipv4.DriverStatusHandling, it is treated as a
-						// keep-alive heartbeat message. Any other status indicates that
-						// the adapter is no longer handling the service.
-						if status != ipv4.AdapterStatusHandling {
-							s.log.Debug("adapter returned non-handling status", "status", status)
-							break waitUntilFailure
-						}
-					}
-				}
+				s.superviseAdapter(asIPv4Factory.HandleIPv4(context), context.Addr(), lib.ControllerTypeIPv4, statusChan)
 
 				// If we've reached this point, the adapter is done.
 				// Kill it, and move on to the next viable adapter
 				ipv4.KillContext(context)
-				s.removeAdapter(adapterID)
 			}
 		}
 	}
 	// If we've reached this point, all viable adapters (if any) have failed.
 	// Release the IP; if it's still there, it will be picked up on the next
 	// scan and tried again.
-	s.ipv4Scan.Unlock(n.IP)
+	s.ipv4Scan.Unlock(net.IPAddr{IP: n.IP, Zone: n.Zone})
+}
+
+//SSDP
+
+// tryHandlingSSDPService gives the service to each matching factory's
+// Adapter in turn until one handles it
+func (s *Server) tryHandlingSSDPService(n ssdp.ServiceFoundNotification) {
+	for _, id := range n.MatchingDescriptionIDs {
+		factory, ok := s.factoryByDescriptionID(id)
+		if !ok {
+			continue
+		}
+		asSSDPFactory, ok := factory.(adapter.SSDPFactory)
+		if !ok {
+			s.log.Error("expected an SSDP factory, got something different!", "got", fmt.Sprintf("%T", factory))
+			continue
+		}
+		config, err := s.getAdapterConfig(factory)
+		if err != nil {
+			s.log.Warn("could not get adapter config; using defaults", "factory", factory.Name(), "err", err)
+		}
+		context, statusChan := ssdp.BuildContext(n.Service, s.Store, factory.Name(), config)
+		s.superviseAdapter(asSSDPFactory.HandleSSDP(context), net.IPAddr{IP: n.Service.IP}, lib.ControllerTypeIPv4, statusChan)
+		ssdp.KillContext(context)
+	}
+	// All viable adapters (if any) have failed. Release the service; if it's
+	// still there, it will be found again.
+	s.ssdpSearch.Unlock(n.Service)
+}
+
+//BLE
+
+// tryHandlingBLEService gives the peripheral to each matching factory's
+// Adapter in turn until one handles it. Updates from the Adapters are
+// prioritized by their factory's controller type.
+func (s *Server) tryHandlingBLEService(n ble.ServiceFoundNotification) {
+	for _, id := range n.MatchingDescriptionIDs {
+		factory, ok := s.factoryByDescriptionID(id)
+		if !ok {
+			continue
+		}
+		asBLEFactory, ok := factory.(adapter.BLEFactory)
+		if !ok {
+			s.log.Error("expected a BLE factory, got something different!", "got", fmt.Sprintf("%T", factory))
+			continue
+		}
+		config, err := s.getAdapterConfig(factory)
+		if err != nil {
+			s.log.Warn("could not get adapter config; using defaults", "factory", factory.Name(), "err", err)
+		}
+		context, statusChan := ble.BuildContext(n.Peripheral, s.bleDiscovery.Transport(), s.Store, factory.Name(), config)
+		s.superviseAdapter(asBLEFactory.HandleBLE(context), net.IPAddr{}, asBLEFactory.ControllerType(), statusChan)
+		ble.KillContext(context)
+	}
+	// All viable adapters (if any) have failed. Release the peripheral; if
+	// it's still there, it will be found again.
+	s.bleDiscovery.Unlock(n.Peripheral)
+}
+
+// superviseAdapter passes updates from the Adapter handling the service at
+// addr to the Server until it fails, times out, reports (through statusChan)
+// that it is no longer handling its service, or is released because the
+// service's network is no longer reachable (see releaseAdapters). The updates
+// are prioritized as coming from a controller of the given type. addr is empty
+// for services which are not reached over IP.
+func (s *Server) superviseAdapter(adapter adapter.Adapter, addr net.IPAddr, controller lib.ControllerType, statusChan <-chan network.AdapterStatus) {
+	if adapter == nil {
+		return
+	}
+	adapterID, supervised := s.addAdapter(adapter, addr)
+	defer s.removeAdapter(adapterID)
+
+	// keep listening to the adapter until it fails or times out
+	adapterDied := make(chan bool, 10)
+	go func() {
+		for update := range adapter.UpdateChan() {
+			// pass the update and adapter to the main channel
+			pkg := updatePackage{
+				AdapterDescription: lib.AdapterDescription{
+					Type: controller,
+					ID:   adapterID,
+				},
+				update: update,
+			}
+			// This passes the update to be eval'd by the server
+			s.updatesFromAdapters <- pkg
+			// This signals that the Adapter should be allowed to
+			// continue handling the context (NOTE: it should also be
+			// heartbeating)
+			adapterDied <- false
+		}
+		adapterDied <- true
+	}()
+
+	timer := time.NewTimer(adapterTimeout)
+	for {
+		timer.Reset(adapterTimeout)
+
+		select {
+		case <-timer.C:
+			s.log.Debug("adapter timed out")
+			return // timed out
+		case <-supervised.release:
+			s.log.Debug("adapter released", "addr", addr.String())
+			return
+		case itDied := <-adapterDied:
+			// if it died, return. if it didn't, keep going
+			if itDied {
+				s.log.Debug("adapter died")
+				return
+			}
+		case status, more := <-statusChan:
+			if !more {
+				s.log.Debug("adapter status channel closed")
+				return
+			}
+			// The adapter can send messages through the context.Status channel.
+			// If the value is network.AdapterStatusHandling, it is treated as a
+			// keep-alive heartbeat message. Any other status indicates that
+			// the adapter is no longer handling the service.
+			if status != network.AdapterStatusHandling {
+				s.log.Debug("adapter returned non-handling status", "status", status)
+				return
+			}
+		}
+	}
 }
 
 func (s *Server) sanityCheck() error {
@@ -3,8 +3,14 @@ package sift_test
 import (
 	"fmt"
 	"github.com/upwrd/sift"
+	"github.com/upwrd/sift/adapter"
+	cbtcp "github.com/upwrd/sift/adapter/connectedbytcp"
 	"github.com/upwrd/sift/adapter/example"
 	"github.com/upwrd/sift/db"
+	"github.com/upwrd/sift/lib"
+	"github.com/upwrd/sift/network/ble"
+	"github.com/upwrd/sift/network/ipv4"
+	"github.com/upwrd/sift/network/ssdp"
 	"github.com/upwrd/sift/notif"
 	"github.com/upwrd/sift/types"
 	. "gopkg.in/check.v1"
@@ -140,6 +146,100 @@ func (s *SiftSuite) TestServerNetwork(c *C) {
 	//	c.Assert(err, IsNil)
 }
 
+func (s *SiftSuite) TestEnactIntentValidation(c *C) {
+	siftServ, err := sift.NewServer("")
+	c.Assert(err, IsNil)
+	defer siftServ.Close()
+
+	// Store a light directly; no adapter is needed to validate intents
+	resp, err := siftServ.UpsertDevice(types.ExternalDeviceID{Manufacturer: "example", ID: "1"}, types.Device{
+		Name: "lamp",
+		Components: map[string]types.Component{
+			"light": types.LightEmitter{
+				BaseComponent: types.BaseComponent{Make: "example", Model: "light_emitter_1"},
+			},
+		},
+	})
+	c.Assert(err, IsNil)
+	target := types.ComponentID{DeviceID: resp.DeviceID, Name: "light"}
+
+	// An intent for a different type of component should be rejected
+	err = siftServ.EnactIntent(target, types.SetMediaPlayerIntent{PlayState: types.MediaPlayerStatePlaying})
+	verr, ok := err.(*types.IntentValidationError)
+	c.Assert(ok, Equals, true, Commentf("err: %v", err))
+	c.Assert(verr.Reason, Equals, types.ValidationReasonIncompatible)
+
+	// So should a brightness that the light can't do
+	err = siftServ.EnactIntent(target, types.SetLightEmitterIntent{BrightnessInPercent: 200})
+	verr, ok = err.(*types.IntentValidationError)
+	c.Assert(ok, Equals, true, Commentf("err: %v", err))
+	c.Assert(verr.Reason, Equals, types.ValidationReasonOutOfRange)
+	c.Assert(verr.Field, Equals, "BrightnessInPercent")
+
+	// A valid intent passes validation, but fails because no adapter is
+	// handling the light
+	err = siftServ.EnactIntent(target, types.SetLightEmitterIntent{BrightnessInPercent: 50})
+	c.Assert(err, NotNil)
+	_, ok = err.(*types.IntentValidationError)
+	c.Assert(ok, Equals, false)
+
+	// Unknown components can't be validated
+	err = siftServ.EnactIntent(types.ComponentID{DeviceID: resp.DeviceID, Name: "nope"}, types.SetLightEmitterIntent{})
+	c.Assert(err, ErrorMatches, "could not get component.*")
+}
+
+func (s *SiftSuite) TestLocationNotifications(c *C) {
+	siftServ, err := sift.NewServer("")
+	c.Assert(err, IsNil)
+	defer siftServ.Close()
+
+	token := siftServ.Login()
+	locations := siftServ.Listen(token, notif.LocationFilter{})
+	devices := siftServ.Listen(token, notif.DeviceFilter{Actions: notif.Moved})
+
+	resp, err := siftServ.UpsertDevice(types.ExternalDeviceID{Manufacturer: "example", ID: "1"}, types.Device{Name: "lamp"})
+	c.Assert(err, IsNil)
+
+	floor, err := siftServ.CreateLocation("first floor", 0)
+	c.Assert(err, IsNil)
+	c.Assert(<-locations, DeepEquals, notif.LocationNotification{
+		ID:       floor,
+		Location: types.Location{Name: "first floor"},
+		Action:   notif.Create,
+	})
+	den, err := siftServ.CreateLocation("den", floor)
+	c.Assert(err, IsNil)
+	<-locations
+
+	c.Assert(siftServ.RenameLocation(den, "living room"), IsNil)
+	c.Assert(<-locations, DeepEquals, notif.LocationNotification{
+		ID:       den,
+		Location: types.Location{Name: "living room", ParentID: floor},
+		Action:   notif.Update,
+	})
+
+	c.Assert(siftServ.SetDeviceLocation(resp.DeviceID, den), IsNil)
+	devNotif, ok := (<-devices).(notif.DeviceNotification)
+	c.Assert(ok, Equals, true)
+	c.Assert(devNotif.ID, Equals, resp.DeviceID)
+	c.Assert(devNotif.Action, Equals, notif.Moved)
+
+	// Deleting the room moves the device to the floor
+	_, err = siftServ.DeleteLocation(den)
+	c.Assert(err, IsNil)
+	c.Assert(<-locations, DeepEquals, notif.LocationNotification{
+		ID:       den,
+		Location: types.Location{Name: "living room", ParentID: floor},
+		Action:   notif.Delete,
+	})
+	devNotif, ok = (<-devices).(notif.DeviceNotification)
+	c.Assert(ok, Equals, true)
+	c.Assert(devNotif.ID, Equals, resp.DeviceID)
+	locID, err := siftServ.GetDeviceLocation(resp.DeviceID)
+	c.Assert(err, IsNil)
+	c.Assert(locID, Equals, floor)
+}
+
 func Example() {
 	// start a new SIFT server
 	serv, _ := sift.NewServer("") // "" indicates a random, temporary file
@@ -181,3 +281,446 @@ func Example() {
 		fmt.Printf("   component %v: %+v", id, component)
 	}
 }
+
+func (s *SiftSuite) TestMemoryServer(c *C) {
+	siftServ, err := sift.NewServer(":memory:")
+	c.Assert(err, IsNil)
+	defer siftServ.Close()
+
+	_, isMemory := siftServ.Store.(*db.MemoryStore)
+	c.Assert(isMemory, Equals, true)
+	resp, err := siftServ.UpsertDevice(types.ExternalDeviceID{Manufacturer: "example", ID: "1"}, types.Device{Name: "lamp", IsOnline: true})
+	c.Assert(err, IsNil)
+	devs, err := siftServ.GetDevices(db.ExpandNone)
+	c.Assert(err, IsNil)
+	c.Assert(devs, DeepEquals, map[types.DeviceID]types.Device{
+		resp.DeviceID: {Name: "lamp", IsOnline: true, Components: map[string]types.Component{}},
+	})
+}
+
+func (s *SiftSuite) TestAdapterConfig(c *C) {
+	siftServ, err := sift.NewServer(":memory:")
+	c.Assert(err, IsNil)
+	defer siftServ.Close()
+
+	// factories must be added before they can be configured
+	c.Assert(siftServ.SetAdapterConfig("SIFT example", example.ConfigPort, "8080"), NotNil)
+	factory := example.NewFactory(12345)
+	_, err = siftServ.AddAdapterFactory(factory)
+	c.Assert(err, IsNil)
+
+	fields, err := siftServ.AdapterConfigFields("SIFT example")
+	c.Assert(err, IsNil)
+	c.Assert(len(fields), Equals, 1)
+	c.Assert(fields[0].Default, Equals, "12345")
+
+	// values are checked against the field type and by the factory
+	c.Assert(siftServ.SetAdapterConfig("SIFT example", example.ConfigPort, "http"), NotNil)
+	c.Assert(siftServ.SetAdapterConfig("SIFT example", example.ConfigPort, "70000"), NotNil)
+	c.Assert(siftServ.SetAdapterConfig("SIFT example", "host", "example.local"), NotNil)
+	c.Assert(factory.GetIPv4Description().OpenPorts, DeepEquals, []uint16{12345})
+
+	c.Assert(siftServ.SetAdapterConfig("SIFT example", example.ConfigPort, "8080"), IsNil)
+	c.Assert(factory.GetIPv4Description().OpenPorts, DeepEquals, []uint16{8080})
+	config, err := siftServ.GetAdapterConfig("SIFT example")
+	c.Assert(err, IsNil)
+	c.Assert(config, DeepEquals, map[string]string{example.ConfigPort: "8080"})
+
+	// deleting a value restores the default
+	c.Assert(siftServ.DeleteAdapterConfig("SIFT example", example.ConfigPort), IsNil)
+	c.Assert(factory.GetIPv4Description().OpenPorts, DeepEquals, []uint16{12345})
+	c.Assert(siftServ.DeleteAdapterConfig("SIFT example", example.ConfigPort), NotNil)
+
+	// stored config is applied when a factory is added
+	other, err := sift.NewServer(":memory:")
+	c.Assert(err, IsNil)
+	defer other.Close()
+	c.Assert(other.Store.SetAdapterConfig("SIFT example", example.ConfigPort, "9000"), IsNil)
+	factory = example.NewFactory(12345)
+	_, err = other.AddAdapterFactory(factory)
+	c.Assert(err, IsNil)
+	c.Assert(factory.GetIPv4Description().OpenPorts, DeepEquals, []uint16{9000})
+}
+
+func (s *SiftSuite) TestSecretAdapterConfig(c *C) {
+	siftServ, err := sift.NewServer(":memory:")
+	c.Assert(err, IsNil)
+	defer siftServ.Close()
+	_, err = siftServ.AddAdapterFactory(cbtcp.NewFactory())
+	c.Assert(err, IsNil)
+
+	c.Assert(siftServ.SetAdapterConfig("Connected by TCP", cbtcp.ConfigPassword, "hunter2"), NotNil) // no email
+	c.Assert(siftServ.SetAdapterConfig("Connected by TCP", cbtcp.ConfigEmail, "me@example.com"), IsNil)
+	c.Assert(siftServ.SetAdapterConfig("Connected by TCP", cbtcp.ConfigPassword, "hunter2"), IsNil)
+
+	// secret values are kept with the adapter's credentials
+	config, err := siftServ.GetAdapterConfig("Connected by TCP")
+	c.Assert(err, IsNil)
+	c.Assert(config, DeepEquals, map[string]string{cbtcp.ConfigEmail: "me@example.com"})
+	keys, err := siftServ.ListAdapterCredentials("Connected by TCP")
+	c.Assert(err, IsNil)
+	c.Assert(keys, DeepEquals, []string{"config:" + cbtcp.ConfigPassword})
+
+	c.Assert(siftServ.DeleteAdapterConfig("Connected by TCP", cbtcp.ConfigPassword), IsNil)
+	keys, err = siftServ.ListAdapterCredentials("Connected by TCP")
+	c.Assert(err, IsNil)
+	c.Assert(keys, DeepEquals, []string{})
+}
+
+type testSSDPFactory struct{}
+
+func (f testSSDPFactory) Name() string                                    { return "test ssdp" }
+func (f testSSDPFactory) HandleSSDP(*ssdp.ServiceContext) adapter.Adapter { return nil }
+func (f testSSDPFactory) GetSSDPDescription() ssdp.ServiceDescription {
+	return ssdp.ServiceDescription{ST: "urn:schemas-upnp-org:device:MediaRenderer:1"}
+}
+
+func (s *SiftSuite) TestAddSSDPFactory(c *C) {
+	siftServ, err := sift.NewServer(":memory:")
+	c.Assert(err, IsNil)
+	defer siftServ.Close()
+
+	id, err := siftServ.AddAdapterFactory(testSSDPFactory{})
+	c.Assert(err, IsNil)
+	c.Assert(id, Not(Equals), "")
+	_, err = siftServ.AddAdapterFactory(testSSDPFactory{})
+	c.Assert(err, NotNil) // names must be unique
+}
+
+// testIPv4Factory passes the contexts it is given to a channel, rather than
+// handling them
+type testIPv4Factory struct {
+	contexts chan *ipv4.ServiceContext
+}
+
+func (f testIPv4Factory) Name() string { return "test ipv4" }
+func (f testIPv4Factory) HandleIPv4(context *ipv4.ServiceContext) adapter.Adapter {
+	select {
+	case f.contexts <- context:
+	default:
+	}
+	return nil
+}
+func (f testIPv4Factory) GetIPv4Description() ipv4.ServiceDescription {
+	return ipv4.ServiceDescription{OpenPorts: []uint16{1}}
+}
+func (f testIPv4Factory) ConfigFields() []types.ConfigField {
+	return []types.ConfigField{{Name: types.ConfigFieldPort, Type: types.ConfigTypeInt, Default: "80"}}
+}
+func (f testIPv4Factory) Configure(types.AdapterConfig) error { return nil }
+
+func (s *SiftSuite) TestStaticServices(c *C) {
+	siftServ, err := sift.NewServer(":memory:")
+	c.Assert(err, IsNil)
+	factory := testIPv4Factory{contexts: make(chan *ipv4.ServiceContext, 10)}
+
+	// factories must be added, and must handle IPv4 services
+	_, err = siftServ.RegisterStaticService("test ipv4", net.IPv4(127, 0, 0, 1), 8080)
+	c.Assert(err, NotNil)
+	_, err = siftServ.AddAdapterFactory(factory)
+	c.Assert(err, IsNil)
+	_, err = siftServ.AddAdapterFactory(testSSDPFactory{})
+	c.Assert(err, IsNil)
+	_, err = siftServ.RegisterStaticService("test ssdp", net.IPv4(127, 0, 0, 1), 8080)
+	c.Assert(err, NotNil)
+	_, err = siftServ.RegisterStaticService("test ipv4", net.ParseIP("fe80::1"), 8080)
+	c.Assert(err, NotNil)
+
+	// a port may only be given to factories which accept one in their config
+	_, err = siftServ.AddAdapterFactory(testIPv4ReportingFactory{newReportingAdapter()})
+	c.Assert(err, IsNil)
+	_, err = siftServ.RegisterStaticService("test ipv4 reporter", net.IPv4(127, 0, 0, 1), 8080)
+	c.Assert(err, NotNil)
+
+	id, err := siftServ.RegisterStaticService("test ipv4", net.IPv4(127, 0, 0, 1), 8080)
+	c.Assert(err, IsNil)
+	_, err = siftServ.RegisterStaticService("test ipv4", net.IPv4(127, 0, 0, 1), 8080)
+	c.Assert(err, NotNil) // already registered
+	svcs, err := siftServ.GetStaticServices()
+	c.Assert(err, IsNil)
+	c.Assert(svcs, DeepEquals, []db.StaticService{{ID: id, FactoryName: "test ipv4", IP: "127.0.0.1", Port: 8080}})
+
+	// once serving, the service is handed directly to the factory
+	go siftServ.Serve()
+	defer siftServ.StopAndWait(5 * time.Second)
+	select {
+	case context := <-factory.contexts:
+		c.Assert(context.IP.String(), Equals, "127.0.0.1")
+		port, err := context.Config.Int(types.ConfigFieldPort)
+		c.Assert(err, IsNil)
+		c.Assert(port, Equals, 8080)
+	case <-time.After(5 * time.Second):
+		c.Fatalf("static service was not handed to its factory")
+	}
+
+	c.Assert(siftServ.RemoveStaticService(id), IsNil)
+	c.Assert(siftServ.RemoveStaticService(id), NotNil)
+}
+
+// testBLEFactory passes the contexts it is given to a channel, rather than
+// handling them
+type testBLEFactory struct {
+	contexts chan *ble.ServiceContext
+}
+
+func (f testBLEFactory) Name() string                       { return "test ble" }
+func (f testBLEFactory) ControllerType() lib.ControllerType { return lib.ControllerTypeBluetooth }
+func (f testBLEFactory) HandleBLE(context *ble.ServiceContext) adapter.Adapter {
+	select {
+	case f.contexts <- context:
+	default:
+	}
+	return nil
+}
+func (f testBLEFactory) GetBLEDescription() ble.ServiceDescription {
+	return ble.ServiceDescription{NamePrefix: "Lock", ServiceUUIDs: []string{"fff0"}}
+}
+
+func (s *SiftSuite) TestBLEServices(c *C) {
+	siftServ, err := sift.NewServer(":memory:")
+	c.Assert(err, IsNil)
+	factory := testBLEFactory{contexts: make(chan *ble.ServiceContext, 10)}
+	_, err = siftServ.AddAdapterFactory(factory)
+	c.Assert(err, IsNil)
+
+	transport := ble.NewFakeTransport()
+	transport.SetPeripheral(ble.Peripheral{Address: "C4:7C:8D:6A:2F:01", Name: "Lock 2F01", ServiceUUIDs: []string{"FFF0"}})
+	transport.SetPeripheral(ble.Peripheral{Address: "C4:7C:8D:6A:2F:02", Name: "Bulb 2F02", ServiceUUIDs: []string{"fff0"}})
+	c.Assert(transport.SetCharacteristic("c4:7c:8d:6a:2f:01", "fff0", "fff1", []byte{1}), IsNil)
+	siftServ.SetBLETransport(transport)
+
+	// matching peripherals are handed to the factory, and can be reached
+	// through their contexts
+	go siftServ.Serve()
+	defer siftServ.StopAndWait(5 * time.Second)
+	select {
+	case context := <-factory.contexts:
+		c.Assert(context.Address, Equals, "C4:7C:8D:6A:2F:01")
+		conn, err := context.Connect()
+		c.Assert(err, IsNil)
+		defer conn.Close()
+		value, err := conn.ReadCharacteristic("fff0", "fff1")
+		c.Assert(err, IsNil)
+		c.Assert(value, DeepEquals, []byte{1})
+	case <-time.After(5 * time.Second):
+		c.Fatalf("ble peripheral was not handed to its factory")
+	}
+}
+
+// reportingAdapter sends the updates it is given to the Server, and passes the
+// intents it receives to a channel
+type reportingAdapter struct {
+	updates chan interface{}
+	intents chan types.SetLightEmitterIntent
+}
+
+func newReportingAdapter() *reportingAdapter {
+	return &reportingAdapter{updates: make(chan interface{}, 10), intents: make(chan types.SetLightEmitterIntent, 10)}
+}
+
+func (a *reportingAdapter) UpdateChan() chan interface{} { return a.updates }
+func (a *reportingAdapter) EnactIntent(target types.ExternalComponentID, intent types.Intent) error {
+	if typed, ok := intent.(types.SetLightEmitterIntent); ok {
+		a.intents <- typed
+	}
+	return nil
+}
+
+// reportLight sends an update for a light with the given ID
+func (a *reportingAdapter) reportLight(id string, brightness uint8) {
+	a.updates <- lib.DeviceUpdated{
+		ID: types.ExternalDeviceID{Manufacturer: "test", ID: id},
+		NewState: types.Device{IsOnline: true, Components: map[string]types.Component{
+			"bulb": types.LightEmitter{State: types.LightEmitterState{BrightnessInPercent: brightness}},
+		}},
+	}
+}
+
+type testIPv4ReportingFactory struct{ adapter *reportingAdapter }
+
+func (f testIPv4ReportingFactory) Name() string { return "test ipv4 reporter" }
+func (f testIPv4ReportingFactory) HandleIPv4(*ipv4.ServiceContext) adapter.Adapter {
+	return f.adapter
+}
+func (f testIPv4ReportingFactory) GetIPv4Description() ipv4.ServiceDescription {
+	return ipv4.ServiceDescription{OpenPorts: []uint16{1}}
+}
+
+type testBLEReportingFactory struct{ adapter *reportingAdapter }
+
+func (f testBLEReportingFactory) Name() string { return "test ble reporter" }
+func (f testBLEReportingFactory) ControllerType() lib.ControllerType {
+	return lib.ControllerTypeBluetooth
+}
+func (f testBLEReportingFactory) HandleBLE(*ble.ServiceContext) adapter.Adapter {
+	return f.adapter
+}
+func (f testBLEReportingFactory) GetBLEDescription() ble.ServiceDescription {
+	return ble.ServiceDescription{NamePrefix: "Light"}
+}
+
+// expectBrightness waits for one of the Server's lights to have the given
+// brightness, and returns its ID
+func expectBrightness(c *C, server *sift.Server, brightness uint8) types.ComponentID {
+	var last interface{}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		comps, err := server.GetComponents(db.ExpandNone)
+		c.Assert(err, IsNil)
+		for id, comp := range comps {
+			last = comp
+			if light, ok := comp.(types.LightEmitter); ok && light.State.BrightnessInPercent == brightness {
+				return id
+			}
+		}
+	}
+	c.Fatalf("light did not reach brightness %v; last saw %+v", brightness, last)
+	return types.ComponentID{}
+}
+
+// startReportingServer starts a Server with an IPv4 adapter and a Bluetooth
+// adapter, which report whatever they are told to
+func startReportingServer(c *C) (server *sift.Server, ipv4Adapter, bleAdapter *reportingAdapter) {
+	server, err := sift.NewServer(":memory:")
+	c.Assert(err, IsNil)
+	ipv4Adapter, bleAdapter = newReportingAdapter(), newReportingAdapter()
+	_, err = server.AddAdapterFactory(testIPv4ReportingFactory{ipv4Adapter})
+	c.Assert(err, IsNil)
+	_, err = server.AddAdapterFactory(testBLEReportingFactory{bleAdapter})
+	c.Assert(err, IsNil)
+	_, err = server.RegisterStaticService("test ipv4 reporter", net.IPv4(127, 0, 0, 1), 0)
+	c.Assert(err, IsNil)
+	transport := ble.NewFakeTransport()
+	transport.SetPeripheral(ble.Peripheral{Address: "c4:7c:8d:6a:2f:03", Name: "Light 2F03"})
+	server.SetBLETransport(transport)
+	go server.Serve()
+	return server, ipv4Adapter, bleAdapter
+}
+
+func (s *SiftSuite) TestBLEPrioritized(c *C) {
+	siftServ, ipv4Adapter, bleAdapter := startReportingServer(c)
+	defer siftServ.StopAndWait(5 * time.Second)
+
+	// at first, only the IPv4 adapter reports the light
+	ipv4Adapter.reportLight("light", 90)
+	expectBrightness(c, siftServ, 90)
+
+	// once the Bluetooth adapter reports it too, it takes precedence...
+	bleAdapter.reportLight("light", 10)
+	id := expectBrightness(c, siftServ, 10)
+
+	// ...so updates from the IPv4 adapter are ignored...
+	ipv4Adapter.reportLight("light", 50)
+	bleAdapter.reportLight("light", 20)
+	expectBrightness(c, siftServ, 20)
+	time.Sleep(100 * time.Millisecond)
+	expectBrightness(c, siftServ, 20)
+
+	// ...and intents are sent to the Bluetooth adapter
+	c.Assert(siftServ.EnactIntent(id, types.SetLightEmitterIntent{BrightnessInPercent: 70}), IsNil)
+	select {
+	case intent := <-bleAdapter.intents:
+		c.Assert(intent.BrightnessInPercent, Equals, uint8(70))
+	case <-time.After(5 * time.Second):
+		c.Fatalf("intent was not sent to the bluetooth adapter")
+	}
+	c.Assert(len(ipv4Adapter.intents), Equals, 0)
+}
+
+func (s *SiftSuite) TestMergeDevicesPrioritized(c *C) {
+	for _, intoBLE := range []bool{false, true} {
+		testMergeDevicesPrioritized(c, intoBLE)
+	}
+}
+
+// testMergeDevicesPrioritized merges the light reported by the IPv4 adapter
+// with that reported by the Bluetooth adapter; if intoBLE is true, the merged
+// light is known by the Bluetooth adapter's ID, otherwise by the IPv4 one's
+func testMergeDevicesPrioritized(c *C, intoBLE bool) {
+	siftServ, ipv4Adapter, bleAdapter := startReportingServer(c)
+	defer siftServ.StopAndWait(5 * time.Second)
+
+	// the adapters report the same light under different IDs, so at first
+	// they are two lights
+	ipv4Adapter.reportLight("ipv4 light", 90)
+	bleAdapter.reportLight("ble light", 10)
+	ipv4ID := expectBrightness(c, siftServ, 90)
+	bleID := expectBrightness(c, siftServ, 10)
+	ipv4Adapter.reportLight("ipv4 light", 80)
+	expectBrightness(c, siftServ, 80)
+
+	// once the lights are merged, the Bluetooth adapter takes precedence,
+	// whichever ID the merged light is known by...
+	into, from, brightness := ipv4ID, bleID, uint8(80)
+	if intoBLE {
+		into, from, brightness = bleID, ipv4ID, 10
+	}
+	c.Assert(siftServ.MergeDevices(into.DeviceID, from.DeviceID), IsNil)
+	c.Assert(siftServ.EnactIntent(into, types.SetLightEmitterIntent{BrightnessInPercent: 70}), IsNil)
+	select {
+	case intent := <-bleAdapter.intents:
+		c.Assert(intent.BrightnessInPercent, Equals, uint8(70))
+	case <-time.After(5 * time.Second):
+		c.Fatalf("intent was not sent to the bluetooth adapter")
+	}
+	c.Assert(len(ipv4Adapter.intents), Equals, 0)
+
+	// ...so updates from the IPv4 adapter are ignored
+	ipv4Adapter.reportLight("ipv4 light", 50)
+	time.Sleep(100 * time.Millisecond)
+	expectBrightness(c, siftServ, brightness)
+	bleAdapter.reportLight("ble light", 20)
+	id := expectBrightness(c, siftServ, 20)
+	c.Assert(id.DeviceID, Equals, into.DeviceID)
+}
+
+func (s *SiftSuite) TestRemoveDeviceAliasPrioritized(c *C) {
+	for _, intoBLE := range []bool{false, true} {
+		testRemoveDeviceAliasPrioritized(c, intoBLE)
+	}
+}
+
+// testRemoveDeviceAliasPrioritized merges the lights reported by the IPv4 and
+// Bluetooth adapters as testMergeDevicesPrioritized does, then splits them
+// again by removing the alias
+func testRemoveDeviceAliasPrioritized(c *C, intoBLE bool) {
+	siftServ, ipv4Adapter, bleAdapter := startReportingServer(c)
+	defer siftServ.StopAndWait(5 * time.Second)
+
+	ipv4Adapter.reportLight("ipv4 light", 90)
+	bleAdapter.reportLight("ble light", 10)
+	ipv4ID := expectBrightness(c, siftServ, 90)
+	bleID := expectBrightness(c, siftServ, 10)
+	into, from := ipv4ID, bleID
+	intoAdapter, fromAdapter := ipv4Adapter, bleAdapter
+	alias := types.ExternalDeviceID{Manufacturer: "test", ID: "ble light"}
+	if intoBLE {
+		into, from = bleID, ipv4ID
+		intoAdapter, fromAdapter = bleAdapter, ipv4Adapter
+		alias = types.ExternalDeviceID{Manufacturer: "test", ID: "ipv4 light"}
+	}
+	c.Assert(siftServ.MergeDevices(into.DeviceID, from.DeviceID), IsNil)
+	fromAdapter.reportLight(alias.ID, 40) // reported under the merged light
+	time.Sleep(100 * time.Millisecond)
+	c.Assert(siftServ.RemoveDeviceAlias(alias), IsNil)
+	c.Assert(siftServ.RemoveDeviceAlias(alias), NotNil) // no longer an alias
+
+	// once the alias is removed, intents for the merged light are sent to the
+	// adapter which reported it...
+	expectIntent := func(id types.ComponentID, adapter, other *reportingAdapter) {
+		c.Assert(siftServ.EnactIntent(id, types.SetLightEmitterIntent{BrightnessInPercent: 70}), IsNil)
+		select {
+		case intent := <-adapter.intents:
+			c.Assert(intent.BrightnessInPercent, Equals, uint8(70))
+		case <-time.After(5 * time.Second):
+			c.Fatalf("intent was not sent to the expected adapter")
+		}
+		c.Assert(len(other.intents), Equals, 0)
+	}
+	expectIntent(into, intoAdapter, fromAdapter)
+
+	// ...and the alias's adapter reports a light of its own
+	fromAdapter.reportLight(alias.ID, 30)
+	id := expectBrightness(c, siftServ, 30)
+	c.Assert(id.DeviceID, Not(Equals), into.DeviceID)
+	expectIntent(id, fromAdapter, intoAdapter)
+}
@@ -0,0 +1,129 @@
+package sift
+
+import (
+	"fmt"
+	"github.com/upwrd/sift/adapter"
+	"github.com/upwrd/sift/db"
+	"github.com/upwrd/sift/lib"
+	"github.com/upwrd/sift/network/ipv4"
+	"github.com/upwrd/sift/types"
+	"net"
+	"strconv"
+)
+
+// RegisterStaticService registers an IPv4 service at the given IP and port,
+// to be handled by the named Adapter Factory without scanning for it. This is
+// useful for services which cannot be found by scanning, such as those on
+// other subnets. The factory must have been added to the Server, and must be
+// an IPv4 factory. If port is 0, the factory uses its default; otherwise the
+// factory must accept a port in its config (see types.ConfigFieldPort), and
+// the Adapter handling the service is given port in its config. The service is
+// kept in the Store, and is handed to the factory whenever it is not already
+// being handled. Returns the ID of the registered service.
+func (s *Server) RegisterStaticService(factoryName string, ip net.IP, port uint16) (int64, error) {
+	factory, ok := s.factoryByName(factoryName)
+	if !ok {
+		return 0, fmt.Errorf("no adapter factory named %v has been added", factoryName)
+	}
+	if _, ok := factory.(adapter.IPv4Factory); !ok {
+		return 0, fmt.Errorf("adapter factory %v does not handle IPv4 services", factoryName)
+	}
+	if ip.To4() == nil {
+		return 0, fmt.Errorf("%v is not an IPv4 address", ip)
+	}
+	if port != 0 && !acceptsPort(factory) {
+		return 0, fmt.Errorf("adapter factory %v does not accept a port", factoryName)
+	}
+	id, err := s.Store.AddStaticService(factoryName, ip.To4().String(), port)
+	if err != nil {
+		return 0, err
+	}
+	s.log.Info("registered static service", "factory", factoryName, "ip", ip, "port", port, "id", id)
+
+	// hand the service to its factory without waiting for the next check
+	select {
+	case s.staticServicesChanged <- struct{}{}:
+	default: // a check is already pending
+	}
+	return id, nil
+}
+
+// RemoveStaticService removes the registered service with the given ID. An
+// Adapter already handling the service is not stopped, but the service is not
+// handed to the factory again once that Adapter is done.
+func (s *Server) RemoveStaticService(id int64) error {
+	if err := s.Store.DeleteStaticService(id); err != nil {
+		return err
+	}
+	s.log.Info("removed static service", "id", id)
+	return nil
+}
+
+// handleStaticServices hands each registered service which is not already
+// being handled to its factory. Services whose factories have not been added
+// are ignored until they are.
+func (s *Server) handleStaticServices() {
+	svcs, err := s.Store.GetStaticServices()
+	if err != nil {
+		s.log.Error("could not get static services", "err", err)
+		return
+	}
+	for _, svc := range svcs {
+		found, _ := s.factoryByName(svc.FactoryName)
+		factory, ok := found.(adapter.IPv4Factory)
+		if !ok {
+			continue
+		}
+		ip := net.ParseIP(svc.IP)
+		if ip == nil {
+			s.log.Warn("ignoring static service with invalid IP", "id", svc.ID, "ip", svc.IP)
+			continue
+		}
+		// static services share locks with scanned services, so that only one
+		// Adapter handles each IP
+		if !s.ipv4Scan.Lock(ip) {
+			continue
+		}
+		go s.tryHandlingStaticService(factory, svc)
+	}
+}
+
+// tryHandlingStaticService gives the registered service to its factory's
+// Adapter, in the same way as services found by scanning (see
+// tryHandlingIPv4Service). The service's IP must already be locked.
+func (s *Server) tryHandlingStaticService(factory adapter.IPv4Factory, svc db.StaticService) {
+	ip := net.ParseIP(svc.IP)
+	config, err := s.getAdapterConfig(factory)
+	if err != nil {
+		s.log.Warn("could not get adapter config; using defaults", "factory", factory.Name(), "err", err)
+	}
+	if svc.Port != 0 { // registered with a port
+		if config, err = config.With(types.ConfigFieldPort, strconv.Itoa(int(svc.Port))); err != nil {
+			s.log.Error("could not set port of static service", "id", svc.ID, "factory", factory.Name(), "err", err)
+			s.ipv4Scan.Unlock(net.IPAddr{IP: ip})
+			return
+		}
+	}
+	context, statusChan := ipv4.BuildContext(ip, s.Store, factory.Name(), config)
+	s.superviseAdapter(factory.HandleIPv4(context), net.IPAddr{IP: ip}, lib.ControllerTypeIPv4, statusChan)
+	ipv4.KillContext(context)
+
+	// The adapter is done. Release the IP; if the service is still
+	// registered, it will be handed to the factory again.
+	s.ipv4Scan.Unlock(net.IPAddr{IP: ip})
+}
+
+// acceptsPort reports whether the factory declares an int config field for
+// the port of its services
+func acceptsPort(factory adapter.Factory) bool {
+	configurable, ok := factory.(adapter.ConfigurableFactory)
+	if !ok {
+		return false
+	}
+	for _, field := range configurable.ConfigFields() {
+		if field.Name == types.ConfigFieldPort {
+			return field.Type == types.ConfigTypeInt
+		}
+	}
+	return false
+}
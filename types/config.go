@@ -0,0 +1,204 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// A ConfigType is the type of value held by an Adapter configuration field
+type ConfigType string
+
+// Possible configuration types
+const (
+	ConfigTypeString   ConfigType = "string"
+	ConfigTypeInt      ConfigType = "int"
+	ConfigTypeBool     ConfigType = "bool"
+	ConfigTypeDuration ConfigType = "duration" // parsed with time.ParseDuration, e.g. "10s"
+)
+
+func (t ConfigType) isValid() bool {
+	switch t {
+	case ConfigTypeString, ConfigTypeInt, ConfigTypeBool, ConfigTypeDuration:
+		return true
+	}
+	return false
+}
+
+// ConfigFieldPort is the name of the int field in which Adapter Factories
+// accept the port of their services. Factories which declare it can be given
+// static services on other ports (see sift.Server.RegisterStaticService),
+// whose port is set in the config of that service's Adapter.
+const ConfigFieldPort = "port"
+
+// A ConfigField declares a setting which an Adapter Factory accepts, such as
+// the port of a service or the username used to log in to a hub. Operators
+// set values for these fields (see sift.Server.SetAdapterConfig); Adapters
+// read them from their context.
+type ConfigField struct {
+	Name        string
+	Type        ConfigType
+	Default     string // used when the operator has not set a value; must be valid for Type
+	Description string
+	Secret      bool // if true, the value is stored as an Adapter credential and never listed
+}
+
+// Validate checks that value can be parsed as the field's type
+func (f ConfigField) Validate(value string) error {
+	var err error
+	switch f.Type {
+	case ConfigTypeString:
+	case ConfigTypeInt:
+		_, err = strconv.Atoi(value)
+	case ConfigTypeBool:
+		_, err = strconv.ParseBool(value)
+	case ConfigTypeDuration:
+		_, err = time.ParseDuration(value)
+	default:
+		return fmt.Errorf("config field %v has unknown type %q", f.Name, f.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid value %q for %v field %v: %v", value, f.Type, f.Name, err)
+	}
+	return nil
+}
+
+// An AdapterConfig holds the configuration of a single Adapter Factory: the
+// fields it declares, and any values set for them by an operator. The zero
+// value is an empty configuration, in which every lookup fails.
+type AdapterConfig struct {
+	fields map[string]ConfigField
+	values map[string]string
+}
+
+// NewAdapterConfig builds an AdapterConfig from declared fields and the values
+// which have been set for them. Values for undeclared fields are ignored;
+// values which do not match their field's type cause an error.
+func NewAdapterConfig(fields []ConfigField, values map[string]string) (AdapterConfig, error) {
+	c := AdapterConfig{
+		fields: make(map[string]ConfigField, len(fields)),
+		values: make(map[string]string),
+	}
+	for _, f := range fields {
+		if f.Name == "" {
+			return AdapterConfig{}, fmt.Errorf("config fields must have a name")
+		}
+		if _, dup := c.fields[f.Name]; dup {
+			return AdapterConfig{}, fmt.Errorf("duplicate config field %v", f.Name)
+		}
+		if !f.Type.isValid() {
+			return AdapterConfig{}, fmt.Errorf("config field %v has unknown type %q", f.Name, f.Type)
+		}
+		if f.Default != "" {
+			if err := f.Validate(f.Default); err != nil {
+				return AdapterConfig{}, fmt.Errorf("invalid default: %v", err)
+			}
+		}
+		c.fields[f.Name] = f
+		if value, ok := values[f.Name]; ok {
+			if err := f.Validate(value); err != nil {
+				return AdapterConfig{}, err
+			}
+			c.values[f.Name] = value
+		}
+	}
+	return c, nil
+}
+
+// Fields returns the declared fields, sorted by name
+func (c AdapterConfig) Fields() []ConfigField {
+	fields := make([]ConfigField, 0, len(c.fields))
+	for _, f := range c.fields {
+		fields = append(fields, f)
+	}
+	sort.Sort(configFieldsByName(fields))
+	return fields
+}
+
+// IsSet reports whether an operator has set a value for the named field
+func (c AdapterConfig) IsSet(name string) bool {
+	_, ok := c.values[name]
+	return ok
+}
+
+// With returns a copy of the config in which the named field is set to value.
+// The field must be declared, and value must be valid for its type.
+func (c AdapterConfig) With(name, value string) (AdapterConfig, error) {
+	f, ok := c.fields[name]
+	if !ok {
+		return AdapterConfig{}, fmt.Errorf("no config field named %v", name)
+	}
+	if err := f.Validate(value); err != nil {
+		return AdapterConfig{}, err
+	}
+	values := make(map[string]string, len(c.values)+1)
+	for k, v := range c.values {
+		values[k] = v
+	}
+	values[name] = value
+	return AdapterConfig{fields: c.fields, values: values}, nil
+}
+
+// lookup returns the value of the named field (or its default), checking that
+// the field has the expected type
+func (c AdapterConfig) lookup(name string, typ ConfigType) (string, error) {
+	f, ok := c.fields[name]
+	if !ok {
+		return "", fmt.Errorf("no config field named %v", name)
+	}
+	if f.Type != typ {
+		return "", fmt.Errorf("config field %v has type %v, not %v", name, f.Type, typ)
+	}
+	if value, ok := c.values[name]; ok {
+		return value, nil
+	}
+	return f.Default, nil
+}
+
+// String returns the value of the named string field
+func (c AdapterConfig) String(name string) (string, error) {
+	return c.lookup(name, ConfigTypeString)
+}
+
+// Int returns the value of the named int field
+func (c AdapterConfig) Int(name string) (int, error) {
+	value, err := c.lookup(name, ConfigTypeInt)
+	if err != nil {
+		return 0, err
+	}
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// Bool returns the value of the named bool field
+func (c AdapterConfig) Bool(name string) (bool, error) {
+	value, err := c.lookup(name, ConfigTypeBool)
+	if err != nil {
+		return false, err
+	}
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// Duration returns the value of the named duration field
+func (c AdapterConfig) Duration(name string) (time.Duration, error) {
+	value, err := c.lookup(name, ConfigTypeDuration)
+	if err != nil {
+		return 0, err
+	}
+	if value == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(value)
+}
+
+type configFieldsByName []ConfigField
+
+func (s configFieldsByName) Len() int           { return len(s) }
+func (s configFieldsByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s configFieldsByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
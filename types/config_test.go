@@ -0,0 +1,85 @@
+package types
+
+import (
+	. "gopkg.in/check.v1"
+	"time"
+)
+
+var testConfigFields = []ConfigField{
+	{Name: "port", Type: ConfigTypeInt, Default: "80"},
+	{Name: "user", Type: ConfigTypeString},
+	{Name: "secure", Type: ConfigTypeBool, Default: "false"},
+	{Name: "poll_interval", Type: ConfigTypeDuration, Default: "10s"},
+}
+
+func (s *TypesTestSuite) TestAdapterConfig(c *C) {
+	config, err := NewAdapterConfig(testConfigFields, map[string]string{
+		"port":    "8080",
+		"secure":  "true",
+		"unknown": "ignored",
+	})
+	c.Assert(err, IsNil)
+
+	port, err := config.Int("port")
+	c.Assert(err, IsNil)
+	c.Assert(port, Equals, 8080)
+	c.Assert(config.IsSet("port"), Equals, true)
+	secure, err := config.Bool("secure")
+	c.Assert(err, IsNil)
+	c.Assert(secure, Equals, true)
+
+	// unset fields use their defaults
+	user, err := config.String("user")
+	c.Assert(err, IsNil)
+	c.Assert(user, Equals, "")
+	c.Assert(config.IsSet("user"), Equals, false)
+	interval, err := config.Duration("poll_interval")
+	c.Assert(err, IsNil)
+	c.Assert(interval, Equals, 10*time.Second)
+
+	// fields must be declared, and read as their declared type
+	_, err = config.String("unknown")
+	c.Assert(err, NotNil)
+	_, err = config.String("port")
+	c.Assert(err, NotNil)
+
+	c.Assert(len(config.Fields()), Equals, 4)
+	c.Assert(config.Fields()[0].Name, Equals, "poll_interval")
+}
+
+func (s *TypesTestSuite) TestAdapterConfigWith(c *C) {
+	config, err := NewAdapterConfig(testConfigFields, map[string]string{"port": "8080"})
+	c.Assert(err, IsNil)
+
+	with, err := config.With("port", "8443")
+	c.Assert(err, IsNil)
+	port, err := with.Int("port")
+	c.Assert(err, IsNil)
+	c.Assert(port, Equals, 8443)
+	port, err = config.Int("port") // the original is unchanged
+	c.Assert(err, IsNil)
+	c.Assert(port, Equals, 8080)
+
+	// the field must be declared, and the value valid
+	_, err = config.With("unknown", "1")
+	c.Assert(err, NotNil)
+	_, err = config.With("port", "eighty")
+	c.Assert(err, NotNil)
+}
+
+func (s *TypesTestSuite) TestAdapterConfigValidation(c *C) {
+	_, err := NewAdapterConfig(testConfigFields, map[string]string{"port": "eighty"})
+	c.Assert(err, NotNil)
+	_, err = NewAdapterConfig(testConfigFields, map[string]string{"poll_interval": "10"})
+	c.Assert(err, NotNil)
+	_, err = NewAdapterConfig([]ConfigField{{Name: "port", Type: ConfigTypeInt, Default: "x"}}, nil)
+	c.Assert(err, NotNil)
+	_, err = NewAdapterConfig([]ConfigField{{Name: "a", Type: "float"}}, nil)
+	c.Assert(err, NotNil)
+	_, err = NewAdapterConfig(append(testConfigFields, ConfigField{Name: "port", Type: ConfigTypeInt}), nil)
+	c.Assert(err, NotNil)
+
+	// the zero config has no fields
+	_, err = AdapterConfig{}.Int("port")
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,118 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// typeField is used to peek at the Type field of marshalled Components and
+// Intents. JSON field matching is case-insensitive, so both "Type" and "type"
+// are accepted.
+type typeField struct {
+	Type string
+}
+
+// UnmarshalComponent decodes a JSON-encoded Component, such as one produced by
+// marshalling the result of Component.GetTyped(). The Component's Type field
+// is used to look up the registered ComponentType to decode into.
+func UnmarshalComponent(data []byte) (Component, error) {
+	var t typeField
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("could not read component type: %v", err)
+	}
+	if t.Type == "" {
+		return nil, fmt.Errorf("component JSON does not have a type")
+	}
+	ct, ok := LookupComponentType(t.Type)
+	if !ok {
+		return nil, fmt.Errorf("unknown component type: %v", t.Type)
+	}
+	decoded, err := unmarshalInto(data, ct.New())
+	if err != nil {
+		return nil, fmt.Errorf("could not decode component of type %v: %v", t.Type, err)
+	}
+	return decoded.(Component), nil
+}
+
+// UnmarshalIntent decodes a JSON-encoded Intent, such as one produced by
+// marshalling the result of Intent.GetTyped(). The Intent's Type field is used
+// to look up the registered IntentType to decode into.
+func UnmarshalIntent(data []byte) (Intent, error) {
+	var t typeField
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("could not read intent type: %v", err)
+	}
+	if t.Type == "" {
+		return nil, fmt.Errorf("intent JSON does not have a type")
+	}
+	it, ok := LookupIntentType(t.Type)
+	if !ok {
+		return nil, fmt.Errorf("unknown intent type: %v", t.Type)
+	}
+	decoded, err := unmarshalInto(data, it.New())
+	if err != nil {
+		return nil, fmt.Errorf("could not decode intent of type %v: %v", t.Type, err)
+	}
+	return decoded.(Intent), nil
+}
+
+// unmarshalInto decodes data into a copy of zero, which is typically a
+// non-pointer struct value, and returns the copy.
+func unmarshalInto(data []byte, zero interface{}) (interface{}, error) {
+	ptr := reflect.New(reflect.TypeOf(zero))
+	ptr.Elem().Set(reflect.ValueOf(zero))
+	if err := json.Unmarshal(data, ptr.Interface()); err != nil {
+		return nil, err
+	}
+	return ptr.Elem().Interface(), nil
+}
+
+// MarshalJSON encodes the Device, including the Type of each of its
+// Components. Devices implement json.Marshaler
+func (d Device) MarshalJSON() ([]byte, error) {
+	var typed map[string]interface{}
+	if d.Components != nil {
+		typed = make(map[string]interface{}, len(d.Components))
+		for name, comp := range d.Components {
+			typed[name] = comp.GetTyped()
+		}
+	}
+	type device Device // avoid recursing into Device.MarshalJSON
+	return json.Marshal(struct {
+		device
+		Components map[string]interface{}
+	}{
+		device:     device(d),
+		Components: typed,
+	})
+}
+
+// UnmarshalJSON decodes a Device produced by Device.MarshalJSON. Devices
+// implement json.Unmarshaler
+func (d *Device) UnmarshalJSON(data []byte) error {
+	type device Device // avoid recursing into Device.UnmarshalJSON
+	raw := struct {
+		*device
+		Components map[string]json.RawMessage
+	}{
+		device: (*device)(d),
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	d.Components = nil
+	if raw.Components == nil {
+		return nil
+	}
+	d.Components = make(map[string]Component, len(raw.Components))
+	for name, rawComp := range raw.Components {
+		comp, err := UnmarshalComponent(rawComp)
+		if err != nil {
+			return fmt.Errorf("could not decode component %v: %v", name, err)
+		}
+		d.Components[name] = comp
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package types
+
+import (
+	"encoding/json"
+	. "gopkg.in/check.v1"
+	"testing"
+)
+
+// Hook up gocheck into the "go test" runner.
+func TestTypes(t *testing.T) { TestingT(t) }
+
+type TypesTestSuite struct{}
+
+var _ = Suite(&TypesTestSuite{})
+
+var jsonDeviceTests = map[string]Device{
+	"empty device": Device{},
+	"device with no components": Device{
+		Name:       "empty",
+		Components: map[string]Component{},
+	},
+	"device with every component type": Device{
+		Name:     "everything",
+		IsOnline: true,
+		Components: map[string]Component{
+			"light": LightEmitter{
+				BaseComponent: BaseComponent{Make: "example", Model: "light_emitter_1"},
+				State:         LightEmitterState{BrightnessInPercent: 42},
+				Specs:         &LightEmitterSpecs{MaxOutputInLumens: 700},
+			},
+			"tv": MediaPlayer{
+				BaseComponent: BaseComponent{Make: "google", Model: "chromecast"},
+				State: MediaPlayerState{
+					PlayState: MediaPlayerStatePlaying,
+					MediaType: MediaTypeVideo,
+					Source:    "Netflix",
+				},
+			},
+			"speaker": Speaker{State: SpeakerState{OutputInPercent: 11}},
+			"outlet":  Switch{State: SwitchState{IsOn: true, PowerDrawInWatts: 3.5}},
+			"thermostat": Thermostat{
+				State: ThermostatState{Mode: ThermostatModeCool, CoolSetpointInCelsius: 24.5},
+			},
+		},
+	},
+}
+
+func (s *TypesTestSuite) TestDeviceJSONBackAndForth(c *C) {
+	for testName, testDevice := range jsonDeviceTests {
+		asJSON, err := json.Marshal(testDevice)
+		c.Assert(err, IsNil, Commentf("failed case: %v", testName))
+		var remarshalled Device
+		err = json.Unmarshal(asJSON, &remarshalled)
+		c.Assert(err, IsNil, Commentf("failed case: %v", testName))
+		c.Assert(remarshalled, DeepEquals, testDevice, Commentf("failed case: %v", testName))
+	}
+}
+
+var jsonIntentTests = map[string]Intent{
+	"light emitter": SetLightEmitterIntent{BrightnessInPercent: 80},
+	"media player":  SetMediaPlayerIntent{PlayState: MediaPlayerStatePaused},
+	"speaker":       SetSpeakerIntent{OutputInPercent: 20},
+	"switch":        SetSwitchIntent{IsOn: true},
+	"thermostat": SetThermostatIntent{
+		Mode:                  ThermostatModeAuto,
+		HeatSetpointInCelsius: 19,
+		CoolSetpointInCelsius: 25,
+	},
+}
+
+func (s *TypesTestSuite) TestIntentJSONBackAndForth(c *C) {
+	for testName, testIntent := range jsonIntentTests {
+		asJSON, err := json.Marshal(testIntent.GetTyped())
+		c.Assert(err, IsNil, Commentf("failed case: %v", testName))
+		remarshalled, err := UnmarshalIntent(asJSON)
+		c.Assert(err, IsNil, Commentf("failed case: %v", testName))
+		c.Assert(remarshalled, DeepEquals, testIntent, Commentf("failed case: %v", testName))
+	}
+}
+
+func (s *TypesTestSuite) TestUnmarshalComponentErrors(c *C) {
+	_, err := UnmarshalComponent([]byte(`{"Make": "example"}`))
+	c.Assert(err, ErrorMatches, ".*does not have a type.*")
+	_, err = UnmarshalComponent([]byte(`{"Type": "flux_capacitor"}`))
+	c.Assert(err, ErrorMatches, "unknown component type.*")
+	_, err = UnmarshalComponent([]byte(`{"Type": "light_emitter", "State": {"brightness_in_percent": "bright"}}`))
+	c.Assert(err, NotNil)
+
+	// lowercase keys, as produced by the chromecast helper, are accepted
+	comp, err := UnmarshalComponent([]byte(`{"type": "media_player", "make": "Google", "state": {"play_state": "PLAYING"}}`))
+	c.Assert(err, IsNil)
+	c.Assert(comp, DeepEquals, MediaPlayer{
+		BaseComponent: BaseComponent{Make: "Google"},
+		State:         MediaPlayerState{PlayState: MediaPlayerStatePlaying},
+	})
+}
@@ -6,6 +6,20 @@ const (
 	IntentTypeSetLightEmitter = "set_light_emitter"
 )
 
+func init() {
+	mustRegisterComponentType(ComponentType{
+		Name: ComponentTypeLightEmitter,
+		New:  func() Component { return LightEmitter{} },
+		Intents: []IntentType{
+			{
+				Name:     IntentTypeSetLightEmitter,
+				New:      func() Intent { return SetLightEmitterIntent{} },
+				Validate: validateSetLightEmitterIntent,
+			},
+		},
+	})
+}
+
 // LightEmitter represents a real-world light emitter, like a light bulb or lamp.
 type LightEmitter struct {
 	BaseComponent
@@ -6,6 +6,20 @@ const (
 	IntentTypeSetMediaPlayerPlayState = "set_media_player_play_state"
 )
 
+func init() {
+	mustRegisterComponentType(ComponentType{
+		Name: ComponentTypeMediaPlayer,
+		New:  func() Component { return MediaPlayer{} },
+		Intents: []IntentType{
+			{
+				Name:     IntentTypeSetMediaPlayerPlayState,
+				New:      func() Intent { return SetMediaPlayerIntent{} },
+				Validate: validateSetMediaPlayerIntent,
+			},
+		},
+	})
+}
+
 // Possible media player states
 const (
 	MediaPlayerStateIdle      = "IDLE"
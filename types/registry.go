@@ -0,0 +1,234 @@
+package types
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// A ComponentType describes a type of Component to SIFT. Each Component type
+// (including the built-in ones, like LightEmitter) registers a ComponentType
+// with RegisterComponentType, which allows packages outside of SIFT to add new
+// types of Components without modifying SIFT itself.
+type ComponentType struct {
+	// Name must match the value returned by the Component's Type() method,
+	// e.g. "light_emitter"
+	Name string
+
+	// New returns a zero-valued Component of this type. It is used when
+	// decoding Components from JSON.
+	New func() Component
+
+	// Storage persists Components of this type in the SIFT database. It may
+	// be nil if Components of this type are not stored.
+	Storage ComponentStorage
+
+	// Intents lists the Intents which may target Components of this type.
+	Intents []IntentType
+}
+
+// An IntentType describes a type of Intent, and how to check that it can be
+// satisfied by a particular Component.
+type IntentType struct {
+	// Name must match the value returned by the Intent's Type() method
+	Name string
+
+	// New returns a zero-valued Intent of this type. It is used when decoding
+	// Intents from JSON.
+	New func() Intent
+
+	// Validate checks that the Intent can be satisfied by the target
+	// Component. The Component will have its Specs expanded if they are known.
+	// Validate may be nil, in which case any Intent of this type is considered
+	// valid for Components of the registering type.
+	Validate func(Intent, Component) error
+}
+
+// A StorageTx is a database transaction used by ComponentStorage. It is
+// satisfied by *sqlx.Tx.
+type StorageTx interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Get(dest interface{}, query string, args ...interface{}) error
+	Select(dest interface{}, query string, args ...interface{}) error
+}
+
+// ComponentStorage persists a single type of Component in the SIFT database.
+// The base component row (name, make, model, type) is managed by SIFT; each
+// ComponentStorage is only responsible for the type-specific tables, keyed by
+// the base component's id.
+type ComponentStorage interface {
+	// Schema returns the statements needed to create the tables used by this
+	// type. It is run each time the database is opened, so the statements must
+	// be idempotent (e.g. CREATE TABLE IF NOT EXISTS ...)
+	Schema() string
+
+	// Get retrieves the Component with the given id
+	Get(tx StorageTx, id int64, base BaseComponent) (Component, error)
+
+	// Upsert inserts or updates the Component with the given id
+	Upsert(tx StorageTx, id int64, c Component) error
+
+	// Delete removes the Component with the given id
+	Delete(tx StorageTx, id int64) error
+
+	// GetSpecs returns a copy of the Component with its Specs populated from
+	// the spec tables. If no specs are known for the Component's make and
+	// model, the Component is returned unchanged.
+	GetSpecs(tx StorageTx, c Component) (Component, error)
+}
+
+// A SpecStorage is a ComponentStorage which can store the specs of a make and
+// model, allowing them to be imported from a spec catalog.
+type SpecStorage interface {
+	ComponentStorage
+
+	// UpsertSpecs inserts or replaces the specs for the given make and model.
+	// The specs are JSON-encoded, e.g. {"max_output_in_lumens": 700}
+	UpsertSpecs(tx StorageTx, make, model string, specs json.RawMessage) error
+
+	// ListSpecs returns the specs of every stored make and model, encoded as
+	// they would be passed to UpsertSpecs
+	ListSpecs(tx StorageTx) ([]ModelSpecs, error)
+}
+
+// ModelSpecs holds the JSON-encoded specs of a single make and model
+type ModelSpecs struct {
+	Make, Model string
+	Specs       json.RawMessage
+}
+
+// A QueryableStorage is a ComponentStorage which keeps each Component's state
+// in a single table, allowing Components to be filtered by their state (see
+// db.Query).
+type QueryableStorage interface {
+	ComponentStorage
+
+	// StateTable returns the name of the table holding Component state. The
+	// table must have an id column matching the base component's id.
+	StateTable() string
+}
+
+var registry = struct {
+	sync.RWMutex
+	componentTypes map[string]ComponentType
+}{
+	componentTypes: make(map[string]ComponentType),
+}
+
+// RegisterComponentType adds a type of Component to SIFT. Each type may only
+// be registered once.
+func RegisterComponentType(ct ComponentType) error {
+	if ct.Name == "" {
+		return fmt.Errorf("component type must have a name")
+	}
+	if ct.New == nil {
+		return fmt.Errorf("component type %v must provide New()", ct.Name)
+	}
+	if got := ct.New().Type(); got != ct.Name {
+		return fmt.Errorf("component type %v: New() returned a component of type %v", ct.Name, got)
+	}
+	for _, it := range ct.Intents {
+		if it.Name == "" || it.New == nil {
+			return fmt.Errorf("component type %v: intents must have a name and provide New()", ct.Name)
+		}
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	if _, exists := registry.componentTypes[ct.Name]; exists {
+		return fmt.Errorf("component type %v is already registered", ct.Name)
+	}
+	registry.componentTypes[ct.Name] = ct
+	return nil
+}
+
+// mustRegisterComponentType is used to register the built-in types
+func mustRegisterComponentType(ct ComponentType) {
+	if err := RegisterComponentType(ct); err != nil {
+		panic(err)
+	}
+}
+
+// SetComponentStorage sets the storage hooks for an already-registered type
+// of Component. It is used by the SIFT database to provide storage for the
+// built-in types.
+func SetComponentStorage(name string, storage ComponentStorage) error {
+	registry.Lock()
+	defer registry.Unlock()
+	ct, ok := registry.componentTypes[name]
+	if !ok {
+		return fmt.Errorf("component type %v is not registered", name)
+	}
+	ct.Storage = storage
+	registry.componentTypes[name] = ct
+	return nil
+}
+
+// LookupComponentType returns the registered ComponentType with the given
+// name.
+func LookupComponentType(name string) (ComponentType, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	ct, ok := registry.componentTypes[name]
+	return ct, ok
+}
+
+// ComponentTypes returns all registered ComponentTypes, sorted by name
+func ComponentTypes() []ComponentType {
+	registry.RLock()
+	defer registry.RUnlock()
+	cts := make([]ComponentType, 0, len(registry.componentTypes))
+	for _, ct := range registry.componentTypes {
+		cts = append(cts, ct)
+	}
+	sort.Sort(byName(cts))
+	return cts
+}
+
+type byName []ComponentType
+
+func (s byName) Len() int           { return len(s) }
+func (s byName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+
+// LookupIntentType returns the IntentType with the given name, if any
+// registered ComponentType accepts it.
+func LookupIntentType(name string) (IntentType, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	for _, ct := range registry.componentTypes {
+		for _, it := range ct.Intents {
+			if it.Name == name {
+				return it, true
+			}
+		}
+	}
+	return IntentType{}, false
+}
+
+// ValidateIntent checks that the Intent may target the Component, using the
+// validators registered for the Component's type. If the Intent is not valid,
+// the returned error will be an *IntentValidationError.
+func ValidateIntent(intent Intent, target Component) error {
+	if intent == nil || target == nil {
+		return fmt.Errorf("intent and target must not be nil")
+	}
+	ct, ok := LookupComponentType(target.Type())
+	if !ok {
+		return newValidationError(intent, target, "", ValidationReasonIncompatible,
+			"component type %v is not registered", target.Type())
+	}
+	for _, it := range ct.Intents {
+		if it.Name != intent.Type() {
+			continue
+		}
+		if it.Validate == nil {
+			return nil
+		}
+		return it.Validate(intent, target)
+	}
+	return newValidationError(intent, target, "", ValidationReasonIncompatible,
+		"intent type %v cannot target components of type %v", intent.Type(), target.Type())
+}
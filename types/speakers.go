@@ -6,6 +6,20 @@ const (
 	IntentTypeSetSpeaker = "set_speaker"
 )
 
+func init() {
+	mustRegisterComponentType(ComponentType{
+		Name: ComponentTypeSpeaker,
+		New:  func() Component { return Speaker{} },
+		Intents: []IntentType{
+			{
+				Name:     IntentTypeSetSpeaker,
+				New:      func() Intent { return SetSpeakerIntent{} },
+				Validate: validateSetSpeakerIntent,
+			},
+		},
+	})
+}
+
 // Speaker represents a real-world speaker.
 type Speaker struct {
 	BaseComponent
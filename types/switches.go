@@ -0,0 +1,82 @@
+package types
+
+// string constants
+const (
+	ComponentTypeSwitch = "switch"
+	IntentTypeSetSwitch = "set_switch"
+)
+
+func init() {
+	mustRegisterComponentType(ComponentType{
+		Name: ComponentTypeSwitch,
+		New:  func() Component { return Switch{} },
+		Intents: []IntentType{
+			{
+				Name: IntentTypeSetSwitch,
+				New:  func() Intent { return SetSwitchIntent{} },
+			},
+		},
+	})
+}
+
+// Switch represents a real-world switch or outlet, like a smart plug.
+type Switch struct {
+	BaseComponent
+	State SwitchState
+	Stats *SwitchStats
+	Specs *SwitchSpecs
+}
+
+// SwitchState represents the state of a real-world switch.
+type SwitchState struct {
+	IsOn             bool    `db:"is_on" json:"is_on"`
+	PowerDrawInWatts float64 `db:"power_draw_in_watts" json:"power_draw_in_watts"` // 0 if the switch is not metered
+}
+
+// SwitchStats contains statistics about the switch.
+type SwitchStats struct {
+	HoursOn int `db:"hours_on"`
+}
+
+// SwitchSpecs represents the specifications of a real-world switch.
+type SwitchSpecs struct {
+	MaxLoadInWatts float64 `db:"max_load_in_watts" json:"max_load_in_watts"`
+	IsMetered      bool    `db:"is_metered" json:"is_metered"` // true if the switch reports its power draw
+}
+
+// Type returns ComponentTypeSwitch. Switch implements types.Component
+func (c Switch) Type() string { return ComponentTypeSwitch }
+
+// GetTyped returns a typed version of the Component. Switch implements types.Component
+func (c Switch) GetTyped() interface{} {
+	return struct {
+		Type string
+		Switch
+	}{
+		Type:   c.Type(),
+		Switch: c,
+	}
+}
+
+//
+// Intents
+//
+
+// SetSwitchIntent represents an intent to turn a switch on or off
+type SetSwitchIntent struct {
+	IsOn bool `db:"is_on" json:"is_on"`
+}
+
+// Type returns IntentTypeSetSwitch. SetSwitchIntent implements types.Intent
+func (i SetSwitchIntent) Type() string { return IntentTypeSetSwitch }
+
+// GetTyped returns a typed version of the Intent. SetSwitchIntent implements types.Intent
+func (i SetSwitchIntent) GetTyped() interface{} {
+	return struct {
+		Type string
+		SetSwitchIntent
+	}{
+		Type:            i.Type(),
+		SetSwitchIntent: i,
+	}
+}
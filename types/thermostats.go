@@ -0,0 +1,100 @@
+package types
+
+// string constants
+const (
+	ComponentTypeThermostat = "thermostat"
+	IntentTypeSetThermostat = "set_thermostat"
+)
+
+func init() {
+	mustRegisterComponentType(ComponentType{
+		Name: ComponentTypeThermostat,
+		New:  func() Component { return Thermostat{} },
+		Intents: []IntentType{
+			{
+				Name:     IntentTypeSetThermostat,
+				New:      func() Intent { return SetThermostatIntent{} },
+				Validate: validateSetThermostatIntent,
+			},
+		},
+	})
+}
+
+// Possible thermostat modes
+const (
+	ThermostatModeOff  = "OFF"
+	ThermostatModeHeat = "HEAT"
+	ThermostatModeCool = "COOL"
+	ThermostatModeAuto = "AUTO"
+)
+
+// Thermostat represents a real-world thermostat.
+type Thermostat struct {
+	BaseComponent
+	State ThermostatState
+	Stats *ThermostatStats
+	Specs *ThermostatSpecs
+}
+
+// ThermostatState represents the state of a real-world thermostat.
+type ThermostatState struct {
+	// OFF, HEAT, COOL, AUTO
+	Mode string `db:"mode" json:"mode"`
+
+	CurrentTempInCelsius  float64 `db:"current_temp_in_celsius" json:"current_temp_in_celsius"`
+	HeatSetpointInCelsius float64 `db:"heat_setpoint_in_celsius" json:"heat_setpoint_in_celsius"` // heat when below
+	CoolSetpointInCelsius float64 `db:"cool_setpoint_in_celsius" json:"cool_setpoint_in_celsius"` // cool when above
+}
+
+// ThermostatStats contains statistics about the thermostat.
+type ThermostatStats struct {
+	HoursHeating int `db:"hours_heating"`
+	HoursCooling int `db:"hours_cooling"`
+}
+
+// ThermostatSpecs represents the specifications of a real-world thermostat.
+type ThermostatSpecs struct {
+	SupportedModes       string  `db:"supported_modes" json:"supported_modes"` // comma-separated, e.g. "OFF,HEAT"
+	MinSetpointInCelsius float64 `db:"min_setpoint_in_celsius" json:"min_setpoint_in_celsius"`
+	MaxSetpointInCelsius float64 `db:"max_setpoint_in_celsius" json:"max_setpoint_in_celsius"`
+}
+
+// Type returns ComponentTypeThermostat. Thermostat implements types.Component
+func (c Thermostat) Type() string { return ComponentTypeThermostat }
+
+// GetTyped returns a typed version of the Component. Thermostat implements types.Component
+func (c Thermostat) GetTyped() interface{} {
+	return struct {
+		Type string
+		Thermostat
+	}{
+		Type:       c.Type(),
+		Thermostat: c,
+	}
+}
+
+//
+// Intents
+//
+
+// SetThermostatIntent represents an intent to change the thermostat's mode
+// and setpoints
+type SetThermostatIntent struct {
+	Mode                  string  `db:"mode" json:"mode"`
+	HeatSetpointInCelsius float64 `db:"heat_setpoint_in_celsius" json:"heat_setpoint_in_celsius"`
+	CoolSetpointInCelsius float64 `db:"cool_setpoint_in_celsius" json:"cool_setpoint_in_celsius"`
+}
+
+// Type returns IntentTypeSetThermostat. SetThermostatIntent implements types.Intent
+func (i SetThermostatIntent) Type() string { return IntentTypeSetThermostat }
+
+// GetTyped returns a typed version of the Intent. SetThermostatIntent implements types.Intent
+func (i SetThermostatIntent) GetTyped() interface{} {
+	return struct {
+		Type string
+		SetThermostatIntent
+	}{
+		Type:                i.Type(),
+		SetThermostatIntent: i,
+	}
+}
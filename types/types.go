@@ -1,5 +1,10 @@
 package types
 
+import (
+	"net"
+	"strings"
+)
+
 // An ExternalDeviceID universally identifies a unique Device. Two separate
 // systems (e.g. SmartThings and HomeKit) should use the same DeviceExternalKey
 // for identical devices.
@@ -25,6 +30,16 @@ type ComponentID struct {
 	DeviceID DeviceID `db:"device_id"`
 }
 
+// A LocationID locally identifies a Location within a particular SIFT service
+type LocationID int64
+
+// A Location is a place where Devices may be found, such as a room. Locations
+// may be nested (e.g. a room may be within a floor of a building).
+type Location struct {
+	Name     string
+	ParentID LocationID `db:"parent_id" json:"parent_id"` // (Optional) The Location containing this one; 0 if none
+}
+
 // A Device represents a single physical unit which contains zero-or-more
 // functional units, called Components.
 type Device struct {
@@ -33,6 +48,40 @@ type Device struct {
 	//	ExternalID   string `json:"external_id"` //TODO: should identifiers be moved outside of the struct?
 	IsOnline   bool                 `db:"is_online" json:"is_online"`
 	Components map[string]Component // All components connected to the Device (indexed by their ID).
+	Metadata   *Metadata            `json:",omitempty"` // (Optional) User-provided metadata, if requested and set
+
+	// (Optional) Identifiers which are shared by every Adapter that can see
+	// this Device, indexed by kind (e.g. IdentifierMAC). SIFT may use them to
+	// recognize the same Device reported under different ExternalDeviceIDs.
+	Identifiers map[string]string `json:",omitempty"`
+}
+
+// Kinds of Device identifiers
+const (
+	IdentifierMAC = "mac" // a hardware address, e.g. "00:1a:2b:3c:4d:5e"
+)
+
+// NormalizeIdentifier returns value in a canonical form for its kind, so that
+// identifiers reported by different Adapters can be compared. MAC addresses
+// are lower-cased and colon-separated; other kinds are returned unchanged.
+func NormalizeIdentifier(kind, value string) string {
+	if kind == IdentifierMAC {
+		if hw, err := net.ParseMAC(value); err == nil {
+			return hw.String()
+		}
+		return strings.ToLower(value)
+	}
+	return value
+}
+
+// Metadata describes a Device or Component as the user would like to see it.
+// Metadata is set by users rather than Adapters, and is never overwritten by
+// updates from Adapters.
+type Metadata struct {
+	DisplayName string   `json:"display_name,omitempty"` // If set, overrides the name reported by the Adapter
+	Icon        string   `json:"icon,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Hidden      bool     `json:"hidden,omitempty"` // If true, apps should not show the Device or Component to users
 }
 
 // DeviceStats describe statistics generated about an individual Device
@@ -63,8 +112,21 @@ type Typeable interface {
 // BaseComponent describes the shared attributes of each Componenent
 type BaseComponent struct {
 	//DeviceID string `json:"device_id"`
-	Make  string
-	Model string
+	Make     string
+	Model    string
+	Metadata *Metadata `json:",omitempty"` // (Optional) User-provided metadata, if requested and set
+}
+
+// A FieldChange describes a change to a single field of a Component, such as
+// its brightness going from 100 to 10. Field is the path of the field within
+// the Component, e.g. "State.BrightnessInPercent"; fields of embedded structs
+// (like BaseComponent) are named as if they belonged to the Component itself.
+// Old and New hold the field's values before and after the change; either may
+// be nil if the field is a pointer which was unset.
+type FieldChange struct {
+	Field string
+	Old   interface{}
+	New   interface{}
 }
 
 // A Baseable struct can produce a BaseComponent.
@@ -0,0 +1,143 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Reasons that an Intent may fail validation
+const (
+	// the Intent cannot target Components of this type
+	ValidationReasonIncompatible = "incompatible"
+	// the value is not valid for any Component (e.g. an unknown play state)
+	ValidationReasonInvalid = "invalid"
+	// the value is outside of the range the Component can do
+	ValidationReasonOutOfRange = "out_of_range"
+	// the value is valid, but not supported by this make and model
+	ValidationReasonUnsupported = "unsupported"
+)
+
+// An IntentValidationError describes why an Intent cannot be enacted on a
+// particular Component.
+type IntentValidationError struct {
+	IntentType    string
+	ComponentType string
+	Field         string // the field of the Intent which failed validation; "" if the Intent as a whole is invalid
+	Reason        string // one of the ValidationReason constants
+	Message       string // a human-readable description of the problem
+}
+
+func (e *IntentValidationError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("invalid intent %v for %v (%v): %v", e.IntentType, e.ComponentType, e.Reason, e.Message)
+	}
+	return fmt.Sprintf("invalid intent %v for %v: field %v (%v): %v", e.IntentType, e.ComponentType, e.Field, e.Reason, e.Message)
+}
+
+func newValidationError(intent Intent, target Component, field, reason, format string, args ...interface{}) *IntentValidationError {
+	return &IntentValidationError{
+		IntentType:    intent.Type(),
+		ComponentType: target.Type(),
+		Field:         field,
+		Reason:        reason,
+		Message:       fmt.Sprintf(format, args...),
+	}
+}
+
+// isInList reports whether s is in the comma-separated list
+func isInList(s, list string) bool {
+	for _, item := range strings.Split(list, ",") {
+		if strings.EqualFold(strings.TrimSpace(item), s) {
+			return true
+		}
+	}
+	return false
+}
+
+//
+// Validators for the built-in Intents
+//
+
+func validateSetLightEmitterIntent(i Intent, c Component) error {
+	intent, ok := i.(SetLightEmitterIntent)
+	if !ok {
+		return newValidationError(i, c, "", ValidationReasonInvalid, "unexpected intent %T", i)
+	}
+	if intent.BrightnessInPercent > 100 {
+		return newValidationError(i, c, "BrightnessInPercent", ValidationReasonOutOfRange,
+			"brightness must be between 0 and 100 percent, got %v", intent.BrightnessInPercent)
+	}
+	return nil
+}
+
+func validateSetMediaPlayerIntent(i Intent, c Component) error {
+	intent, ok := i.(SetMediaPlayerIntent)
+	if !ok {
+		return newValidationError(i, c, "", ValidationReasonInvalid, "unexpected intent %T", i)
+	}
+	switch intent.PlayState {
+	case MediaPlayerStateIdle, MediaPlayerStateStopped, MediaPlayerStateBuffering,
+		MediaPlayerStatePaused, MediaPlayerStatePlaying:
+		return nil
+	}
+	return newValidationError(i, c, "PlayState", ValidationReasonInvalid,
+		"unknown play state %q", intent.PlayState)
+}
+
+func validateSetSpeakerIntent(i Intent, c Component) error {
+	intent, ok := i.(SetSpeakerIntent)
+	if !ok {
+		return newValidationError(i, c, "", ValidationReasonInvalid, "unexpected intent %T", i)
+	}
+	if intent.OutputInPercent > 100 {
+		return newValidationError(i, c, "OutputInPercent", ValidationReasonOutOfRange,
+			"output must be between 0 and 100 percent, got %v", intent.OutputInPercent)
+	}
+	return nil
+}
+
+func validateSetThermostatIntent(i Intent, c Component) error {
+	intent, ok := i.(SetThermostatIntent)
+	if !ok {
+		return newValidationError(i, c, "", ValidationReasonInvalid, "unexpected intent %T", i)
+	}
+	switch intent.Mode {
+	case ThermostatModeOff, ThermostatModeHeat, ThermostatModeCool, ThermostatModeAuto:
+	default:
+		return newValidationError(i, c, "Mode", ValidationReasonInvalid,
+			"unknown thermostat mode %q", intent.Mode)
+	}
+	if intent.Mode == ThermostatModeAuto && intent.HeatSetpointInCelsius > intent.CoolSetpointInCelsius {
+		return newValidationError(i, c, "HeatSetpointInCelsius", ValidationReasonInvalid,
+			"heat setpoint (%v) must not be above cool setpoint (%v)", intent.HeatSetpointInCelsius, intent.CoolSetpointInCelsius)
+	}
+
+	// The remaining checks require the thermostat's specs
+	t, ok := c.(Thermostat)
+	if !ok || t.Specs == nil {
+		return nil
+	}
+	if t.Specs.SupportedModes != "" && !isInList(intent.Mode, t.Specs.SupportedModes) {
+		return newValidationError(i, c, "Mode", ValidationReasonUnsupported,
+			"mode %v is not supported (supported: %v)", intent.Mode, t.Specs.SupportedModes)
+	}
+	setpoints := []struct {
+		field string
+		value float64
+		used  bool
+	}{
+		{"HeatSetpointInCelsius", intent.HeatSetpointInCelsius, intent.Mode == ThermostatModeHeat || intent.Mode == ThermostatModeAuto},
+		{"CoolSetpointInCelsius", intent.CoolSetpointInCelsius, intent.Mode == ThermostatModeCool || intent.Mode == ThermostatModeAuto},
+	}
+	for _, sp := range setpoints {
+		if !sp.used {
+			continue
+		}
+		if sp.value < t.Specs.MinSetpointInCelsius || sp.value > t.Specs.MaxSetpointInCelsius {
+			return newValidationError(i, c, sp.field, ValidationReasonOutOfRange,
+				"setpoint must be between %v and %v degrees Celsius, got %v",
+				t.Specs.MinSetpointInCelsius, t.Specs.MaxSetpointInCelsius, sp.value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package types
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type validationTest struct {
+	intent         Intent
+	target         Component
+	expectedField  string
+	expectedReason string // "" if the intent should be valid
+}
+
+var thermostatWithSpecs = Thermostat{
+	Specs: &ThermostatSpecs{
+		SupportedModes:       "OFF,HEAT",
+		MinSetpointInCelsius: 10,
+		MaxSetpointInCelsius: 30,
+	},
+}
+
+var validationTests = map[string]validationTest{
+	"valid brightness": {
+		intent: SetLightEmitterIntent{BrightnessInPercent: 100},
+		target: LightEmitter{},
+	},
+	"brightness too high": {
+		intent:         SetLightEmitterIntent{BrightnessInPercent: 101},
+		target:         LightEmitter{},
+		expectedField:  "BrightnessInPercent",
+		expectedReason: ValidationReasonOutOfRange,
+	},
+	"light intent to media player": {
+		intent:         SetLightEmitterIntent{BrightnessInPercent: 50},
+		target:         MediaPlayer{},
+		expectedReason: ValidationReasonIncompatible,
+	},
+	"unknown play state": {
+		intent:         SetMediaPlayerIntent{PlayState: "REWINDING"},
+		target:         MediaPlayer{},
+		expectedField:  "PlayState",
+		expectedReason: ValidationReasonInvalid,
+	},
+	"switch": {
+		intent: SetSwitchIntent{IsOn: true},
+		target: Switch{},
+	},
+	"thermostat without specs": {
+		intent: SetThermostatIntent{Mode: ThermostatModeCool, CoolSetpointInCelsius: 40},
+		target: Thermostat{},
+	},
+	"thermostat heat above cool": {
+		intent:         SetThermostatIntent{Mode: ThermostatModeAuto, HeatSetpointInCelsius: 25, CoolSetpointInCelsius: 20},
+		target:         Thermostat{},
+		expectedField:  "HeatSetpointInCelsius",
+		expectedReason: ValidationReasonInvalid,
+	},
+	"thermostat unsupported mode": {
+		intent:         SetThermostatIntent{Mode: ThermostatModeCool, CoolSetpointInCelsius: 25},
+		target:         thermostatWithSpecs,
+		expectedField:  "Mode",
+		expectedReason: ValidationReasonUnsupported,
+	},
+	"thermostat setpoint out of range": {
+		intent:         SetThermostatIntent{Mode: ThermostatModeHeat, HeatSetpointInCelsius: 35},
+		target:         thermostatWithSpecs,
+		expectedField:  "HeatSetpointInCelsius",
+		expectedReason: ValidationReasonOutOfRange,
+	},
+	"thermostat within specs": {
+		intent: SetThermostatIntent{Mode: ThermostatModeHeat, HeatSetpointInCelsius: 21},
+		target: thermostatWithSpecs,
+	},
+}
+
+func (s *TypesTestSuite) TestValidateIntent(c *C) {
+	for testName, test := range validationTests {
+		err := ValidateIntent(test.intent, test.target)
+		if test.expectedReason == "" {
+			c.Assert(err, IsNil, Commentf("failed case: %v", testName))
+			continue
+		}
+		verr, ok := err.(*IntentValidationError)
+		c.Assert(ok, Equals, true, Commentf("failed case: %v (err: %v)", testName, err))
+		c.Assert(verr.Reason, Equals, test.expectedReason, Commentf("failed case: %v", testName))
+		c.Assert(verr.Field, Equals, test.expectedField, Commentf("failed case: %v", testName))
+		c.Assert(verr.IntentType, Equals, test.intent.Type(), Commentf("failed case: %v", testName))
+		c.Assert(verr.ComponentType, Equals, test.target.Type(), Commentf("failed case: %v", testName))
+	}
+}